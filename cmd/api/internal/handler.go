@@ -28,5 +28,8 @@ func API(build string, shutdown chan os.Signal, log *log.Logger, postgresDB *sql
 	a = routes.UserRoutes(a, postgresDB, basePermissions)
 	a = routes.StoreRoutes(a, postgresDB, basePermissions)
 	a = routes.SubscriptionRoutes(a, postgresDB, basePermissions)
+	a = routes.CalendarSyncRoutes(a, postgresDB, basePermissions)
+	a = routes.NotificationRoutes(a, postgresDB, basePermissions)
+	a = routes.PaymentRoutes(a, postgresDB, basePermissions)
 	return a
 }
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/genda/genda-api/internal/app"
+	"github.com/genda/genda-api/internal/middlewares"
+	"github.com/genda/genda-api/pkg/calendarsync"
+)
+
+func CalendarSyncRoutes(a *app.App, postgresDB *sql.DB, basePermissions []string) *app.App {
+
+	calendarSyncHandler := calendarsync.NewHandler(postgresDB)
+
+	a.Handle(http.MethodPost, "/api/v1/users/:id/calendar-sync", calendarSyncHandler.Connect, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodGet, "/api/v1/users/:id/calendar-sync", calendarSyncHandler.GetConnections, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodDelete, "/api/v1/users/:id/calendar-sync/:provider", calendarSyncHandler.Disconnect, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodPost, "/api/v1/users/:id/calendar-sync/:provider/sync", calendarSyncHandler.SyncNow, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodGet, "/api/v1/users/:id/calendar-busy", calendarSyncHandler.GetBusyBlocks, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+
+	return a
+}
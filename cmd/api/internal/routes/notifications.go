@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/genda/genda-api/internal/app"
+	"github.com/genda/genda-api/internal/middlewares"
+	"github.com/genda/genda-api/pkg/notifications"
+)
+
+func NotificationRoutes(a *app.App, postgresDB *sql.DB, basePermissions []string) *app.App {
+
+	notificationHandler := notifications.NewHandler(postgresDB)
+
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/appointments/:appointmentId/notifications", notificationHandler.GetAppointmentNotifications, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+
+	return a
+}
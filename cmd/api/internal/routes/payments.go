@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/genda/genda-api/internal/app"
+	"github.com/genda/genda-api/internal/middlewares"
+	"github.com/genda/genda-api/pkg/payments"
+)
+
+func PaymentRoutes(a *app.App, postgresDB *sql.DB, basePermissions []string) *app.App {
+
+	paymentHandler := payments.NewHandler(postgresDB)
+
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/appointments/:appointmentId/checkout", paymentHandler.Checkout, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/payments", paymentHandler.GetStorePayments, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/payments/:paymentId", paymentHandler.GetPayment, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/payments/:paymentId/capture", paymentHandler.CapturePayment, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/payments/:paymentId/cancel", paymentHandler.CancelPayment, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/payments/:paymentId/refunds", paymentHandler.CreateRefund, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/payments/:paymentId/refunds", paymentHandler.GetRefunds, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+
+	// Only the platform sets the fee it takes, stores can see what they pay.
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/platform-fee", paymentHandler.GetStorePlatformFee, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodPut, "/api/v1/stores/:id/platform-fee", paymentHandler.UpdateStorePlatformFee, middlewares.Authenticate(basePermissions))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/plans/:planId/platform-fee", paymentHandler.GetPlanPlatformFee, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodPut, "/api/v1/stores/:id/plans/:planId/platform-fee", paymentHandler.UpdatePlanPlatformFee, middlewares.Authenticate(basePermissions))
+
+	// Providers call the webhook without a token, its signature is checked instead.
+	a.Handle(http.MethodPost, "/api/v1/webhooks/payments/:provider", paymentHandler.ReceiveWebhook)
+	a.Handle(http.MethodGet, "/api/v1/webhook-events", paymentHandler.GetWebhookEvents, middlewares.Authenticate(append(basePermissions, []string{"genda-admin"}...)))
+	a.Handle(http.MethodPost, "/api/v1/webhook-events/:id/replay", paymentHandler.ReplayWebhookEvent, middlewares.Authenticate(append(basePermissions, []string{"genda-admin"}...)))
+
+	return a
+}
@@ -19,6 +19,26 @@ func StoreRoutes(a *app.App, postgresDB *sql.DB, basePermissions []string) *app.
 	a.Handle(http.MethodPut, "/api/v1/stores/:id", organizationHandler.UpdateStore, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
 	a.Handle(http.MethodDelete, "/api/v1/stores/:id", organizationHandler.DeleteStore, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
 
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/slots", organizationHandler.GetStoreSlots, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/holidays", organizationHandler.GetStoreHolidays, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/booking-policy", organizationHandler.GetStoreBookingPolicy, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodPut, "/api/v1/stores/:id/booking-policy", organizationHandler.UpdateStoreBookingPolicy, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/cancellation-policy", organizationHandler.GetStoreCancellationPolicy, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodPut, "/api/v1/stores/:id/cancellation-policy", organizationHandler.UpdateStoreCancellationPolicy, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/customers/:userId/no-shows", organizationHandler.GetStoreCustomerNoShows, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/services", organizationHandler.CreateStoreService, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/services", organizationHandler.GetStoreServices, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/services/:serviceId", organizationHandler.GetStoreService, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodPut, "/api/v1/stores/:id/services/:serviceId", organizationHandler.UpdateStoreService, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodDelete, "/api/v1/stores/:id/services/:serviceId", organizationHandler.DeleteStoreService, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/resources", organizationHandler.CreateStoreResource, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/resources", organizationHandler.GetStoreResources, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/resources/:resourceId", organizationHandler.GetStoreResource, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodPut, "/api/v1/stores/:id/resources/:resourceId", organizationHandler.UpdateStoreResource, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodDelete, "/api/v1/stores/:id/resources/:resourceId", organizationHandler.DeleteStoreResource, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+
 	a.Handler(http.MethodPost, "/api/v1/stores/:id/plans", organizationHandler.CreateStorePlan, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
 	a.Handler(http.MethodGet, "/api/v1/stores/:id/plans", organizationHandler.GetStorePlans, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
 	a.Handler(http.MethodPut, "/api/v1/stores/:id/plans/:planId", organizationHandler.UpdateStorePlan, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
@@ -28,6 +48,11 @@ func StoreRoutes(a *app.App, postgresDB *sql.DB, basePermissions []string) *app.
 	a.Handler(http.MethodGet, "/api/v1/stores/:id/availability", organizationHandler.GetStoreAvailability, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
 	a.Handler(http.MethodPut, "/api/v1/stores/:id/availability/:availabilityId", organizationHandler.UpdateStoreAvailability, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
 	a.Handler(http.MethodDelete, "/api/v1/stores/:id/availability/:availabilityId", organizationHandler.DeleteStoreAvailability, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/availability/exceptions", organizationHandler.CreateStoreAvailabilityException, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/availability/exceptions", organizationHandler.GetStoreAvailabilityExceptions, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	// /availability/exceptions/:exceptionId, see isExceptionsPath
+	a.Handle(http.MethodPut, "/api/v1/stores/:id/availability/:availabilityId/:exceptionId", organizationHandler.UpdateStoreAvailabilityException, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodDelete, "/api/v1/stores/:id/availability/:availabilityId/:exceptionId", organizationHandler.DeleteStoreAvailabilityException, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
 
 	a.Handler(http.MethodPost, "/api/v1/stores/:id/ratings", organizationHandler.CreateStoreRating, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
 	a.Handler(http.MethodGet, "/api/v1/stores/:id/ratings", organizationHandler.GetStoreRatings, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
@@ -38,6 +63,52 @@ func StoreRoutes(a *app.App, postgresDB *sql.DB, basePermissions []string) *app.
 	a.Handler(http.MethodGet, "/api/v1/stores/:id/appointments", organizationHandler.GetStoreAppointments, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
 	a.Handler(http.MethodPut, "/api/v1/stores/:id/appointments/:appointmentId", organizationHandler.UpdateStoreAppointment, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
 	a.Handler(http.MethodDelete, "/api/v1/stores/:id/appointments/:appointmentId", organizationHandler.DeleteStoreAppointment, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/appointments/:appointmentId/confirm", organizationHandler.ConfirmStoreAppointment, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/appointments/:appointmentId/cancel", organizationHandler.CancelStoreAppointment, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/appointments/:appointmentId/complete", organizationHandler.CompleteStoreAppointment, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/appointments/:appointmentId/no-show", organizationHandler.NoShowStoreAppointment, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/appointments/:appointmentId/history", organizationHandler.GetStoreAppointmentHistory, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/appointments/:appointmentId/reschedule", organizationHandler.RescheduleStoreAppointment, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/appointments/:appointmentId/reschedules", organizationHandler.GetStoreAppointmentReschedules, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+
+	// /appointments/series sits where /appointments/:appointmentId has its wildcard.
+	a.HandleStatic(http.MethodPost, "/api/v1/stores/:id/appointments/series", organizationHandler.CreateStoreAppointmentSeries, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.HandleStatic(http.MethodGet, "/api/v1/stores/:id/appointments/series/:seriesId", organizationHandler.GetStoreAppointmentSeries, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.HandleStatic(http.MethodPut, "/api/v1/stores/:id/appointments/series/:seriesId", organizationHandler.UpdateStoreAppointmentSeries, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.HandleStatic(http.MethodPost, "/api/v1/stores/:id/appointments/series/:seriesId/cancel", organizationHandler.CancelStoreAppointmentSeries, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/waitlist", organizationHandler.CreateStoreWaitlistEntry, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/waitlist", organizationHandler.GetStoreWaitlistEntries, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/waitlist/:entryId", organizationHandler.GetStoreWaitlistEntry, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodDelete, "/api/v1/stores/:id/waitlist/:entryId", organizationHandler.CancelStoreWaitlistEntry, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/waitlist/:entryId/accept", organizationHandler.AcceptStoreWaitlistOffer, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/waitlist/:entryId/decline", organizationHandler.DeclineStoreWaitlistOffer, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/sessions", organizationHandler.CreateStoreSession, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/sessions", organizationHandler.GetStoreSessions, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/sessions/:sessionId", organizationHandler.GetStoreSession, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodPut, "/api/v1/stores/:id/sessions/:sessionId", organizationHandler.UpdateStoreSession, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/sessions/:sessionId/cancel", organizationHandler.CancelStoreSession, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/sessions/:sessionId/bookings", organizationHandler.CreateStoreSessionBooking, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/sessions/:sessionId/bookings", organizationHandler.GetStoreSessionBookings, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/sessions/:sessionId/bookings/:bookingId/cancel", organizationHandler.CancelStoreSessionBooking, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodPut, "/api/v1/stores/:id/sessions/:sessionId/attendance", organizationHandler.MarkStoreSessionAttendance, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+
+	// the .ics feeds are read by calendar apps, the token in the URL stands in
+	// for the authentication they can't do
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/calendar-feed", organizationHandler.CreateStoreCalendarFeed, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodDelete, "/api/v1/stores/:id/calendar-feed", organizationHandler.RevokeStoreCalendarFeed, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/calendar.ics", organizationHandler.GetStoreCalendarFeed)
+	a.Handle(http.MethodPost, "/api/v1/users/:id/calendar-feed", organizationHandler.CreateUserCalendarFeed, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodDelete, "/api/v1/users/:id/calendar-feed", organizationHandler.RevokeUserCalendarFeed, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner", "genda-customer"}...)))
+	a.Handle(http.MethodGet, "/api/v1/users/:id/calendar.ics", organizationHandler.GetUserCalendarFeed)
+
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/calendar-sources", organizationHandler.CreateStoreCalendarSource, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/calendar-sources", organizationHandler.GetStoreCalendarSources, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodGet, "/api/v1/stores/:id/calendar-sources/:sourceId", organizationHandler.GetStoreCalendarSource, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodPut, "/api/v1/stores/:id/calendar-sources/:sourceId/content", organizationHandler.UploadStoreCalendarSource, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodPost, "/api/v1/stores/:id/calendar-sources/:sourceId/refresh", organizationHandler.RefreshStoreCalendarSource, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
+	a.Handle(http.MethodDelete, "/api/v1/stores/:id/calendar-sources/:sourceId", organizationHandler.DeleteStoreCalendarSource, middlewares.Authenticate(append(basePermissions, []string{"genda-admin", "genda-owner"}...)))
 
 	return a
 }
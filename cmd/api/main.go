@@ -11,7 +11,11 @@ import (
 
 	"github.com/genda/genda-api/cmd/api/internal"
 	"github.com/genda/genda-api/internal/storage/postgres"
+	"github.com/genda/genda-api/pkg/calendarsync"
 	"github.com/genda/genda-api/pkg/config"
+	"github.com/genda/genda-api/pkg/notifications"
+	"github.com/genda/genda-api/pkg/payments"
+	"github.com/genda/genda-api/pkg/stores"
 	"github.com/pkg/errors"
 	"github.com/rs/cors"
 )
@@ -49,6 +53,50 @@ func run() error {
 		Handler: c.Handler(internal.API(conf.Environment, shutdown, log, postgresDB)), //add redis again if we're to use it
 	}
 
+	// Release expired appointment holds in the background while the API runs.
+	holdSweep, err := time.ParseDuration(conf.AppointmentHoldSweep)
+	if err != nil || holdSweep <= 0 {
+		holdSweep, _ = time.ParseDuration(config.DefaultHoldSweep)
+	}
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go stores.NewHoldSweeper(postgresDB, holdSweep, log).Run(workersCtx)
+
+	// Push appointments to and import busy time from the connected calendars.
+	calendarSync, err := time.ParseDuration(conf.CalendarSyncInterval)
+	if err != nil || calendarSync <= 0 {
+		calendarSync, _ = time.ParseDuration(config.DefaultCalendarSync)
+	}
+	go calendarsync.NewWorker(postgresDB, calendarSync, log).Run(workersCtx)
+
+	// Read the store calendar sources again as they go stale.
+	sourceRefresh, err := time.ParseDuration(conf.CalendarSourceRefresh)
+	if err != nil || sourceRefresh <= 0 {
+		sourceRefresh, _ = time.ParseDuration(config.DefaultSourceRefresh)
+	}
+	go stores.NewCalendarSourceRefresher(postgresDB, sourceRefresh, log).Run(workersCtx)
+
+	// Send the appointment confirmations, reminders and rating requests.
+	notificationRun, err := time.ParseDuration(conf.NotificationInterval)
+	if err != nil || notificationRun <= 0 {
+		notificationRun, _ = time.ParseDuration(config.DefaultNotificationRun)
+	}
+	go notifications.NewWorker(postgresDB, notificationRun, log).Run(workersCtx)
+
+	// Apply the payment provider webhook events as they come in.
+	webhookRun, err := time.ParseDuration(conf.PaymentWebhookInterval)
+	if err != nil || webhookRun <= 0 {
+		webhookRun, _ = time.ParseDuration(config.DefaultWebhookRun)
+	}
+	go payments.NewWebhookWorker(postgresDB, webhookRun, log).Run(workersCtx)
+
+	// Submit the refunds waiting on the provider, such as the ones cancellations record.
+	refundRun, err := time.ParseDuration(conf.PaymentRefundInterval)
+	if err != nil || refundRun <= 0 {
+		refundRun, _ = time.ParseDuration(config.DefaultRefundRun)
+	}
+	go payments.NewRefundWorker(postgresDB, refundRun, log).Run(workersCtx)
+
 	// Make a channel to listen for errors coming from the listener. Use a
 	// buffered channel so the goroutine can exit if we don't collect this error.
 	serverErrors := make(chan error, 1)
@@ -0,0 +1,11 @@
+CREATE TABLE "store_appointment_status_history" (
+  "id" uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "appointment_id" uuid NOT NULL,
+  "from_status" varchar NOT NULL,
+  "to_status" varchar NOT NULL,
+  "changed_by" varchar, -- NULL when the change was made by the system (e.g. expired holds)
+  "reason" varchar,
+  "created_at" timestamp NOT NULL DEFAULT now(),
+  CONSTRAINT fk_store_appointment_status_history_appointment_id FOREIGN KEY ("appointment_id") REFERENCES "store_appointments"("id") ON DELETE CASCADE
+);
+CREATE INDEX ON "store_appointment_status_history" ("appointment_id");
@@ -0,0 +1,4 @@
+ALTER TABLE "store_appointments" DROP CONSTRAINT IF EXISTS fk_store_appointments_series_id;
+ALTER TABLE "store_appointments" DROP COLUMN IF EXISTS "series_id";
+
+DROP TABLE IF EXISTS "store_appointment_series";
@@ -0,0 +1,20 @@
+CREATE TABLE "store_appointment_series" (
+  "id" uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "store_id" uuid NOT NULL,
+  "user_id" uuid NOT NULL,
+  "rrule" varchar NOT NULL,
+  "start_at" timestamp NOT NULL, -- first occurrence
+  "end_at" timestamp NOT NULL,
+  "notes" varchar,
+  "created_at" timestamp NOT NULL DEFAULT now(),
+  "updated_at" timestamp NOT NULL DEFAULT now(),
+  CONSTRAINT fk_store_appointment_series_store_id FOREIGN KEY ("store_id") REFERENCES "stores"("id") ON DELETE CASCADE,
+  CONSTRAINT fk_store_appointment_series_user_id FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE RESTRICT
+);
+CREATE INDEX ON "store_appointment_series" ("store_id");
+
+ALTER TABLE "store_appointments"
+  ADD COLUMN "series_id" uuid,
+  ADD CONSTRAINT fk_store_appointments_series_id
+  FOREIGN KEY ("series_id") REFERENCES "store_appointment_series"("id") ON DELETE SET NULL;
+CREATE INDEX ON "store_appointments" ("series_id");
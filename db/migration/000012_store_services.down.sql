@@ -0,0 +1,14 @@
+ALTER TABLE "store_appointments" DROP CONSTRAINT IF EXISTS no_overlap_per_store;
+ALTER TABLE "store_appointments"
+  ADD CONSTRAINT no_overlap_per_store
+  EXCLUDE USING gist (
+    "store_id" WITH =,
+    tsrange("start_at","end_at",'[)') WITH &&
+  )
+  WHERE ("status" IN ('pending','confirmed'));
+
+ALTER TABLE "store_appointments" DROP CONSTRAINT IF EXISTS fk_store_appointments_service_id;
+ALTER TABLE "store_appointments" DROP COLUMN IF EXISTS "buffer_minutes";
+ALTER TABLE "store_appointments" DROP COLUMN IF EXISTS "service_id";
+
+DROP TABLE IF EXISTS "store_services";
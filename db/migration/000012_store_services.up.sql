@@ -0,0 +1,33 @@
+CREATE TABLE "store_services" (
+  "id" uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "store_id" uuid NOT NULL,
+  "name" varchar NOT NULL,
+  "description" varchar,
+  "duration_minutes" int NOT NULL CHECK ("duration_minutes" > 0),
+  "buffer_minutes" int NOT NULL DEFAULT 0 CHECK ("buffer_minutes" >= 0),
+  "price" numeric(12,2) NOT NULL,
+  "currency" varchar NOT NULL DEFAULT 'BRL',
+  "active" boolean NOT NULL DEFAULT true,
+  "created_at" timestamp NOT NULL DEFAULT now(),
+  "updated_at" timestamp NOT NULL DEFAULT now(),
+  CONSTRAINT fk_store_services_store_id FOREIGN KEY ("store_id") REFERENCES "stores"("id") ON DELETE CASCADE
+);
+CREATE INDEX ON "store_services" ("store_id");
+
+ALTER TABLE "store_appointments"
+  ADD COLUMN "service_id" uuid,
+  ADD COLUMN "buffer_minutes" int NOT NULL DEFAULT 0,
+  ADD CONSTRAINT fk_store_appointments_service_id
+  FOREIGN KEY ("service_id") REFERENCES "store_services"("id") ON DELETE SET NULL;
+CREATE INDEX ON "store_appointments" ("service_id");
+
+-- the buffer after an appointment is blocked too, so the next client can't
+-- be booked into the cleanup time
+ALTER TABLE "store_appointments" DROP CONSTRAINT no_overlap_per_store;
+ALTER TABLE "store_appointments"
+  ADD CONSTRAINT no_overlap_per_store
+  EXCLUDE USING gist (
+    "store_id" WITH =,
+    tsrange("start_at","end_at" + make_interval(mins => "buffer_minutes"),'[)') WITH &&
+  )
+  WHERE ("status" IN ('pending','confirmed'));
@@ -0,0 +1,13 @@
+ALTER TABLE "store_appointments" DROP CONSTRAINT IF EXISTS no_overlap_per_resource;
+ALTER TABLE "store_appointments"
+  ADD CONSTRAINT no_overlap_per_store
+  EXCLUDE USING gist (
+    "store_id" WITH =,
+    tsrange("start_at","end_at" + make_interval(mins => "buffer_minutes"),'[)') WITH &&
+  )
+  WHERE ("status" IN ('pending','confirmed'));
+
+ALTER TABLE "store_appointments" DROP CONSTRAINT IF EXISTS fk_store_appointments_resource_id;
+ALTER TABLE "store_appointments" DROP COLUMN IF EXISTS "resource_id";
+
+DROP TABLE IF EXISTS "store_resources";
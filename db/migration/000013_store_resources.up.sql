@@ -0,0 +1,30 @@
+CREATE TABLE "store_resources" (
+  "id" uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "store_id" uuid NOT NULL,
+  "name" varchar NOT NULL,
+  "kind" varchar NOT NULL DEFAULT 'staff' CHECK ("kind" IN ('staff','room','equipment')),
+  "availability" json, -- weekly hours, null means the store hours
+  "active" boolean NOT NULL DEFAULT true,
+  "created_at" timestamp NOT NULL DEFAULT now(),
+  "updated_at" timestamp NOT NULL DEFAULT now(),
+  CONSTRAINT fk_store_resources_store_id FOREIGN KEY ("store_id") REFERENCES "stores"("id") ON DELETE CASCADE
+);
+CREATE INDEX ON "store_resources" ("store_id");
+
+ALTER TABLE "store_appointments"
+  ADD COLUMN "resource_id" uuid,
+  ADD CONSTRAINT fk_store_appointments_resource_id
+  FOREIGN KEY ("resource_id") REFERENCES "store_resources"("id") ON DELETE RESTRICT;
+CREATE INDEX ON "store_appointments" ("resource_id");
+
+-- overlap is enforced per resource; appointments without one keep sharing
+-- the single store wide calendar
+ALTER TABLE "store_appointments" DROP CONSTRAINT no_overlap_per_store;
+ALTER TABLE "store_appointments"
+  ADD CONSTRAINT no_overlap_per_resource
+  EXCLUDE USING gist (
+    "store_id" WITH =,
+    COALESCE("resource_id", '00000000-0000-0000-0000-000000000000'::uuid) WITH =,
+    tsrange("start_at","end_at" + make_interval(mins => "buffer_minutes"),'[)') WITH &&
+  )
+  WHERE ("status" IN ('pending','confirmed'));
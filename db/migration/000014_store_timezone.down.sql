@@ -0,0 +1,19 @@
+ALTER TABLE "store_appointment_series"
+  ALTER COLUMN "start_at" TYPE timestamp USING "start_at" AT TIME ZONE 'UTC',
+  ALTER COLUMN "end_at" TYPE timestamp USING "end_at" AT TIME ZONE 'UTC';
+
+ALTER TABLE "store_appointments" DROP CONSTRAINT IF EXISTS no_overlap_per_resource;
+ALTER TABLE "store_appointments"
+  ALTER COLUMN "start_at" TYPE timestamp USING "start_at" AT TIME ZONE 'UTC',
+  ALTER COLUMN "end_at" TYPE timestamp USING "end_at" AT TIME ZONE 'UTC',
+  ALTER COLUMN "hold_expires_at" TYPE timestamp USING "hold_expires_at" AT TIME ZONE 'UTC';
+ALTER TABLE "store_appointments"
+  ADD CONSTRAINT no_overlap_per_resource
+  EXCLUDE USING gist (
+    "store_id" WITH =,
+    COALESCE("resource_id", '00000000-0000-0000-0000-000000000000'::uuid) WITH =,
+    tsrange("start_at","end_at" + make_interval(mins => "buffer_minutes"),'[)') WITH &&
+  )
+  WHERE ("status" IN ('pending','confirmed'));
+
+ALTER TABLE "stores" DROP COLUMN IF EXISTS "timezone";
@@ -0,0 +1,20 @@
+ALTER TABLE "stores" ADD COLUMN "timezone" varchar NOT NULL DEFAULT 'America/Sao_Paulo';
+
+-- appointment instants were written as UTC wall clock, keep them as instants
+ALTER TABLE "store_appointments" DROP CONSTRAINT no_overlap_per_resource;
+ALTER TABLE "store_appointments"
+  ALTER COLUMN "start_at" TYPE timestamptz USING "start_at" AT TIME ZONE 'UTC',
+  ALTER COLUMN "end_at" TYPE timestamptz USING "end_at" AT TIME ZONE 'UTC',
+  ALTER COLUMN "hold_expires_at" TYPE timestamptz USING "hold_expires_at" AT TIME ZONE 'UTC';
+ALTER TABLE "store_appointments"
+  ADD CONSTRAINT no_overlap_per_resource
+  EXCLUDE USING gist (
+    "store_id" WITH =,
+    COALESCE("resource_id", '00000000-0000-0000-0000-000000000000'::uuid) WITH =,
+    tstzrange("start_at","end_at" + make_interval(mins => "buffer_minutes"),'[)') WITH &&
+  )
+  WHERE ("status" IN ('pending','confirmed'));
+
+ALTER TABLE "store_appointment_series"
+  ALTER COLUMN "start_at" TYPE timestamptz USING "start_at" AT TIME ZONE 'UTC',
+  ALTER COLUMN "end_at" TYPE timestamptz USING "end_at" AT TIME ZONE 'UTC';
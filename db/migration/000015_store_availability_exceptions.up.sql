@@ -0,0 +1,18 @@
+CREATE TABLE "store_availability_exceptions" (
+  "id" uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "store_id" uuid NOT NULL,
+  "resource_id" uuid, -- null applies to the whole store
+  "kind" varchar NOT NULL CHECK ("kind" IN ('closed','hours')),
+  "start_date" date NOT NULL,
+  "end_date" date NOT NULL,
+  "open_time" varchar,
+  "close_time" varchar,
+  "reason" varchar,
+  "created_at" timestamp NOT NULL DEFAULT now(),
+  "updated_at" timestamp NOT NULL DEFAULT now(),
+  CONSTRAINT fk_store_availability_exceptions_store_id FOREIGN KEY ("store_id") REFERENCES "stores"("id") ON DELETE CASCADE,
+  CONSTRAINT fk_store_availability_exceptions_resource_id FOREIGN KEY ("resource_id") REFERENCES "store_resources"("id") ON DELETE CASCADE,
+  CONSTRAINT chk_store_availability_exceptions_dates CHECK ("end_date" >= "start_date"),
+  CONSTRAINT chk_store_availability_exceptions_hours CHECK ("kind" <> 'hours' OR ("open_time" IS NOT NULL AND "close_time" IS NOT NULL))
+);
+CREATE INDEX ON "store_availability_exceptions" ("store_id", "start_date", "end_date");
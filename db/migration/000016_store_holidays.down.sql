@@ -0,0 +1,4 @@
+ALTER TABLE "stores"
+  DROP COLUMN IF EXISTS "holiday_city",
+  DROP COLUMN IF EXISTS "holiday_state",
+  DROP COLUMN IF EXISTS "holiday_calendar";
@@ -0,0 +1,4 @@
+ALTER TABLE "stores"
+  ADD COLUMN "holiday_calendar" boolean NOT NULL DEFAULT false,
+  ADD COLUMN "holiday_state" varchar(2),
+  ADD COLUMN "holiday_city" varchar;
@@ -0,0 +1,11 @@
+-- zero means the rule is off
+CREATE TABLE "store_booking_policies" (
+  "store_id" uuid PRIMARY KEY,
+  "min_lead_minutes" int NOT NULL DEFAULT 0 CHECK ("min_lead_minutes" >= 0),
+  "max_horizon_days" int NOT NULL DEFAULT 0 CHECK ("max_horizon_days" >= 0),
+  "buffer_minutes" int NOT NULL DEFAULT 0 CHECK ("buffer_minutes" >= 0),
+  "max_daily_appointments" int NOT NULL DEFAULT 0 CHECK ("max_daily_appointments" >= 0),
+  "created_at" timestamp NOT NULL DEFAULT now(),
+  "updated_at" timestamp NOT NULL DEFAULT now(),
+  CONSTRAINT fk_store_booking_policies_store_id FOREIGN KEY ("store_id") REFERENCES "stores"("id") ON DELETE CASCADE
+);
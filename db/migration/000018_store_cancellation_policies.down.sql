@@ -0,0 +1,2 @@
+ALTER TABLE "store_appointments" DROP COLUMN IF EXISTS "penalty_fee";
+DROP TABLE IF EXISTS "store_cancellation_policies";
@@ -0,0 +1,14 @@
+-- windows is a json list of {"hours_before": 24, "fee_percent": 50}: canceling
+-- less than hours_before hours ahead costs fee_percent of the price
+CREATE TABLE "store_cancellation_policies" (
+  "store_id" uuid PRIMARY KEY,
+  "windows" json NOT NULL DEFAULT '[]',
+  "no_show_fee_percent" numeric(5,2) NOT NULL DEFAULT 0 CHECK ("no_show_fee_percent" BETWEEN 0 AND 100),
+  "created_at" timestamp NOT NULL DEFAULT now(),
+  "updated_at" timestamp NOT NULL DEFAULT now(),
+  CONSTRAINT fk_store_cancellation_policies_store_id FOREIGN KEY ("store_id") REFERENCES "stores"("id") ON DELETE CASCADE
+);
+
+ALTER TABLE "store_appointments"
+  ADD COLUMN "penalty_fee" numeric(12,2) NOT NULL DEFAULT 0;
+CREATE INDEX ON "store_appointments" ("store_id", "user_id") WHERE "status" = 'no_show';
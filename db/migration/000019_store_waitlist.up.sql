@@ -0,0 +1,21 @@
+CREATE TABLE "store_waitlist_entries" (
+  "id" uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "store_id" uuid NOT NULL,
+  "user_id" uuid NOT NULL,
+  "service_id" uuid,
+  "window_start" timestamptz NOT NULL,
+  "window_end" timestamptz NOT NULL,
+  "status" varchar NOT NULL DEFAULT 'waiting' CHECK ("status" IN ('waiting','offered','booked','declined','expired','canceled')),
+  "appointment_id" uuid,
+  "offer_expires_at" timestamptz,
+  "notes" varchar,
+  "created_at" timestamp NOT NULL DEFAULT now(),
+  "updated_at" timestamp NOT NULL DEFAULT now(),
+  CHECK ("window_end" > "window_start"),
+  CONSTRAINT fk_store_waitlist_entries_store_id FOREIGN KEY ("store_id") REFERENCES "stores"("id") ON DELETE CASCADE,
+  CONSTRAINT fk_store_waitlist_entries_user_id FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE,
+  CONSTRAINT fk_store_waitlist_entries_service_id FOREIGN KEY ("service_id") REFERENCES "store_services"("id") ON DELETE SET NULL,
+  CONSTRAINT fk_store_waitlist_entries_appointment_id FOREIGN KEY ("appointment_id") REFERENCES "store_appointments"("id") ON DELETE SET NULL
+);
+CREATE INDEX ON "store_waitlist_entries" ("store_id", "created_at") WHERE "status" = 'waiting';
+CREATE INDEX ON "store_waitlist_entries" ("appointment_id");
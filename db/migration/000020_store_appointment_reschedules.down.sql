@@ -0,0 +1 @@
+DROP TABLE IF EXISTS "store_appointment_reschedules";
@@ -0,0 +1,15 @@
+CREATE TABLE "store_appointment_reschedules" (
+  "id" uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "appointment_id" uuid NOT NULL,
+  "previous_start_at" timestamptz NOT NULL,
+  "previous_end_at" timestamptz NOT NULL,
+  "previous_resource_id" uuid,
+  "start_at" timestamptz NOT NULL,
+  "end_at" timestamptz NOT NULL,
+  "resource_id" uuid,
+  "changed_by" varchar,
+  "reason" varchar,
+  "created_at" timestamp NOT NULL DEFAULT now(),
+  CONSTRAINT fk_store_appointment_reschedules_appointment_id FOREIGN KEY ("appointment_id") REFERENCES "store_appointments"("id") ON DELETE CASCADE
+);
+CREATE INDEX ON "store_appointment_reschedules" ("appointment_id");
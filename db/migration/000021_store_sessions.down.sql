@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS store_appointments_session_overlap ON "store_appointments";
+DROP FUNCTION IF EXISTS store_appointments_session_overlap();
+DROP TABLE IF EXISTS "store_session_bookings";
+DROP TABLE IF EXISTS "store_sessions";
+DROP FUNCTION IF EXISTS store_sessions_appointment_overlap();
@@ -0,0 +1,97 @@
+CREATE TABLE "store_sessions" (
+  "id" uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "store_id" uuid NOT NULL,
+  "service_id" uuid,
+  "resource_id" uuid,
+  "title" varchar NOT NULL,
+  "description" varchar,
+  "start_at" timestamptz NOT NULL,
+  "end_at" timestamptz NOT NULL,
+  "capacity" int NOT NULL CHECK ("capacity" > 0),
+  "price" numeric(12,2) NOT NULL DEFAULT 0,
+  "currency" varchar NOT NULL DEFAULT 'BRL',
+  "status" varchar NOT NULL DEFAULT 'scheduled' CHECK ("status" IN ('scheduled','canceled')),
+  "created_at" timestamp NOT NULL DEFAULT now(),
+  "updated_at" timestamp NOT NULL DEFAULT now(),
+  CHECK ("end_at" > "start_at"),
+  CONSTRAINT fk_store_sessions_store_id FOREIGN KEY ("store_id") REFERENCES "stores"("id") ON DELETE CASCADE,
+  CONSTRAINT fk_store_sessions_service_id FOREIGN KEY ("service_id") REFERENCES "store_services"("id") ON DELETE SET NULL,
+  CONSTRAINT fk_store_sessions_resource_id FOREIGN KEY ("resource_id") REFERENCES "store_resources"("id") ON DELETE RESTRICT
+);
+CREATE INDEX ON "store_sessions" ("store_id", "start_at");
+CREATE INDEX ON "store_sessions" ("resource_id");
+
+-- a class takes its resource, or the store wide calendar, like an
+-- appointment does
+ALTER TABLE "store_sessions"
+  ADD CONSTRAINT no_session_overlap_per_resource
+  EXCLUDE USING gist (
+    "store_id" WITH =,
+    COALESCE("resource_id", '00000000-0000-0000-0000-000000000000'::uuid) WITH =,
+    tstzrange("start_at","end_at",'[)') WITH &&
+  )
+  WHERE ("status" = 'scheduled');
+
+CREATE TABLE "store_session_bookings" (
+  "id" uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "session_id" uuid NOT NULL,
+  "user_id" uuid NOT NULL,
+  "status" varchar NOT NULL DEFAULT 'booked' CHECK ("status" IN ('booked','waitlisted','canceled','attended','no_show')),
+  "attendance_marked_at" timestamptz,
+  "created_at" timestamp NOT NULL DEFAULT now(),
+  "updated_at" timestamp NOT NULL DEFAULT now(),
+  CONSTRAINT fk_store_session_bookings_session_id FOREIGN KEY ("session_id") REFERENCES "store_sessions"("id") ON DELETE CASCADE,
+  CONSTRAINT fk_store_session_bookings_user_id FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE RESTRICT
+);
+CREATE INDEX ON "store_session_bookings" ("session_id", "created_at");
+CREATE INDEX ON "store_session_bookings" ("user_id");
+CREATE UNIQUE INDEX uniq_session_booking ON "store_session_bookings" ("session_id", "user_id") WHERE ("status" <> 'canceled');
+
+-- appointments and classes live in different tables, so the exclusion
+-- constraints can't see each other. These triggers keep a resource, or the
+-- store wide calendar, from being booked by both at the same time. The
+-- advisory lock serializes writers of the same calendar so two concurrent
+-- inserts can't both miss each other.
+CREATE FUNCTION store_appointments_session_overlap() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_advisory_xact_lock(hashtext(NEW.store_id::text || COALESCE(NEW.resource_id::text, '')));
+  IF EXISTS (
+    SELECT 1 FROM store_sessions
+    WHERE store_id = NEW.store_id
+      AND resource_id IS NOT DISTINCT FROM NEW.resource_id
+      AND status = 'scheduled'
+      AND tstzrange(start_at, end_at, '[)') && tstzrange(NEW.start_at, NEW.end_at + make_interval(mins => NEW.buffer_minutes), '[)')
+  ) THEN
+    RAISE EXCEPTION 'appointment overlaps a class'
+      USING ERRCODE = 'exclusion_violation', CONSTRAINT = 'no_overlap_with_sessions';
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER store_appointments_session_overlap
+  BEFORE INSERT OR UPDATE OF "start_at", "end_at", "buffer_minutes", "resource_id", "status" ON "store_appointments"
+  FOR EACH ROW WHEN (NEW."status" IN ('pending','confirmed'))
+  EXECUTE FUNCTION store_appointments_session_overlap();
+
+CREATE FUNCTION store_sessions_appointment_overlap() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_advisory_xact_lock(hashtext(NEW.store_id::text || COALESCE(NEW.resource_id::text, '')));
+  IF EXISTS (
+    SELECT 1 FROM store_appointments
+    WHERE store_id = NEW.store_id
+      AND resource_id IS NOT DISTINCT FROM NEW.resource_id
+      AND status IN ('pending','confirmed')
+      AND tstzrange(start_at, end_at + make_interval(mins => buffer_minutes), '[)') && tstzrange(NEW.start_at, NEW.end_at, '[)')
+  ) THEN
+    RAISE EXCEPTION 'class overlaps an appointment'
+      USING ERRCODE = 'exclusion_violation', CONSTRAINT = 'no_overlap_with_appointments';
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER store_sessions_appointment_overlap
+  BEFORE INSERT OR UPDATE OF "start_at", "end_at", "resource_id", "status" ON "store_sessions"
+  FOR EACH ROW WHEN (NEW."status" = 'scheduled')
+  EXECUTE FUNCTION store_sessions_appointment_overlap();
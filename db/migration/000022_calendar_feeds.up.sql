@@ -0,0 +1,15 @@
+-- a feed belongs to either a store or a customer; only the hash of its
+-- token is kept, the token itself is shown once when the feed is created
+CREATE TABLE "calendar_feeds" (
+  "id" uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "store_id" uuid,
+  "user_id" uuid,
+  "token_hash" varchar NOT NULL UNIQUE,
+  "revoked_at" timestamptz,
+  "created_at" timestamp NOT NULL DEFAULT now(),
+  CHECK (("store_id" IS NULL) <> ("user_id" IS NULL)),
+  CONSTRAINT fk_calendar_feeds_store_id FOREIGN KEY ("store_id") REFERENCES "stores"("id") ON DELETE CASCADE,
+  CONSTRAINT fk_calendar_feeds_user_id FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX uniq_live_store_calendar_feed ON "calendar_feeds" ("store_id") WHERE ("revoked_at" IS NULL AND "store_id" IS NOT NULL);
+CREATE UNIQUE INDEX uniq_live_user_calendar_feed ON "calendar_feeds" ("user_id") WHERE ("revoked_at" IS NULL AND "user_id" IS NOT NULL);
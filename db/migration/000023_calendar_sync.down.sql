@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "calendar_busy_blocks";
+DROP TABLE IF EXISTS "calendar_event_links";
+DROP TABLE IF EXISTS "calendar_connections";
@@ -0,0 +1,47 @@
+-- an external calendar a user keeps in sync; the provider tokens stay in the
+-- secrets manager, this only tracks the sync itself
+CREATE TABLE "calendar_connections" (
+  "id" uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "user_id" uuid NOT NULL,
+  "provider" varchar NOT NULL CHECK ("provider" IN ('microsoft')),
+  "active" boolean NOT NULL DEFAULT true,
+  "last_synced_at" timestamptz,
+  "last_error" varchar,
+  "created_at" timestamp NOT NULL DEFAULT now(),
+  "updated_at" timestamp NOT NULL DEFAULT now(),
+  CONSTRAINT fk_calendar_connections_user_id FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX uniq_calendar_connection ON "calendar_connections" ("user_id", "provider");
+
+-- the external event each pushed appointment became; appointment_updated_at
+-- is the version of the appointment last pushed, a newer one is pushed again
+CREATE TABLE "calendar_event_links" (
+  "connection_id" uuid NOT NULL,
+  "appointment_id" uuid NOT NULL,
+  "external_id" varchar NOT NULL,
+  "deleted" boolean NOT NULL DEFAULT false,
+  "appointment_updated_at" timestamp NOT NULL,
+  "synced_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("connection_id", "appointment_id"),
+  CONSTRAINT fk_calendar_event_links_connection_id FOREIGN KEY ("connection_id") REFERENCES "calendar_connections"("id") ON DELETE CASCADE,
+  CONSTRAINT fk_calendar_event_links_appointment_id FOREIGN KEY ("appointment_id") REFERENCES "store_appointments"("id") ON DELETE CASCADE
+);
+CREATE INDEX ON "calendar_event_links" ("appointment_id");
+CREATE INDEX ON "calendar_event_links" ("connection_id", "external_id");
+
+-- busy time imported from the external calendar, it makes the stores of the
+-- user unavailable
+CREATE TABLE "calendar_busy_blocks" (
+  "id" uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "connection_id" uuid NOT NULL,
+  "user_id" uuid NOT NULL,
+  "external_id" varchar NOT NULL,
+  "start_at" timestamptz NOT NULL,
+  "end_at" timestamptz NOT NULL,
+  "updated_at" timestamp NOT NULL DEFAULT now(),
+  CHECK ("end_at" > "start_at"),
+  CONSTRAINT fk_calendar_busy_blocks_connection_id FOREIGN KEY ("connection_id") REFERENCES "calendar_connections"("id") ON DELETE CASCADE,
+  CONSTRAINT fk_calendar_busy_blocks_user_id FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX uniq_calendar_busy_block ON "calendar_busy_blocks" ("connection_id", "external_id");
+CREATE INDEX ON "calendar_busy_blocks" ("user_id", "start_at");
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "store_calendar_source_blocks";
+DROP TABLE IF EXISTS "store_calendar_sources";
@@ -0,0 +1,34 @@
+-- an iCalendar file a store takes busy time from, fetched from url or
+-- uploaded as content; with a resource it only blocks that professional
+CREATE TABLE "store_calendar_sources" (
+  "id" uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "store_id" uuid NOT NULL,
+  "resource_id" uuid,
+  "name" varchar NOT NULL,
+  "url" varchar,
+  "content" text,
+  "last_fetched_at" timestamptz,
+  "last_error" varchar,
+  "created_at" timestamp NOT NULL DEFAULT now(),
+  "updated_at" timestamp NOT NULL DEFAULT now(),
+  CHECK (("url" IS NULL) <> ("content" IS NULL)),
+  CONSTRAINT fk_store_calendar_sources_store_id FOREIGN KEY ("store_id") REFERENCES "stores"("id") ON DELETE CASCADE,
+  CONSTRAINT fk_store_calendar_sources_resource_id FOREIGN KEY ("resource_id") REFERENCES "store_resources"("id") ON DELETE CASCADE
+);
+CREATE INDEX ON "store_calendar_sources" ("store_id");
+
+-- the events of a source, recurring ones expanded, over the import window;
+-- replaced as a whole on every refresh
+CREATE TABLE "store_calendar_source_blocks" (
+  "id" uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "source_id" uuid NOT NULL,
+  "store_id" uuid NOT NULL,
+  "resource_id" uuid,
+  "uid" varchar NOT NULL,
+  "start_at" timestamptz NOT NULL,
+  "end_at" timestamptz NOT NULL,
+  CHECK ("end_at" > "start_at"),
+  CONSTRAINT fk_store_calendar_source_blocks_source_id FOREIGN KEY ("source_id") REFERENCES "store_calendar_sources"("id") ON DELETE CASCADE
+);
+CREATE INDEX ON "store_calendar_source_blocks" ("source_id");
+CREATE INDEX ON "store_calendar_source_blocks" ("store_id", "start_at");
@@ -0,0 +1,21 @@
+-- the notifications of an appointment, each sent by the scheduler once
+-- send_at passes; start_at is the appointment start the job was planned for
+CREATE TABLE "notification_jobs" (
+  "id" uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+  "appointment_id" uuid,
+  "kind" varchar NOT NULL CHECK ("kind" IN ('confirmation','reminder_24h','reminder_1h','rating_request')),
+  "status" varchar NOT NULL DEFAULT 'pending' CHECK ("status" IN ('pending','sent','canceled','failed')),
+  "send_at" timestamptz NOT NULL,
+  "start_at" timestamp NOT NULL,
+  "attempts" integer NOT NULL DEFAULT 0,
+  "delivered_channels" varchar[] NOT NULL DEFAULT '{}',
+  "locked_until" timestamptz,
+  "last_error" varchar,
+  "sent_at" timestamptz,
+  "created_at" timestamp NOT NULL DEFAULT now(),
+  "updated_at" timestamp NOT NULL DEFAULT now(),
+  CONSTRAINT fk_notification_jobs_appointment_id FOREIGN KEY ("appointment_id") REFERENCES "store_appointments"("id") ON DELETE SET NULL
+);
+CREATE UNIQUE INDEX uniq_pending_notification ON "notification_jobs" ("appointment_id", "kind") WHERE ("status" = 'pending');
+CREATE INDEX ON "notification_jobs" ("send_at") WHERE ("status" = 'pending');
+CREATE INDEX ON "notification_jobs" ("appointment_id");
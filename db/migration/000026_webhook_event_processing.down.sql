@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS "webhook_events_next_attempt_at_idx";
+DROP INDEX IF EXISTS "webhook_events_status_received_at_idx";
+ALTER TABLE "webhook_events"
+  DROP CONSTRAINT IF EXISTS webhook_events_status_check,
+  DROP COLUMN IF EXISTS "attempts",
+  DROP COLUMN IF EXISTS "last_error",
+  DROP COLUMN IF EXISTS "next_attempt_at",
+  DROP COLUMN IF EXISTS "locked_until";
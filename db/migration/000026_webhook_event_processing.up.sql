@@ -0,0 +1,11 @@
+-- provider webhook events are stored as they arrive and processed by a
+-- worker; failed ones keep their error and attempts until replayed
+UPDATE "webhook_events" SET "status" = 'pending' WHERE "status" NOT IN ('pending','processed','ignored','failed');
+ALTER TABLE "webhook_events"
+  ADD CONSTRAINT webhook_events_status_check CHECK ("status" IN ('pending','processed','ignored','failed')),
+  ADD COLUMN "attempts" integer NOT NULL DEFAULT 0,
+  ADD COLUMN "last_error" varchar,
+  ADD COLUMN "next_attempt_at" timestamptz NOT NULL DEFAULT now(),
+  ADD COLUMN "locked_until" timestamptz;
+CREATE INDEX ON "webhook_events" ("next_attempt_at") WHERE ("status" = 'pending');
+CREATE INDEX ON "webhook_events" ("status", "received_at");
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS "refunds_created_at_idx";
+ALTER TABLE "refunds"
+  DROP COLUMN IF EXISTS "attempts",
+  DROP COLUMN IF EXISTS "last_error",
+  DROP COLUMN IF EXISTS "locked_until";
@@ -0,0 +1,7 @@
+-- refunds are submitted to the provider by the API or, for the ones recorded
+-- on cancellation, by a worker that retries them until attempts run out
+ALTER TABLE "refunds"
+  ADD COLUMN "attempts" integer NOT NULL DEFAULT 0,
+  ADD COLUMN "last_error" varchar,
+  ADD COLUMN "locked_until" timestamptz;
+CREATE INDEX ON "refunds" ("created_at") WHERE ("status" = 'pending' AND "provider_refund_id" IS NULL);
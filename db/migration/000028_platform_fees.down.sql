@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS payments_fees ON "payments";
+DROP FUNCTION IF EXISTS payments_fees();
+DROP FUNCTION IF EXISTS platform_fee_pct(uuid, uuid);
+ALTER TABLE "store_plans" DROP COLUMN IF EXISTS "platform_fee_pct";
+ALTER TABLE "stores" DROP COLUMN IF EXISTS "platform_fee_pct";
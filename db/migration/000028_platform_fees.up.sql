@@ -0,0 +1,40 @@
+-- the platform fee is ours to set: a store, or one of its plans, may get its
+-- own rate, otherwise the 8% default applies
+ALTER TABLE "stores"
+  ADD COLUMN "platform_fee_pct" numeric(5,2) CHECK ("platform_fee_pct" BETWEEN 0 AND 100);
+ALTER TABLE "store_plans"
+  ADD COLUMN "platform_fee_pct" numeric(5,2) CHECK ("platform_fee_pct" BETWEEN 0 AND 100);
+
+-- the rate of a payment at the store, through the plan of its subscription
+-- when it has one
+CREATE FUNCTION platform_fee_pct(p_store_id uuid, p_subscription_id uuid) RETURNS numeric AS $$
+  SELECT COALESCE(
+    (SELECT sp.platform_fee_pct
+      FROM subscriptions s
+      JOIN store_plans sp ON sp.id = s.store_plan_id
+      WHERE s.id = p_subscription_id),
+    (SELECT platform_fee_pct FROM stores WHERE id = p_store_id),
+    8.00
+  );
+$$ LANGUAGE sql STABLE;
+
+-- every payment takes its rate when it is created and keeps its fees and net
+-- amount in line with its total from then on. round() on numeric is exact
+-- and rounds half away from zero.
+CREATE FUNCTION payments_fees() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    NEW.fee_platform_pct := platform_fee_pct(NEW.store_id, NEW.subscription_id);
+  END IF;
+  NEW.fee_processing_amount := COALESCE(NEW.fee_processing_amount, 0);
+  NEW.fee_platform_amount := round(NEW.amount_total * NEW.fee_platform_pct / 100, 2);
+  NEW.amount_net := NEW.amount_total - NEW.fee_platform_amount - NEW.fee_processing_amount;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER payments_fees
+  BEFORE INSERT OR UPDATE OF "amount_total", "fee_platform_pct", "fee_processing_amount" ON "payments"
+  FOR EACH ROW EXECUTE FUNCTION payments_fees();
+
+UPDATE "payments" SET "fee_platform_pct" = "fee_platform_pct";
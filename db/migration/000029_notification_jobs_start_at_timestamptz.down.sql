@@ -0,0 +1,2 @@
+ALTER TABLE "notification_jobs"
+  ALTER COLUMN "start_at" TYPE timestamp USING "start_at" AT TIME ZONE current_setting('TimeZone');
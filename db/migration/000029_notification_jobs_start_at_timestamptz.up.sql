@@ -0,0 +1,4 @@
+-- start_at is compared with the appointment start_at, an instant since 000014;
+-- the planned starts were written as wall clock in the session time zone
+ALTER TABLE "notification_jobs"
+  ALTER COLUMN "start_at" TYPE timestamptz USING "start_at" AT TIME ZONE current_setting('TimeZone');
@@ -0,0 +1,13 @@
+CREATE OR REPLACE FUNCTION payments_fees() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    NEW.fee_platform_pct := platform_fee_pct(NEW.store_id, NEW.subscription_id);
+  END IF;
+  NEW.fee_processing_amount := COALESCE(NEW.fee_processing_amount, 0);
+  NEW.fee_platform_amount := round(NEW.amount_total * NEW.fee_platform_pct / 100, 2);
+  NEW.amount_net := NEW.amount_total - NEW.fee_platform_amount - NEW.fee_processing_amount;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS currency_digits(varchar);
@@ -0,0 +1,26 @@
+-- fees are rounded to the minor units of the payment currency, as the API
+-- rounds them at booking: whole yen for JPY, three places for KWD. Currencies
+-- not listed have two, the same default as money.Currency.Digits.
+CREATE FUNCTION currency_digits(p_currency varchar) RETURNS integer AS $$
+  SELECT CASE
+    WHEN p_currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG',
+      'RWF', 'UGX', 'UYI', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 0
+    WHEN p_currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 3
+    WHEN p_currency IN ('CLF', 'UYW') THEN 4
+    ELSE 2
+  END;
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION payments_fees() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    NEW.fee_platform_pct := platform_fee_pct(NEW.store_id, NEW.subscription_id);
+  END IF;
+  NEW.fee_processing_amount := COALESCE(NEW.fee_processing_amount, 0);
+  NEW.fee_platform_amount := round(NEW.amount_total * NEW.fee_platform_pct / 100, currency_digits(NEW.currency));
+  NEW.amount_net := NEW.amount_total - NEW.fee_platform_amount - NEW.fee_processing_amount;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+UPDATE "payments" SET "fee_platform_pct" = "fee_platform_pct" WHERE currency_digits("currency") <> 2;
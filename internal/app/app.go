@@ -21,15 +21,27 @@ var ContextIDKey = &contextID{}
 type Handler func(ctx context.Context, w http.ResponseWriter, r *http.Request, params httprouter.Params) error
 
 // CtxValue type holds all info that we want pass to context.
-// It holds: TraceID, HTTPStatusCode and Now(that is the current time)
+// It holds: TraceID, HTTPStatusCode, Now(that is the current time) and the
+// UserID of the authenticated caller, when the route is authenticated.
 type CtxValue struct {
 	TraceID        string
 	HTTPStatusCode int
 	Now            time.Time
+	UserID         string
+}
+
+// UserID returns the authenticated caller stored in the context, or an empty
+// string for public routes.
+func UserID(ctx context.Context) string {
+	if v, ok := ctx.Value(ContextIDKey).(*CtxValue); ok {
+		return v.UserID
+	}
+	return ""
 }
 
 type App struct {
 	*httprouter.Router
+	static   *httprouter.Router
 	shutdown chan os.Signal
 	mw       []Middleware
 }
@@ -38,6 +50,7 @@ type App struct {
 func New(shutdown chan os.Signal, mw ...Middleware) *App {
 	a := App{
 		Router:   httprouter.New(),
+		static:   httprouter.New(),
 		shutdown: shutdown,
 		mw:       mw,
 	}
@@ -52,6 +65,19 @@ func (a *App) SignalShutdown() {
 
 // Handle is the function for mounting Handlers given a HTTP verb and path pair.
 func (a *App) Handle(verb, path string, handler Handler, mw ...Middleware) {
+	a.Router.Handle(verb, path, a.handle(handler, mw))
+}
+
+// HandleStatic mounts a route with a static segment where other routes have a
+// wildcard, like /appointments/series next to /appointments/:appointmentId.
+// httprouter can't keep both in one tree, so these routes live in a tree of
+// their own that is looked up first.
+func (a *App) HandleStatic(verb, path string, handler Handler, mw ...Middleware) {
+	a.static.Handle(verb, path, a.handle(handler, mw))
+}
+
+// handle wraps handler in its middlewares and the app's ones.
+func (a *App) handle(handler Handler, mw []Middleware) httprouter.Handle {
 
 	// Add specific middlewares around this handler.
 	handler = addMiddleware(mw, handler)
@@ -77,11 +103,14 @@ func (a *App) Handle(verb, path string, handler Handler, mw ...Middleware) {
 		}
 	}
 
-	// Add this handler to the route.
-	a.Router.Handle(verb, path, h)
+	return h
 }
 
 // It overrides the ServeHTTP of the embedded httprouter.
 func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h, params, _ := a.static.Lookup(r.Method, r.URL.Path); h != nil {
+		h(w, r, params)
+		return
+	}
 	a.Router.ServeHTTP(w, r)
 }
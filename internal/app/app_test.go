@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestHandleStatic(t *testing.T) {
+	a := New(nil)
+	route := func(name string, param string) Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+			_, _ = w.Write([]byte(name + " " + p.ByName(param)))
+			return nil
+		}
+	}
+	a.Handle(http.MethodGet, "/stores/:id/appointments/:appointmentId/history", route("history", "appointmentId"))
+	a.Handle(http.MethodPut, "/stores/:id/appointments/:appointmentId", route("appointment", "appointmentId"))
+	a.HandleStatic(http.MethodGet, "/stores/:id/appointments/series/:seriesId", route("series", "seriesId"))
+	a.HandleStatic(http.MethodPut, "/stores/:id/appointments/series/:seriesId", route("series", "seriesId"))
+
+	for _, tc := range []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{http.MethodGet, "/stores/s1/appointments/series/r1", http.StatusOK, "series r1"},
+		{http.MethodPut, "/stores/s1/appointments/series/r1", http.StatusOK, "series r1"},
+		{http.MethodGet, "/stores/s1/appointments/a1/history", http.StatusOK, "history a1"},
+		{http.MethodPut, "/stores/s1/appointments/a1", http.StatusOK, "appointment a1"},
+		{http.MethodGet, "/stores/s1/appointments/a1/other", http.StatusNotFound, ""},
+		{http.MethodDelete, "/stores/s1/appointments/series/r1", http.StatusNotFound, ""},
+	} {
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if w.Code != tc.code {
+			t.Errorf("%s %s: status %d, want %d", tc.method, tc.path, w.Code, tc.code)
+		}
+		if tc.code == http.StatusOK && w.Body.String() != tc.body {
+			t.Errorf("%s %s: served %q, want %q", tc.method, tc.path, w.Body.String(), tc.body)
+		}
+	}
+}
@@ -22,6 +22,14 @@ type ErrorResponse struct {
 	Fields []FieldError `json:"fields,omitempty"`
 }
 
+// ConflictResponse is the form used for API responses when a request collides
+// with existing data.
+type ConflictResponse struct {
+	Message  string `json:"message"`
+	Error    string `json:"error"`
+	Conflict any    `json:"conflict,omitempty"`
+}
+
 // Error is used to pass an error during the request through the
 // application with web specific context.
 type Error struct {
@@ -46,6 +46,10 @@ func Authenticate(roles []string) app.Middleware {
 				return nil
 			}
 
+			if v, ok := ctx.Value(app.ContextIDKey).(*app.CtxValue); ok {
+				v.UserID = tokenSubject(tokenString)
+			}
+
 			return current(ctx, w, r, params)
 		}
 
@@ -99,6 +103,15 @@ func validateTokenAtKeycloak(tokenString string) bool {
 // 	return tokenCache != ""
 // }
 
+// tokenSubject reads the sub claim of a token that was already validated at keycloak.
+func tokenSubject(tokenString string) string {
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, &claims); err != nil {
+		return ""
+	}
+	return claims.Subject
+}
+
 func validateJwtScope(tokenString string, roles []string) bool {
 	if len(roles) == 0 {
 		return true
@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+const (
+	uniqueViolation    = "23505"
+	exclusionViolation = "23P01"
+)
+
+// ConflictError is returned by repositories when a write is rejected by a
+// unique or exclusion constraint. Conflict optionally carries details about
+// the existing data the write collided with.
+type ConflictError struct {
+	Constraint string
+	Message    string
+	Conflict   any
+}
+
+// Error implements the error interface.
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+// ViolatedConstraint returns the constraint name when err is a unique or
+// exclusion violation raised by postgres.
+func ViolatedConstraint(err error) (string, bool) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && (pqErr.Code == uniqueViolation || pqErr.Code == exclusionViolation) {
+		return pqErr.Constraint, true
+	}
+	return "", false
+}
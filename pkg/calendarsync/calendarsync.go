@@ -0,0 +1,50 @@
+package calendarsync
+
+import "time"
+
+// Connection is a user's external calendar kept in sync: their appointments
+// are pushed to it and its busy time makes their stores unavailable.
+type Connection struct {
+	Id           string `json:"id"`
+	UserId       string `json:"user_id"`
+	Provider     string `json:"provider"`
+	Active       bool   `json:"active"`
+	LastSyncedAt string `json:"last_synced_at"`
+	LastError    string `json:"last_error"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+type ConnectRequest struct {
+	Provider string `json:"provider" validate:"required,oneof=microsoft"`
+}
+
+type ImportedBusyBlock struct {
+	Id         string `json:"id"`
+	Provider   string `json:"provider"`
+	ExternalId string `json:"external_id"`
+	StartAt    string `json:"start_at"`
+	EndAt      string `json:"end_at"`
+}
+
+// SyncResult is what a sync run did on one connection.
+type SyncResult struct {
+	Pushed   int `json:"pushed"`
+	Deleted  int `json:"deleted"`
+	Imported int `json:"imported"`
+}
+
+// pendingPush is an appointment at one of the user's stores whose external
+// event is missing or older than the appointment.
+type pendingPush struct {
+	AppointmentId string
+	Status        string
+	StartAt       time.Time
+	EndAt         time.Time
+	UpdatedAt     time.Time
+	ServiceName   string
+	CustomerName  string
+	StoreName     string
+	Notes         string
+	ExternalId    string
+}
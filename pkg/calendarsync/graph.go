@@ -0,0 +1,321 @@
+package calendarsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/genda/genda-api/pkg/config"
+)
+
+const ProviderMicrosoft = "microsoft"
+
+// graphDateTimeLayout is how Graph writes a dateTimeTimeZone, without offset;
+// the fractional seconds it adds are accepted when parsing.
+const graphDateTimeLayout = "2006-01-02T15:04:05"
+
+// graphMaxPages bounds how many pages of a calendar view are read. A view
+// with more fails the import rather than replacing the busy time with part
+// of it.
+const graphMaxPages = 50
+
+// graphBusy are the showAs values that make the user unavailable.
+var graphBusy = map[string]bool{
+	"busy":      true,
+	"oof":       true,
+	"tentative": true,
+}
+
+// GraphConfig points the Microsoft Graph provider at the Graph API and the
+// Microsoft identity platform, or at a fake of both.
+type GraphConfig struct {
+	BaseURL      string
+	LoginURL     string
+	TenantId     string
+	ClientId     string
+	ClientSecret string
+	HTTPClient   *http.Client
+}
+
+func GraphConfigFrom(conf *config.Conf) GraphConfig {
+	return GraphConfig{
+		BaseURL:      conf.MicrosoftGraphUrl,
+		LoginURL:     conf.MicrosoftLoginUrl,
+		TenantId:     conf.MicrosoftTenantId,
+		ClientId:     conf.MicrosoftAppId,
+		ClientSecret: conf.MicrosoftAppSecret,
+	}
+}
+
+// graphProvider syncs with the user's default Outlook calendar through
+// Microsoft Graph. An expired access token is refreshed once per call.
+type graphProvider struct {
+	conf   GraphConfig
+	tokens TokenStore
+	client *http.Client
+}
+
+func NewGraphProvider(conf GraphConfig, tokens TokenStore) Provider {
+	client := conf.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if conf.TenantId == "" {
+		conf.TenantId = "common"
+	}
+	return &graphProvider{conf: conf, tokens: tokens, client: client}
+}
+
+type graphDateTime struct {
+	DateTime string `json:"dateTime"`
+	TimeZone string `json:"timeZone"`
+}
+
+type graphBody struct {
+	ContentType string `json:"contentType"`
+	Content     string `json:"content"`
+}
+
+type graphLocation struct {
+	DisplayName string `json:"displayName"`
+}
+
+type graphEvent struct {
+	Id            string         `json:"id,omitempty"`
+	TransactionId string         `json:"transactionId,omitempty"`
+	Subject       string         `json:"subject,omitempty"`
+	Body          *graphBody     `json:"body,omitempty"`
+	Location      *graphLocation `json:"location,omitempty"`
+	Start         *graphDateTime `json:"start,omitempty"`
+	End           *graphDateTime `json:"end,omitempty"`
+	ShowAs        string         `json:"showAs,omitempty"`
+	IsCancelled   bool           `json:"isCancelled,omitempty"`
+}
+
+type graphEventPage struct {
+	Value    []graphEvent `json:"value"`
+	NextLink string       `json:"@odata.nextLink"`
+}
+
+func (p *graphProvider) Name() string {
+	return ProviderMicrosoft
+}
+
+func (p *graphProvider) CreateEvent(ctx context.Context, userId string, event Event) (string, error) {
+	body := toGraphEvent(event)
+	body.TransactionId = event.TransactionId
+
+	var created graphEvent
+	if err := p.do(ctx, userId, http.MethodPost, p.conf.BaseURL+"/me/events", body, &created); err != nil {
+		return "", err
+	}
+	if created.Id == "" {
+		return "", errors.New("graph returned an event without id")
+	}
+	return created.Id, nil
+}
+
+func (p *graphProvider) UpdateEvent(ctx context.Context, userId string, externalId string, event Event) error {
+	path := p.conf.BaseURL + "/me/events/" + url.PathEscape(externalId)
+	return p.do(ctx, userId, http.MethodPatch, path, toGraphEvent(event), nil)
+}
+
+func (p *graphProvider) DeleteEvent(ctx context.Context, userId string, externalId string) error {
+	path := p.conf.BaseURL + "/me/events/" + url.PathEscape(externalId)
+	err := p.do(ctx, userId, http.MethodDelete, path, nil, nil)
+	if errors.Is(err, ErrEventNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (p *graphProvider) BusyBlocks(ctx context.Context, userId string, from time.Time, to time.Time) ([]BusyBlock, error) {
+	query := url.Values{}
+	query.Set("startDateTime", from.UTC().Format(time.RFC3339))
+	query.Set("endDateTime", to.UTC().Format(time.RFC3339))
+	query.Set("$select", "id,start,end,showAs,isCancelled")
+	query.Set("$top", "100")
+	next := p.conf.BaseURL + "/me/calendarView?" + query.Encode()
+
+	blocks := []BusyBlock{}
+	for page := 0; next != ""; page++ {
+		if page == graphMaxPages {
+			return nil, fmt.Errorf("the calendar view has more than %d pages", graphMaxPages)
+		}
+		var res graphEventPage
+		if err := p.do(ctx, userId, http.MethodGet, next, nil, &res); err != nil {
+			return nil, err
+		}
+		for _, e := range res.Value {
+			if e.IsCancelled || !graphBusy[e.ShowAs] || e.Start == nil || e.End == nil {
+				continue
+			}
+			start, err := parseGraphDateTime(*e.Start)
+			if err != nil {
+				return nil, err
+			}
+			end, err := parseGraphDateTime(*e.End)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, BusyBlock{ExternalId: e.Id, Start: start, End: end})
+		}
+		next = res.NextLink
+	}
+	return blocks, nil
+}
+
+// do sends a Graph request as the user, refreshing the access token and
+// retrying once when Graph rejects it.
+func (p *graphProvider) do(ctx context.Context, userId string, method string, path string, body any, out any) error {
+	tokens, err := p.tokens.Tokens(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	res, err := p.send(ctx, tokens.AccessToken, method, path, body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode == http.StatusUnauthorized {
+		res.Body.Close()
+		if tokens, err = p.refresh(ctx, userId, tokens.RefreshToken); err != nil {
+			return err
+		}
+		if res, err = p.send(ctx, tokens.AccessToken, method, path, body); err != nil {
+			return err
+		}
+	}
+	defer res.Body.Close()
+
+	data, _ := io.ReadAll(res.Body)
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return ErrEventNotFound
+	case res.StatusCode == http.StatusUnauthorized:
+		return ErrNotAuthorized
+	case res.StatusCode >= http.StatusMultipleChoices:
+		return fmt.Errorf("graph returned %d: %s", res.StatusCode, string(data))
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("unmarshal graph response: %w", err)
+	}
+	return nil
+}
+
+func (p *graphProvider) send(ctx context.Context, accessToken string, method string, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Prefer", `outlook.timezone="UTC"`)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("graph request: %w", err)
+	}
+	return res, nil
+}
+
+// refresh trades the refresh token for new tokens and stores them.
+func (p *graphProvider) refresh(ctx context.Context, userId string, refreshToken string) (*Tokens, error) {
+	if refreshToken == "" {
+		return nil, ErrNotAuthorized
+	}
+
+	data := url.Values{}
+	data.Set("client_id", p.conf.ClientId)
+	data.Set("client_secret", p.conf.ClientSecret)
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", refreshToken)
+	data.Set("scope", "offline_access Calendars.ReadWrite")
+
+	tokenURL := fmt.Sprintf("%s/%s/oauth2/v2.0/token", p.conf.LoginURL, p.conf.TenantId)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("microsoft refresh request: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode == http.StatusBadRequest || res.StatusCode == http.StatusUnauthorized {
+		return nil, ErrNotAuthorized
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("microsoft returned %d: %s", res.StatusCode, string(body))
+	}
+
+	var tok struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return nil, fmt.Errorf("unmarshal microsoft token: %w", err)
+	}
+
+	// The identity platform doesn't always rotate the refresh token.
+	tokens := Tokens{AccessToken: tok.AccessToken, RefreshToken: tok.RefreshToken}
+	if tokens.RefreshToken == "" {
+		tokens.RefreshToken = refreshToken
+	}
+	if err := p.tokens.SaveTokens(ctx, userId, tokens); err != nil {
+		return nil, err
+	}
+	return &tokens, nil
+}
+
+func toGraphEvent(event Event) graphEvent {
+	e := graphEvent{
+		Subject: event.Subject,
+		Body:    &graphBody{ContentType: "text", Content: event.Body},
+		Start:   &graphDateTime{DateTime: event.Start.UTC().Format(graphDateTimeLayout), TimeZone: "UTC"},
+		End:     &graphDateTime{DateTime: event.End.UTC().Format(graphDateTimeLayout), TimeZone: "UTC"},
+		ShowAs:  "busy",
+	}
+	if event.Location != "" {
+		e.Location = &graphLocation{DisplayName: event.Location}
+	}
+	return e
+}
+
+func parseGraphDateTime(value graphDateTime) (time.Time, error) {
+	loc, err := time.LoadLocation(value.TimeZone)
+	if err != nil || value.TimeZone == "" {
+		loc = time.UTC
+	}
+	t, err := time.ParseInLocation(graphDateTimeLayout, value.DateTime, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid graph dateTime %q: %w", value.DateTime, err)
+	}
+	return t, nil
+}
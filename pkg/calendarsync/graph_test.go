@@ -0,0 +1,196 @@
+package calendarsync
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/genda/genda-api/pkg/calendarsync/graphfake"
+)
+
+const testUser = "user-1"
+
+// newGraphTest starts a fake Graph server and a provider pointed at it, with
+// the user holding the tokens the fake accepts.
+func newGraphTest(t *testing.T) (*graphfake.Server, Provider, *MemoryTokenStore) {
+	t.Helper()
+	server := graphfake.NewServer("access-0", "refresh-0")
+	t.Cleanup(server.Close)
+
+	tokens := NewMemoryTokenStore()
+	tokens.SaveTokens(context.Background(), testUser, Tokens{AccessToken: "access-0", RefreshToken: "refresh-0"})
+	provider := NewGraphProvider(GraphConfig{
+		BaseURL:  server.GraphURL(),
+		LoginURL: server.LoginURL(),
+		ClientId: "client",
+	}, tokens)
+	return server, provider, tokens
+}
+
+func testEvent(subject string, start time.Time) Event {
+	return Event{
+		TransactionId: subject,
+		Subject:       subject,
+		Body:          "notes",
+		Location:      "Store",
+		Start:         start,
+		End:           start.Add(time.Hour),
+	}
+}
+
+func TestGraphProviderEvents(t *testing.T) {
+	ctx := context.Background()
+	server, provider, _ := newGraphTest(t)
+	start := time.Date(2026, 3, 2, 14, 0, 0, 0, time.UTC)
+
+	id, err := provider.CreateEvent(ctx, testUser, testEvent("Haircut", start))
+	if err != nil {
+		t.Fatalf("CreateEvent: %v", err)
+	}
+	again, err := provider.CreateEvent(ctx, testUser, testEvent("Haircut", start))
+	if err != nil {
+		t.Fatalf("CreateEvent retried: %v", err)
+	}
+	if again != id {
+		t.Errorf("retried CreateEvent made event %s, want %s", again, id)
+	}
+
+	moved := testEvent("Beard", start.Add(2*time.Hour))
+	if err := provider.UpdateEvent(ctx, testUser, id, moved); err != nil {
+		t.Fatalf("UpdateEvent: %v", err)
+	}
+	events := server.Events()
+	if len(events) != 1 {
+		t.Fatalf("calendar has %d events, want 1", len(events))
+	}
+	if events[0].Subject != "Beard" || events[0].Start.DateTime != "2026-03-02T16:00:00" || events[0].ShowAs != "busy" {
+		t.Errorf("updated event is %+v", events[0])
+	}
+
+	if err := provider.DeleteEvent(ctx, testUser, id); err != nil {
+		t.Fatalf("DeleteEvent: %v", err)
+	}
+	if n := len(server.Events()); n != 0 {
+		t.Errorf("calendar has %d events after delete, want 0", n)
+	}
+	if err := provider.DeleteEvent(ctx, testUser, id); err != nil {
+		t.Errorf("deleting a deleted event: %v", err)
+	}
+	if err := provider.UpdateEvent(ctx, testUser, id, moved); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("updating a deleted event: got %v, want ErrEventNotFound", err)
+	}
+}
+
+func TestGraphProviderRefreshesExpiredToken(t *testing.T) {
+	ctx := context.Background()
+	server, provider, tokens := newGraphTest(t)
+	server.ExpireAccessToken()
+
+	if _, err := provider.CreateEvent(ctx, testUser, testEvent("Haircut", time.Now())); err != nil {
+		t.Fatalf("CreateEvent: %v", err)
+	}
+	if n := server.Refreshes(); n != 1 {
+		t.Errorf("refreshed %d times, want 1", n)
+	}
+	saved, _ := tokens.Tokens(ctx, testUser)
+	if saved.AccessToken != "access-1" || saved.RefreshToken != "refresh-1" {
+		t.Errorf("saved tokens are %+v, want the refreshed ones", saved)
+	}
+
+	// The new token is used from then on.
+	if _, err := provider.BusyBlocks(ctx, testUser, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("BusyBlocks: %v", err)
+	}
+	if n := server.Refreshes(); n != 1 {
+		t.Errorf("refreshed %d times, want 1", n)
+	}
+}
+
+func TestGraphProviderRevokedToken(t *testing.T) {
+	ctx := context.Background()
+	server, provider, tokens := newGraphTest(t)
+	server.ExpireAccessToken()
+	tokens.SaveTokens(ctx, testUser, Tokens{AccessToken: "access-0", RefreshToken: "revoked"})
+
+	_, err := provider.CreateEvent(ctx, testUser, testEvent("Haircut", time.Now()))
+	if !errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("got %v, want ErrNotAuthorized", err)
+	}
+	if _, err := provider.CreateEvent(ctx, "someone-else", testEvent("Haircut", time.Now())); !errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("user without tokens: got %v, want ErrNotAuthorized", err)
+	}
+}
+
+func TestGraphProviderBusyBlocks(t *testing.T) {
+	ctx := context.Background()
+	server, provider, _ := newGraphTest(t)
+	server.SetPageSize(2)
+
+	from := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	at := func(h int) time.Time { return from.Add(time.Duration(h) * time.Hour) }
+
+	want := map[string]BusyBlock{}
+	for _, e := range []struct {
+		subject string
+		start   int
+		end     int
+		showAs  string
+		busy    bool
+	}{
+		{"meeting", 9, 10, "busy", true},
+		{"vacation", 11, 13, "oof", true},
+		{"maybe", 14, 15, "tentative", true},
+		{"lunch", 12, 13, "free", false},
+		{"remote", 15, 16, "workingElsewhere", false},
+		{"overnight", -2, 1, "busy", true},
+		{"tomorrow", 25, 26, "busy", false},
+	} {
+		id := server.AddBusy(e.subject, at(e.start), at(e.end), e.showAs)
+		if e.busy {
+			want[id] = BusyBlock{ExternalId: id, Start: at(e.start), End: at(e.end)}
+		}
+	}
+
+	blocks, err := provider.BusyBlocks(ctx, testUser, from, to)
+	if err != nil {
+		t.Fatalf("BusyBlocks: %v", err)
+	}
+	if len(blocks) != len(want) {
+		t.Fatalf("got %d blocks, want %d: %+v", len(blocks), len(want), blocks)
+	}
+	for _, b := range blocks {
+		w, ok := want[b.ExternalId]
+		if !ok || !b.Start.Equal(w.Start) || !b.End.Equal(w.End) {
+			t.Errorf("unexpected block %+v", b)
+		}
+	}
+}
+
+func TestGraphProviderBusyBlocksPageLimit(t *testing.T) {
+	ctx := context.Background()
+	server, provider, _ := newGraphTest(t)
+	server.SetPageSize(1)
+
+	from := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	to := from.Add(7 * 24 * time.Hour)
+	for i := 0; i < graphMaxPages; i++ {
+		start := from.Add(time.Duration(i) * time.Hour)
+		server.AddBusy("meeting", start, start.Add(30*time.Minute), "busy")
+	}
+
+	blocks, err := provider.BusyBlocks(ctx, testUser, from, to)
+	if err != nil {
+		t.Fatalf("BusyBlocks with %d pages: %v", graphMaxPages, err)
+	}
+	if len(blocks) != graphMaxPages {
+		t.Errorf("got %d blocks, want %d", len(blocks), graphMaxPages)
+	}
+
+	start := from.Add(graphMaxPages * time.Hour)
+	server.AddBusy("one too many", start, start.Add(30*time.Minute), "busy")
+	if _, err := provider.BusyBlocks(ctx, testUser, from, to); err == nil {
+		t.Errorf("BusyBlocks with %d pages: got no error", graphMaxPages+1)
+	}
+}
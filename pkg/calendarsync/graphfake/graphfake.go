@@ -0,0 +1,310 @@
+// Package graphfake is a local stand-in for Microsoft Graph and the
+// Microsoft identity platform, enough of both for the calendar sync to run
+// against it without a Microsoft 365 tenant.
+package graphfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dateTimeLayout = "2006-01-02T15:04:05"
+
+type dateTime struct {
+	DateTime string `json:"dateTime"`
+	TimeZone string `json:"timeZone"`
+}
+
+// Event is an event on the fake calendar.
+type Event struct {
+	Id            string    `json:"id"`
+	TransactionId string    `json:"transactionId,omitempty"`
+	Subject       string    `json:"subject,omitempty"`
+	Body          any       `json:"body,omitempty"`
+	Location      any       `json:"location,omitempty"`
+	Start         *dateTime `json:"start,omitempty"`
+	End           *dateTime `json:"end,omitempty"`
+	ShowAs        string    `json:"showAs,omitempty"`
+	IsCancelled   bool      `json:"isCancelled,omitempty"`
+}
+
+// Server serves /v1.0/me/events, /v1.0/me/calendarView and the token
+// endpoint under /login. It has one calendar, whoever the caller is, and
+// accepts the current access token only.
+type Server struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	accessToken  string
+	refreshToken string
+	events       map[string]*Event
+	nextId       int
+	refreshes    int
+	pageSize     int
+}
+
+// NewServer starts a fake accepting accessToken, that hands out a new one
+// for refreshToken.
+func NewServer(accessToken string, refreshToken string) *Server {
+	s := &Server{
+		accessToken:  accessToken,
+		refreshToken: refreshToken,
+		events:       map[string]*Event{},
+		pageSize:     10,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/", s.token)
+	mux.HandleFunc("/v1.0/me/events", s.authorized(s.eventsRoot))
+	mux.HandleFunc("/v1.0/me/events/", s.authorized(s.event))
+	mux.HandleFunc("/v1.0/me/calendarView", s.authorized(s.calendarView))
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// GraphURL is the value for GraphConfig.BaseURL.
+func (s *Server) GraphURL() string {
+	return s.URL + "/v1.0"
+}
+
+// LoginURL is the value for GraphConfig.LoginURL.
+func (s *Server) LoginURL() string {
+	return s.URL + "/login"
+}
+
+// ExpireAccessToken makes the current access token rejected, as happens when
+// it expires on the Microsoft side.
+func (s *Server) ExpireAccessToken() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessToken = ""
+}
+
+// SetPageSize sets how many events a calendar view page holds.
+func (s *Server) SetPageSize(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pageSize = n
+}
+
+// Refreshes is how many times the refresh token was redeemed.
+func (s *Server) Refreshes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refreshes
+}
+
+// AddBusy puts an event the user made themselves on the calendar.
+func (s *Server) AddBusy(subject string, start time.Time, end time.Time, showAs string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.add(&Event{
+		Subject: subject,
+		Start:   &dateTime{DateTime: start.UTC().Format(dateTimeLayout), TimeZone: "UTC"},
+		End:     &dateTime{DateTime: end.UTC().Format(dateTimeLayout), TimeZone: "UTC"},
+		ShowAs:  showAs,
+	})
+}
+
+// DeleteEvent removes an event as the user would from Outlook.
+func (s *Server) DeleteEvent(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.events, id)
+}
+
+// Events returns the events on the calendar, by start.
+func (s *Server) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]Event, 0, len(s.events))
+	for _, e := range s.events {
+		events = append(events, *e)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Start.DateTime < events[j].Start.DateTime
+	})
+	return events
+}
+
+func (s *Server) add(e *Event) string {
+	s.nextId++
+	e.Id = fmt.Sprintf("AAMk-%d", s.nextId)
+	s.events[e.Id] = e
+	return e.Id
+}
+
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		token := s.accessToken
+		s.mu.Unlock()
+
+		if token == "" || r.Header.Get("Authorization") != "Bearer "+token {
+			writeError(w, http.StatusUnauthorized, "InvalidAuthenticationToken")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/oauth2/v2.0/token") {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("refresh_token") != s.refreshToken {
+		writeError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	s.refreshes++
+	s.accessToken = fmt.Sprintf("access-%d", s.refreshes)
+	s.refreshToken = fmt.Sprintf("refresh-%d", s.refreshes)
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"token_type":    "Bearer",
+		"access_token":  s.accessToken,
+		"refresh_token": s.refreshToken,
+	})
+}
+
+func (s *Server) eventsRoot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var e Event
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		writeError(w, http.StatusBadRequest, "ErrorInvalidRequest")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Graph answers a repeated transactionId with the event it created.
+	if e.TransactionId != "" {
+		for _, existing := range s.events {
+			if existing.TransactionId == e.TransactionId {
+				writeJSON(w, http.StatusCreated, existing)
+				return
+			}
+		}
+	}
+	s.add(&e)
+	writeJSON(w, http.StatusCreated, e)
+}
+
+func (s *Server) event(w http.ResponseWriter, r *http.Request) {
+	id, err := url.PathUnescape(strings.TrimPrefix(r.URL.Path, "/v1.0/me/events/"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "ErrorInvalidIdMalformed")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.events[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "ErrorItemNotFound")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, existing)
+	case http.MethodPatch:
+		var patch Event
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			writeError(w, http.StatusBadRequest, "ErrorInvalidRequest")
+			return
+		}
+		patch.Id = existing.Id
+		patch.TransactionId = existing.TransactionId
+		s.events[id] = &patch
+		writeJSON(w, http.StatusOK, patch)
+	case http.MethodDelete:
+		delete(s.events, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// calendarView lists the events overlapping the window, pageSize at a time
+// with the rest behind @odata.nextLink.
+func (s *Server) calendarView(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, err := time.Parse(time.RFC3339, query.Get("startDateTime"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "ErrorInvalidParameter")
+		return
+	}
+	to, err := time.Parse(time.RFC3339, query.Get("endDateTime"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "ErrorInvalidParameter")
+		return
+	}
+
+	in := []Event{}
+	for _, e := range s.Events() {
+		start, _ := time.Parse(dateTimeLayout, e.Start.DateTime)
+		end, _ := time.Parse(dateTimeLayout, e.End.DateTime)
+		if start.Before(to) && end.After(from) {
+			in = append(in, e)
+		}
+	}
+
+	s.mu.Lock()
+	pageSize := s.pageSize
+	s.mu.Unlock()
+
+	skip := 0
+	fmt.Sscan(query.Get("$skip"), &skip)
+	if skip > len(in) {
+		skip = len(in)
+	}
+	page := in[skip:]
+
+	res := map[string]any{}
+	if len(page) > pageSize {
+		page = page[:pageSize]
+		next := *r.URL
+		q := next.Query()
+		q.Set("$skip", fmt.Sprint(skip+pageSize))
+		next.RawQuery = q.Encode()
+		res["@odata.nextLink"] = s.URL + next.String()
+	}
+	res["value"] = page
+	writeJSON(w, http.StatusOK, res)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]string{"code": code, "message": code},
+	})
+}
@@ -0,0 +1,117 @@
+package calendarsync
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/genda/genda-api/internal/app"
+	"github.com/go-playground/validator/v10"
+	"github.com/julienschmidt/httprouter"
+)
+
+type handler struct {
+	service Service
+}
+
+func NewHandler(postgresDB *sql.DB) *handler {
+	repository := NewCalendarSyncRepository(postgresDB)
+
+	return &handler{
+		service: newConfiguredService(repository),
+	}
+}
+
+// POST /users/:id/calendar-sync
+func (h *handler) Connect(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	var req ConnectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(req); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.Connect(p.ByName("id"), req)
+	if err != nil {
+		transformError(w, "Failed to connect calendar", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /users/:id/calendar-sync
+func (h *handler) GetConnections(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.GetConnections(p.ByName("id"))
+	if err != nil {
+		transformError(w, "Failed to get calendar connections", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// DELETE /users/:id/calendar-sync/:provider
+func (h *handler) Disconnect(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	if err := h.service.Disconnect(p.ByName("id"), p.ByName("provider")); err != nil {
+		transformError(w, "Failed to disconnect calendar", err.Error())
+		return nil
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// POST /users/:id/calendar-sync/:provider/sync
+func (h *handler) SyncNow(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.SyncNow(ctx, p.ByName("id"), p.ByName("provider"))
+	if err != nil {
+		transformError(w, "Failed to sync calendar", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /users/:id/calendar-busy
+func (h *handler) GetBusyBlocks(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	query := r.URL.Query()
+
+	res, err := h.service.GetBusyBlocks(p.ByName("id"), query.Get("from"), query.Get("to"))
+	if err != nil {
+		transformError(w, "Failed to get calendar busy time", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// transform error for response api
+func transformError(w http.ResponseWriter, m string, e string) {
+	var data = app.ValidateError{
+		Message: m,
+		Error:   e,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,51 @@
+package calendarsync
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrEventNotFound is returned by a provider when the external event is
+// gone, deleted by the user on their side.
+var ErrEventNotFound = errors.New("calendar event not found")
+
+// ErrNotAuthorized is returned by a provider when the user tokens are missing
+// or were revoked and can't be refreshed.
+var ErrNotAuthorized = errors.New("calendar access not authorized")
+
+// Event is an appointment as it is written to the external calendar.
+type Event struct {
+	// TransactionId makes creating the event idempotent, a retried push
+	// doesn't add a second copy.
+	TransactionId string
+	Subject       string
+	Body          string
+	Location      string
+	Start         time.Time
+	End           time.Time
+}
+
+// BusyBlock is time the user is busy on the external calendar.
+type BusyBlock struct {
+	ExternalId string
+	Start      time.Time
+	End        time.Time
+}
+
+// Provider reads and writes a user's external calendar. Implementations
+// get the user's tokens themselves.
+type Provider interface {
+	// Name is the value stored in calendar_connections.provider.
+	Name() string
+	// CreateEvent adds the event and returns its external id.
+	CreateEvent(ctx context.Context, userId string, event Event) (string, error)
+	// UpdateEvent rewrites the event, failing with ErrEventNotFound when it
+	// no longer exists.
+	UpdateEvent(ctx context.Context, userId string, externalId string, event Event) error
+	// DeleteEvent removes the event. Deleting an event that is already gone
+	// is not an error.
+	DeleteEvent(ctx context.Context, userId string, externalId string) error
+	// BusyBlocks lists the time the user is busy between from and to.
+	BusyBlocks(ctx context.Context, userId string, from time.Time, to time.Time) ([]BusyBlock, error)
+}
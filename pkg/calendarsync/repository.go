@@ -0,0 +1,375 @@
+package calendarsync
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// pushBatch bounds how many appointments one sync run pushes per connection,
+// the rest go in the next run.
+const pushBatch = 200
+
+const connectionColumns = `
+			id,
+			user_id,
+			provider,
+			active,
+			last_synced_at,
+			COALESCE(last_error, ''),
+			created_at,
+			updated_at`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+type CalendarSyncRepo struct {
+	postgresDB *sql.DB
+}
+
+func NewCalendarSyncRepository(postgresDB *sql.DB) *CalendarSyncRepo {
+	return &CalendarSyncRepo{postgresDB: postgresDB}
+}
+
+// CreateConnection turns on the sync of the user's calendar at the provider,
+// turning it back on when it was disconnected before.
+func (i *CalendarSyncRepo) CreateConnection(userId string, provider string) (*Connection, error) {
+	const sqlStmt = `
+		INSERT INTO calendar_connections
+			(user_id, provider)
+		VALUES
+			($1,$2)
+		ON CONFLICT (user_id, provider) DO UPDATE
+		SET active = true, last_error = NULL, updated_at = now()
+		RETURNING ` + connectionColumns + `;
+	`
+	connection, err := i.formatConnection(i.postgresDB.QueryRow(sqlStmt, userId, provider))
+	if err != nil {
+		log.Println("An error occurred while creating calendar connection", err)
+		return nil, err
+	}
+	return connection, nil
+}
+
+func (i *CalendarSyncRepo) GetConnections(userId string) ([]Connection, error) {
+	const sqlStmt = `
+		SELECT ` + connectionColumns + `
+		FROM calendar_connections
+		WHERE user_id = $1
+		ORDER BY created_at ASC;
+	`
+	return i.queryConnections(sqlStmt, userId)
+}
+
+func (i *CalendarSyncRepo) GetConnection(userId string, provider string) (*Connection, error) {
+	const sqlStmt = `
+		SELECT ` + connectionColumns + `
+		FROM calendar_connections
+		WHERE user_id = $1 AND provider = $2;
+	`
+	connection, err := i.formatConnection(i.postgresDB.QueryRow(sqlStmt, userId, provider))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("no %s calendar connected", provider)
+		}
+		log.Println("An error occurred while getting calendar connection", err)
+		return nil, err
+	}
+	return connection, nil
+}
+
+func (i *CalendarSyncRepo) GetActiveConnections() ([]Connection, error) {
+	const sqlStmt = `
+		SELECT ` + connectionColumns + `
+		FROM calendar_connections
+		WHERE active
+		ORDER BY last_synced_at ASC NULLS FIRST;
+	`
+	return i.queryConnections(sqlStmt)
+}
+
+func (i *CalendarSyncRepo) queryConnections(sqlStmt string, args ...any) ([]Connection, error) {
+	rows, err := i.postgresDB.Query(sqlStmt, args...)
+	if err != nil {
+		log.Println("An error occurred while getting calendar connections", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	connections := []Connection{}
+	for rows.Next() {
+		connection, err := i.formatConnection(rows)
+		if err != nil {
+			log.Println("An error occurred while scanning calendar connection", err)
+			return nil, err
+		}
+		connections = append(connections, *connection)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting calendar connections", err)
+		return nil, err
+	}
+
+	return connections, nil
+}
+
+// DisableConnection stops syncing the calendar and drops the busy time it
+// imported, so it no longer blocks the user's stores.
+func (i *CalendarSyncRepo) DisableConnection(userId string, provider string) error {
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting calendar disconnection", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	const disableSQL = `
+		UPDATE calendar_connections
+		SET active = false, updated_at = now()
+		WHERE user_id = $1 AND provider = $2
+		RETURNING id
+	`
+	var connectionId string
+	err = tx.QueryRow(disableSQL, userId, provider).Scan(&connectionId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no %s calendar connected", provider)
+	}
+	if err != nil {
+		log.Println("An error occurred while disabling calendar connection", err)
+		return err
+	}
+
+	const blocksSQL = `DELETE FROM calendar_busy_blocks WHERE connection_id = $1`
+	if _, err := tx.Exec(blocksSQL, connectionId); err != nil {
+		log.Println("An error occurred while deleting calendar busy blocks", err)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing calendar disconnection", err)
+		return err
+	}
+	return nil
+}
+
+// GetPendingPushes lists the appointments at the user's stores, ending after
+// since, that are out of date on the connected calendar: confirmed ones never
+// pushed, and pushed ones that changed afterwards.
+func (i *CalendarSyncRepo) GetPendingPushes(connectionId string, userId string, since time.Time) ([]pendingPush, error) {
+	const sqlStmt = `
+		SELECT
+			a.id,
+			a.status,
+			a.start_at,
+			a.end_at,
+			a.updated_at,
+			COALESCE(sv.name, ''),
+			u.name,
+			s.name,
+			COALESCE(a.notes, ''),
+			COALESCE(l.external_id, '')
+		FROM store_appointments a
+		JOIN stores s ON s.id = a.store_id
+		JOIN users u ON u.id = a.user_id
+		LEFT JOIN store_services sv ON sv.id = a.service_id
+		LEFT JOIN calendar_event_links l ON l.appointment_id = a.id AND l.connection_id = $1
+		WHERE s.owner_id = $2
+			AND a.end_at >= $3
+			AND (
+				(l.appointment_id IS NULL AND a.status IN ('confirmed','completed'))
+				OR (l.appointment_id IS NOT NULL AND NOT l.deleted AND a.updated_at > l.appointment_updated_at)
+			)
+		ORDER BY a.updated_at ASC
+		LIMIT $4;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, connectionId, userId, since, pushBatch)
+	if err != nil {
+		log.Println("An error occurred while getting pending calendar pushes", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	pushes := []pendingPush{}
+	for rows.Next() {
+		var p pendingPush
+		err := rows.Scan(
+			&p.AppointmentId,
+			&p.Status,
+			&p.StartAt,
+			&p.EndAt,
+			&p.UpdatedAt,
+			&p.ServiceName,
+			&p.CustomerName,
+			&p.StoreName,
+			&p.Notes,
+			&p.ExternalId,
+		)
+		if err != nil {
+			log.Println("An error occurred while scanning pending calendar push", err)
+			return nil, err
+		}
+		pushes = append(pushes, p)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting pending calendar pushes", err)
+		return nil, err
+	}
+
+	return pushes, nil
+}
+
+// SaveEventLink records the external event an appointment was pushed as, at
+// the appointment version that was pushed.
+func (i *CalendarSyncRepo) SaveEventLink(connectionId string, appointmentId string, externalId string, version time.Time, deleted bool) error {
+	const sqlStmt = `
+		INSERT INTO calendar_event_links
+			(connection_id, appointment_id, external_id, deleted, appointment_updated_at)
+		VALUES
+			($1,$2,$3,$4,$5)
+		ON CONFLICT (connection_id, appointment_id) DO UPDATE
+		SET external_id = EXCLUDED.external_id,
+			deleted = EXCLUDED.deleted,
+			appointment_updated_at = EXCLUDED.appointment_updated_at,
+			synced_at = now()
+	`
+	if _, err := i.postgresDB.Exec(sqlStmt, connectionId, appointmentId, externalId, deleted, version); err != nil {
+		log.Println("An error occurred while saving calendar event link", err)
+		return err
+	}
+	return nil
+}
+
+// ReplaceBusyBlocks makes the busy time stored for the connection between
+// from and to match blocks. The events pushed from appointments come back
+// from the calendar too, they are left out since the appointments already
+// take that time.
+func (i *CalendarSyncRepo) ReplaceBusyBlocks(connectionId string, userId string, from time.Time, to time.Time, blocks []BusyBlock) (int, error) {
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting calendar busy import", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	const deleteSQL = `
+		DELETE FROM calendar_busy_blocks
+		WHERE connection_id = $1
+			AND start_at < $3
+			AND end_at > $2
+	`
+	if _, err := tx.Exec(deleteSQL, connectionId, from, to); err != nil {
+		log.Println("An error occurred while clearing calendar busy blocks", err)
+		return 0, err
+	}
+
+	const insertSQL = `
+		INSERT INTO calendar_busy_blocks
+			(connection_id, user_id, external_id, start_at, end_at)
+		SELECT $1, $2, $3, $4, $5
+		WHERE NOT EXISTS (
+			SELECT 1 FROM calendar_event_links l
+			WHERE l.connection_id = $1 AND l.external_id = $3
+		)
+		ON CONFLICT (connection_id, external_id) DO UPDATE
+		SET start_at = EXCLUDED.start_at,
+			end_at = EXCLUDED.end_at,
+			updated_at = now()
+	`
+	imported := 0
+	for _, block := range blocks {
+		if !block.End.After(block.Start) {
+			continue
+		}
+		res, err := tx.Exec(insertSQL, connectionId, userId, block.ExternalId, block.Start, block.End)
+		if err != nil {
+			log.Println("An error occurred while importing calendar busy block", err)
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			imported++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing calendar busy import", err)
+		return 0, err
+	}
+	return imported, nil
+}
+
+// MarkSynced records the end of a sync run, with the error it ended on.
+func (i *CalendarSyncRepo) MarkSynced(connectionId string, syncErr string) error {
+	const sqlStmt = `
+		UPDATE calendar_connections
+		SET last_synced_at = now(), last_error = NULLIF($2,''), updated_at = now()
+		WHERE id = $1
+	`
+	if _, err := i.postgresDB.Exec(sqlStmt, connectionId, syncErr); err != nil {
+		log.Println("An error occurred while marking calendar connection synced", err)
+		return err
+	}
+	return nil
+}
+
+func (i *CalendarSyncRepo) GetBusyBlocks(userId string, from time.Time, to time.Time) ([]ImportedBusyBlock, error) {
+	const sqlStmt = `
+		SELECT b.id, c.provider, b.external_id, b.start_at, b.end_at
+		FROM calendar_busy_blocks b
+		JOIN calendar_connections c ON c.id = b.connection_id
+		WHERE b.user_id = $1
+			AND c.active
+			AND b.start_at < $3
+			AND b.end_at > $2
+		ORDER BY b.start_at ASC;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, userId, from, to)
+	if err != nil {
+		log.Println("An error occurred while getting calendar busy blocks", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocks := []ImportedBusyBlock{}
+	for rows.Next() {
+		var b ImportedBusyBlock
+		var start, end time.Time
+		if err := rows.Scan(&b.Id, &b.Provider, &b.ExternalId, &start, &end); err != nil {
+			log.Println("An error occurred while scanning calendar busy block", err)
+			return nil, err
+		}
+		b.StartAt = start.UTC().Format(time.RFC3339)
+		b.EndAt = end.UTC().Format(time.RFC3339)
+		blocks = append(blocks, b)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting calendar busy blocks", err)
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+func (i *CalendarSyncRepo) formatConnection(row rowScanner) (*Connection, error) {
+	c := Connection{}
+
+	var lastSyncedAt sql.NullString
+	err := row.Scan(
+		&c.Id,
+		&c.UserId,
+		&c.Provider,
+		&c.Active,
+		&lastSyncedAt,
+		&c.LastError,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	c.LastSyncedAt = lastSyncedAt.String
+	return &c, nil
+}
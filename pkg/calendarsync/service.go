@@ -0,0 +1,234 @@
+package calendarsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// importWindow is how far ahead busy time is imported, bookings further out
+// are checked against it on a later sync.
+const importWindow = 60 * 24 * time.Hour
+
+// pushLookback is how far back appointments are still pushed, so ones that
+// ended while the sync was failing make it to the calendar.
+const pushLookback = 7 * 24 * time.Hour
+
+type Service interface {
+	Connect(string, ConnectRequest) (*Connection, error)
+	GetConnections(string) ([]Connection, error)
+	Disconnect(string, string) error
+	SyncNow(context.Context, string, string) (*SyncResult, error)
+	SyncConnection(context.Context, Connection) (*SyncResult, error)
+	GetBusyBlocks(string, string, string) ([]ImportedBusyBlock, error)
+}
+
+type Repository interface {
+	CreateConnection(string, string) (*Connection, error)
+	GetConnections(string) ([]Connection, error)
+	GetConnection(string, string) (*Connection, error)
+	GetActiveConnections() ([]Connection, error)
+	DisableConnection(string, string) error
+	GetPendingPushes(string, string, time.Time) ([]pendingPush, error)
+	SaveEventLink(string, string, string, time.Time, bool) error
+	ReplaceBusyBlocks(string, string, time.Time, time.Time, []BusyBlock) (int, error)
+	MarkSynced(string, string) error
+	GetBusyBlocks(string, time.Time, time.Time) ([]ImportedBusyBlock, error)
+}
+
+type service struct {
+	repository Repository
+	providers  map[string]Provider
+}
+
+func NewService(r Repository, providers ...Provider) Service {
+	byName := map[string]Provider{}
+	for _, p := range providers {
+		byName[p.Name()] = p
+	}
+	return &service{repository: r, providers: byName}
+}
+
+func (s *service) Connect(userId string, req ConnectRequest) (*Connection, error) {
+	if _, ok := s.providers[req.Provider]; !ok {
+		return nil, fmt.Errorf("calendar provider %s is not available", req.Provider)
+	}
+	return s.repository.CreateConnection(userId, req.Provider)
+}
+
+func (s *service) GetConnections(userId string) ([]Connection, error) {
+	return s.repository.GetConnections(userId)
+}
+
+func (s *service) Disconnect(userId string, provider string) error {
+	return s.repository.DisableConnection(userId, provider)
+}
+
+func (s *service) SyncNow(ctx context.Context, userId string, provider string) (*SyncResult, error) {
+	connection, err := s.repository.GetConnection(userId, provider)
+	if err != nil {
+		return nil, err
+	}
+	if !connection.Active {
+		return nil, fmt.Errorf("the %s calendar is disconnected", provider)
+	}
+	return s.SyncConnection(ctx, *connection)
+}
+
+// SyncConnection pushes the appointments that changed since the last run to
+// the external calendar, then imports its busy time. How the run ended is
+// recorded on the connection.
+func (s *service) SyncConnection(ctx context.Context, connection Connection) (*SyncResult, error) {
+	provider, ok := s.providers[connection.Provider]
+	if !ok {
+		return nil, fmt.Errorf("calendar provider %s is not available", connection.Provider)
+	}
+
+	result := &SyncResult{}
+	err := s.push(ctx, provider, connection, result)
+	if err == nil {
+		err = s.importBusy(ctx, provider, connection, result)
+	}
+
+	syncErr := ""
+	if errors.Is(err, ErrNotAuthorized) {
+		syncErr = "calendar access was revoked, connect the calendar again"
+	} else if err != nil {
+		syncErr = err.Error()
+	}
+	if markErr := s.repository.MarkSynced(connection.Id, syncErr); markErr != nil && err == nil {
+		err = markErr
+	}
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+func (s *service) push(ctx context.Context, provider Provider, connection Connection, result *SyncResult) error {
+	since := time.Now().UTC().Add(-pushLookback)
+	pushes, err := s.repository.GetPendingPushes(connection.Id, connection.UserId, since)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pushes {
+		if p.Status == "canceled" || p.Status == "no_show" {
+			if err := provider.DeleteEvent(ctx, connection.UserId, p.ExternalId); err != nil {
+				return err
+			}
+			if err := s.repository.SaveEventLink(connection.Id, p.AppointmentId, p.ExternalId, p.UpdatedAt, true); err != nil {
+				return err
+			}
+			result.Deleted++
+			continue
+		}
+
+		event := appointmentEvent(p)
+		externalId := p.ExternalId
+		if externalId != "" {
+			err = provider.UpdateEvent(ctx, connection.UserId, externalId, event)
+			if errors.Is(err, ErrEventNotFound) {
+				// Deleted on the calendar side, the appointment still holds
+				// the time so it is written again.
+				externalId = ""
+			} else if err != nil {
+				return err
+			}
+		}
+		if externalId == "" {
+			if externalId, err = provider.CreateEvent(ctx, connection.UserId, event); err != nil {
+				return err
+			}
+		}
+
+		if err := s.repository.SaveEventLink(connection.Id, p.AppointmentId, externalId, p.UpdatedAt, false); err != nil {
+			return err
+		}
+		result.Pushed++
+	}
+	return nil
+}
+
+func (s *service) importBusy(ctx context.Context, provider Provider, connection Connection, result *SyncResult) error {
+	from := time.Now().UTC().Truncate(time.Minute)
+	to := from.Add(importWindow)
+
+	blocks, err := provider.BusyBlocks(ctx, connection.UserId, from, to)
+	if err != nil {
+		return err
+	}
+	imported, err := s.repository.ReplaceBusyBlocks(connection.Id, connection.UserId, from, to, blocks)
+	if err != nil {
+		return err
+	}
+	result.Imported = imported
+	return nil
+}
+
+func (s *service) GetBusyBlocks(userId string, from string, to string) ([]ImportedBusyBlock, error) {
+	start := time.Now().UTC()
+	if from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from, expected RFC3339")
+		}
+		start = t
+	}
+	end := start.Add(7 * 24 * time.Hour)
+	if to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to, expected RFC3339")
+		}
+		end = t
+	}
+	if !end.After(start) {
+		return nil, fmt.Errorf("to must be after from")
+	}
+	if end.Sub(start) > importWindow {
+		return nil, fmt.Errorf("the range can't be longer than %d days", int(importWindow.Hours()/24))
+	}
+	return s.repository.GetBusyBlocks(userId, start, end)
+}
+
+// appointmentEvent is how an appointment reads on the owner's calendar.
+func appointmentEvent(p pendingPush) Event {
+	subject := p.CustomerName
+	if p.ServiceName != "" {
+		subject = p.ServiceName + " - " + p.CustomerName
+	}
+	return Event{
+		TransactionId: p.AppointmentId,
+		Subject:       subject,
+		Body:          p.Notes,
+		Location:      p.StoreName,
+		Start:         p.StartAt,
+		End:           p.EndAt,
+	}
+}
+
+// syncAll runs a sync on every active connection, a failing one doesn't stop
+// the others.
+func syncAll(ctx context.Context, s Service, r Repository, logger *log.Logger) {
+	connections, err := r.GetActiveConnections()
+	if err != nil {
+		logger.Printf("calendar sync: %v", err)
+		return
+	}
+	for _, connection := range connections {
+		if ctx.Err() != nil {
+			return
+		}
+		result, err := s.SyncConnection(ctx, connection)
+		if err != nil {
+			logger.Printf("calendar sync: connection %s: %v", connection.Id, err)
+			continue
+		}
+		if result.Pushed+result.Deleted+result.Imported > 0 {
+			logger.Printf("calendar sync: connection %s pushed %d, deleted %d, imported %d", connection.Id, result.Pushed, result.Deleted, result.Imported)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package calendarsync
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+)
+
+type memoryLink struct {
+	ExternalId string
+	UpdatedAt  time.Time
+	Deleted    bool
+}
+
+// memoryRepository keeps one connection's appointments, event links and busy
+// blocks, picking the pending pushes and skipping our own events on import
+// the way the SQL does.
+type memoryRepository struct {
+	appointments map[string]*pendingPush
+	links        map[string]memoryLink
+	busy         map[string]BusyBlock
+	lastError    string
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{
+		appointments: map[string]*pendingPush{},
+		links:        map[string]memoryLink{},
+		busy:         map[string]BusyBlock{},
+	}
+}
+
+// save adds or changes an appointment, as the stores would.
+func (r *memoryRepository) save(id string, status string, start time.Time) {
+	r.appointments[id] = &pendingPush{
+		AppointmentId: id,
+		Status:        status,
+		StartAt:       start,
+		EndAt:         start.Add(time.Hour),
+		UpdatedAt:     time.Now(),
+		ServiceName:   "Haircut",
+		CustomerName:  "Ana",
+		StoreName:     "Store",
+	}
+}
+
+func (r *memoryRepository) CreateConnection(string, string) (*Connection, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *memoryRepository) GetConnections(string) ([]Connection, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *memoryRepository) GetConnection(string, string) (*Connection, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *memoryRepository) GetActiveConnections() ([]Connection, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *memoryRepository) DisableConnection(string, string) error {
+	return errors.New("not implemented")
+}
+
+func (r *memoryRepository) GetPendingPushes(connectionId string, userId string, since time.Time) ([]pendingPush, error) {
+	pushes := []pendingPush{}
+	for _, a := range r.appointments {
+		if a.EndAt.Before(since) {
+			continue
+		}
+		link, linked := r.links[a.AppointmentId]
+		switch {
+		case !linked && (a.Status == "confirmed" || a.Status == "completed"):
+		case linked && !link.Deleted && a.UpdatedAt.After(link.UpdatedAt):
+		default:
+			continue
+		}
+		p := *a
+		p.ExternalId = link.ExternalId
+		pushes = append(pushes, p)
+	}
+	sort.Slice(pushes, func(i, j int) bool { return pushes[i].UpdatedAt.Before(pushes[j].UpdatedAt) })
+	return pushes, nil
+}
+
+func (r *memoryRepository) SaveEventLink(connectionId string, appointmentId string, externalId string, updatedAt time.Time, deleted bool) error {
+	r.links[appointmentId] = memoryLink{ExternalId: externalId, UpdatedAt: updatedAt, Deleted: deleted}
+	return nil
+}
+
+func (r *memoryRepository) ReplaceBusyBlocks(connectionId string, userId string, from time.Time, to time.Time, blocks []BusyBlock) (int, error) {
+	ours := map[string]bool{}
+	for _, link := range r.links {
+		ours[link.ExternalId] = true
+	}
+	for id, b := range r.busy {
+		if b.Start.Before(to) && b.End.After(from) {
+			delete(r.busy, id)
+		}
+	}
+	imported := 0
+	for _, b := range blocks {
+		if !b.End.After(b.Start) || ours[b.ExternalId] {
+			continue
+		}
+		r.busy[b.ExternalId] = b
+		imported++
+	}
+	return imported, nil
+}
+
+func (r *memoryRepository) MarkSynced(connectionId string, syncErr string) error {
+	r.lastError = syncErr
+	return nil
+}
+
+func (r *memoryRepository) GetBusyBlocks(string, time.Time, time.Time) ([]ImportedBusyBlock, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestSyncConnection(t *testing.T) {
+	ctx := context.Background()
+	server, provider, _ := newGraphTest(t)
+	repo := newMemoryRepository()
+	s := NewService(repo, provider)
+	connection := Connection{Id: "connection-1", UserId: testUser, Provider: ProviderMicrosoft, Active: true}
+
+	start := time.Now().UTC().Add(24 * time.Hour).Truncate(time.Hour)
+	repo.save("a1", "confirmed", start)
+	repo.save("a2", "confirmed", start.Add(2*time.Hour))
+	repo.save("a3", "pending", start.Add(4*time.Hour))
+
+	sync := func(want SyncResult) {
+		t.Helper()
+		got, err := s.SyncConnection(ctx, connection)
+		if err != nil {
+			t.Fatalf("SyncConnection: %v", err)
+		}
+		if *got != want {
+			t.Errorf("SyncConnection did %+v, want %+v", *got, want)
+		}
+		if repo.lastError != "" {
+			t.Errorf("sync recorded error %q", repo.lastError)
+		}
+	}
+	subjects := func() map[string]string {
+		bySubject := map[string]string{}
+		for _, e := range server.Events() {
+			bySubject[e.Start.DateTime] = e.Subject
+		}
+		return bySubject
+	}
+
+	// Confirmed appointments are created, the pending hold is left out.
+	sync(SyncResult{Pushed: 2})
+	if n := len(server.Events()); n != 2 {
+		t.Fatalf("calendar has %d events, want 2", n)
+	}
+
+	// Nothing changed, nothing is pushed.
+	sync(SyncResult{})
+
+	// A moved appointment updates its event in place.
+	time.Sleep(time.Millisecond)
+	repo.save("a1", "confirmed", start.Add(6*time.Hour))
+	sync(SyncResult{Pushed: 1})
+	events := subjects()
+	if len(events) != 2 || events[start.Add(6*time.Hour).Format(graphDateTimeLayout)] != "Haircut - Ana" {
+		t.Errorf("after the move the calendar has %v", events)
+	}
+
+	// An event deleted in Outlook is written again on the next change.
+	server.DeleteEvent(repo.links["a2"].ExternalId)
+	time.Sleep(time.Millisecond)
+	repo.appointments["a2"].UpdatedAt = time.Now()
+	sync(SyncResult{Pushed: 1})
+	if n := len(server.Events()); n != 2 {
+		t.Errorf("calendar has %d events after re-creating, want 2", n)
+	}
+	if repo.links["a2"].ExternalId == "" {
+		t.Error("a2 has no event link after re-creating")
+	}
+
+	// Busy time the user added is imported, our own events are not.
+	busyId := server.AddBusy("dentist", start.Add(8*time.Hour), start.Add(9*time.Hour), "busy")
+	sync(SyncResult{Imported: 1})
+	if len(repo.busy) != 1 || repo.busy[busyId].ExternalId != busyId {
+		t.Errorf("imported busy blocks are %+v, want only %s", repo.busy, busyId)
+	}
+
+	// A canceled appointment deletes its event.
+	time.Sleep(time.Millisecond)
+	repo.save("a1", "canceled", start.Add(6*time.Hour))
+	sync(SyncResult{Deleted: 1, Imported: 1})
+	if n := len(server.Events()); n != 2 {
+		t.Errorf("calendar has %d events after the cancel, want 2 with the dentist", n)
+	}
+	if !repo.links["a1"].Deleted {
+		t.Error("a1 link is not marked deleted")
+	}
+}
+
+func TestSyncConnectionRevokedToken(t *testing.T) {
+	ctx := context.Background()
+	server, provider, tokens := newGraphTest(t)
+	repo := newMemoryRepository()
+	s := NewService(repo, provider)
+	connection := Connection{Id: "connection-1", UserId: testUser, Provider: ProviderMicrosoft, Active: true}
+
+	server.ExpireAccessToken()
+	tokens.SaveTokens(ctx, testUser, Tokens{AccessToken: "access-0", RefreshToken: "revoked"})
+	repo.save("a1", "confirmed", time.Now().Add(time.Hour))
+
+	_, err := s.SyncConnection(ctx, connection)
+	if !errors.Is(err, ErrNotAuthorized) {
+		t.Fatalf("got %v, want ErrNotAuthorized", err)
+	}
+	if repo.lastError != "calendar access was revoked, connect the calendar again" {
+		t.Errorf("recorded error %q", repo.lastError)
+	}
+	if _, linked := repo.links["a1"]; linked {
+		t.Error("a1 was linked to an event that wasn't created")
+	}
+}
@@ -0,0 +1,138 @@
+package calendarsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/genda/genda-api/internal/middlewares"
+	"github.com/genda/genda-api/pkg/config"
+)
+
+// Tokens are the OAuth tokens a provider calls the calendar API with.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// TokenStore keeps the calendar tokens of each user.
+type TokenStore interface {
+	Tokens(ctx context.Context, userId string) (*Tokens, error)
+	SaveTokens(ctx context.Context, userId string, tokens Tokens) error
+}
+
+// secretsTokenStore reads the calendar tokens from the same secret that holds
+// the user's Keycloak tokens, leaving those untouched.
+type secretsTokenStore struct {
+	conf *config.Conf
+}
+
+func NewSecretsTokenStore(conf *config.Conf) TokenStore {
+	return &secretsTokenStore{conf: conf}
+}
+
+func (s *secretsTokenStore) client(ctx context.Context) (*secretsmanager.Client, error) {
+	awsCfg, err := awsConfig.LoadDefaultConfig(ctx,
+		awsConfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(s.conf.AwsAccessKeyId, s.conf.AwsSecretAccessKey, ""),
+		),
+		awsConfig.WithRegion("us-east-1"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("aws config: %w", err)
+	}
+	return secretsmanager.NewFromConfig(awsCfg), nil
+}
+
+func (s *secretsTokenStore) secrets(ctx context.Context, sm *secretsmanager.Client, userId string) (*middlewares.UserTokenSecrets, error) {
+	out, err := sm.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(secretName(userId))})
+	if err != nil {
+		return nil, fmt.Errorf("get secret: %w", err)
+	}
+
+	var secrets middlewares.UserTokenSecrets
+	if err := json.Unmarshal([]byte(aws.ToString(out.SecretString)), &secrets); err != nil {
+		return nil, fmt.Errorf("unmarshal secret: %w", err)
+	}
+	return &secrets, nil
+}
+
+func (s *secretsTokenStore) Tokens(ctx context.Context, userId string) (*Tokens, error) {
+	sm, err := s.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := s.secrets(ctx, sm, userId)
+	if err != nil {
+		return nil, err
+	}
+	if secrets.CalendarToken == "" && secrets.CalendarRefreshToken == "" {
+		return nil, ErrNotAuthorized
+	}
+	return &Tokens{AccessToken: secrets.CalendarToken, RefreshToken: secrets.CalendarRefreshToken}, nil
+}
+
+func (s *secretsTokenStore) SaveTokens(ctx context.Context, userId string, tokens Tokens) error {
+	sm, err := s.client(ctx)
+	if err != nil {
+		return err
+	}
+	secrets, err := s.secrets(ctx, sm, userId)
+	if err != nil {
+		return err
+	}
+	secrets.CalendarToken = tokens.AccessToken
+	secrets.CalendarRefreshToken = tokens.RefreshToken
+
+	updated, err := json.Marshal(secrets)
+	if err != nil {
+		return fmt.Errorf("marshal secret: %w", err)
+	}
+	_, err = sm.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(secretName(userId)),
+		SecretString: aws.String(string(updated)),
+	})
+	if err != nil {
+		return fmt.Errorf("put secret: %w", err)
+	}
+	return nil
+}
+
+func secretName(userId string) string {
+	return "calender/tokens/" + userId
+}
+
+// MemoryTokenStore keeps the tokens in memory, for running the provider
+// against the graphfake server.
+type MemoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]Tokens
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: map[string]Tokens{}}
+}
+
+func (s *MemoryTokenStore) Tokens(ctx context.Context, userId string) (*Tokens, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens, ok := s.tokens[userId]
+	if !ok {
+		return nil, ErrNotAuthorized
+	}
+	return &tokens, nil
+}
+
+func (s *MemoryTokenStore) SaveTokens(ctx context.Context, userId string, tokens Tokens) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[userId] = tokens
+	return nil
+}
@@ -0,0 +1,52 @@
+package calendarsync
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/genda/genda-api/pkg/config"
+)
+
+// Worker keeps the connected calendars in sync, one run over every active
+// connection per interval.
+type Worker struct {
+	repository Repository
+	service    Service
+	interval   time.Duration
+	log        *log.Logger
+}
+
+func NewWorker(postgresDB *sql.DB, interval time.Duration, log *log.Logger) *Worker {
+	repository := NewCalendarSyncRepository(postgresDB)
+	return &Worker{
+		repository: repository,
+		service:    newConfiguredService(repository),
+		interval:   interval,
+		log:        log,
+	}
+}
+
+// Run syncs once per interval until the context is canceled.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			syncAll(ctx, w.service, w.repository, w.log)
+		}
+	}
+}
+
+// newConfiguredService builds the service with the providers the
+// configuration enables.
+func newConfiguredService(r Repository) Service {
+	conf := config.New()
+	tokens := NewSecretsTokenStore(conf)
+	return NewService(r, NewGraphProvider(GraphConfigFrom(conf), tokens))
+}
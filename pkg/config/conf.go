@@ -16,6 +16,19 @@ const (
 	RedisDefaultDb         = "0"
 	AwsAccessKeyId         = "a"
 	AwsSecretAccessKey     = "b"
+	DefaultHoldTTL         = "10m"
+	DefaultHoldSweep       = "1m"
+	DefaultOfferTTL        = "30m"
+	DefaultCalendarSync    = "5m"
+	DefaultSourceRefresh   = "15m"
+	DefaultNotificationRun = "30s"
+	DefaultSmtpPort        = "587"
+	DefaultSmsApiUrl       = "https://api.twilio.com/2010-04-01"
+	DefaultGraphUrl        = "https://graph.microsoft.com/v1.0"
+	DefaultMicrosoftLogin  = "https://login.microsoftonline.com"
+	DefaultPaymentProvider = "fake"
+	DefaultWebhookRun      = "10s"
+	DefaultRefundRun       = "1m"
 )
 
 type RedisConf struct {
@@ -41,12 +54,35 @@ type Conf struct {
 	MicrosoftAppId           string
 	MicrosoftAppSecret       string
 	MicrosoftTenantId        string
+	MicrosoftGraphUrl        string
+	MicrosoftLoginUrl        string
 	PostgresHost             string
 	PostgresPort             string
 	PostgresUser             string
 	PostgresPassword         string
 	PostgresDatabase         string
 	PostgresSsl              string
+	AppointmentHoldTTL       string
+	AppointmentHoldSweep     string
+	WaitlistOfferTTL         string
+	CalendarSyncInterval     string
+	CalendarSourceRefresh    string
+	NotificationInterval     string
+	SmtpHost                 string
+	SmtpPort                 string
+	SmtpUser                 string
+	SmtpPassword             string
+	SmtpFrom                 string
+	SmsApiUrl                string
+	SmsAccountSid            string
+	SmsAuthToken             string
+	SmsFrom                  string
+	PushGatewayUrl           string
+	PushGatewayToken         string
+	PaymentProvider          string
+	PaymentWebhookSecret     string
+	PaymentWebhookInterval   string
+	PaymentRefundInterval    string
 }
 
 func New() *Conf {
@@ -73,12 +109,35 @@ func New() *Conf {
 		MicrosoftAppId:           getEnv("MICROSOFT_APP_ID", ""),
 		MicrosoftAppSecret:       getEnv("MICROSOFT_CLIENT_SECRET", ""),
 		MicrosoftTenantId:        getEnv("MICROSOFT_TENANT_ID", ""),
+		MicrosoftGraphUrl:        getEnv("MICROSOFT_GRAPH_URL", DefaultGraphUrl),
+		MicrosoftLoginUrl:        getEnv("MICROSOFT_LOGIN_URL", DefaultMicrosoftLogin),
 		PostgresHost:             getEnv("POSTGRES_HOST", ""),
 		PostgresPort:             getEnv("POSTGRES_PORT", ""),
 		PostgresUser:             getEnv("POSTGRES_USER", ""),
 		PostgresPassword:         getEnv("POSTGRES_PASSWORD", ""),
 		PostgresDatabase:         getEnv("POSTGRES_DATABASE", ""),
 		PostgresSsl:              getEnv("POSTGRES_SSL", ""),
+		AppointmentHoldTTL:       getEnv("APPOINTMENT_HOLD_TTL", DefaultHoldTTL),
+		AppointmentHoldSweep:     getEnv("APPOINTMENT_HOLD_SWEEP_INTERVAL", DefaultHoldSweep),
+		WaitlistOfferTTL:         getEnv("WAITLIST_OFFER_TTL", DefaultOfferTTL),
+		CalendarSyncInterval:     getEnv("CALENDAR_SYNC_INTERVAL", DefaultCalendarSync),
+		CalendarSourceRefresh:    getEnv("CALENDAR_SOURCE_REFRESH_INTERVAL", DefaultSourceRefresh),
+		NotificationInterval:     getEnv("NOTIFICATION_INTERVAL", DefaultNotificationRun),
+		SmtpHost:                 getEnv("SMTP_HOST", ""),
+		SmtpPort:                 getEnv("SMTP_PORT", DefaultSmtpPort),
+		SmtpUser:                 getEnv("SMTP_USER", ""),
+		SmtpPassword:             getEnv("SMTP_PASSWORD", ""),
+		SmtpFrom:                 getEnv("SMTP_FROM", ""),
+		SmsApiUrl:                getEnv("SMS_API_URL", DefaultSmsApiUrl),
+		SmsAccountSid:            getEnv("SMS_ACCOUNT_SID", ""),
+		SmsAuthToken:             getEnv("SMS_AUTH_TOKEN", ""),
+		SmsFrom:                  getEnv("SMS_FROM", ""),
+		PushGatewayUrl:           getEnv("PUSH_GATEWAY_URL", ""),
+		PushGatewayToken:         getEnv("PUSH_GATEWAY_TOKEN", ""),
+		PaymentProvider:          getEnv("PAYMENT_PROVIDER", DefaultPaymentProvider),
+		PaymentWebhookSecret:     getEnv("PAYMENT_WEBHOOK_SECRET", ""),
+		PaymentWebhookInterval:   getEnv("PAYMENT_WEBHOOK_INTERVAL", DefaultWebhookRun),
+		PaymentRefundInterval:    getEnv("PAYMENT_REFUND_INTERVAL", DefaultRefundRun),
 	}
 
 	return &conf
@@ -0,0 +1,341 @@
+// Package holidays computes the Brazilian holiday calendar for any year.
+//
+// National holidays are always included. The movable ones are derived from
+// Easter Sunday: Carnaval (47 and 48 days before), Good Friday and Corpus
+// Christi (60 days after). State and municipal sets are added on request,
+// keyed by the state abbreviation (UF) and the city name.
+package holidays
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const DateLayout = "2006-01-02"
+
+const (
+	ScopeNational  = "national"
+	ScopeState     = "state"
+	ScopeMunicipal = "municipal"
+)
+
+// Holiday is a single holiday date. Optional marks a "ponto facultativo",
+// which most businesses still close for, such as Carnaval.
+type Holiday struct {
+	Date     string `json:"date"`
+	Name     string `json:"name"`
+	Scope    string `json:"scope"`
+	Optional bool   `json:"optional"`
+}
+
+// rule describes a holiday: either a fixed month and day, or an offset in
+// days from Easter Sunday when movable is set.
+type rule struct {
+	name     string
+	month    time.Month
+	day      int
+	movable  bool
+	easter   int
+	since    int
+	optional bool
+}
+
+var national = []rule{
+	{name: "Confraternização Universal", month: time.January, day: 1},
+	{name: "Carnaval", movable: true, easter: -48, optional: true},
+	{name: "Carnaval", movable: true, easter: -47, optional: true},
+	{name: "Sexta-feira Santa", movable: true, easter: -2},
+	{name: "Tiradentes", month: time.April, day: 21},
+	{name: "Dia do Trabalho", month: time.May, day: 1},
+	{name: "Corpus Christi", movable: true, easter: 60, optional: true},
+	{name: "Independência do Brasil", month: time.September, day: 7},
+	{name: "Nossa Senhora Aparecida", month: time.October, day: 12, since: 1980},
+	{name: "Finados", month: time.November, day: 2},
+	{name: "Proclamação da República", month: time.November, day: 15},
+	{name: "Dia Nacional de Zumbi e da Consciência Negra", month: time.November, day: 20, since: 2024},
+	{name: "Natal", month: time.December, day: 25},
+}
+
+// states holds the state holidays by UF. States without holidays of their
+// own are listed so they are still accepted.
+var states = map[string][]rule{
+	"AC": {
+		{name: "Dia do Evangélico", month: time.January, day: 23},
+		{name: "Aniversário do Acre", month: time.June, day: 15},
+		{name: "Dia da Amazônia", month: time.September, day: 5},
+		{name: "Assinatura do Tratado de Petrópolis", month: time.November, day: 17},
+	},
+	"AL": {
+		{name: "São João", month: time.June, day: 24},
+		{name: "São Pedro", month: time.June, day: 29},
+		{name: "Emancipação Política de Alagoas", month: time.September, day: 16},
+	},
+	"AM": {
+		{name: "Elevação do Amazonas à Categoria de Província", month: time.September, day: 5},
+	},
+	"AP": {
+		{name: "São José", month: time.March, day: 19},
+		{name: "Criação do Estado do Amapá", month: time.October, day: 5},
+	},
+	"BA": {
+		{name: "Independência da Bahia", month: time.July, day: 2},
+	},
+	"CE": {
+		{name: "São José", month: time.March, day: 19},
+		{name: "Data Magna do Ceará", month: time.March, day: 25},
+	},
+	"DF": {
+		{name: "Dia do Evangélico", month: time.November, day: 30},
+	},
+	"ES": {},
+	"GO": {},
+	"MA": {
+		{name: "Adesão do Maranhão à Independência", month: time.July, day: 28},
+	},
+	"MG": {},
+	"MS": {
+		{name: "Criação do Estado de Mato Grosso do Sul", month: time.October, day: 11},
+	},
+	"MT": {},
+	"PA": {
+		{name: "Adesão do Pará à Independência", month: time.August, day: 15},
+	},
+	"PB": {
+		{name: "Fundação do Estado da Paraíba", month: time.August, day: 5},
+	},
+	"PE": {
+		{name: "Revolução Pernambucana", month: time.March, day: 6},
+	},
+	"PI": {
+		{name: "Dia do Piauí", month: time.October, day: 19},
+	},
+	"PR": {
+		{name: "Emancipação Política do Paraná", month: time.December, day: 19},
+	},
+	"RJ": {
+		{name: "São Jorge", month: time.April, day: 23},
+	},
+	"RN": {
+		{name: "Mártires de Cunhaú e Uruaçu", month: time.October, day: 3},
+	},
+	"RO": {
+		{name: "Criação do Estado de Rondônia", month: time.January, day: 4},
+		{name: "Dia do Evangélico", month: time.June, day: 18},
+	},
+	"RR": {
+		{name: "Criação do Estado de Roraima", month: time.October, day: 5},
+	},
+	"RS": {
+		{name: "Revolução Farroupilha", month: time.September, day: 20},
+	},
+	"SC": {},
+	"SE": {
+		{name: "Emancipação Política de Sergipe", month: time.July, day: 8},
+	},
+	"SP": {
+		{name: "Revolução Constitucionalista", month: time.July, day: 9},
+	},
+	"TO": {
+		{name: "Autonomia do Tocantins", month: time.March, day: 18},
+		{name: "Nossa Senhora da Natividade", month: time.September, day: 8},
+		{name: "Criação do Estado do Tocantins", month: time.October, day: 5},
+	},
+}
+
+// municipalities holds the holidays of the cities we have stores in, keyed by
+// "UF/city" with the city as returned by cityKey.
+var municipalities = map[string][]rule{
+	"SP/sao paulo": {
+		{name: "Aniversário de São Paulo", month: time.January, day: 25},
+	},
+	"RJ/rio de janeiro": {
+		{name: "São Sebastião", month: time.January, day: 20},
+	},
+	"MG/belo horizonte": {
+		{name: "Assunção de Nossa Senhora", month: time.August, day: 15},
+		{name: "Imaculada Conceição", month: time.December, day: 8},
+	},
+	"BA/salvador": {
+		{name: "São João", month: time.June, day: 24},
+		{name: "Nossa Senhora da Conceição da Praia", month: time.December, day: 8},
+	},
+	"PE/recife": {
+		{name: "São João", month: time.June, day: 24},
+		{name: "Nossa Senhora do Carmo", month: time.July, day: 16},
+		{name: "Nossa Senhora da Conceição", month: time.December, day: 8},
+	},
+	"CE/fortaleza": {
+		{name: "Aniversário de Fortaleza", month: time.April, day: 13},
+		{name: "Nossa Senhora da Assunção", month: time.August, day: 15},
+	},
+	"PR/curitiba": {
+		{name: "Nossa Senhora da Luz dos Pinhais", month: time.September, day: 8},
+	},
+	"RS/porto alegre": {
+		{name: "Nossa Senhora dos Navegantes", month: time.February, day: 2},
+	},
+	"AM/manaus": {
+		{name: "Elevação de Manaus à Categoria de Cidade", month: time.October, day: 24},
+		{name: "Nossa Senhora da Conceição", month: time.December, day: 8},
+	},
+	"PA/belem": {
+		{name: "Aniversário de Belém", month: time.January, day: 12},
+	},
+	"GO/goiania": {
+		{name: "Nossa Senhora Auxiliadora", month: time.May, day: 24},
+		{name: "Aniversário de Goiânia", month: time.October, day: 24},
+	},
+}
+
+var accents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a",
+	"é", "e", "ê", "e",
+	"í", "i",
+	"ó", "o", "ô", "o", "õ", "o",
+	"ú", "u", "ü", "u",
+	"ç", "c",
+)
+
+// Easter returns Easter Sunday of the year in the Gregorian calendar, using
+// the anonymous Gregorian algorithm (Meeus/Jones/Butcher).
+func Easter(year int) time.Time {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := b / 4
+	e := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+// National returns the national holidays of the year ordered by date.
+func National(year int) []Holiday {
+	return expand(national, year, ScopeNational)
+}
+
+// State returns the holidays of the state, not including the national ones.
+func State(uf string, year int) ([]Holiday, error) {
+	rules, ok := states[strings.ToUpper(strings.TrimSpace(uf))]
+	if !ok {
+		return nil, fmt.Errorf("unknown state %q", uf)
+	}
+	return expand(rules, year, ScopeState), nil
+}
+
+// Municipal returns the holidays of the city, not including the state and
+// national ones. Cities without a known set have no holidays of their own.
+func Municipal(uf string, city string, year int) ([]Holiday, error) {
+	if _, ok := states[strings.ToUpper(strings.TrimSpace(uf))]; !ok {
+		return nil, fmt.Errorf("unknown state %q", uf)
+	}
+	return expand(municipalities[strings.ToUpper(strings.TrimSpace(uf))+"/"+cityKey(city)], year, ScopeMunicipal), nil
+}
+
+// ValidState reports whether uf is a Brazilian state abbreviation.
+func ValidState(uf string) bool {
+	_, ok := states[strings.ToUpper(strings.TrimSpace(uf))]
+	return ok
+}
+
+// Calendar returns the national holidays of the year plus, when given, the
+// ones of the state and the city, ordered by date. A date that is a holiday
+// for more than one reason is listed once, with the broadest scope.
+func Calendar(year int, uf string, city string) ([]Holiday, error) {
+	all := National(year)
+
+	if uf != "" {
+		state, err := State(uf, year)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, state...)
+
+		if city != "" {
+			municipal, err := Municipal(uf, city, year)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, municipal...)
+		}
+	}
+
+	seen := map[string]bool{}
+	calendar := make([]Holiday, 0, len(all))
+	for _, holiday := range all {
+		if seen[holiday.Date] {
+			continue
+		}
+		seen[holiday.Date] = true
+		calendar = append(calendar, holiday)
+	}
+
+	sort.SliceStable(calendar, func(a, b int) bool {
+		return calendar[a].Date < calendar[b].Date
+	})
+	return calendar, nil
+}
+
+// Between returns the calendar holidays from one date to another, inclusive.
+func Between(from time.Time, to time.Time, uf string, city string) ([]Holiday, error) {
+	first := from.Format(DateLayout)
+	last := to.Format(DateLayout)
+
+	var holidays []Holiday
+	for year := from.Year(); year <= to.Year(); year++ {
+		calendar, err := Calendar(year, uf, city)
+		if err != nil {
+			return nil, err
+		}
+		for _, holiday := range calendar {
+			if holiday.Date >= first && holiday.Date <= last {
+				holidays = append(holidays, holiday)
+			}
+		}
+	}
+	return holidays, nil
+}
+
+func expand(rules []rule, year int, scope string) []Holiday {
+	easter := Easter(year)
+
+	holidays := make([]Holiday, 0, len(rules))
+	for _, r := range rules {
+		if r.since != 0 && year < r.since {
+			continue
+		}
+
+		date := time.Date(year, r.month, r.day, 0, 0, 0, 0, time.UTC)
+		if r.movable {
+			date = easter.AddDate(0, 0, r.easter)
+		}
+		holidays = append(holidays, Holiday{
+			Date:     date.Format(DateLayout),
+			Name:     r.name,
+			Scope:    scope,
+			Optional: r.optional,
+		})
+	}
+
+	sort.SliceStable(holidays, func(a, b int) bool {
+		return holidays[a].Date < holidays[b].Date
+	})
+	return holidays
+}
+
+// cityKey normalizes a city name for lookup: lower case, no accents, single
+// spaces, so "São Paulo", "sao paulo" and "sao-paulo" all match.
+func cityKey(city string) string {
+	city = accents.Replace(strings.ToLower(city))
+	city = strings.NewReplacer("-", " ", "_", " ").Replace(city)
+	return strings.Join(strings.Fields(city), " ")
+}
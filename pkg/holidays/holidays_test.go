@@ -0,0 +1,260 @@
+package holidays
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEaster(t *testing.T) {
+	for year, want := range map[int]string{
+		1818: "1818-03-22",
+		1943: "1943-04-25",
+		2000: "2000-04-23",
+		2016: "2016-03-27",
+		2024: "2024-03-31",
+		2025: "2025-04-20",
+		2026: "2026-04-05",
+		2038: "2038-04-25",
+		2285: "2285-03-22",
+	} {
+		if got := Easter(year).Format(DateLayout); got != want {
+			t.Errorf("Easter(%d) = %s, want %s", year, got, want)
+		}
+	}
+}
+
+// dates indexes the holidays by date.
+func dates(holidays []Holiday) map[string]Holiday {
+	byDate := map[string]Holiday{}
+	for _, h := range holidays {
+		byDate[h.Date] = h
+	}
+	return byDate
+}
+
+func TestNationalMovable(t *testing.T) {
+	tests := []struct {
+		year          int
+		carnaval      [2]string
+		goodFriday    string
+		corpusChristi string
+	}{
+		{2024, [2]string{"2024-02-12", "2024-02-13"}, "2024-03-29", "2024-05-30"},
+		{2025, [2]string{"2025-03-03", "2025-03-04"}, "2025-04-18", "2025-06-19"},
+		{2026, [2]string{"2026-02-16", "2026-02-17"}, "2026-04-03", "2026-06-04"},
+		{2038, [2]string{"2038-03-08", "2038-03-09"}, "2038-04-23", "2038-06-24"},
+	}
+	for _, tc := range tests {
+		byDate := dates(National(tc.year))
+		for _, date := range tc.carnaval {
+			if h := byDate[date]; h.Name != "Carnaval" || !h.Optional {
+				t.Errorf("%d: %s is %+v, want an optional Carnaval", tc.year, date, h)
+			}
+		}
+		if h := byDate[tc.goodFriday]; h.Name != "Sexta-feira Santa" || h.Optional {
+			t.Errorf("%d: %s is %+v, want Sexta-feira Santa", tc.year, tc.goodFriday, h)
+		}
+		if h := byDate[tc.corpusChristi]; h.Name != "Corpus Christi" || !h.Optional {
+			t.Errorf("%d: %s is %+v, want an optional Corpus Christi", tc.year, tc.corpusChristi, h)
+		}
+	}
+}
+
+func TestNationalSince(t *testing.T) {
+	tests := []struct {
+		year int
+		date string
+		want bool
+	}{
+		{2023, "2023-11-20", false},
+		{2024, "2024-11-20", true},
+		{2025, "2025-11-20", true},
+		{1979, "1979-10-12", false},
+		{1980, "1980-10-12", true},
+	}
+	for _, tc := range tests {
+		holidays := National(tc.year)
+		if _, ok := dates(holidays)[tc.date]; ok != tc.want {
+			t.Errorf("%s listed is %v, want %v", tc.date, ok, tc.want)
+		}
+		for i := 1; i < len(holidays); i++ {
+			if holidays[i].Date < holidays[i-1].Date {
+				t.Errorf("%d: %s listed after %s", tc.year, holidays[i].Date, holidays[i-1].Date)
+			}
+		}
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	tests := []struct {
+		name  string
+		year  int
+		uf    string
+		city  string
+		count int
+		// want holds the dates to check, with the name and scope listed.
+		want map[string]Holiday
+		// absent holds dates that must not be listed.
+		absent []string
+	}{
+		{
+			name:  "national only",
+			year:  2026,
+			count: 13,
+			want: map[string]Holiday{
+				"2026-01-01": {Name: "Confraternização Universal", Scope: ScopeNational},
+				"2026-11-20": {Name: "Dia Nacional de Zumbi e da Consciência Negra", Scope: ScopeNational},
+			},
+			absent: []string{"2026-07-09", "2026-01-25"},
+		},
+		{
+			name:  "state",
+			year:  2026,
+			uf:    "sp",
+			count: 14,
+			want: map[string]Holiday{
+				"2026-07-09": {Name: "Revolução Constitucionalista", Scope: ScopeState},
+			},
+			absent: []string{"2026-01-25"},
+		},
+		{
+			name:  "city with accents and dashes",
+			year:  2026,
+			uf:    "SP",
+			city:  "São-Paulo",
+			count: 15,
+			want: map[string]Holiday{
+				"2026-01-25": {Name: "Aniversário de São Paulo", Scope: ScopeMunicipal},
+				"2026-07-09": {Name: "Revolução Constitucionalista", Scope: ScopeState},
+			},
+		},
+		{
+			name:  "city without holidays of its own",
+			year:  2026,
+			uf:    "SP",
+			city:  "Campinas",
+			count: 14,
+		},
+		{
+			name:  "state without holidays of its own",
+			year:  2026,
+			uf:    "SC",
+			count: 13,
+		},
+		{
+			name:  "good friday on tiradentes is listed once",
+			year:  2000,
+			count: 11,
+			want: map[string]Holiday{
+				"2000-04-21": {Name: "Sexta-feira Santa", Scope: ScopeNational},
+			},
+		},
+		{
+			name:  "good friday on a state holiday keeps the national one",
+			year:  2016,
+			uf:    "CE",
+			count: 13,
+			want: map[string]Holiday{
+				"2016-03-19": {Name: "São José", Scope: ScopeState},
+				"2016-03-25": {Name: "Sexta-feira Santa", Scope: ScopeNational},
+			},
+		},
+		{
+			name:  "shared city and state date",
+			year:  2026,
+			uf:    "BA",
+			city:  "Salvador",
+			count: 16,
+			want: map[string]Holiday{
+				"2026-06-24": {Name: "São João", Scope: ScopeMunicipal},
+				"2026-07-02": {Name: "Independência da Bahia", Scope: ScopeState},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calendar, err := Calendar(tc.year, tc.uf, tc.city)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(calendar) != tc.count {
+				t.Errorf("got %d holidays, want %d: %+v", len(calendar), tc.count, calendar)
+			}
+			for i := 1; i < len(calendar); i++ {
+				if calendar[i].Date <= calendar[i-1].Date {
+					t.Errorf("%s listed after %s", calendar[i].Date, calendar[i-1].Date)
+				}
+			}
+			byDate := dates(calendar)
+			for date, want := range tc.want {
+				if got := byDate[date]; got.Name != want.Name || got.Scope != want.Scope {
+					t.Errorf("%s is %+v, want %s (%s)", date, got, want.Name, want.Scope)
+				}
+			}
+			for _, date := range tc.absent {
+				if got, ok := byDate[date]; ok {
+					t.Errorf("%s is listed as %+v", date, got)
+				}
+			}
+		})
+	}
+
+	if _, err := Calendar(2026, "XX", ""); err == nil {
+		t.Error("unknown state accepted")
+	}
+	if _, err := Calendar(2026, "XX", "São Paulo"); err == nil {
+		t.Error("unknown state accepted with a city")
+	}
+}
+
+func TestBetween(t *testing.T) {
+	day := func(value string) time.Time {
+		d, err := time.Parse(DateLayout, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name string
+		from string
+		to   string
+		uf   string
+		city string
+		want []string
+	}{
+		{"inclusive on both ends", "2025-12-25", "2026-01-01", "", "", []string{"2025-12-25", "2026-01-01"}},
+		{"across the year with the city", "2025-12-20", "2026-01-31", "SP", "sao paulo", []string{"2025-12-25", "2026-01-01", "2026-01-25"}},
+		{"single day", "2026-02-17", "2026-02-17", "", "", []string{"2026-02-17"}},
+		{"none", "2026-03-01", "2026-03-31", "SP", "", nil},
+		{"to before from", "2026-12-31", "2026-01-01", "", "", nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			holidays, err := Between(day(tc.from), day(tc.to), tc.uf, tc.city)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, h := range holidays {
+				got = append(got, h.Date)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("got %v, want %v", got, tc.want)
+					break
+				}
+			}
+		})
+	}
+
+	if _, err := Between(day("2026-01-01"), day("2026-12-31"), "XX", ""); err == nil {
+		t.Error("unknown state accepted")
+	}
+}
@@ -0,0 +1,223 @@
+// Package money holds amounts as exact decimals, the way the numeric columns
+// they are stored in do, instead of as binary floats that drift by a cent.
+//
+// Decimal is the number, Currency an ISO 4217 code that knows its minor
+// units and Money the two together, rounded the way the currency is.
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// maxDigits bounds the length of a parsed decimal, amounts are numeric(12,2)
+// and rates numeric(5,2) so anything longer is a mistake.
+const maxDigits = 40
+
+// Decimal is an exact decimal number, coef * 10^-scale. The zero value is 0.
+// Decimals are immutable, operations return new ones.
+type Decimal struct {
+	coef  *big.Int
+	scale int32
+}
+
+// NewDecimal returns coef * 10^-scale, NewDecimal(1250, 2) is 12.50.
+func NewDecimal(coef int64, scale int32) Decimal {
+	if scale < 0 {
+		panic("money: negative scale")
+	}
+	return Decimal{coef: big.NewInt(coef), scale: scale}
+}
+
+// ParseDecimal reads a plain decimal such as "12", "-0.5" or "12.50". The
+// digits after the point are kept, so "12.50" prints back as "12.50".
+func ParseDecimal(s string) (Decimal, error) {
+	text := strings.TrimSpace(s)
+	digits := text
+	if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "+") {
+		digits = text[1:]
+	}
+	whole, frac, hasPoint := strings.Cut(digits, ".")
+	if whole == "" && frac == "" || hasPoint && frac == "" || len(whole)+len(frac) > maxDigits {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	for _, r := range whole + frac {
+		if r < '0' || r > '9' {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+		}
+	}
+
+	coef, _ := new(big.Int).SetString(whole+frac, 10)
+	if strings.HasPrefix(text, "-") {
+		coef.Neg(coef)
+	}
+	return Decimal{coef: coef, scale: int32(len(frac))}, nil
+}
+
+// MustParseDecimal is ParseDecimal for constants, it panics on a bad one.
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// DecimalFromFloat converts f through its shortest decimal form, so 8.3
+// becomes exactly 8.3 and not the binary value closest to it.
+func DecimalFromFloat(f float64) (Decimal, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Decimal{}, fmt.Errorf("invalid decimal %v", f)
+	}
+	return ParseDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+func (d Decimal) int() *big.Int {
+	if d.coef == nil {
+		return new(big.Int)
+	}
+	return d.coef
+}
+
+// rescaled returns the coefficient of d at a scale at least as large as its
+// own.
+func (d Decimal) rescaled(scale int32) *big.Int {
+	c := new(big.Int).Set(d.int())
+	if scale > d.scale {
+		c.Mul(c, pow10(scale-d.scale))
+	}
+	return c
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func (d Decimal) Add(o Decimal) Decimal {
+	scale := max(d.scale, o.scale)
+	return Decimal{coef: new(big.Int).Add(d.rescaled(scale), o.rescaled(scale)), scale: scale}
+}
+
+func (d Decimal) Sub(o Decimal) Decimal {
+	return d.Add(o.Neg())
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{coef: new(big.Int).Neg(d.int()), scale: d.scale}
+}
+
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal{coef: new(big.Int).Mul(d.int(), o.int()), scale: d.scale + o.scale}
+}
+
+// Percent returns percent% of d, exactly.
+func (d Decimal) Percent(percent Decimal) Decimal {
+	return Decimal{coef: new(big.Int).Mul(d.int(), percent.int()), scale: d.scale + percent.scale + 2}
+}
+
+// Cmp returns -1, 0 or +1 as d is less than, equal to or greater than o.
+func (d Decimal) Cmp(o Decimal) int {
+	scale := max(d.scale, o.scale)
+	return d.rescaled(scale).Cmp(o.rescaled(scale))
+}
+
+func (d Decimal) Sign() int {
+	return d.int().Sign()
+}
+
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// Scale is the number of digits after the point.
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+// Round rounds d to places digits after the point, halves away from zero as
+// round() does on numeric. A shorter d is padded, Round(2) of 12.5 is 12.50.
+func (d Decimal) Round(places int32) Decimal {
+	if places >= d.scale {
+		return Decimal{coef: d.rescaled(places), scale: places}
+	}
+
+	q, r := new(big.Int).QuoRem(d.int(), pow10(d.scale-places), new(big.Int))
+	// r carries the sign of d, twice its size against the divisor decides.
+	if r.Abs(r).Lsh(r, 1).Cmp(pow10(d.scale-places)) >= 0 {
+		if d.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return Decimal{coef: q, scale: places}
+}
+
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.int()).String()
+	if d.scale > 0 {
+		if pad := int(d.scale) + 1 - len(digits); pad > 0 {
+			digits = strings.Repeat("0", pad) + digits
+		}
+		digits = digits[:len(digits)-int(d.scale)] + "." + digits[len(digits)-int(d.scale):]
+	}
+	if d.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// MarshalJSON writes d as a string, "12.50", so clients don't read it into a
+// float either.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON takes a string or a plain JSON number.
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	text := string(b)
+	if text == "null" {
+		return nil
+	}
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(b, &text); err != nil {
+			return err
+		}
+	}
+	parsed, err := ParseDecimal(text)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Scan reads a numeric column, NULL reads as 0.
+func (d *Decimal) Scan(src any) error {
+	var err error
+	switch v := src.(type) {
+	case nil:
+		*d = Decimal{}
+	case []byte:
+		*d, err = ParseDecimal(string(v))
+	case string:
+		*d, err = ParseDecimal(v)
+	case int64:
+		*d = NewDecimal(v, 0)
+	case float64:
+		*d, err = DecimalFromFloat(v)
+	default:
+		err = fmt.Errorf("can't scan %T into a decimal", src)
+	}
+	return err
+}
+
+// Value writes d as text, which numeric columns take without loss.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
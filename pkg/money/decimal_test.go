@@ -0,0 +1,200 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  string
+		scale int32
+	}{
+		{"12", "12", 0},
+		{"12.50", "12.50", 2},
+		{"-0.5", "-0.5", 1},
+		{"+3.25", "3.25", 2},
+		{" 7.0 ", "7.0", 1},
+		{".5", "0.5", 1},
+		{"-.05", "-0.05", 2},
+		{"0.000", "0.000", 3},
+		{"-0", "0", 0},
+		{"007.10", "7.10", 2},
+		{"12345678901234567890.12345678901234567890", "12345678901234567890.12345678901234567890", 20},
+	}
+	for _, tc := range tests {
+		d, err := ParseDecimal(tc.in)
+		if err != nil {
+			t.Errorf("ParseDecimal(%q): %v", tc.in, err)
+			continue
+		}
+		if d.String() != tc.want || d.Scale() != tc.scale {
+			t.Errorf("ParseDecimal(%q) = %s at scale %d, want %s at scale %d", tc.in, d, d.Scale(), tc.want, tc.scale)
+		}
+	}
+
+	for _, in := range []string{
+		"", " ", "-", "+", ".", "5.", "1.2.3", "1,50", "1e5", "0x10", "--1", "+-1", "12a", "NaN",
+		"12345678901234567890.123456789012345678901",
+	} {
+		if d, err := ParseDecimal(in); err == nil {
+			t.Errorf("ParseDecimal(%q) = %s, want an error", in, d)
+		}
+	}
+}
+
+func TestDecimalRound(t *testing.T) {
+	tests := []struct {
+		in     string
+		places int32
+		want   string
+	}{
+		{"12.345", 2, "12.35"},
+		{"12.344", 2, "12.34"},
+		{"-12.345", 2, "-12.35"},
+		{"-12.344", 2, "-12.34"},
+		{"0.5", 0, "1"},
+		{"-0.5", 0, "-1"},
+		{"1.5", 0, "2"},
+		{"2.5", 0, "3"},
+		{"0.4999", 0, "0"},
+		{"-0.004", 2, "0.00"},
+		{"9.995", 2, "10.00"},
+		{"-9.995", 2, "-10.00"},
+		{"12.5", 2, "12.50"},
+		{"12", 3, "12.000"},
+		{"12.50", 2, "12.50"},
+		{"1234.5678", 1, "1234.6"},
+		{"0.0049999", 2, "0.00"},
+	}
+	for _, tc := range tests {
+		got := MustParseDecimal(tc.in).Round(tc.places)
+		if got.String() != tc.want || got.Scale() != tc.places {
+			t.Errorf("Round(%s, %d) = %s, want %s", tc.in, tc.places, got, tc.want)
+		}
+	}
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	d := MustParseDecimal
+	tests := []struct {
+		name string
+		got  Decimal
+		want string
+	}{
+		{"add keeps the larger scale", d("1.5").Add(d("2.25")), "3.75"},
+		{"add integer", d("10").Add(d("0.01")), "10.01"},
+		{"sub below zero", d("1.00").Sub(d("2.5")), "-1.50"},
+		{"neg", d("0.10").Neg(), "-0.10"},
+		{"mul adds the scales", d("1.5").Mul(d("2.50")), "3.750"},
+		{"percent", d("200.00").Percent(d("8.33")), "16.660000"},
+		{"percent of a negative", d("-10").Percent(d("12.5")), "-1.250"},
+		{"zero value", Decimal{}.Add(d("1.1")), "1.1"},
+		{"new decimal", NewDecimal(1250, 2), "12.50"},
+		{"new decimal below one", NewDecimal(-5, 3), "-0.005"},
+	}
+	for _, tc := range tests {
+		if tc.got.String() != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, tc.got, tc.want)
+		}
+	}
+
+	if d("12.50").Cmp(d("12.5")) != 0 || d("12.49").Cmp(d("12.5")) != -1 || d("-1").Cmp(d("-1.01")) != 1 {
+		t.Error("Cmp compares across scales wrong")
+	}
+	if !(Decimal{}).IsZero() || !d("0.00").IsZero() || d("-0.01").Sign() != -1 {
+		t.Error("zero and sign wrong")
+	}
+	if (Decimal{}).String() != "0" {
+		t.Errorf("zero value prints as %s", Decimal{})
+	}
+}
+
+func TestDecimalFromFloat(t *testing.T) {
+	for in, want := range map[float64]string{
+		8.3:   "8.3",
+		0.1:   "0.1",
+		100:   "100",
+		-2.75: "-2.75",
+	} {
+		got, err := DecimalFromFloat(in)
+		if err != nil || got.String() != want {
+			t.Errorf("DecimalFromFloat(%v) = %s, %v, want %s", in, got, err, want)
+		}
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	type body struct {
+		Amount Decimal `json:"amount"`
+	}
+
+	tests := []struct {
+		in   string
+		want string
+		out  string
+	}{
+		{`{"amount":"12.50"}`, "12.50", `{"amount":"12.50"}`},
+		{`{"amount":12.50}`, "12.50", `{"amount":"12.50"}`},
+		{`{"amount":-3}`, "-3", `{"amount":"-3"}`},
+		{`{"amount":null}`, "0", `{"amount":"0"}`},
+		{`{}`, "0", `{"amount":"0"}`},
+	}
+	for _, tc := range tests {
+		var b body
+		if err := json.Unmarshal([]byte(tc.in), &b); err != nil {
+			t.Errorf("unmarshal %s: %v", tc.in, err)
+			continue
+		}
+		if b.Amount.String() != tc.want {
+			t.Errorf("unmarshal %s = %s, want %s", tc.in, b.Amount, tc.want)
+		}
+		out, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != tc.out {
+			t.Errorf("marshal %s = %s, want %s", tc.in, out, tc.out)
+		}
+
+		var again body
+		if err := json.Unmarshal(out, &again); err != nil || again.Amount.String() != b.Amount.String() {
+			t.Errorf("round trip of %s gave %s, %v", out, again.Amount, err)
+		}
+	}
+
+	for _, in := range []string{`{"amount":"12,50"}`, `{"amount":1e2}`, `{"amount":true}`, `{"amount":""}`} {
+		var b body
+		if err := json.Unmarshal([]byte(in), &b); err == nil {
+			t.Errorf("unmarshal %s = %s, want an error", in, b.Amount)
+		}
+	}
+}
+
+func TestDecimalScan(t *testing.T) {
+	tests := []struct {
+		src  any
+		want string
+	}{
+		{[]byte("12.50"), "12.50"},
+		{"0.08", "0.08"},
+		{int64(7), "7"},
+		{8.3, "8.3"},
+		{nil, "0"},
+	}
+	for _, tc := range tests {
+		d := MustParseDecimal("1")
+		if err := d.Scan(tc.src); err != nil || d.String() != tc.want {
+			t.Errorf("Scan(%#v) = %s, %v, want %s", tc.src, d, err, tc.want)
+		}
+		if v, _ := d.Value(); v != tc.want {
+			t.Errorf("Value of %s = %v", d, v)
+		}
+	}
+
+	var d Decimal
+	if err := d.Scan(true); err == nil {
+		t.Error("Scan(true) accepted")
+	}
+}
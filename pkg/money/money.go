@@ -0,0 +1,59 @@
+package money
+
+import "fmt"
+
+// Money is an amount in a currency.
+type Money struct {
+	Amount   Decimal  `json:"amount"`
+	Currency Currency `json:"currency"`
+}
+
+// New returns amount in currency, currency must be an ISO 4217 code.
+func New(amount Decimal, currency Currency) (Money, error) {
+	if !currency.Valid() {
+		return Money{}, fmt.Errorf("%q is not an ISO 4217 currency code", currency)
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// Round rounds the amount to the minor units of the currency, halves away
+// from zero: cents for BRL, whole yen for JPY.
+func (m Money) Round() Money {
+	return Money{Amount: m.Amount.Round(m.Currency.Digits()), Currency: m.Currency}
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("can't add %s to %s", o.Currency, m.Currency)
+	}
+	return Money{Amount: m.Amount.Add(o.Amount), Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("can't subtract %s from %s", o.Currency, m.Currency)
+	}
+	return Money{Amount: m.Amount.Sub(o.Amount), Currency: m.Currency}, nil
+}
+
+// CheckPercent refuses rates out of 0 to 100 and ones a numeric(5,2) column
+// would have to round, rates are kept to the hundredth of a percent. name is
+// the field the rate was given in.
+func CheckPercent(name string, percent Decimal) error {
+	if percent.Sign() < 0 || percent.Cmp(NewDecimal(100, 0)) > 0 {
+		return fmt.Errorf("%s must be between 0 and 100", name)
+	}
+	if percent.Round(2).Cmp(percent) != 0 {
+		return fmt.Errorf("%s can't have more than 2 decimal places", name)
+	}
+	return nil
+}
+
+// Percent returns percent% of m, rounded to the currency.
+func (m Money) Percent(percent Decimal) Money {
+	return Money{Amount: m.Amount.Percent(percent), Currency: m.Currency}.Round()
+}
+
+func (m Money) String() string {
+	return m.Amount.String() + " " + string(m.Currency)
+}
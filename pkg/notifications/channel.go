@@ -0,0 +1,253 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/genda/genda-api/pkg/config"
+)
+
+// Message is a notification to one customer, each channel uses the address
+// it needs.
+type Message struct {
+	UserId  string
+	Name    string
+	Email   string
+	Phone   string
+	Subject string
+	Body    string
+	Data    map[string]string
+}
+
+// Channel delivers messages one way: email, SMS, push.
+type Channel interface {
+	// Name is how the channel is recorded in the delivered channels.
+	Name() string
+	// Reaches reports whether the channel has an address for the recipient.
+	Reaches(Message) bool
+	Send(context.Context, Message) error
+}
+
+// ChannelsFrom returns the channels the configuration sets up, the ones
+// without settings are left out.
+func ChannelsFrom(conf *config.Conf) []Channel {
+	var channels []Channel
+	if conf.SmtpHost != "" && conf.SmtpFrom != "" {
+		channels = append(channels, NewSMTPChannel(conf.SmtpHost, conf.SmtpPort, conf.SmtpUser, conf.SmtpPassword, conf.SmtpFrom))
+	}
+	if conf.SmsAccountSid != "" && conf.SmsFrom != "" {
+		channels = append(channels, NewSMSChannel(conf.SmsApiUrl, conf.SmsAccountSid, conf.SmsAuthToken, conf.SmsFrom))
+	}
+	if conf.PushGatewayUrl != "" {
+		channels = append(channels, NewPushChannel(conf.PushGatewayUrl, conf.PushGatewayToken))
+	}
+	return channels
+}
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// smtpTimeout bounds an email sent without a context deadline.
+const smtpTimeout = 30 * time.Second
+
+type smtpChannel struct {
+	addr string
+	host string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPChannel sends email through an SMTP server, with STARTTLS when the
+// server offers it and PLAIN auth when a user is set.
+func NewSMTPChannel(host string, port string, user string, password string, from string) Channel {
+	c := &smtpChannel{addr: net.JoinHostPort(host, port), host: host, from: from}
+	if user != "" {
+		c.auth = smtp.PlainAuth("", user, password, host)
+	}
+	return c
+}
+
+func (c *smtpChannel) Name() string {
+	return "email"
+}
+
+func (c *smtpChannel) Reaches(m Message) bool {
+	return m.Email != ""
+}
+
+func (c *smtpChannel) Send(ctx context.Context, m Message) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", c.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", m.Email)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+
+	if err := c.sendMail(ctx, m.Email, msg.Bytes()); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+// sendMail does what smtp.SendMail does, on a connection bound to ctx: it
+// has the ctx deadline, or smtpTimeout without one, and is closed when ctx
+// is canceled.
+func (c *smtpChannel) sendMail(ctx context.Context, to string, msg []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, c.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: c.host}); err != nil {
+			return err
+		}
+	}
+	if c.auth != nil {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(c.auth); err != nil {
+				return err
+			}
+		}
+	}
+	if err := client.Mail(c.from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+type smsChannel struct {
+	apiURL     string
+	accountSid string
+	authToken  string
+	from       string
+}
+
+// NewSMSChannel sends text messages through the Twilio Messages API, or any
+// gateway that speaks it.
+func NewSMSChannel(apiURL string, accountSid string, authToken string, from string) Channel {
+	return &smsChannel{apiURL: strings.TrimSuffix(apiURL, "/"), accountSid: accountSid, authToken: authToken, from: from}
+}
+
+func (c *smsChannel) Name() string {
+	return "sms"
+}
+
+func (c *smsChannel) Reaches(m Message) bool {
+	return m.Phone != ""
+}
+
+func (c *smsChannel) Send(ctx context.Context, m Message) error {
+	form := url.Values{}
+	form.Set("To", m.Phone)
+	form.Set("From", c.from)
+	form.Set("Body", m.Body)
+
+	endpoint := fmt.Sprintf("%s/Accounts/%s/Messages.json", c.apiURL, url.PathEscape(c.accountSid))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.accountSid, c.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doRequest("sms", req)
+}
+
+type pushChannel struct {
+	gatewayURL string
+	token      string
+}
+
+// NewPushChannel hands push notifications to a gateway that knows the
+// devices of each user.
+func NewPushChannel(gatewayURL string, token string) Channel {
+	return &pushChannel{gatewayURL: gatewayURL, token: token}
+}
+
+func (c *pushChannel) Name() string {
+	return "push"
+}
+
+func (c *pushChannel) Reaches(m Message) bool {
+	return m.UserId != ""
+}
+
+func (c *pushChannel) Send(ctx context.Context, m Message) error {
+	body, err := json.Marshal(map[string]any{
+		"user_id": m.UserId,
+		"title":   m.Subject,
+		"body":    m.Body,
+		"data":    m.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.gatewayURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return doRequest("push", req)
+}
+
+func doRequest(channel string, req *http.Request) error {
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", channel, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusMultipleChoices {
+		data, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("%s: gateway returned %d: %s", channel, res.StatusCode, string(data))
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/genda/genda-api/internal/app"
+	"github.com/julienschmidt/httprouter"
+)
+
+type handler struct {
+	service Service
+}
+
+func NewHandler(postgresDB *sql.DB) *handler {
+	return &handler{
+		service: NewScheduler(postgresDB),
+	}
+}
+
+// GET /stores/:id/appointments/:appointmentId/notifications
+func (h *handler) GetAppointmentNotifications(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.GetAppointmentNotifications(p.ByName("appointmentId"))
+	if err != nil {
+		transformError(w, "Failed to get appointment notifications", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// transform error for response api
+func transformError(w http.ResponseWriter, m string, e string) {
+	var data = app.ValidateError{
+		Message: m,
+		Error:   e,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(data)
+}
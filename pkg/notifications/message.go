@@ -0,0 +1,50 @@
+package notifications
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultTimezone is used for stores without a timezone, as in the stores
+// package.
+const defaultTimezone = "America/Sao_Paulo"
+
+// render writes the message of a due job, with the appointment time on the
+// store's clock.
+func render(d delivery) Message {
+	loc, err := time.LoadLocation(d.Timezone)
+	if err != nil || d.Timezone == "" {
+		loc, _ = time.LoadLocation(defaultTimezone)
+	}
+	when := d.StartAt.In(loc).Format("Mon, Jan 2 at 15:04")
+	what := "appointment"
+	if d.ServiceName != "" {
+		what = d.ServiceName + " appointment"
+	}
+
+	m := Message{
+		UserId: d.UserId,
+		Name:   d.Name,
+		Email:  d.Email,
+		Phone:  d.Phone,
+		Data: map[string]string{
+			"kind":           d.Kind,
+			"appointment_id": d.AppointmentId,
+		},
+	}
+	switch d.Kind {
+	case KindConfirmation:
+		m.Subject = fmt.Sprintf("Your appointment at %s is confirmed", d.StoreName)
+		m.Body = fmt.Sprintf("Hi %s, your %s at %s is confirmed for %s.", d.Name, what, d.StoreName, when)
+	case KindReminder24h:
+		m.Subject = fmt.Sprintf("Reminder: %s tomorrow", d.StoreName)
+		m.Body = fmt.Sprintf("Hi %s, this is a reminder of your %s at %s on %s.", d.Name, what, d.StoreName, when)
+	case KindReminder1h:
+		m.Subject = fmt.Sprintf("Reminder: %s in one hour", d.StoreName)
+		m.Body = fmt.Sprintf("Hi %s, your %s at %s starts in one hour, %s.", d.Name, what, d.StoreName, when)
+	case KindRatingRequest:
+		m.Subject = fmt.Sprintf("How was your visit to %s?", d.StoreName)
+		m.Body = fmt.Sprintf("Hi %s, thanks for visiting %s. Tell us how your %s went by rating it in the app.", d.Name, d.StoreName, what)
+	}
+	return m
+}
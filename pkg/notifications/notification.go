@@ -0,0 +1,109 @@
+package notifications
+
+import "time"
+
+// The notifications sent over an appointment's life.
+const (
+	KindConfirmation  = "confirmation"
+	KindReminder24h   = "reminder_24h"
+	KindReminder1h    = "reminder_1h"
+	KindRatingRequest = "rating_request"
+)
+
+const (
+	JobStatusPending  = "pending"
+	JobStatusSent     = "sent"
+	JobStatusCanceled = "canceled"
+	JobStatusFailed   = "failed"
+)
+
+// ratingRequestDelay is how long after the appointment is completed the
+// customer is asked to rate it.
+const ratingRequestDelay = 2 * time.Hour
+
+// reminderLeads are how long before the start each reminder goes out.
+var reminderLeads = map[string]time.Duration{
+	KindReminder24h: 24 * time.Hour,
+	KindReminder1h:  time.Hour,
+}
+
+// Job is a scheduled notification. DeliveredChannels lists the channels it
+// already went out on, a retry skips them.
+type Job struct {
+	Id                string   `json:"id"`
+	AppointmentId     string   `json:"appointment_id"`
+	Kind              string   `json:"kind"`
+	Status            string   `json:"status"`
+	SendAt            string   `json:"send_at"`
+	Attempts          int      `json:"attempts"`
+	DeliveredChannels []string `json:"delivered_channels"`
+	LastError         string   `json:"last_error"`
+	SentAt            string   `json:"sent_at"`
+	CreatedAt         string   `json:"created_at"`
+	UpdatedAt         string   `json:"updated_at"`
+}
+
+// appointmentState is what the schedule of an appointment depends on.
+type appointmentState struct {
+	Id      string
+	Status  string
+	StartAt time.Time
+}
+
+// plannedJob is a notification an appointment should have.
+type plannedJob struct {
+	Kind   string
+	SendAt time.Time
+}
+
+// delivery is a due job with what its message is made of. The appointment
+// fields are empty when the appointment was deleted.
+type delivery struct {
+	JobId             string
+	Kind              string
+	Attempts          int
+	DeliveredChannels []string
+	PlannedStartAt    time.Time
+	AppointmentId     string
+	Status            string
+	StartAt           time.Time
+	UserId            string
+	Name              string
+	Email             string
+	Phone             string
+	StoreName         string
+	Timezone          string
+	ServiceName       string
+}
+
+// plan lists the notifications an appointment should have at now: the
+// confirmation and the reminders still ahead while confirmed, the rating
+// request once completed, none otherwise.
+func plan(a appointmentState, now time.Time) []plannedJob {
+	switch a.Status {
+	case "confirmed":
+		jobs := []plannedJob{{Kind: KindConfirmation, SendAt: now}}
+		for _, kind := range []string{KindReminder24h, KindReminder1h} {
+			sendAt := a.StartAt.Add(-reminderLeads[kind])
+			if sendAt.After(now) {
+				jobs = append(jobs, plannedJob{Kind: kind, SendAt: sendAt})
+			}
+		}
+		return jobs
+	case "completed":
+		return []plannedJob{{Kind: KindRatingRequest, SendAt: now.Add(ratingRequestDelay)}}
+	}
+	return nil
+}
+
+// stale reports whether the appointment changed since the job was planned,
+// so the job no longer applies.
+func (d delivery) stale() bool {
+	switch d.Kind {
+	case KindRatingRequest:
+		return d.Status != "completed"
+	case KindConfirmation:
+		return d.Status != "confirmed"
+	}
+	return d.Status != "confirmed" || !d.StartAt.Equal(d.PlannedStartAt)
+}
@@ -0,0 +1,346 @@
+package notifications
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// onceKinds are sent once per appointment, however often it moves.
+var onceKinds = map[string]bool{
+	KindConfirmation:  true,
+	KindRatingRequest: true,
+}
+
+const jobColumns = `
+			id,
+			COALESCE(appointment_id::text, ''),
+			kind,
+			status,
+			send_at,
+			attempts,
+			delivered_channels,
+			COALESCE(last_error, ''),
+			sent_at,
+			created_at,
+			updated_at`
+
+type NotificationRepo struct {
+	postgresDB *sql.DB
+}
+
+func NewNotificationRepository(postgresDB *sql.DB) *NotificationRepo {
+	return &NotificationRepo{postgresDB: postgresDB}
+}
+
+// GetAppointmentState reads what the notification schedule of an appointment
+// depends on.
+func (i *NotificationRepo) GetAppointmentState(id string) (*appointmentState, error) {
+	const sqlStmt = `SELECT id, status, start_at FROM store_appointments WHERE id = $1`
+
+	var a appointmentState
+	if err := i.postgresDB.QueryRow(sqlStmt, id).Scan(&a.Id, &a.Status, &a.StartAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("appointment %s not found", id)
+		}
+		log.Println("An error occurred while getting appointment for notifications", err)
+		return nil, err
+	}
+	return &a, nil
+}
+
+// SyncJobs makes the pending jobs of the appointment match planned: jobs no
+// longer planned are canceled, planned ones are moved or added. Jobs already
+// sent aren't sent again, reminders only when the appointment moved since.
+func (i *NotificationRepo) SyncJobs(a appointmentState, planned []plannedJob) error {
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting notification sync", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	const existingSQL = `
+		SELECT id, kind, status, start_at
+		FROM notification_jobs
+		WHERE appointment_id = $1
+		FOR UPDATE
+	`
+	rows, err := tx.Query(existingSQL, a.Id)
+	if err != nil {
+		log.Println("An error occurred while getting notification jobs", err)
+		return err
+	}
+	type existingJob struct {
+		id, kind, status string
+		startAt          time.Time
+	}
+	var existing []existingJob
+	for rows.Next() {
+		var j existingJob
+		if err := rows.Scan(&j.id, &j.kind, &j.status, &j.startAt); err != nil {
+			rows.Close()
+			log.Println("An error occurred while scanning notification job", err)
+			return err
+		}
+		existing = append(existing, j)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting notification jobs", err)
+		return err
+	}
+
+	wanted := map[string]time.Time{}
+	for _, p := range planned {
+		wanted[p.Kind] = p.SendAt
+	}
+
+	const cancelSQL = `
+		UPDATE notification_jobs
+		SET status = 'canceled', locked_until = NULL, updated_at = now()
+		WHERE id = $1
+	`
+	const moveSQL = `
+		UPDATE notification_jobs
+		SET send_at = $2, start_at = $3, updated_at = now()
+		WHERE id = $1
+	`
+	for _, j := range existing {
+		sendAt, ok := wanted[j.kind]
+		switch {
+		case j.status != JobStatusPending:
+			// A job that went out, for this start or once and for all, is
+			// not planned again.
+			if ok && (onceKinds[j.kind] || j.startAt.Equal(a.StartAt)) {
+				delete(wanted, j.kind)
+			}
+		case !ok:
+			if _, err := tx.Exec(cancelSQL, j.id); err != nil {
+				log.Println("An error occurred while canceling notification job", err)
+				return err
+			}
+		default:
+			if _, err := tx.Exec(moveSQL, j.id, sendAt, a.StartAt); err != nil {
+				log.Println("An error occurred while moving notification job", err)
+				return err
+			}
+			delete(wanted, j.kind)
+		}
+	}
+
+	const insertSQL = `
+		INSERT INTO notification_jobs
+			(appointment_id, kind, send_at, start_at)
+		VALUES
+			($1,$2,$3,$4)
+		ON CONFLICT (appointment_id, kind) WHERE status = 'pending' DO NOTHING
+	`
+	for kind, sendAt := range wanted {
+		if _, err := tx.Exec(insertSQL, a.Id, kind, sendAt, a.StartAt); err != nil {
+			log.Println("An error occurred while scheduling notification job", err)
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing notification sync", err)
+		return err
+	}
+	return nil
+}
+
+// CancelJobs cancels the pending jobs of the appointment.
+func (i *NotificationRepo) CancelJobs(appointmentId string) error {
+	const sqlStmt = `
+		UPDATE notification_jobs
+		SET status = 'canceled', locked_until = NULL, updated_at = now()
+		WHERE appointment_id = $1 AND status = 'pending'
+	`
+	if _, err := i.postgresDB.Exec(sqlStmt, appointmentId); err != nil {
+		log.Println("An error occurred while canceling notification jobs", err)
+		return err
+	}
+	return nil
+}
+
+func (i *NotificationRepo) GetJobs(appointmentId string) ([]Job, error) {
+	const sqlStmt = `
+		SELECT ` + jobColumns + `
+		FROM notification_jobs
+		WHERE appointment_id = $1
+		ORDER BY send_at ASC;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, appointmentId)
+	if err != nil {
+		log.Println("An error occurred while getting notification jobs", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		var j Job
+		var sentAt sql.NullString
+		err := rows.Scan(
+			&j.Id,
+			&j.AppointmentId,
+			&j.Kind,
+			&j.Status,
+			&j.SendAt,
+			&j.Attempts,
+			pq.Array(&j.DeliveredChannels),
+			&j.LastError,
+			&sentAt,
+			&j.CreatedAt,
+			&j.UpdatedAt,
+		)
+		if err != nil {
+			log.Println("An error occurred while scanning notification job", err)
+			return nil, err
+		}
+		j.SentAt = sentAt.String
+		if j.DeliveredChannels == nil {
+			j.DeliveredChannels = []string{}
+		}
+		jobs = append(jobs, j)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting notification jobs", err)
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// ClaimDueJobs takes up to limit pending jobs whose time came, leasing them
+// so other workers leave them alone until the lease ends.
+func (i *NotificationRepo) ClaimDueJobs(limit int, lease time.Duration) ([]delivery, error) {
+	const claimSQL = `
+		UPDATE notification_jobs
+		SET locked_until = now() + make_interval(secs => $2), attempts = attempts + 1, updated_at = now()
+		WHERE id IN (
+			SELECT id FROM notification_jobs
+			WHERE status = 'pending'
+				AND send_at <= now()
+				AND (locked_until IS NULL OR locked_until < now())
+			ORDER BY send_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id
+	`
+	rows, err := i.postgresDB.Query(claimSQL, limit, lease.Seconds())
+	if err != nil {
+		log.Println("An error occurred while claiming notification jobs", err)
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			log.Println("An error occurred while scanning claimed notification job", err)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while claiming notification jobs", err)
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	const deliverySQL = `
+		SELECT
+			j.id,
+			j.kind,
+			j.attempts,
+			j.delivered_channels,
+			j.start_at,
+			COALESCE(a.id::text, ''),
+			COALESCE(a.status, ''),
+			COALESCE(a.start_at, j.start_at),
+			COALESCE(u.id::text, ''),
+			COALESCE(u.name, ''),
+			COALESCE(u.email, ''),
+			COALESCE(u.phone_number, ''),
+			COALESCE(s.name, ''),
+			COALESCE(s.timezone, ''),
+			COALESCE(sv.name, '')
+		FROM notification_jobs j
+		LEFT JOIN store_appointments a ON a.id = j.appointment_id
+		LEFT JOIN users u ON u.id = a.user_id
+		LEFT JOIN stores s ON s.id = a.store_id
+		LEFT JOIN store_services sv ON sv.id = a.service_id
+		WHERE j.id = ANY($1)
+		ORDER BY j.send_at ASC;
+	`
+	rows, err = i.postgresDB.Query(deliverySQL, pq.Array(ids))
+	if err != nil {
+		log.Println("An error occurred while getting notification deliveries", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []delivery{}
+	for rows.Next() {
+		var d delivery
+		err := rows.Scan(
+			&d.JobId,
+			&d.Kind,
+			&d.Attempts,
+			pq.Array(&d.DeliveredChannels),
+			&d.PlannedStartAt,
+			&d.AppointmentId,
+			&d.Status,
+			&d.StartAt,
+			&d.UserId,
+			&d.Name,
+			&d.Email,
+			&d.Phone,
+			&d.StoreName,
+			&d.Timezone,
+			&d.ServiceName,
+		)
+		if err != nil {
+			log.Println("An error occurred while scanning notification delivery", err)
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting notification deliveries", err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// FinishJob records how sending a claimed job went: sent, retried at
+// retryAt, or given up on (failed or canceled) with the reason.
+func (i *NotificationRepo) FinishJob(id string, status string, delivered []string, reason string, retryAt time.Time) error {
+	const sqlStmt = `
+		UPDATE notification_jobs
+		SET status = $2,
+			delivered_channels = $3,
+			last_error = NULLIF($4,''),
+			send_at = CASE WHEN $2 = 'pending' THEN $5 ELSE send_at END,
+			sent_at = CASE WHEN $2 = 'sent' THEN now() ELSE sent_at END,
+			locked_until = NULL,
+			updated_at = now()
+		WHERE id = $1
+	`
+	if _, err := i.postgresDB.Exec(sqlStmt, id, status, pq.Array(delivered), reason, retryAt); err != nil {
+		log.Println("An error occurred while finishing notification job", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// dispatchBatch bounds how many due jobs one run sends, the rest go in the
+// next run.
+const dispatchBatch = 100
+
+// dispatchLease is how long a claimed job is left to the worker that claimed
+// it before another may take it.
+const dispatchLease = 5 * time.Minute
+
+// maxAttempts is how many times a job is tried before it is given up on.
+const maxAttempts = 5
+
+// retryBackoff is the wait after the first failed attempt, doubled on each
+// following one.
+const retryBackoff = time.Minute
+
+type Service interface {
+	SyncAppointment(string) error
+	CancelAppointment(string) error
+	GetAppointmentNotifications(string) ([]Job, error)
+	Dispatch(context.Context) (int, error)
+}
+
+type Repository interface {
+	GetAppointmentState(string) (*appointmentState, error)
+	SyncJobs(appointmentState, []plannedJob) error
+	CancelJobs(string) error
+	GetJobs(string) ([]Job, error)
+	ClaimDueJobs(int, time.Duration) ([]delivery, error)
+	FinishJob(string, string, []string, string, time.Time) error
+}
+
+type service struct {
+	repository Repository
+	channels   []Channel
+}
+
+func NewService(r Repository, channels ...Channel) Service {
+	return &service{repository: r, channels: channels}
+}
+
+// SyncAppointment brings the notifications of the appointment in line with
+// its status and start: reminders move with it, the ones that no longer
+// apply are canceled.
+func (s *service) SyncAppointment(appointmentId string) error {
+	a, err := s.repository.GetAppointmentState(appointmentId)
+	if err != nil {
+		return err
+	}
+	return s.repository.SyncJobs(*a, plan(*a, time.Now().UTC()))
+}
+
+// CancelAppointment cancels the pending notifications of the appointment,
+// for when it is about to be deleted.
+func (s *service) CancelAppointment(appointmentId string) error {
+	return s.repository.CancelJobs(appointmentId)
+}
+
+func (s *service) GetAppointmentNotifications(appointmentId string) ([]Job, error) {
+	return s.repository.GetJobs(appointmentId)
+}
+
+// Dispatch sends the jobs that are due and returns how many went out.
+func (s *service) Dispatch(ctx context.Context) (int, error) {
+	deliveries, err := s.repository.ClaimDueJobs(dispatchBatch, dispatchLease)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, d := range deliveries {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		ok, err := s.deliver(ctx, d)
+		if err != nil {
+			return sent, err
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// deliver sends one job on every channel that reaches the customer and
+// hasn't got it yet, then records how it went.
+func (s *service) deliver(ctx context.Context, d delivery) (bool, error) {
+	if d.AppointmentId == "" {
+		return false, s.repository.FinishJob(d.JobId, JobStatusCanceled, d.DeliveredChannels, "the appointment was deleted", time.Time{})
+	}
+	if d.stale() {
+		return false, s.repository.FinishJob(d.JobId, JobStatusCanceled, d.DeliveredChannels, "the appointment changed", time.Time{})
+	}
+
+	m := render(d)
+	delivered := append([]string{}, d.DeliveredChannels...)
+	var failures []string
+	reached := false
+	for _, c := range s.channels {
+		if !c.Reaches(m) {
+			continue
+		}
+		reached = true
+		if contains(delivered, c.Name()) {
+			continue
+		}
+		if err := c.Send(ctx, m); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", c.Name(), err))
+			continue
+		}
+		delivered = append(delivered, c.Name())
+	}
+
+	switch {
+	case !reached:
+		return false, s.repository.FinishJob(d.JobId, JobStatusFailed, delivered, "no channel reaches the customer", time.Time{})
+	case len(failures) == 0:
+		return true, s.repository.FinishJob(d.JobId, JobStatusSent, delivered, "", time.Time{})
+	case d.Attempts >= maxAttempts:
+		return false, s.repository.FinishJob(d.JobId, JobStatusFailed, delivered, strings.Join(failures, "; "), time.Time{})
+	}
+	retryAt := time.Now().UTC().Add(retryBackoff << (d.Attempts - 1))
+	return false, s.repository.FinishJob(d.JobId, JobStatusPending, delivered, strings.Join(failures, "; "), retryAt)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatchAll runs one dispatch and logs how it went.
+func dispatchAll(ctx context.Context, s Service, logger *log.Logger) {
+	sent, err := s.Dispatch(ctx)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.Printf("notifications: %v", err)
+	}
+	if sent > 0 {
+		logger.Printf("notifications: sent %d", sent)
+	}
+}
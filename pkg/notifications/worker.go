@@ -0,0 +1,46 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/genda/genda-api/pkg/config"
+)
+
+// Worker sends the notifications that are due, one run per interval.
+type Worker struct {
+	service  Service
+	interval time.Duration
+	log      *log.Logger
+}
+
+func NewWorker(postgresDB *sql.DB, interval time.Duration, log *log.Logger) *Worker {
+	return &Worker{
+		service:  NewScheduler(postgresDB),
+		interval: interval,
+		log:      log,
+	}
+}
+
+// Run dispatches once per interval until the context is canceled.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			dispatchAll(ctx, w.service, w.log)
+		}
+	}
+}
+
+// NewScheduler builds the service with the channels the configuration sets
+// up, for the packages whose changes move notifications.
+func NewScheduler(postgresDB *sql.DB) Service {
+	return NewService(NewNotificationRepository(postgresDB), ChannelsFrom(config.New())...)
+}
@@ -0,0 +1,175 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genda/genda-api/pkg/money"
+)
+
+// fakeFeePercent is the processing fee the fake provider reports.
+var fakeFeePercent = money.MustParseDecimal("3.99")
+
+// fakeDeclinedCents makes the fake provider decline amounts ending in them,
+// for trying out failed checkouts.
+const fakeDeclinedCents = ".02"
+
+const fakeIdPrefix = "fake_pay_"
+
+const fakeRefundPrefix = "fake_re_"
+
+// FakeSignatureHeader carries the signature of the fake provider's webhooks,
+// "t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>">".
+const FakeSignatureHeader = "Fake-Signature"
+
+// fakeSignatureTolerance is how old a signed webhook may be, older ones are
+// taken for replays.
+const fakeSignatureTolerance = 5 * time.Minute
+
+// fakeProvider answers like a payment processor without calling one, for
+// local development. It keeps no state: the payment id is derived from the
+// reference, so the same checkout always gets the same id, and any id it
+// issued can be captured or canceled. Its webhooks are signed with
+// webhookSecret, see SignFakeWebhook.
+type fakeProvider struct {
+	webhookSecret string
+}
+
+func NewFakeProvider(webhookSecret string) Provider {
+	return fakeProvider{webhookSecret: webhookSecret}
+}
+
+func (fakeProvider) Name() string {
+	return "fake"
+}
+
+func (fakeProvider) CreatePayment(ctx context.Context, charge Charge) (*ProviderPayment, error) {
+	if strings.HasSuffix(charge.Amount.Amount.Round(2).String(), fakeDeclinedCents) {
+		return nil, ErrPaymentDeclined
+	}
+
+	sum := sha256.Sum256([]byte(charge.Reference))
+	res := &ProviderPayment{
+		Id:        fakeIdPrefix + hex.EncodeToString(sum[:12]),
+		Status:    PaymentStatusProcessing,
+		FeeAmount: charge.Amount.Percent(fakeFeePercent).Amount,
+	}
+	if charge.Capture {
+		res.Status = PaymentStatusSucceeded
+	}
+	return res, nil
+}
+
+func (fakeProvider) CapturePayment(ctx context.Context, id string) (*ProviderPayment, error) {
+	if !strings.HasPrefix(id, fakeIdPrefix) {
+		return nil, ErrProviderPaymentNotFound
+	}
+	return &ProviderPayment{Id: id, Status: PaymentStatusSucceeded}, nil
+}
+
+func (fakeProvider) CancelPayment(ctx context.Context, id string) (*ProviderPayment, error) {
+	if !strings.HasPrefix(id, fakeIdPrefix) {
+		return nil, ErrProviderPaymentNotFound
+	}
+	return &ProviderPayment{Id: id, Status: PaymentStatusCanceled}, nil
+}
+
+func (fakeProvider) Refund(ctx context.Context, req RefundRequest) (*ProviderRefund, error) {
+	if !strings.HasPrefix(req.ProviderPaymentId, fakeIdPrefix) {
+		return nil, ErrProviderPaymentNotFound
+	}
+	sum := sha256.Sum256([]byte(req.Reference))
+	return &ProviderRefund{Id: fakeRefundPrefix + hex.EncodeToString(sum[:12]), Status: RefundStatusSucceeded}, nil
+}
+
+// fakeEvent is the body of the fake provider's webhooks. Data is already in
+// our terms.
+type fakeEvent struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object         string        `json:"object"`
+		Id             string        `json:"id"`
+		Status         string        `json:"status"`
+		Fee            money.Decimal `json:"fee"`
+		AmountRefunded money.Decimal `json:"amount_refunded"`
+		FailureCode    string        `json:"failure_code"`
+	} `json:"data"`
+}
+
+func (p fakeProvider) VerifyWebhook(header http.Header, body []byte) (*ProviderEvent, error) {
+	if p.webhookSecret == "" {
+		return nil, errors.New("the fake provider has no webhook secret set")
+	}
+
+	var timestamp, signature string
+	for _, part := range strings.Split(header.Get(FakeSignatureHeader), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || signature == "" {
+		return nil, ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > fakeSignatureTolerance || age < -fakeSignatureTolerance {
+		return nil, ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(fakeSignature(p.webhookSecret, timestamp, body))) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event fakeEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("invalid event: %w", err)
+	}
+	if event.Id == "" || event.Type == "" {
+		return nil, errors.New("invalid event: id and type are required")
+	}
+	return &ProviderEvent{Id: event.Id, Type: event.Type, Payload: body}, nil
+}
+
+func (fakeProvider) EventChange(e ProviderEvent) (*EventChange, error) {
+	var event fakeEvent
+	if err := json.Unmarshal(e.Payload, &event); err != nil {
+		return nil, fmt.Errorf("invalid event: %w", err)
+	}
+	if event.Data.Object == "" || event.Data.Id == "" || event.Data.Status == "" {
+		return nil, nil
+	}
+	return &EventChange{
+		Object:         event.Data.Object,
+		ProviderId:     event.Data.Id,
+		Status:         event.Data.Status,
+		FeeAmount:      event.Data.Fee,
+		RefundedAmount: event.Data.AmountRefunded,
+		FailureCode:    event.Data.FailureCode,
+	}, nil
+}
+
+// SignFakeWebhook returns the FakeSignatureHeader value of body sent at t,
+// for posting events to a local API by hand.
+func SignFakeWebhook(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + fakeSignature(secret, timestamp, body)
+}
+
+func fakeSignature(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,20 @@
+package payments
+
+import "github.com/genda/genda-api/pkg/money"
+
+// PlatformFee is the rate the platform takes from the payments of a store,
+// or from the subscriptions to one of its plans. Percent is the override set
+// on it, null when it takes the rate of the store or the default, and
+// EffectivePercent is the rate new payments are charged.
+type PlatformFee struct {
+	StoreId          string         `json:"store_id"`
+	PlanId           string         `json:"plan_id,omitempty"`
+	Percent          *money.Decimal `json:"platform_fee_pct"`
+	EffectivePercent money.Decimal  `json:"effective_fee_pct"`
+}
+
+// UpdatePlatformFeeRequest sets the override, between 0 and 100 with up to
+// 2 decimal places. A null platform_fee_pct removes it.
+type UpdatePlatformFeeRequest struct {
+	Percent *money.Decimal `json:"platform_fee_pct"`
+}
@@ -0,0 +1,115 @@
+package payments
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/genda/genda-api/internal/storage/postgres"
+	"github.com/genda/genda-api/pkg/money"
+)
+
+// feesMigration defines currency_digits, which the payments_fees trigger
+// rounds the platform fee with.
+const feesMigration = "../../db/migration/000030_currency_platform_fees.up.sql"
+
+// migrationDigits reads the minor units currency_digits gives each currency
+// it lists, the rest have two.
+func migrationDigits(t *testing.T) map[money.Currency]int32 {
+	t.Helper()
+	data, err := os.ReadFile(feesMigration)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digits := map[money.Currency]int32{}
+	when := regexp.MustCompile(`(?s)WHEN p_currency IN \(([^)]*)\) THEN (\d+)`)
+	code := regexp.MustCompile(`'([A-Z]{3})'`)
+	for _, m := range when.FindAllStringSubmatch(string(data), -1) {
+		n, _ := strconv.Atoi(m[2])
+		for _, c := range code.FindAllStringSubmatch(m[1], -1) {
+			digits[money.Currency(c[1])] = int32(n)
+		}
+	}
+	if len(digits) == 0 {
+		t.Fatalf("no currencies found in %s", feesMigration)
+	}
+	return digits
+}
+
+// The fee shown at booking, money.Money.Percent, and the one the trigger
+// stores both round to the minor units of the currency; the two lists of
+// minor units must agree on every code.
+func TestCurrencyDigitsMatchTrigger(t *testing.T) {
+	sqlDigits := migrationDigits(t)
+	for a := 'A'; a <= 'Z'; a++ {
+		for b := 'A'; b <= 'Z'; b++ {
+			for c := 'A'; c <= 'Z'; c++ {
+				currency := money.Currency([]rune{a, b, c})
+				want, ok := sqlDigits[currency]
+				if !ok {
+					want = 2
+				}
+				if got := currency.Digits(); got != want {
+					t.Errorf("%s has %d digits in Go and %d in currency_digits", currency, got, want)
+				}
+			}
+		}
+	}
+}
+
+var feeCases = []struct {
+	amount   string
+	percent  string
+	currency money.Currency
+	fee      string
+}{
+	{"100.00", "8.00", "BRL", "8.00"},
+	{"10.05", "8.00", "BRL", "0.80"},
+	{"10.06", "12.50", "BRL", "1.26"},
+	{"0.06", "8.33", "USD", "0.00"},
+	{"199.99", "100", "EUR", "199.99"},
+	{"1250", "8.00", "JPY", "100"},
+	{"1256", "8.00", "JPY", "100"},
+	{"1257", "8.33", "JPY", "105"},
+	{"6.25", "8.00", "JPY", "1"},
+	{"12.35", "10.00", "KWD", "1.235"},
+	{"12.34", "8.33", "BHD", "1.028"},
+	{"100.00", "0", "BRL", "0.00"},
+}
+
+func TestPlatformFeeRounding(t *testing.T) {
+	for _, tc := range feeCases {
+		got := money.Money{Amount: money.MustParseDecimal(tc.amount), Currency: tc.currency}.Percent(money.MustParseDecimal(tc.percent))
+		if got.Amount.String() != tc.fee {
+			t.Errorf("%s%% of %s %s = %s, want %s", tc.percent, tc.amount, tc.currency, got.Amount, tc.fee)
+		}
+	}
+}
+
+// TestPlatformFeeMatchesTriggerSQL runs the trigger's rounding on a database
+// migrated up to currency_digits, when POSTGRES_HOST points at one.
+func TestPlatformFeeMatchesTriggerSQL(t *testing.T) {
+	if os.Getenv("POSTGRES_HOST") == "" {
+		t.Skip("POSTGRES_HOST is not set")
+	}
+	db, err := postgres.NewConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, tc := range feeCases {
+		var stored money.Decimal
+		err := db.QueryRow(`SELECT round($1::numeric * $2::numeric / 100, currency_digits($3))`,
+			tc.amount, tc.percent, string(tc.currency)).Scan(&stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shown := money.Money{Amount: money.MustParseDecimal(tc.amount), Currency: tc.currency}.Percent(money.MustParseDecimal(tc.percent))
+		if stored.Cmp(shown.Amount) != 0 {
+			t.Errorf("%s%% of %s %s is %s at booking and %s stored", tc.percent, tc.amount, tc.currency, shown.Amount, stored)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package payments
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/genda/genda-api/internal/app"
+	"github.com/genda/genda-api/internal/storage/postgres"
+	"github.com/julienschmidt/httprouter"
+)
+
+type handler struct {
+	service Service
+}
+
+func NewHandler(postgresDB *sql.DB) *handler {
+	repository := NewPaymentRepository(postgresDB)
+
+	return &handler{
+		service: newConfiguredService(repository),
+	}
+}
+
+// POST /stores/:id/appointments/:appointmentId/checkout
+func (h *handler) Checkout(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	// The body is optional, an empty one checks out with the defaults.
+	var req CheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.Checkout(ctx, p.ByName("id"), p.ByName("appointmentId"), req)
+	if err != nil {
+		respondError(w, "Failed to check out appointment", err)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /stores/:id/payments?page={page}&limit={limit}
+func (h *handler) GetStorePayments(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	query := r.URL.Query()
+
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 10
+	}
+
+	res, err := h.service.GetStorePayments(p.ByName("id"), page, limit)
+	if err != nil {
+		transformError(w, "Failed to get payments", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /stores/:id/payments/:paymentId
+func (h *handler) GetPayment(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.GetPayment(p.ByName("id"), p.ByName("paymentId"))
+	if err != nil {
+		transformError(w, "Failed to get payment", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// POST /stores/:id/payments/:paymentId/capture
+func (h *handler) CapturePayment(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.CapturePayment(ctx, p.ByName("id"), p.ByName("paymentId"))
+	if err != nil {
+		respondError(w, "Failed to capture payment", err)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// POST /stores/:id/payments/:paymentId/cancel
+func (h *handler) CancelPayment(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.CancelPayment(ctx, p.ByName("id"), p.ByName("paymentId"))
+	if err != nil {
+		respondError(w, "Failed to cancel payment", err)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// POST /stores/:id/payments/:paymentId/refunds
+func (h *handler) CreateRefund(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	// The body is optional, an empty one refunds all that is left.
+	var req CreateRefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.CreateRefund(ctx, p.ByName("id"), p.ByName("paymentId"), req)
+	if err != nil {
+		respondError(w, "Failed to refund payment", err)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /stores/:id/payments/:paymentId/refunds
+func (h *handler) GetRefunds(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.GetRefunds(p.ByName("id"), p.ByName("paymentId"))
+	if err != nil {
+		transformError(w, "Failed to get refunds", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// POST /webhooks/payments/:provider
+func (h *handler) ReceiveWebhook(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.ReceiveWebhook(p.ByName("provider"), r.Header, body)
+	if err != nil {
+		transformError(w, "Failed to receive webhook", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /webhook-events?provider={provider}&status={status}&page={page}&limit={limit}
+func (h *handler) GetWebhookEvents(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	query := r.URL.Query()
+
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 10
+	}
+
+	res, err := h.service.GetWebhookEvents(query.Get("provider"), query.Get("status"), page, limit)
+	if err != nil {
+		transformError(w, "Failed to get webhook events", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// POST /webhook-events/:id/replay
+func (h *handler) ReplayWebhookEvent(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.ReplayWebhookEvent(p.ByName("id"))
+	if err != nil {
+		respondError(w, "Failed to replay webhook event", err)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /stores/:id/platform-fee
+func (h *handler) GetStorePlatformFee(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.GetStorePlatformFee(p.ByName("id"))
+	if err != nil {
+		transformError(w, "Failed to get platform fee", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// PUT /stores/:id/platform-fee
+func (h *handler) UpdateStorePlatformFee(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	var req UpdatePlatformFeeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.UpdateStorePlatformFee(p.ByName("id"), req)
+	if err != nil {
+		transformError(w, "Failed to update platform fee", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /stores/:id/plans/:planId/platform-fee
+func (h *handler) GetPlanPlatformFee(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.GetPlanPlatformFee(p.ByName("id"), p.ByName("planId"))
+	if err != nil {
+		transformError(w, "Failed to get platform fee", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// PUT /stores/:id/plans/:planId/platform-fee
+func (h *handler) UpdatePlanPlatformFee(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	var req UpdatePlatformFeeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.UpdatePlanPlatformFee(p.ByName("id"), p.ByName("planId"), req)
+	if err != nil {
+		transformError(w, "Failed to update platform fee", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// transform error for response api
+func transformError(w http.ResponseWriter, m string, e string) {
+	var data = app.ValidateError{
+		Message: m,
+		Error:   e,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(data)
+}
+
+// respondError answers conflicts with a 409 and anything else as
+// transformError does.
+func respondError(w http.ResponseWriter, m string, err error) {
+	var conflict *postgres.ConflictError
+	if !errors.As(err, &conflict) {
+		transformError(w, m, err.Error())
+		return
+	}
+
+	var data = app.ConflictResponse{
+		Message:  m,
+		Error:    conflict.Message,
+		Conflict: conflict.Conflict,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,71 @@
+package payments
+
+import (
+	"encoding/json"
+
+	"github.com/genda/genda-api/pkg/money"
+)
+
+const (
+	PaymentStatusRequiresPaymentMethod = "requires_payment_method"
+	PaymentStatusProcessing            = "processing"
+	PaymentStatusSucceeded             = "succeeded"
+	PaymentStatusPartiallyRefunded     = "partially_refunded"
+	PaymentStatusRefunded              = "refunded"
+	PaymentStatusFailed                = "failed"
+	PaymentStatusCanceled              = "canceled"
+)
+
+// Payment is a charge to a customer through a provider. A checkout starts it
+// as requires_payment_method, the provider authorizes it into processing and
+// capturing it makes it succeeded. The platform fee, the processing fee and
+// the net amount are worked out by the database from amount_total, at the
+// rate of the store when the payment was created.
+type Payment struct {
+	Id                  string          `json:"id"`
+	StoreId             string          `json:"store_id"`
+	UserId              string          `json:"user_id"`
+	AppointmentId       string          `json:"appointment_id"`
+	SubscriptionId      string          `json:"subscription_id"`
+	Provider            string          `json:"provider"`
+	ProviderPaymentId   string          `json:"provider_payment_id"`
+	Status              string          `json:"status"`
+	Currency            money.Currency  `json:"currency"`
+	AmountTotal         money.Decimal   `json:"amount_total"`
+	FeePlatformPct      money.Decimal   `json:"fee_platform_pct"`
+	FeePlatformAmount   money.Decimal   `json:"fee_platform_amount"`
+	FeeProcessingAmount money.Decimal   `json:"fee_processing_amount"`
+	AmountNet           money.Decimal   `json:"amount_net"`
+	CapturedAt          string          `json:"captured_at"`
+	RefundedAmount      money.Decimal   `json:"refunded_amount"`
+	Metadata            json.RawMessage `json:"metadata,omitempty"`
+	CreatedAt           string          `json:"created_at"`
+	UpdatedAt           string          `json:"updated_at"`
+}
+
+type GetPaymentsResponse struct {
+	Total    int       `json:"total"`
+	Limit    int       `json:"limit"`
+	Payments []Payment `json:"payments"`
+}
+
+// CheckoutRequest pays for an appointment. Provider defaults to the one the
+// configuration sets; AuthorizeOnly leaves the payment to be captured later,
+// at the visit.
+type CheckoutRequest struct {
+	Provider      string `json:"provider"`
+	AuthorizeOnly bool   `json:"authorize_only"`
+}
+
+// checkoutAppointment is what a checkout needs to know of the appointment,
+// with the status of the payment it is linked to, if any.
+type checkoutAppointment struct {
+	Id            string
+	StoreId       string
+	UserId        string
+	Status        string
+	Price         money.Decimal
+	Currency      money.Currency
+	PaymentId     string
+	PaymentStatus string
+}
@@ -0,0 +1,216 @@
+package payments
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/genda/genda-api/pkg/money"
+)
+
+// defaultCurrency is what amounts without a currency are charged in, as the
+// payments table does.
+const defaultCurrency money.Currency = "BRL"
+
+// Penalty is a fee charged to a customer over an appointment, for canceling
+// it late or not showing up. PaymentId is the payment of the appointment, if
+// it has one, and Refund gives back what the payment has left over the fee.
+type Penalty struct {
+	StoreId       string
+	UserId        string
+	AppointmentId string
+	PaymentId     string
+	Kind          string
+	Percent       money.Decimal
+	Amount        money.Money
+	Reason        string
+	Refund        bool
+}
+
+// penaltyRecord is how a penalty is written in payment metadata.
+type penaltyRecord struct {
+	Type    string        `json:"type"`
+	Percent money.Decimal `json:"fee_percent"`
+	Amount  money.Decimal `json:"amount"`
+	Reason  string        `json:"reason"`
+}
+
+// refundable is a captured payment locked for refunding, with what is left
+// of it once the refunds still pending are counted.
+type refundable struct {
+	Status            string
+	Provider          string
+	ProviderPaymentId string
+	Currency          money.Currency
+	Left              money.Decimal
+}
+
+// refundAmount checks a refund of amount against what is left of the
+// payment and returns what to refund, all that is left for a zero amount.
+func (r *refundable) refundAmount(amount money.Decimal) (money.Decimal, error) {
+	if r.Status != PaymentStatusSucceeded && r.Status != PaymentStatusPartiallyRefunded {
+		return money.Decimal{}, fmt.Errorf("a %s payment can't be refunded", r.Status)
+	}
+	if r.Left.Sign() <= 0 {
+		return money.Decimal{}, errors.New("the payment has nothing left to refund")
+	}
+	if err := checkDigits(money.Money{Amount: amount, Currency: r.Currency}, "refund"); err != nil {
+		return money.Decimal{}, err
+	}
+	if amount.IsZero() {
+		return r.Left, nil
+	}
+	if amount.Cmp(r.Left) > 0 {
+		return money.Decimal{}, fmt.Errorf("the refund can't be more than the %s left to refund", r.Left)
+	}
+	return amount, nil
+}
+
+// RecordPenalty records the penalty inside tx, which the caller commits. A
+// captured payment keeps the fee, noted in its metadata, and with Refund the
+// rest is given back through a pending refund the refund worker submits.
+// Without one the fee is recorded as a payment the customer owes.
+func RecordPenalty(tx *sql.Tx, p Penalty) error {
+	if p.Amount.Currency == "" {
+		p.Amount.Currency = defaultCurrency
+	}
+	if _, err := money.New(p.Amount.Amount, p.Amount.Currency); err != nil {
+		return err
+	}
+	if err := checkDigits(p.Amount, "penalty"); err != nil {
+		return err
+	}
+
+	metadata, err := json.Marshal(penaltyRecord{
+		Type:    p.Kind,
+		Percent: p.Percent,
+		Amount:  p.Amount.Amount,
+		Reason:  p.Reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	if p.PaymentId != "" {
+		payment, err := lockRefundable(tx, p.PaymentId)
+		if err != nil {
+			return err
+		}
+		if payment.Status == PaymentStatusSucceeded || payment.Status == PaymentStatusPartiallyRefunded {
+			return keepPenalty(tx, p, payment, metadata)
+		}
+	}
+
+	if p.Amount.Amount.Sign() <= 0 {
+		return nil
+	}
+	const chargeSQL = `
+		INSERT INTO payments
+			(store_id, user_id, appointment_id, status, currency, amount_total, metadata)
+		VALUES
+			($1,$2,$3,'requires_payment_method',$4,$5,$6::json)
+	`
+	_, err = tx.Exec(chargeSQL,
+		p.StoreId,
+		p.UserId,
+		p.AppointmentId,
+		p.Amount.Currency,
+		p.Amount.Amount,
+		string(metadata),
+	)
+	if err != nil {
+		log.Println("An error occurred while recording penalty charge", err)
+		return err
+	}
+	return nil
+}
+
+// keepPenalty keeps the fee out of the captured payment and, when asked,
+// refunds the rest of it.
+func keepPenalty(tx *sql.Tx, p Penalty, payment *refundable, metadata []byte) error {
+	if p.Amount.Currency != payment.Currency {
+		return fmt.Errorf("the penalty is in %s but the payment in %s", p.Amount.Currency, payment.Currency)
+	}
+
+	if p.Amount.Amount.Sign() > 0 {
+		const noteSQL = `
+			UPDATE payments
+			SET metadata = (COALESCE(metadata::jsonb, '{}'::jsonb) || jsonb_build_object('penalty', $2::jsonb))::json,
+				updated_at = now()
+			WHERE id = $1
+		`
+		if _, err := tx.Exec(noteSQL, p.PaymentId, string(metadata)); err != nil {
+			log.Println("An error occurred while recording penalty on payment", err)
+			return err
+		}
+	}
+
+	if !p.Refund {
+		return nil
+	}
+	amount := payment.Left.Sub(p.Amount.Amount)
+	if amount.Sign() <= 0 {
+		return nil
+	}
+	_, err := insertRefund(tx, p.PaymentId, amount, p.Reason, 0)
+	return err
+}
+
+// lockRefundable locks the payment for a refund and reads what is left of it.
+func lockRefundable(tx *sql.Tx, paymentId string) (*refundable, error) {
+	const sqlStmt = `
+		SELECT
+			p.status,
+			COALESCE(p.provider, ''),
+			COALESCE(p.provider_payment_id, ''),
+			p.currency,
+			p.amount_total - COALESCE(p.refunded_amount, 0) - COALESCE((
+				SELECT SUM(r.amount) FROM refunds r
+				WHERE r.payment_id = p.id AND r.status = 'pending'
+			), 0)
+		FROM payments p
+		WHERE p.id = $1
+		FOR UPDATE OF p
+	`
+	var r refundable
+	err := tx.QueryRow(sqlStmt, paymentId).Scan(&r.Status, &r.Provider, &r.ProviderPaymentId, &r.Currency, &r.Left)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("payment %s not found", paymentId)
+	}
+	if err != nil {
+		log.Println("An error occurred while getting payment for refund", err)
+		return nil, err
+	}
+	return &r, nil
+}
+
+// insertRefund records a pending refund. With a lease it is taken by the
+// caller to submit right away, otherwise the refund worker submits it.
+func insertRefund(tx *sql.Tx, paymentId string, amount money.Decimal, reason string, lease time.Duration) (string, error) {
+	const sqlStmt = `
+		INSERT INTO refunds
+			(payment_id, status, amount, reason, attempts, locked_until)
+		VALUES
+			($1,'pending',$2,NULLIF($3,''),
+				CASE WHEN $4::float8 > 0 THEN 1 ELSE 0 END,
+				CASE WHEN $4::float8 > 0 THEN now() + make_interval(secs => $4::float8) END)
+		RETURNING id;
+	`
+	var id string
+	if err := tx.QueryRow(sqlStmt, paymentId, amount, reason, lease.Seconds()).Scan(&id); err != nil {
+		log.Println("An error occurred while creating refund", err)
+		return "", err
+	}
+	return id, nil
+}
+
+// checkDigits refuses amounts with more decimal places than their currency.
+func checkDigits(m money.Money, what string) error {
+	if m.Amount.Round(m.Currency.Digits()).Cmp(m.Amount) != 0 {
+		return fmt.Errorf("the %s can't have more than %d decimal places in %s", what, m.Currency.Digits(), m.Currency)
+	}
+	return nil
+}
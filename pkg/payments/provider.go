@@ -0,0 +1,95 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/genda/genda-api/pkg/money"
+)
+
+// ErrPaymentDeclined is returned by a provider that refused to authorize the
+// payment.
+var ErrPaymentDeclined = errors.New("the payment was declined")
+
+// ErrProviderPaymentNotFound is returned by a provider that has no payment
+// with the id.
+var ErrProviderPaymentNotFound = errors.New("the payment was not found at the provider")
+
+// ErrRefundDeclined is returned by a provider that refused the refund.
+var ErrRefundDeclined = errors.New("the refund was declined")
+
+// ErrInvalidSignature is returned for a webhook the provider didn't sign.
+var ErrInvalidSignature = errors.New("the webhook signature is invalid")
+
+// Charge is what the provider is asked to collect. Reference is our payment
+// id, providers keep it to make retries of the same payment safe.
+type Charge struct {
+	Reference   string
+	Amount      money.Money
+	Description string
+	Capture     bool
+}
+
+// ProviderPayment is how the provider reports a payment. FeeAmount is the
+// processing fee it keeps, zero when the call doesn't report one.
+type ProviderPayment struct {
+	Id        string
+	Status    string
+	FeeAmount money.Decimal
+}
+
+// RefundRequest is what the provider is asked to give back of a payment.
+// Reference is our refund id, providers keep it to make retries of the same
+// refund safe.
+type RefundRequest struct {
+	Reference         string
+	ProviderPaymentId string
+	Amount            money.Money
+	Reason            string
+}
+
+// ProviderRefund is how the provider reports a refund, Status in the terms
+// of the refunds table.
+type ProviderRefund struct {
+	Id     string
+	Status string
+}
+
+// ProviderEvent is a webhook event as the provider sent it.
+type ProviderEvent struct {
+	Id      string
+	Type    string
+	Payload json.RawMessage
+}
+
+// EventChange is what a webhook event says happened to one of our objects,
+// in our terms: Object is payment, refund, subscription or payout, Status
+// one of the statuses of its table. RefundedAmount is, for a payment, all
+// the provider has refunded of it so far, ours and any made on its side.
+type EventChange struct {
+	Object         string
+	ProviderId     string
+	Status         string
+	FeeAmount      money.Decimal
+	RefundedAmount money.Decimal
+	FailureCode    string
+}
+
+// Provider is a payment processor. Statuses are reported in our terms:
+// processing once authorized, succeeded once captured, canceled.
+type Provider interface {
+	// Name is how the provider is recorded on payments.
+	Name() string
+	CreatePayment(context.Context, Charge) (*ProviderPayment, error)
+	CapturePayment(context.Context, string) (*ProviderPayment, error)
+	CancelPayment(context.Context, string) (*ProviderPayment, error)
+	Refund(context.Context, RefundRequest) (*ProviderRefund, error)
+	// VerifyWebhook checks the signature of a webhook request and reads the
+	// event out of it.
+	VerifyWebhook(http.Header, []byte) (*ProviderEvent, error)
+	// EventChange reads the change an event carries, nil for events that
+	// change nothing of ours.
+	EventChange(ProviderEvent) (*EventChange, error)
+}
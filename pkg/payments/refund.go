@@ -0,0 +1,71 @@
+package payments
+
+import (
+	"errors"
+	"time"
+
+	"github.com/genda/genda-api/pkg/money"
+)
+
+const (
+	RefundStatusPending   = "pending"
+	RefundStatusSucceeded = "succeeded"
+	RefundStatusFailed    = "failed"
+	RefundStatusCanceled  = "canceled"
+)
+
+// refundBatch bounds how many refunds one run submits, the rest go in the
+// next run.
+const refundBatch = 50
+
+// refundLease is how long a refund being submitted is left to whoever
+// submits it before the worker may take it.
+const refundLease = 2 * time.Minute
+
+// maxRefundAttempts is how many times a refund is submitted before it is
+// left failed.
+const maxRefundAttempts = 6
+
+// refundRetryBackoff is the wait after the first failed submission, doubled
+// on each following one.
+const refundRetryBackoff = time.Minute
+
+// Refund gives back part or all of a captured payment. It stays pending
+// until the provider reports it succeeded, directly or by webhook.
+type Refund struct {
+	Id               string        `json:"id"`
+	PaymentId        string        `json:"payment_id"`
+	ProviderRefundId string        `json:"provider_refund_id"`
+	Status           string        `json:"status"`
+	Amount           money.Decimal `json:"amount"`
+	Reason           string        `json:"reason"`
+	Attempts         int           `json:"attempts"`
+	LastError        string        `json:"last_error"`
+	CreatedAt        string        `json:"created_at"`
+	UpdatedAt        string        `json:"updated_at"`
+}
+
+// CreateRefundRequest refunds Amount, or all that is left to refund when
+// it is left out.
+type CreateRefundRequest struct {
+	Amount money.Decimal `json:"amount"`
+	Reason string        `json:"reason"`
+}
+
+// refundSubmission is a pending refund with what the provider needs to make
+// it.
+type refundSubmission struct {
+	RefundId          string
+	Amount            money.Decimal
+	Reason            string
+	Attempts          int
+	Provider          string
+	ProviderPaymentId string
+	Currency          money.Currency
+}
+
+// terminalRefundError reports whether submitting the refund again can't go
+// better.
+func terminalRefundError(err error) bool {
+	return errors.Is(err, ErrRefundDeclined) || errors.Is(err, ErrProviderPaymentNotFound)
+}
@@ -0,0 +1,230 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genda/genda-api/pkg/money"
+)
+
+func TestRefundAmount(t *testing.T) {
+	d := money.MustParseDecimal
+	tests := []struct {
+		name    string
+		payment refundable
+		amount  string
+		want    string
+		err     string
+	}{
+		{"partial", refundable{Status: PaymentStatusSucceeded, Currency: "BRL", Left: d("100.00")}, "30.00", "30.00", ""},
+		{"all that is left", refundable{Status: PaymentStatusSucceeded, Currency: "BRL", Left: d("100.00")}, "100", "100", ""},
+		{"zero refunds what is left", refundable{Status: PaymentStatusPartiallyRefunded, Currency: "BRL", Left: d("70.00")}, "0", "70.00", ""},
+		{"second partial", refundable{Status: PaymentStatusPartiallyRefunded, Currency: "BRL", Left: d("70.00")}, "69.99", "69.99", ""},
+		{"over refund", refundable{Status: PaymentStatusSucceeded, Currency: "BRL", Left: d("100.00")}, "100.01", "", "can't be more than the 100.00 left"},
+		{"over what partial refunds left", refundable{Status: PaymentStatusPartiallyRefunded, Currency: "BRL", Left: d("70.00")}, "80", "", "can't be more than the 70.00 left"},
+		{"already refunded", refundable{Status: PaymentStatusRefunded, Currency: "BRL", Left: d("0.00")}, "10", "", "a refunded payment can't be refunded"},
+		{"pending refunds take the rest", refundable{Status: PaymentStatusPartiallyRefunded, Currency: "BRL", Left: d("0.00")}, "0", "", "nothing left to refund"},
+		{"not captured", refundable{Status: PaymentStatusProcessing, Currency: "BRL", Left: d("100.00")}, "10", "", "a processing payment can't be refunded"},
+		{"failed", refundable{Status: PaymentStatusFailed, Currency: "BRL", Left: d("100.00")}, "0", "", "a failed payment can't be refunded"},
+		{"past the cents", refundable{Status: PaymentStatusSucceeded, Currency: "BRL", Left: d("100.00")}, "10.005", "", "more than 2 decimal places in BRL"},
+		{"yen have no cents", refundable{Status: PaymentStatusSucceeded, Currency: "JPY", Left: d("1000")}, "10.5", "", "more than 0 decimal places in JPY"},
+		{"trailing zeros are fine", refundable{Status: PaymentStatusSucceeded, Currency: "JPY", Left: d("1000")}, "10.00", "10.00", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.payment.refundAmount(d(tc.amount))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("got %s, %v, want an error with %q", got, err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+// refundRepository keeps payments and their refunds the way the SQL does,
+// counting pending refunds in what is left.
+type refundRepository struct {
+	Repository
+	payments map[string]*Payment
+	refunds  map[string]*Refund
+	changes  []EventChange
+	from     [][]string
+}
+
+func newRefundRepository(payments ...Payment) *refundRepository {
+	r := &refundRepository{payments: map[string]*Payment{}, refunds: map[string]*Refund{}}
+	for _, p := range payments {
+		p := p
+		r.payments[p.Id] = &p
+	}
+	return r
+}
+
+func (r *refundRepository) GetPayment(storeId string, id string) (*Payment, error) {
+	p, ok := r.payments[id]
+	if !ok || p.StoreId != storeId {
+		return nil, fmt.Errorf("payment %s not found", id)
+	}
+	payment := *p
+	return &payment, nil
+}
+
+func (r *refundRepository) left(paymentId string) money.Decimal {
+	p := r.payments[paymentId]
+	left := p.AmountTotal.Sub(p.RefundedAmount)
+	for _, refund := range r.refunds {
+		if refund.PaymentId == paymentId && refund.Status == RefundStatusPending {
+			left = left.Sub(refund.Amount)
+		}
+	}
+	return left
+}
+
+func (r *refundRepository) CreateRefund(paymentId string, amount money.Decimal, reason string, lease time.Duration) (*refundSubmission, error) {
+	p, ok := r.payments[paymentId]
+	if !ok {
+		return nil, fmt.Errorf("payment %s not found", paymentId)
+	}
+	payment := refundable{Status: p.Status, Provider: p.Provider, ProviderPaymentId: p.ProviderPaymentId, Currency: p.Currency, Left: r.left(paymentId)}
+	amount, err := payment.refundAmount(amount)
+	if err != nil {
+		return nil, err
+	}
+	id := fmt.Sprintf("refund-%d", len(r.refunds)+1)
+	r.refunds[id] = &Refund{Id: id, PaymentId: paymentId, Status: RefundStatusPending, Amount: amount, Reason: reason, Attempts: 1}
+	return &refundSubmission{RefundId: id, Amount: amount, Reason: reason, Attempts: 1, Provider: p.Provider, ProviderPaymentId: p.ProviderPaymentId, Currency: p.Currency}, nil
+}
+
+func (r *refundRepository) FinishRefund(id string, result ProviderRefund, lastError string, retryAt time.Time) (*Refund, error) {
+	refund := r.refunds[id]
+	refund.Status, refund.ProviderRefundId, refund.LastError = result.Status, result.Id, lastError
+	if refund.Status == RefundStatusSucceeded {
+		p := r.payments[refund.PaymentId]
+		p.RefundedAmount = p.RefundedAmount.Add(refund.Amount)
+		p.Status = PaymentStatusPartiallyRefunded
+		if p.RefundedAmount.Cmp(p.AmountTotal) >= 0 {
+			p.Status = PaymentStatusRefunded
+		}
+	}
+	copied := *refund
+	return &copied, nil
+}
+
+func (r *refundRepository) GetRefunds(paymentId string) ([]Refund, error) {
+	refunds := []Refund{}
+	for _, refund := range r.refunds {
+		if refund.PaymentId == paymentId {
+			refunds = append(refunds, *refund)
+		}
+	}
+	return refunds, nil
+}
+
+func (r *refundRepository) ApplyEventChange(provider string, change EventChange, from []string) (bool, error) {
+	r.changes = append(r.changes, change)
+	r.from = append(r.from, from)
+	return true, nil
+}
+
+func TestCreateRefund(t *testing.T) {
+	ctx := context.Background()
+	d := money.MustParseDecimal
+	repo := newRefundRepository(Payment{
+		Id:                "payment-1",
+		StoreId:           "store-1",
+		Provider:          "fake",
+		ProviderPaymentId: fakeIdPrefix + "1",
+		Status:            PaymentStatusSucceeded,
+		Currency:          "BRL",
+		AmountTotal:       d("100.00"),
+	})
+	s := NewService(repo, "fake", NewFakeProvider(""))
+
+	refund := func(storeId string, amount string) (*Refund, error) {
+		return s.CreateRefund(ctx, storeId, "payment-1", CreateRefundRequest{Amount: d(amount)})
+	}
+
+	if _, err := refund("store-2", "10"); err == nil {
+		t.Error("refunded the payment of another store")
+	}
+	if _, err := s.GetRefunds("store-2", "payment-1"); err == nil {
+		t.Error("listed the refunds of another store's payment")
+	}
+	if len(repo.refunds) != 0 {
+		t.Fatalf("another store's refund was recorded: %+v", repo.refunds)
+	}
+
+	if _, err := refund("store-1", "-1"); err == nil {
+		t.Error("negative refund accepted")
+	}
+
+	r, err := refund("store-1", "30.00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != RefundStatusSucceeded || r.Amount.String() != "30.00" {
+		t.Errorf("partial refund is %+v", r)
+	}
+	if p := repo.payments["payment-1"]; p.Status != PaymentStatusPartiallyRefunded || p.RefundedAmount.String() != "30.00" {
+		t.Errorf("after the partial refund the payment is %s with %s refunded", p.Status, p.RefundedAmount)
+	}
+
+	if _, err := refund("store-1", "70.01"); err == nil || !strings.Contains(err.Error(), "70.00 left") {
+		t.Errorf("over refund: got %v", err)
+	}
+
+	r, err = refund("store-1", "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Amount.String() != "70.00" {
+		t.Errorf("refunding the rest gave back %s, want 70.00", r.Amount)
+	}
+	if p := repo.payments["payment-1"]; p.Status != PaymentStatusRefunded {
+		t.Errorf("after refunding the rest the payment is %s", p.Status)
+	}
+
+	if _, err := refund("store-1", "0"); err == nil {
+		t.Error("refunded a refunded payment")
+	}
+	refunds, err := s.GetRefunds("store-1", "payment-1")
+	if err != nil || len(refunds) != 2 {
+		t.Errorf("got %d refunds, %v, want 2", len(refunds), err)
+	}
+}
+
+func TestProcessEventRefundedAmount(t *testing.T) {
+	repo := newRefundRepository()
+	s := NewService(repo, "fake", NewFakeProvider("")).(*service)
+
+	payload := `{"id":"evt_1","type":"charge.refunded","data":{"object":"payment","id":"fake_pay_1","status":"partially_refunded","amount_refunded":"50.00"}}`
+	status, err := s.processEvent(claimedEvent{Provider: "fake", Event: ProviderEvent{Id: "evt_1", Type: "charge.refunded", Payload: []byte(payload)}})
+	if err != nil || status != WebhookStatusProcessed {
+		t.Fatalf("got %s, %v", status, err)
+	}
+	if len(repo.changes) != 1 || repo.changes[0].RefundedAmount.String() != "50.00" {
+		t.Fatalf("applied %+v, want the refunded total of 50.00", repo.changes)
+	}
+
+	// A further partial refund raises the total of a partially refunded
+	// payment.
+	partial := false
+	for _, from := range repo.from[0] {
+		partial = partial || from == PaymentStatusPartiallyRefunded
+	}
+	if !partial {
+		t.Errorf("a partially refunded payment can't take another partial refund, from %v", repo.from[0])
+	}
+}
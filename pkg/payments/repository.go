@@ -0,0 +1,871 @@
+package payments
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/genda/genda-api/internal/storage/postgres"
+	"github.com/genda/genda-api/pkg/money"
+)
+
+// checkoutConstraint names the conflict of two checkouts of one appointment
+// racing each other.
+const checkoutConstraint = "appointment_checkout"
+
+const paymentColumns = `
+			id,
+			store_id,
+			user_id,
+			COALESCE(appointment_id::text, ''),
+			COALESCE(subscription_id::text, ''),
+			COALESCE(provider, ''),
+			COALESCE(provider_payment_id, ''),
+			status,
+			currency,
+			amount_total,
+			fee_platform_pct,
+			COALESCE(fee_platform_amount, 0),
+			COALESCE(fee_processing_amount, 0),
+			COALESCE(amount_net, 0),
+			captured_at,
+			COALESCE(refunded_amount, 0),
+			metadata,
+			created_at,
+			updated_at`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+type PaymentRepo struct {
+	postgresDB *sql.DB
+}
+
+func NewPaymentRepository(postgresDB *sql.DB) *PaymentRepo {
+	return &PaymentRepo{postgresDB: postgresDB}
+}
+
+func (i *PaymentRepo) GetCheckoutAppointment(storeId string, appointmentId string) (*checkoutAppointment, error) {
+	const sqlStmt = `
+		SELECT
+			a.id,
+			a.store_id,
+			a.user_id,
+			a.status,
+			COALESCE(a.price, 0),
+			COALESCE(NULLIF(a.currency, ''), 'BRL'),
+			COALESCE(a.payment_id::text, ''),
+			COALESCE(p.status, '')
+		FROM store_appointments a
+		LEFT JOIN payments p ON p.id = a.payment_id
+		WHERE a.id = $1 AND a.store_id = $2;
+	`
+	var a checkoutAppointment
+	err := i.postgresDB.QueryRow(sqlStmt, appointmentId, storeId).Scan(
+		&a.Id,
+		&a.StoreId,
+		&a.UserId,
+		&a.Status,
+		&a.Price,
+		&a.Currency,
+		&a.PaymentId,
+		&a.PaymentStatus,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("appointment %s not found", appointmentId)
+		}
+		log.Println("An error occurred while getting appointment for checkout", err)
+		return nil, err
+	}
+	return &a, nil
+}
+
+// CreateAppointmentPayment records the payment and links the appointment to
+// it, as long as the appointment is still linked to previousPaymentId.
+func (i *PaymentRepo) CreateAppointmentPayment(payment Payment, previousPaymentId string) (*Payment, error) {
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting appointment checkout", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	const insertSQL = `
+		INSERT INTO payments
+			(store_id, user_id, appointment_id, provider, status, currency, amount_total)
+		VALUES
+			($1,$2,$3,$4,$5,$6,$7)
+		RETURNING ` + paymentColumns + `;
+	`
+	created, err := i.formatPayment(tx.QueryRow(insertSQL,
+		payment.StoreId,
+		payment.UserId,
+		payment.AppointmentId,
+		payment.Provider,
+		payment.Status,
+		payment.Currency,
+		payment.AmountTotal,
+	))
+	if err != nil {
+		log.Println("An error occurred while creating payment", err)
+		return nil, err
+	}
+
+	const linkSQL = `
+		UPDATE store_appointments
+		SET payment_id = $2, updated_at = now()
+		WHERE id = $1 AND COALESCE(payment_id::text, '') = $3
+	`
+	res, err := tx.Exec(linkSQL, payment.AppointmentId, created.Id, previousPaymentId)
+	if err != nil {
+		log.Println("An error occurred while linking appointment payment", err)
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, &postgres.ConflictError{
+			Constraint: checkoutConstraint,
+			Message:    "the appointment is being checked out already",
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing appointment checkout", err)
+		return nil, err
+	}
+	return created, nil
+}
+
+func (i *PaymentRepo) GetPayment(storeId string, id string) (*Payment, error) {
+	const sqlStmt = `
+		SELECT ` + paymentColumns + `
+		FROM payments
+		WHERE id = $1 AND store_id = $2;
+	`
+	payment, err := i.formatPayment(i.postgresDB.QueryRow(sqlStmt, id, storeId))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("payment %s not found", id)
+		}
+		log.Println("An error occurred while getting payment", err)
+		return nil, err
+	}
+	return payment, nil
+}
+
+func (i *PaymentRepo) GetStorePayments(storeId string, page int, limit int) (*GetPaymentsResponse, error) {
+	const countStmt = `SELECT COUNT(*) FROM payments WHERE store_id = $1`
+	var total int
+	if err := i.postgresDB.QueryRow(countStmt, storeId).Scan(&total); err != nil {
+		log.Println("An error occurred while counting payments", err)
+		return nil, err
+	}
+
+	const sqlStmt = `
+		SELECT ` + paymentColumns + `
+		FROM payments
+		WHERE store_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, storeId, limit, (page-1)*limit)
+	if err != nil {
+		log.Println("An error occurred while getting payments", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []Payment{}
+	for rows.Next() {
+		payment, err := i.formatPayment(rows)
+		if err != nil {
+			log.Println("An error occurred while scanning payment", err)
+			return nil, err
+		}
+		payments = append(payments, *payment)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting payments", err)
+		return nil, err
+	}
+
+	return &GetPaymentsResponse{
+		Total:    total,
+		Limit:    limit,
+		Payments: payments,
+	}, nil
+}
+
+// UpdatePaymentStatus moves the payment from one status to another with what
+// the provider reported. A payment that left from in the meantime is a
+// conflict.
+func (i *PaymentRepo) UpdatePaymentStatus(id string, from string, result ProviderPayment) (*Payment, error) {
+	const sqlStmt = `
+		UPDATE payments
+		SET status = $3,
+			provider_payment_id = COALESCE(NULLIF($4,''), provider_payment_id),
+			fee_processing_amount = CASE WHEN $5::numeric > 0 THEN $5::numeric ELSE fee_processing_amount END,
+			captured_at = CASE WHEN $3 = 'succeeded' THEN now() ELSE captured_at END,
+			updated_at = now()
+		WHERE id = $1 AND status = $2
+		RETURNING ` + paymentColumns + `;
+	`
+	payment, err := i.formatPayment(i.postgresDB.QueryRow(sqlStmt, id, from, result.Status, result.Id, result.FeeAmount))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &postgres.ConflictError{
+				Constraint: "payment_status",
+				Message:    fmt.Sprintf("payment %s is no longer %s", id, from),
+			}
+		}
+		log.Println("An error occurred while updating payment status", err)
+		return nil, err
+	}
+	return payment, nil
+}
+
+func (i *PaymentRepo) GetStorePlatformFee(storeId string) (*PlatformFee, error) {
+	const sqlStmt = `
+		SELECT id, platform_fee_pct, platform_fee_pct(id, NULL)
+		FROM stores
+		WHERE id = $1;
+	`
+	fee := PlatformFee{}
+	err := i.postgresDB.QueryRow(sqlStmt, storeId).Scan(&fee.StoreId, &fee.Percent, &fee.EffectivePercent)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("store %s not found", storeId)
+		}
+		log.Println("An error occurred while getting store platform fee", err)
+		return nil, err
+	}
+	return &fee, nil
+}
+
+func (i *PaymentRepo) UpdateStorePlatformFee(storeId string, percent *money.Decimal) (*PlatformFee, error) {
+	const sqlStmt = `
+		UPDATE stores
+		SET platform_fee_pct = $2, updated_at = now()
+		WHERE id = $1
+	`
+	res, err := i.postgresDB.Exec(sqlStmt, storeId, percent)
+	if err != nil {
+		log.Println("An error occurred while updating store platform fee", err)
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("store %s not found", storeId)
+	}
+	return i.GetStorePlatformFee(storeId)
+}
+
+func (i *PaymentRepo) GetPlanPlatformFee(storeId string, planId string) (*PlatformFee, error) {
+	const sqlStmt = `
+		SELECT store_id, id, platform_fee_pct, COALESCE(platform_fee_pct, platform_fee_pct(store_id, NULL))
+		FROM store_plans
+		WHERE id = $1 AND store_id = $2;
+	`
+	fee := PlatformFee{}
+	err := i.postgresDB.QueryRow(sqlStmt, planId, storeId).Scan(&fee.StoreId, &fee.PlanId, &fee.Percent, &fee.EffectivePercent)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("plan %s not found", planId)
+		}
+		log.Println("An error occurred while getting plan platform fee", err)
+		return nil, err
+	}
+	return &fee, nil
+}
+
+func (i *PaymentRepo) UpdatePlanPlatformFee(storeId string, planId string, percent *money.Decimal) (*PlatformFee, error) {
+	const sqlStmt = `
+		UPDATE store_plans
+		SET platform_fee_pct = $3, updated_at = now()
+		WHERE id = $1 AND store_id = $2
+	`
+	res, err := i.postgresDB.Exec(sqlStmt, planId, storeId, percent)
+	if err != nil {
+		log.Println("An error occurred while updating plan platform fee", err)
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("plan %s not found", planId)
+	}
+	return i.GetPlanPlatformFee(storeId, planId)
+}
+
+func (i *PaymentRepo) formatPayment(row rowScanner) (*Payment, error) {
+	p := Payment{}
+
+	var capturedAt sql.NullString
+	var metadata []byte
+	err := row.Scan(
+		&p.Id,
+		&p.StoreId,
+		&p.UserId,
+		&p.AppointmentId,
+		&p.SubscriptionId,
+		&p.Provider,
+		&p.ProviderPaymentId,
+		&p.Status,
+		&p.Currency,
+		&p.AmountTotal,
+		&p.FeePlatformPct,
+		&p.FeePlatformAmount,
+		&p.FeeProcessingAmount,
+		&p.AmountNet,
+		&capturedAt,
+		&p.RefundedAmount,
+		&metadata,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	p.CapturedAt = capturedAt.String
+	if len(metadata) > 0 {
+		p.Metadata = metadata
+	}
+	return &p, nil
+}
+
+const webhookEventColumns = `
+			id,
+			provider,
+			event_id,
+			event_type,
+			status,
+			attempts,
+			COALESCE(last_error, ''),
+			payload,
+			received_at,
+			next_attempt_at,
+			processed_at`
+
+// SaveWebhookEvent stores the event unless the provider sent it before, and
+// reports whether it was stored.
+func (i *PaymentRepo) SaveWebhookEvent(provider string, event ProviderEvent) (bool, error) {
+	const sqlStmt = `
+		INSERT INTO webhook_events
+			(provider, event_id, event_type, payload)
+		VALUES
+			($1,$2,$3,$4::json)
+		ON CONFLICT (provider, event_id) DO NOTHING
+		RETURNING id;
+	`
+	var id string
+	err := i.postgresDB.QueryRow(sqlStmt, provider, event.Id, event.Type, string(event.Payload)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		log.Println("An error occurred while saving webhook event", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// ClaimWebhookEvents takes up to limit pending events that are due, leasing
+// them so other workers leave them alone until the lease ends. They come
+// back in the order they were received.
+func (i *PaymentRepo) ClaimWebhookEvents(limit int, lease time.Duration) ([]claimedEvent, error) {
+	const sqlStmt = `
+		UPDATE webhook_events
+		SET locked_until = now() + make_interval(secs => $2), attempts = attempts + 1
+		WHERE id IN (
+			SELECT id FROM webhook_events
+			WHERE status = 'pending'
+				AND next_attempt_at <= now()
+				AND (locked_until IS NULL OR locked_until < now())
+			ORDER BY received_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, provider, event_id, event_type, payload, attempts, received_at
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, limit, lease.Seconds())
+	if err != nil {
+		log.Println("An error occurred while claiming webhook events", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []claimedEvent{}
+	for rows.Next() {
+		var e claimedEvent
+		var payload []byte
+		if err := rows.Scan(&e.Id, &e.Provider, &e.Event.Id, &e.Event.Type, &payload, &e.Attempts, &e.ReceivedAt); err != nil {
+			log.Println("An error occurred while scanning webhook event", err)
+			return nil, err
+		}
+		e.Event.Payload = payload
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while claiming webhook events", err)
+		return nil, err
+	}
+
+	sort.Slice(events, func(a, b int) bool { return events[a].ReceivedAt.Before(events[b].ReceivedAt) })
+	return events, nil
+}
+
+// FinishWebhookEvent records how processing a claimed event went. A pending
+// event is tried again at nextAttemptAt.
+func (i *PaymentRepo) FinishWebhookEvent(id string, status string, lastError string, nextAttemptAt time.Time) error {
+	const sqlStmt = `
+		UPDATE webhook_events
+		SET status = $2,
+			last_error = NULLIF($3,''),
+			next_attempt_at = CASE WHEN $2 = 'pending' THEN $4 ELSE next_attempt_at END,
+			processed_at = CASE WHEN $2 IN ('processed','ignored') THEN now() ELSE processed_at END,
+			locked_until = NULL
+		WHERE id = $1
+	`
+	if _, err := i.postgresDB.Exec(sqlStmt, id, status, lastError, nextAttemptAt); err != nil {
+		log.Println("An error occurred while finishing webhook event", err)
+		return err
+	}
+	return nil
+}
+
+func (i *PaymentRepo) GetWebhookEvent(id string) (*WebhookEvent, error) {
+	const sqlStmt = `
+		SELECT ` + webhookEventColumns + `
+		FROM webhook_events
+		WHERE id = $1;
+	`
+	event, err := i.formatWebhookEvent(i.postgresDB.QueryRow(sqlStmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("webhook event %s not found", id)
+		}
+		log.Println("An error occurred while getting webhook event", err)
+		return nil, err
+	}
+	return event, nil
+}
+
+// GetWebhookEvents lists the events, latest first. An empty provider or
+// status doesn't filter on it.
+func (i *PaymentRepo) GetWebhookEvents(provider string, status string, page int, limit int) (*GetWebhookEventsResponse, error) {
+	const countStmt = `
+		SELECT COUNT(*) FROM webhook_events
+		WHERE ($1 = '' OR provider = $1) AND ($2 = '' OR status = $2)
+	`
+	var total int
+	if err := i.postgresDB.QueryRow(countStmt, provider, status).Scan(&total); err != nil {
+		log.Println("An error occurred while counting webhook events", err)
+		return nil, err
+	}
+
+	const sqlStmt = `
+		SELECT ` + webhookEventColumns + `
+		FROM webhook_events
+		WHERE ($1 = '' OR provider = $1) AND ($2 = '' OR status = $2)
+		ORDER BY received_at DESC
+		LIMIT $3 OFFSET $4;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, provider, status, limit, (page-1)*limit)
+	if err != nil {
+		log.Println("An error occurred while getting webhook events", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []WebhookEvent{}
+	for rows.Next() {
+		event, err := i.formatWebhookEvent(rows)
+		if err != nil {
+			log.Println("An error occurred while scanning webhook event", err)
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting webhook events", err)
+		return nil, err
+	}
+
+	return &GetWebhookEventsResponse{
+		Total:  total,
+		Limit:  limit,
+		Events: events,
+	}, nil
+}
+
+// ReplayWebhookEvent puts a processed, ignored or failed event back in line
+// with a fresh set of attempts.
+func (i *PaymentRepo) ReplayWebhookEvent(id string) (*WebhookEvent, error) {
+	const sqlStmt = `
+		UPDATE webhook_events
+		SET status = 'pending', attempts = 0, next_attempt_at = now(), locked_until = NULL, processed_at = NULL
+		WHERE id = $1 AND status <> 'pending'
+		RETURNING ` + webhookEventColumns + `;
+	`
+	event, err := i.formatWebhookEvent(i.postgresDB.QueryRow(sqlStmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &postgres.ConflictError{
+				Constraint: "webhook_event_status",
+				Message:    fmt.Sprintf("webhook event %s is pending already", id),
+			}
+		}
+		log.Println("An error occurred while replaying webhook event", err)
+		return nil, err
+	}
+	return event, nil
+}
+
+// ApplyEventChange moves the object the change is about to its new status,
+// if it is in one of the from statuses; otherwise it is left as it is and
+// false returned. An object that isn't there is an error, its event may
+// have come before our own write.
+func (i *PaymentRepo) ApplyEventChange(provider string, change EventChange, from []string) (bool, error) {
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting webhook event change", err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var lockSQL string
+	switch change.Object {
+	case ObjectPayment:
+		lockSQL = `SELECT id, status FROM payments WHERE provider = $1 AND provider_payment_id = $2 FOR UPDATE`
+	case ObjectRefund:
+		lockSQL = `
+			SELECT r.id, r.status
+			FROM refunds r
+			JOIN payments p ON p.id = r.payment_id
+			WHERE p.provider = $1 AND r.provider_refund_id = $2
+			FOR UPDATE OF r
+		`
+	case ObjectSubscription:
+		lockSQL = `SELECT id, status FROM subscriptions WHERE provider = $1 AND provider_sub_id = $2 FOR UPDATE`
+	case ObjectPayout:
+		lockSQL = `SELECT id, status FROM payouts WHERE provider = $1 AND provider_transfer_id = $2 FOR UPDATE`
+	default:
+		return false, fmt.Errorf("unknown object %s", change.Object)
+	}
+
+	var id, status string
+	err = tx.QueryRow(lockSQL, provider, change.ProviderId).Scan(&id, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("no %s %s from %s", change.Object, change.ProviderId, provider)
+	}
+	if err != nil {
+		log.Println("An error occurred while getting webhook event object", err)
+		return false, err
+	}
+	if !slices.Contains(from, status) {
+		return false, nil
+	}
+
+	switch change.Object {
+	case ObjectPayment:
+		// A refund the event reports counts toward the payment like ours
+		// do, see refundSucceeded; the refunded total never goes down.
+		const sqlStmt = `
+			UPDATE payments
+			SET status = $2,
+				fee_processing_amount = CASE WHEN $3::numeric > 0 THEN $3::numeric ELSE fee_processing_amount END,
+				captured_at = CASE WHEN $2 = 'succeeded' THEN now() ELSE captured_at END,
+				refunded_amount = CASE
+					WHEN $2 = 'refunded' THEN amount_total
+					WHEN $2 = 'partially_refunded' THEN GREATEST(COALESCE(refunded_amount, 0), $4::numeric)
+					ELSE refunded_amount
+				END,
+				updated_at = now()
+			WHERE id = $1
+		`
+		_, err = tx.Exec(sqlStmt, id, change.Status, change.FeeAmount, change.RefundedAmount)
+	case ObjectRefund:
+		const sqlStmt = `UPDATE refunds SET status = $2, updated_at = now() WHERE id = $1`
+		if _, err = tx.Exec(sqlStmt, id, change.Status); err == nil && change.Status == "succeeded" {
+			err = refundSucceeded(tx, id)
+		}
+	case ObjectSubscription:
+		const sqlStmt = `
+			UPDATE subscriptions
+			SET status = $2,
+				canceled_at = CASE WHEN $2 = 'canceled' THEN now() ELSE canceled_at END,
+				updated_at = now()
+			WHERE id = $1
+		`
+		_, err = tx.Exec(sqlStmt, id, change.Status)
+	case ObjectPayout:
+		const sqlStmt = `
+			UPDATE payouts
+			SET status = $2,
+				paid_at = CASE WHEN $2 = 'paid' THEN now() ELSE paid_at END,
+				failure_code = COALESCE(NULLIF($3,''), failure_code)
+			WHERE id = $1
+		`
+		_, err = tx.Exec(sqlStmt, id, change.Status, change.FailureCode)
+	}
+	if err != nil {
+		log.Println("An error occurred while applying webhook event change", err)
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing webhook event change", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// refundSucceeded counts the refund in what its payment has refunded, and
+// marks the payment refunded once all of it is. The refunded total is the
+// sum of our succeeded refunds, or the total a payment event reported when
+// that is larger, so a refund both events report is counted once.
+func refundSucceeded(tx *sql.Tx, refundId string) error {
+	const sqlStmt = `
+		WITH refunded AS (
+			SELECT payment_id, SUM(amount) AS amount
+			FROM refunds
+			WHERE payment_id = (SELECT payment_id FROM refunds WHERE id = $1) AND status = 'succeeded'
+			GROUP BY payment_id
+		)
+		UPDATE payments p
+		SET refunded_amount = GREATEST(COALESCE(p.refunded_amount, 0), refunded.amount),
+			status = CASE
+				WHEN GREATEST(COALESCE(p.refunded_amount, 0), refunded.amount) >= p.amount_total THEN 'refunded'
+				ELSE 'partially_refunded'
+			END,
+			updated_at = now()
+		FROM refunded
+		WHERE p.id = refunded.payment_id
+	`
+	_, err := tx.Exec(sqlStmt, refundId)
+	return err
+}
+
+func (i *PaymentRepo) formatWebhookEvent(row rowScanner) (*WebhookEvent, error) {
+	e := WebhookEvent{}
+
+	var payload []byte
+	var processedAt sql.NullString
+	err := row.Scan(
+		&e.Id,
+		&e.Provider,
+		&e.EventId,
+		&e.EventType,
+		&e.Status,
+		&e.Attempts,
+		&e.LastError,
+		&payload,
+		&e.ReceivedAt,
+		&e.NextAttemptAt,
+		&processedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	e.Payload = payload
+	e.ProcessedAt = processedAt.String
+	return &e, nil
+}
+
+const refundColumns = `
+			id,
+			payment_id,
+			COALESCE(provider_refund_id, ''),
+			status,
+			amount,
+			COALESCE(reason, ''),
+			attempts,
+			COALESCE(last_error, ''),
+			created_at,
+			updated_at`
+
+// CreateRefund records a pending refund of amount, or of all that is left to
+// refund when amount is zero, leased to the caller to submit. What is left
+// counts the refunds still pending, so two refunds at once can't give back
+// more than was captured.
+func (i *PaymentRepo) CreateRefund(paymentId string, amount money.Decimal, reason string, lease time.Duration) (*refundSubmission, error) {
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting refund", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	payment, err := lockRefundable(tx, paymentId)
+	if err != nil {
+		return nil, err
+	}
+	if amount, err = payment.refundAmount(amount); err != nil {
+		return nil, err
+	}
+
+	s := refundSubmission{
+		Amount:            amount,
+		Reason:            reason,
+		Attempts:          1,
+		Provider:          payment.Provider,
+		ProviderPaymentId: payment.ProviderPaymentId,
+		Currency:          payment.Currency,
+	}
+	if s.RefundId, err = insertRefund(tx, paymentId, amount, reason, lease); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing refund", err)
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ClaimRefunds takes up to limit pending refunds never submitted to the
+// provider, leasing them so they are submitted once at a time.
+func (i *PaymentRepo) ClaimRefunds(limit int, lease time.Duration) ([]refundSubmission, error) {
+	const sqlStmt = `
+		WITH claimed AS (
+			UPDATE refunds
+			SET locked_until = now() + make_interval(secs => $2), attempts = attempts + 1, updated_at = now()
+			WHERE id IN (
+				SELECT id FROM refunds
+				WHERE status = 'pending'
+					AND provider_refund_id IS NULL
+					AND (locked_until IS NULL OR locked_until < now())
+				ORDER BY created_at ASC
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, payment_id, amount, COALESCE(reason, '') AS reason, attempts, created_at
+		)
+		SELECT c.id, c.amount, c.reason, c.attempts, COALESCE(p.provider, ''), COALESCE(p.provider_payment_id, ''), p.currency
+		FROM claimed c
+		JOIN payments p ON p.id = c.payment_id
+		ORDER BY c.created_at ASC;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, limit, lease.Seconds())
+	if err != nil {
+		log.Println("An error occurred while claiming refunds", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	submissions := []refundSubmission{}
+	for rows.Next() {
+		var s refundSubmission
+		if err := rows.Scan(&s.RefundId, &s.Amount, &s.Reason, &s.Attempts, &s.Provider, &s.ProviderPaymentId, &s.Currency); err != nil {
+			log.Println("An error occurred while scanning refund", err)
+			return nil, err
+		}
+		submissions = append(submissions, s)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while claiming refunds", err)
+		return nil, err
+	}
+
+	return submissions, nil
+}
+
+// FinishRefund records how submitting a refund went. A pending refund with
+// no provider id is submitted again after retryAt; once it succeeded, its
+// payment counts it as refunded.
+func (i *PaymentRepo) FinishRefund(id string, result ProviderRefund, lastError string, retryAt time.Time) (*Refund, error) {
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting refund update", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	const sqlStmt = `
+		UPDATE refunds
+		SET status = $2,
+			provider_refund_id = COALESCE(NULLIF($3,''), provider_refund_id),
+			last_error = NULLIF($4,''),
+			locked_until = CASE WHEN $2 = 'pending' AND NULLIF($3,'') IS NULL THEN $5 ELSE NULL END,
+			updated_at = now()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING ` + refundColumns + `;
+	`
+	refund, err := i.formatRefund(tx.QueryRow(sqlStmt, id, result.Status, result.Id, lastError, retryAt))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &postgres.ConflictError{
+				Constraint: "refund_status",
+				Message:    fmt.Sprintf("refund %s is no longer pending", id),
+			}
+		}
+		log.Println("An error occurred while updating refund", err)
+		return nil, err
+	}
+	if refund.Status == RefundStatusSucceeded {
+		if err := refundSucceeded(tx, id); err != nil {
+			log.Println("An error occurred while updating refunded payment", err)
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing refund update", err)
+		return nil, err
+	}
+	return refund, nil
+}
+
+func (i *PaymentRepo) GetRefunds(paymentId string) ([]Refund, error) {
+	const sqlStmt = `
+		SELECT ` + refundColumns + `
+		FROM refunds
+		WHERE payment_id = $1
+		ORDER BY created_at ASC;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, paymentId)
+	if err != nil {
+		log.Println("An error occurred while getting refunds", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	refunds := []Refund{}
+	for rows.Next() {
+		refund, err := i.formatRefund(rows)
+		if err != nil {
+			log.Println("An error occurred while scanning refund", err)
+			return nil, err
+		}
+		refunds = append(refunds, *refund)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting refunds", err)
+		return nil, err
+	}
+
+	return refunds, nil
+}
+
+func (i *PaymentRepo) formatRefund(row rowScanner) (*Refund, error) {
+	r := Refund{}
+	err := row.Scan(
+		&r.Id,
+		&r.PaymentId,
+		&r.ProviderRefundId,
+		&r.Status,
+		&r.Amount,
+		&r.Reason,
+		&r.Attempts,
+		&r.LastError,
+		&r.CreatedAt,
+		&r.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
@@ -0,0 +1,463 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/genda/genda-api/pkg/config"
+	"github.com/genda/genda-api/pkg/money"
+)
+
+type Service interface {
+	Checkout(context.Context, string, string, CheckoutRequest) (*Payment, error)
+	GetPayment(string, string) (*Payment, error)
+	GetStorePayments(string, int, int) (*GetPaymentsResponse, error)
+	CapturePayment(context.Context, string, string) (*Payment, error)
+	CancelPayment(context.Context, string, string) (*Payment, error)
+	CreateRefund(context.Context, string, string, CreateRefundRequest) (*Refund, error)
+	GetRefunds(string, string) ([]Refund, error)
+	SubmitPendingRefunds(context.Context) (int, error)
+	ReceiveWebhook(string, http.Header, []byte) (*WebhookReceipt, error)
+	ProcessWebhookEvents(context.Context) (int, error)
+	GetWebhookEvents(string, string, int, int) (*GetWebhookEventsResponse, error)
+	ReplayWebhookEvent(string) (*WebhookEvent, error)
+	GetStorePlatformFee(string) (*PlatformFee, error)
+	UpdateStorePlatformFee(string, UpdatePlatformFeeRequest) (*PlatformFee, error)
+	GetPlanPlatformFee(string, string) (*PlatformFee, error)
+	UpdatePlanPlatformFee(string, string, UpdatePlatformFeeRequest) (*PlatformFee, error)
+}
+
+type Repository interface {
+	GetCheckoutAppointment(string, string) (*checkoutAppointment, error)
+	CreateAppointmentPayment(Payment, string) (*Payment, error)
+	GetPayment(string, string) (*Payment, error)
+	GetStorePayments(string, int, int) (*GetPaymentsResponse, error)
+	UpdatePaymentStatus(string, string, ProviderPayment) (*Payment, error)
+	CreateRefund(string, money.Decimal, string, time.Duration) (*refundSubmission, error)
+	ClaimRefunds(int, time.Duration) ([]refundSubmission, error)
+	FinishRefund(string, ProviderRefund, string, time.Time) (*Refund, error)
+	GetRefunds(string) ([]Refund, error)
+	SaveWebhookEvent(string, ProviderEvent) (bool, error)
+	ClaimWebhookEvents(int, time.Duration) ([]claimedEvent, error)
+	FinishWebhookEvent(string, string, string, time.Time) error
+	GetWebhookEvent(string) (*WebhookEvent, error)
+	GetWebhookEvents(string, string, int, int) (*GetWebhookEventsResponse, error)
+	ReplayWebhookEvent(string) (*WebhookEvent, error)
+	ApplyEventChange(string, EventChange, []string) (bool, error)
+	GetStorePlatformFee(string) (*PlatformFee, error)
+	UpdateStorePlatformFee(string, *money.Decimal) (*PlatformFee, error)
+	GetPlanPlatformFee(string, string) (*PlatformFee, error)
+	UpdatePlanPlatformFee(string, string, *money.Decimal) (*PlatformFee, error)
+}
+
+type service struct {
+	repository      Repository
+	defaultProvider string
+	providers       map[string]Provider
+}
+
+func NewService(r Repository, defaultProvider string, providers ...Provider) Service {
+	byName := map[string]Provider{}
+	for _, p := range providers {
+		byName[p.Name()] = p
+	}
+	return &service{repository: r, defaultProvider: defaultProvider, providers: byName}
+}
+
+// newConfiguredService builds the service with the providers available and
+// the default one from the configuration.
+func newConfiguredService(r Repository) Service {
+	conf := config.New()
+	return NewService(r, conf.PaymentProvider, NewFakeProvider(conf.PaymentWebhookSecret))
+}
+
+// Checkout charges the customer the price of the appointment and links the
+// appointment to the payment. An appointment whose last checkout failed or
+// was canceled can be checked out again, and one the provider never answered
+// is sent again as the same payment.
+func (s *service) Checkout(ctx context.Context, storeId string, appointmentId string, req CheckoutRequest) (*Payment, error) {
+	name := req.Provider
+	if name == "" {
+		name = s.defaultProvider
+	}
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("payment provider %s is not available", name)
+	}
+
+	appointment, err := s.repository.GetCheckoutAppointment(storeId, appointmentId)
+	if err != nil {
+		return nil, err
+	}
+	if appointment.Status != "pending" && appointment.Status != "confirmed" {
+		return nil, fmt.Errorf("a %s appointment can't be checked out", appointment.Status)
+	}
+	if appointment.Price.Sign() <= 0 {
+		return nil, errors.New("the appointment has nothing to pay")
+	}
+	var payment *Payment
+	switch appointment.PaymentStatus {
+	case "", PaymentStatusFailed, PaymentStatusCanceled:
+	case PaymentStatusRequiresPaymentMethod:
+		// The last checkout didn't hear back from the provider, which may
+		// have charged it. It is retried with the same reference so the
+		// provider answers with that charge instead of making another.
+		if payment, err = s.pendingCheckout(storeId, appointment, provider.Name()); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("the appointment already has a %s payment", appointment.PaymentStatus)
+	}
+
+	if payment == nil {
+		payment, err = s.repository.CreateAppointmentPayment(Payment{
+			StoreId:       appointment.StoreId,
+			UserId:        appointment.UserId,
+			AppointmentId: appointment.Id,
+			Provider:      provider.Name(),
+			Status:        PaymentStatusRequiresPaymentMethod,
+			Currency:      appointment.Currency,
+			AmountTotal:   appointment.Price,
+		}, appointment.PaymentId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	amount, err := money.New(payment.AmountTotal, payment.Currency)
+	if err != nil {
+		return nil, err
+	}
+	res, err := provider.CreatePayment(ctx, Charge{
+		Reference:   payment.Id,
+		Amount:      amount,
+		Description: "Appointment " + appointment.Id,
+		Capture:     !req.AuthorizeOnly,
+	})
+	if err != nil {
+		// Only a refusal settles the payment. Anything else, a timeout
+		// included, leaves it waiting on the webhook or the next checkout.
+		if errors.Is(err, ErrPaymentDeclined) {
+			if _, markErr := s.repository.UpdatePaymentStatus(payment.Id, payment.Status, ProviderPayment{Status: PaymentStatusFailed}); markErr != nil {
+				return nil, markErr
+			}
+		}
+		return nil, err
+	}
+	return s.repository.UpdatePaymentStatus(payment.Id, payment.Status, *res)
+}
+
+// pendingCheckout returns the payment of a checkout the provider never
+// answered, to be sent again as it was.
+func (s *service) pendingCheckout(storeId string, appointment *checkoutAppointment, provider string) (*Payment, error) {
+	payment, err := s.repository.GetPayment(storeId, appointment.PaymentId)
+	if err != nil {
+		return nil, err
+	}
+	if payment.ProviderPaymentId != "" {
+		return nil, fmt.Errorf("the appointment already has a %s payment", payment.Status)
+	}
+	if payment.Provider != provider {
+		return nil, fmt.Errorf("the last checkout of the appointment through %s isn't settled yet", payment.Provider)
+	}
+	if payment.AmountTotal.Cmp(appointment.Price) != 0 || payment.Currency != appointment.Currency {
+		return nil, fmt.Errorf("the last checkout of the appointment, for %s %s, isn't settled yet", payment.AmountTotal, payment.Currency)
+	}
+	return payment, nil
+}
+
+func (s *service) GetPayment(storeId string, id string) (*Payment, error) {
+	return s.repository.GetPayment(storeId, id)
+}
+
+func (s *service) GetStorePayments(storeId string, page int, limit int) (*GetPaymentsResponse, error) {
+	return s.repository.GetStorePayments(storeId, page, limit)
+}
+
+// CapturePayment collects a payment the checkout only authorized.
+func (s *service) CapturePayment(ctx context.Context, storeId string, id string) (*Payment, error) {
+	payment, provider, err := s.providerPayment(storeId, id)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status != PaymentStatusProcessing {
+		return nil, fmt.Errorf("a %s payment can't be captured", payment.Status)
+	}
+
+	res, err := provider.CapturePayment(ctx, payment.ProviderPaymentId)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.UpdatePaymentStatus(payment.Id, payment.Status, *res)
+}
+
+// CancelPayment releases a payment that wasn't captured.
+func (s *service) CancelPayment(ctx context.Context, storeId string, id string) (*Payment, error) {
+	payment, provider, err := s.providerPayment(storeId, id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch payment.Status {
+	case PaymentStatusRequiresPaymentMethod:
+		// Never reached the provider, there is nothing to release there.
+		return s.repository.UpdatePaymentStatus(payment.Id, payment.Status, ProviderPayment{Status: PaymentStatusCanceled})
+	case PaymentStatusProcessing:
+	default:
+		return nil, fmt.Errorf("a %s payment can't be canceled", payment.Status)
+	}
+
+	res, err := provider.CancelPayment(ctx, payment.ProviderPaymentId)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.UpdatePaymentStatus(payment.Id, payment.Status, *res)
+}
+
+// providerPayment gets the payment with the provider it was made through.
+func (s *service) providerPayment(storeId string, id string) (*Payment, Provider, error) {
+	payment, err := s.repository.GetPayment(storeId, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	provider, ok := s.providers[payment.Provider]
+	if !ok {
+		return nil, nil, fmt.Errorf("payment provider %s is not available", payment.Provider)
+	}
+	return payment, provider, nil
+}
+
+// CreateRefund gives back part or all of a captured payment through its
+// provider. A refund the provider couldn't be reached for is kept pending
+// and submitted again by the refund worker.
+func (s *service) CreateRefund(ctx context.Context, storeId string, paymentId string, req CreateRefundRequest) (*Refund, error) {
+	if req.Amount.Sign() < 0 {
+		return nil, errors.New("amount can't be negative")
+	}
+	// The payment is only found in the store it was made in.
+	if _, err := s.repository.GetPayment(storeId, paymentId); err != nil {
+		return nil, err
+	}
+	submission, err := s.repository.CreateRefund(paymentId, req.Amount, req.Reason, refundLease)
+	if err != nil {
+		return nil, err
+	}
+	refund, err := s.submitRefund(ctx, *submission)
+	if err != nil {
+		return nil, err
+	}
+	if refund.Status == RefundStatusFailed {
+		return nil, errors.New(refund.LastError)
+	}
+	return refund, nil
+}
+
+func (s *service) GetRefunds(storeId string, paymentId string) ([]Refund, error) {
+	if _, err := s.repository.GetPayment(storeId, paymentId); err != nil {
+		return nil, err
+	}
+	return s.repository.GetRefunds(paymentId)
+}
+
+func (s *service) GetStorePlatformFee(storeId string) (*PlatformFee, error) {
+	return s.repository.GetStorePlatformFee(storeId)
+}
+
+// UpdateStorePlatformFee sets the rate charged on the payments of the store
+// from now on, payments already made keep theirs.
+func (s *service) UpdateStorePlatformFee(storeId string, req UpdatePlatformFeeRequest) (*PlatformFee, error) {
+	if err := checkPlatformFee(req.Percent); err != nil {
+		return nil, err
+	}
+	return s.repository.UpdateStorePlatformFee(storeId, req.Percent)
+}
+
+func (s *service) GetPlanPlatformFee(storeId string, planId string) (*PlatformFee, error) {
+	return s.repository.GetPlanPlatformFee(storeId, planId)
+}
+
+// UpdatePlanPlatformFee sets the rate charged on the payments of the
+// subscriptions to the plan, over the rate of the store.
+func (s *service) UpdatePlanPlatformFee(storeId string, planId string, req UpdatePlatformFeeRequest) (*PlatformFee, error) {
+	if err := checkPlatformFee(req.Percent); err != nil {
+		return nil, err
+	}
+	return s.repository.UpdatePlanPlatformFee(storeId, planId, req.Percent)
+}
+
+// checkPlatformFee checks a rate being set, nil clears it.
+func checkPlatformFee(percent *money.Decimal) error {
+	if percent == nil {
+		return nil
+	}
+	return money.CheckPercent("platform_fee_pct", *percent)
+}
+
+// SubmitPendingRefunds submits the refunds waiting on the provider, such as
+// the ones recorded when a prepaid appointment is canceled, and returns how
+// many the provider took.
+func (s *service) SubmitPendingRefunds(ctx context.Context) (int, error) {
+	submissions, err := s.repository.ClaimRefunds(refundBatch, refundLease)
+	if err != nil {
+		return 0, err
+	}
+
+	submitted := 0
+	for _, submission := range submissions {
+		if ctx.Err() != nil {
+			return submitted, ctx.Err()
+		}
+		refund, err := s.submitRefund(ctx, submission)
+		if err != nil {
+			return submitted, err
+		}
+		if refund.ProviderRefundId != "" {
+			submitted++
+		}
+	}
+	return submitted, nil
+}
+
+// submitRefund asks the provider for the refund and records the answer. It
+// is tried again later unless the provider refused it or attempts ran out.
+func (s *service) submitRefund(ctx context.Context, submission refundSubmission) (*Refund, error) {
+	var res *ProviderRefund
+	provider, ok := s.providers[submission.Provider]
+	err := fmt.Errorf("payment provider %s is not available", submission.Provider)
+	if ok {
+		res, err = provider.Refund(ctx, RefundRequest{
+			Reference:         submission.RefundId,
+			ProviderPaymentId: submission.ProviderPaymentId,
+			Amount:            money.Money{Amount: submission.Amount, Currency: submission.Currency},
+			Reason:            submission.Reason,
+		})
+	}
+	if err == nil {
+		return s.repository.FinishRefund(submission.RefundId, *res, "", time.Time{})
+	}
+
+	failed := ProviderRefund{Status: RefundStatusFailed}
+	if !terminalRefundError(err) && submission.Attempts < maxRefundAttempts {
+		failed.Status = RefundStatusPending
+	}
+	retryAt := time.Now().UTC().Add(refundRetryBackoff << (submission.Attempts - 1))
+	return s.repository.FinishRefund(submission.RefundId, failed, err.Error(), retryAt)
+}
+
+// submitAll runs one round of refund submissions and logs how it went.
+func submitAll(ctx context.Context, s Service, logger *log.Logger) {
+	submitted, err := s.SubmitPendingRefunds(ctx)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.Printf("payment refunds: %v", err)
+	}
+	if submitted > 0 {
+		logger.Printf("payment refunds: submitted %d", submitted)
+	}
+}
+
+// ReceiveWebhook verifies the webhook with the provider and stores its event
+// for the worker. An event received before is acknowledged again and not
+// stored twice.
+func (s *service) ReceiveWebhook(providerName string, header http.Header, body []byte) (*WebhookReceipt, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, fmt.Errorf("payment provider %s is not available", providerName)
+	}
+	event, err := provider.VerifyWebhook(header, body)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := s.repository.SaveWebhookEvent(provider.Name(), *event)
+	if err != nil {
+		return nil, err
+	}
+	return &WebhookReceipt{EventId: event.Id, Duplicate: !stored}, nil
+}
+
+// ProcessWebhookEvents applies the events that are due and returns how many
+// were processed. An event that fails is tried again with a growing wait,
+// and left failed after maxEventAttempts.
+func (s *service) ProcessWebhookEvents(ctx context.Context) (int, error) {
+	events, err := s.repository.ClaimWebhookEvents(eventBatch, eventLease)
+	if err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for _, e := range events {
+		if ctx.Err() != nil {
+			return processed, ctx.Err()
+		}
+
+		status, err := s.processEvent(e)
+		lastError := ""
+		nextAttemptAt := time.Time{}
+		if err != nil {
+			lastError = err.Error()
+			status = WebhookStatusFailed
+			if e.Attempts < maxEventAttempts {
+				status = WebhookStatusPending
+				nextAttemptAt = time.Now().UTC().Add(eventRetryBackoff << (e.Attempts - 1))
+			}
+		}
+		if err := s.repository.FinishWebhookEvent(e.Id, status, lastError, nextAttemptAt); err != nil {
+			return processed, err
+		}
+		if status == WebhookStatusProcessed {
+			processed++
+		}
+	}
+	return processed, nil
+}
+
+// processEvent applies one event. Events that change nothing of ours are
+// ignored.
+func (s *service) processEvent(e claimedEvent) (string, error) {
+	provider, ok := s.providers[e.Provider]
+	if !ok {
+		return "", fmt.Errorf("payment provider %s is not available", e.Provider)
+	}
+	change, err := provider.EventChange(e.Event)
+	if err != nil {
+		return "", err
+	}
+	if change == nil {
+		return WebhookStatusIgnored, nil
+	}
+	from, ok := eventTransitions[change.Object][change.Status]
+	if !ok {
+		return WebhookStatusIgnored, nil
+	}
+	if _, err := s.repository.ApplyEventChange(e.Provider, *change, from); err != nil {
+		return "", err
+	}
+	return WebhookStatusProcessed, nil
+}
+
+func (s *service) GetWebhookEvents(provider string, status string, page int, limit int) (*GetWebhookEventsResponse, error) {
+	return s.repository.GetWebhookEvents(provider, status, page, limit)
+}
+
+// ReplayWebhookEvent processes the event again, for failed events once what
+// made them fail is fixed.
+func (s *service) ReplayWebhookEvent(id string) (*WebhookEvent, error) {
+	if _, err := s.repository.GetWebhookEvent(id); err != nil {
+		return nil, err
+	}
+	return s.repository.ReplayWebhookEvent(id)
+}
+
+// processAll runs one round of webhook processing and logs how it went.
+func processAll(ctx context.Context, s Service, logger *log.Logger) {
+	processed, err := s.ProcessWebhookEvents(ctx)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.Printf("payment webhooks: %v", err)
+	}
+	if processed > 0 {
+		logger.Printf("payment webhooks: processed %d", processed)
+	}
+}
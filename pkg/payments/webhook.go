@@ -0,0 +1,111 @@
+package payments
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	WebhookStatusPending   = "pending"
+	WebhookStatusProcessed = "processed"
+	WebhookStatusIgnored   = "ignored"
+	WebhookStatusFailed    = "failed"
+)
+
+// The objects webhook events change.
+const (
+	ObjectPayment      = "payment"
+	ObjectRefund       = "refund"
+	ObjectSubscription = "subscription"
+	ObjectPayout       = "payout"
+)
+
+// eventBatch bounds how many events one run processes, the rest go in the
+// next run.
+const eventBatch = 100
+
+// eventLease is how long a claimed event is left to the worker that claimed
+// it before another may take it.
+const eventLease = 2 * time.Minute
+
+// maxEventAttempts is how many times an event is processed before it is
+// left failed, to be replayed.
+const maxEventAttempts = 8
+
+// eventRetryBackoff is the wait after the first failed attempt, doubled on
+// each following one.
+const eventRetryBackoff = 30 * time.Second
+
+// maxWebhookSize bounds the webhook bodies read.
+const maxWebhookSize = 1 << 20
+
+// WebhookEvent is an event a provider sent, kept once per provider and event
+// id, with how processing it went.
+type WebhookEvent struct {
+	Id            string          `json:"id"`
+	Provider      string          `json:"provider"`
+	EventId       string          `json:"event_id"`
+	EventType     string          `json:"event_type"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"last_error"`
+	Payload       json.RawMessage `json:"payload"`
+	ReceivedAt    string          `json:"received_at"`
+	NextAttemptAt string          `json:"next_attempt_at"`
+	ProcessedAt   string          `json:"processed_at"`
+}
+
+type GetWebhookEventsResponse struct {
+	Total  int            `json:"total"`
+	Limit  int            `json:"limit"`
+	Events []WebhookEvent `json:"events"`
+}
+
+// WebhookReceipt answers the provider, Duplicate when the event was
+// received before.
+type WebhookReceipt struct {
+	EventId   string `json:"event_id"`
+	Duplicate bool   `json:"duplicate"`
+}
+
+// claimedEvent is a stored event taken for processing.
+type claimedEvent struct {
+	Id         string
+	Provider   string
+	Attempts   int
+	ReceivedAt time.Time
+	Event      ProviderEvent
+}
+
+// eventTransitions lists, per object and the status an event moves it to,
+// the statuses it may move from. Events that arrive out of order find the
+// object past them and leave it as it is. Each further partial refund moves
+// a payment from partially_refunded to itself, with a larger refunded total.
+var eventTransitions = map[string]map[string][]string{
+	ObjectPayment: {
+		PaymentStatusProcessing:        {PaymentStatusRequiresPaymentMethod, "requires_confirmation"},
+		PaymentStatusSucceeded:         {PaymentStatusRequiresPaymentMethod, "requires_confirmation", PaymentStatusProcessing},
+		PaymentStatusFailed:            {PaymentStatusRequiresPaymentMethod, "requires_confirmation", PaymentStatusProcessing},
+		PaymentStatusCanceled:          {PaymentStatusRequiresPaymentMethod, "requires_confirmation", PaymentStatusProcessing},
+		PaymentStatusPartiallyRefunded: {PaymentStatusSucceeded, PaymentStatusPartiallyRefunded},
+		PaymentStatusRefunded:          {PaymentStatusSucceeded, PaymentStatusPartiallyRefunded},
+	},
+	ObjectRefund: {
+		"succeeded": {"pending"},
+		"failed":    {"pending"},
+		"canceled":  {"pending"},
+	},
+	ObjectSubscription: {
+		"active":   {"trialing", "past_due", "paused", "unpaid"},
+		"past_due": {"trialing", "active", "unpaid"},
+		"paused":   {"trialing", "active", "past_due"},
+		"unpaid":   {"active", "past_due"},
+		"canceled": {"trialing", "active", "past_due", "paused", "unpaid"},
+	},
+	ObjectPayout: {
+		"in_transit": {"pending"},
+		"paid":       {"pending", "in_transit"},
+		"failed":     {"pending", "in_transit"},
+		"canceled":   {"pending", "in_transit"},
+	},
+}
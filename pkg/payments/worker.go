@@ -0,0 +1,70 @@
+package payments
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+// WebhookWorker processes the stored provider webhook events, one run per
+// interval.
+type WebhookWorker struct {
+	service  Service
+	interval time.Duration
+	log      *log.Logger
+}
+
+func NewWebhookWorker(postgresDB *sql.DB, interval time.Duration, log *log.Logger) *WebhookWorker {
+	return &WebhookWorker{
+		service:  newConfiguredService(NewPaymentRepository(postgresDB)),
+		interval: interval,
+		log:      log,
+	}
+}
+
+// Run processes once per interval until the context is canceled.
+func (w *WebhookWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			processAll(ctx, w.service, w.log)
+		}
+	}
+}
+
+// RefundWorker submits the refunds waiting on the provider, one run per
+// interval.
+type RefundWorker struct {
+	service  Service
+	interval time.Duration
+	log      *log.Logger
+}
+
+func NewRefundWorker(postgresDB *sql.DB, interval time.Duration, log *log.Logger) *RefundWorker {
+	return &RefundWorker{
+		service:  newConfiguredService(NewPaymentRepository(postgresDB)),
+		interval: interval,
+		log:      log,
+	}
+}
+
+// Run submits once per interval until the context is canceled.
+func (w *RefundWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			submitAll(ctx, w.service, w.log)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+// Package rrule parses and expands RFC 5545 recurrence rules.
+//
+// It supports the FREQ, INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY, BYMONTH
+// and WKST rule parts, which covers what customers and calendar apps send us
+// for bookings ("every Tuesday at 10:00 for 3 months"). Other rule parts are
+// rejected instead of silently ignored.
+package rrule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// maxPeriods bounds how many periods are walked while expanding a rule, so a
+// rule that never matches can't loop forever.
+const maxPeriods = 10000
+
+// Weekday is a BYDAY entry. N is the ordinal inside the period (1 is the
+// first, -1 the last), 0 means every such weekday.
+type Weekday struct {
+	Day time.Weekday
+	N   int
+}
+
+// Rule is a parsed RRULE.
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []Weekday
+	ByMonthDay []int
+	ByMonth    []time.Month
+	WeekStart  time.Weekday
+}
+
+var dayNames = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Parse reads a rule such as "FREQ=WEEKLY;BYDAY=TU;COUNT=12". A leading
+// "RRULE:" is accepted. UNTIL values without a zone are read in loc, which
+// should be the zone of the series start.
+func Parse(value string, loc *time.Location) (*Rule, error) {
+	value = strings.TrimSpace(value)
+	value = strings.TrimPrefix(strings.TrimPrefix(value, "RRULE:"), "rrule:")
+	if value == "" {
+		return nil, fmt.Errorf("rrule is empty")
+	}
+
+	rule := Rule{Interval: 1, WeekStart: time.Monday}
+	for _, part := range strings.Split(value, ";") {
+		if part == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(part, "=")
+		if !ok || val == "" {
+			return nil, fmt.Errorf("invalid rrule part %q", part)
+		}
+
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq = Frequency(strings.ToUpper(val))
+			switch rule.Freq {
+			case Daily, Weekly, Monthly, Yearly:
+			default:
+				err = fmt.Errorf("unsupported FREQ %q", val)
+			}
+		case "INTERVAL":
+			rule.Interval, err = positiveInt(val)
+		case "COUNT":
+			rule.Count, err = positiveInt(val)
+		case "UNTIL":
+			rule.Until, err = parseUntil(val, loc)
+		case "BYDAY":
+			rule.ByDay, err = parseByDay(val)
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = parseIntList(val, -31, 31)
+		case "BYMONTH":
+			var months []int
+			months, err = parseIntList(val, 1, 12)
+			for _, m := range months {
+				rule.ByMonth = append(rule.ByMonth, time.Month(m))
+			}
+		case "WKST":
+			day, ok := dayNames[strings.ToUpper(val)]
+			if !ok {
+				err = fmt.Errorf("invalid WKST %q", val)
+			}
+			rule.WeekStart = day
+		default:
+			err = fmt.Errorf("unsupported rrule part %q", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, fmt.Errorf("rrule requires FREQ")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return nil, fmt.Errorf("rrule can't have both COUNT and UNTIL")
+	}
+
+	return &rule, nil
+}
+
+// Bounded reports whether the rule ends on its own, through COUNT or UNTIL.
+func (r *Rule) Bounded() bool {
+	return r.Count > 0 || !r.Until.IsZero()
+}
+
+// All returns the occurrences starting at dtstart, at most limit of them.
+func (r *Rule) All(dtstart time.Time, limit int) []time.Time {
+	return r.Between(dtstart, dtstart, time.Time{}, limit)
+}
+
+// Between returns the occurrences in [after, before), at most limit of them.
+// A zero before means no upper bound. COUNT is always counted from dtstart.
+func (r *Rule) Between(dtstart time.Time, after time.Time, before time.Time, limit int) []time.Time {
+	var occurrences []time.Time
+	seen := 0
+
+	period := r.periodStart(dtstart)
+	for i := 0; i < maxPeriods; i++ {
+		for _, day := range r.expand(period, dtstart) {
+			t := wallTime(day, dtstart)
+			if t.Before(dtstart) {
+				continue
+			}
+			if !r.Until.IsZero() && t.After(r.Until) {
+				return occurrences
+			}
+			if !before.IsZero() && !t.Before(before) {
+				return occurrences
+			}
+
+			seen++
+			if r.Count > 0 && seen > r.Count {
+				return occurrences
+			}
+			if t.Before(after) {
+				continue
+			}
+
+			occurrences = append(occurrences, t)
+			if limit > 0 && len(occurrences) >= limit {
+				return occurrences
+			}
+		}
+		period = r.nextPeriod(period)
+	}
+
+	return occurrences
+}
+
+// wallTime is day at the clock time of dtstart. A clock time the zone skips
+// when it springs forward is read with the offset from before the gap, as RFC
+// 5545 asks, so 02:30 becomes 03:30 and not the 01:30 time.Date gives.
+func wallTime(day time.Time, dtstart time.Time) time.Time {
+	t := time.Date(day.Year(), day.Month(), day.Day(), dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, dtstart.Location())
+	if t.Hour() == dtstart.Hour() && t.Minute() == dtstart.Minute() {
+		return t
+	}
+	_, offset := t.Add(-12 * time.Hour).Zone()
+	wall := time.Date(day.Year(), day.Month(), day.Day(), dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, time.UTC)
+	return wall.Add(-time.Duration(offset) * time.Second).In(dtstart.Location())
+}
+
+// periodStart returns the first day of the period that contains t.
+func (r *Rule) periodStart(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch r.Freq {
+	case Weekly:
+		offset := (int(day.Weekday()) - int(r.WeekStart) + 7) % 7
+		return day.AddDate(0, 0, -offset)
+	case Monthly:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+	case Yearly:
+		return time.Date(day.Year(), time.January, 1, 0, 0, 0, 0, day.Location())
+	}
+	return day
+}
+
+func (r *Rule) nextPeriod(period time.Time) time.Time {
+	switch r.Freq {
+	case Weekly:
+		return period.AddDate(0, 0, 7*r.Interval)
+	case Monthly:
+		return period.AddDate(0, r.Interval, 0)
+	case Yearly:
+		return period.AddDate(r.Interval, 0, 0)
+	}
+	return period.AddDate(0, 0, r.Interval)
+}
+
+// expand lists, in order, the days of the period that match the rule.
+func (r *Rule) expand(period time.Time, dtstart time.Time) []time.Time {
+	var days []time.Time
+
+	switch r.Freq {
+	case Daily:
+		days = []time.Time{period}
+	case Weekly:
+		if len(r.ByDay) == 0 {
+			offset := (int(dtstart.Weekday()) - int(period.Weekday()) + 7) % 7
+			days = []time.Time{period.AddDate(0, 0, offset)}
+		} else {
+			for offset := 0; offset < 7; offset++ {
+				day := period.AddDate(0, 0, offset)
+				if r.matchesWeekday(day) {
+					days = append(days, day)
+				}
+			}
+		}
+	case Monthly:
+		days = r.expandMonth(period, dtstart)
+	case Yearly:
+		months := r.ByMonth
+		if len(months) == 0 && (len(r.ByDay) == 0 || len(r.ByMonthDay) > 0) {
+			months = []time.Month{dtstart.Month()}
+		}
+		if len(months) == 0 {
+			// BYDAY alone on a yearly rule counts ordinals across the whole year.
+			days = byDayIn(period, period.AddDate(1, 0, 0), r.ByDay)
+		}
+		for _, month := range months {
+			start := time.Date(period.Year(), month, 1, 0, 0, 0, 0, period.Location())
+			days = append(days, r.expandMonth(start, dtstart)...)
+		}
+	}
+
+	return r.filter(days)
+}
+
+func (r *Rule) expandMonth(start time.Time, dtstart time.Time) []time.Time {
+	end := start.AddDate(0, 1, 0)
+
+	switch {
+	case len(r.ByMonthDay) > 0:
+		var days []time.Time
+		last := end.AddDate(0, 0, -1).Day()
+		for _, d := range r.ByMonthDay {
+			if d < 0 {
+				d = last + d + 1
+			}
+			if d >= 1 && d <= last {
+				days = append(days, time.Date(start.Year(), start.Month(), d, 0, 0, 0, 0, start.Location()))
+			}
+		}
+		return days
+	case len(r.ByDay) > 0:
+		return byDayIn(start, end, r.ByDay)
+	}
+
+	day := time.Date(start.Year(), start.Month(), dtstart.Day(), 0, 0, 0, 0, start.Location())
+	if day.Month() != start.Month() {
+		// e.g. the 31st in a 30 day month, RFC 5545 skips it.
+		return nil
+	}
+	return []time.Time{day}
+}
+
+// byDayIn lists the days in [start, end) matching the BYDAY entries, ordinals
+// are counted inside that range.
+func byDayIn(start time.Time, end time.Time, byDay []Weekday) []time.Time {
+	var days []time.Time
+	for _, wd := range byDay {
+		var matches []time.Time
+		for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+			if day.Weekday() == wd.Day {
+				matches = append(matches, day)
+			}
+		}
+
+		switch {
+		case wd.N == 0:
+			days = append(days, matches...)
+		case wd.N > 0 && wd.N <= len(matches):
+			days = append(days, matches[wd.N-1])
+		case wd.N < 0 && -wd.N <= len(matches):
+			days = append(days, matches[len(matches)+wd.N])
+		}
+	}
+	return days
+}
+
+// filter applies the BY* parts that limit rather than expand the set, then
+// sorts and removes duplicates.
+func (r *Rule) filter(days []time.Time) []time.Time {
+	var kept []time.Time
+	for _, day := range days {
+		if len(r.ByMonth) > 0 && !containsMonth(r.ByMonth, day.Month()) {
+			continue
+		}
+		if r.Freq == Daily && len(r.ByDay) > 0 && !r.matchesWeekday(day) {
+			continue
+		}
+		if r.Freq == Daily && len(r.ByMonthDay) > 0 && !r.matchesMonthDay(day) {
+			continue
+		}
+		if (r.Freq == Monthly || r.Freq == Yearly) && len(r.ByMonthDay) > 0 && len(r.ByDay) > 0 && !r.matchesWeekday(day) {
+			continue
+		}
+		kept = append(kept, day)
+	}
+
+	sort.Slice(kept, func(a, b int) bool { return kept[a].Before(kept[b]) })
+
+	unique := kept[:0]
+	for idx, day := range kept {
+		if idx > 0 && day.Equal(kept[idx-1]) {
+			continue
+		}
+		unique = append(unique, day)
+	}
+	return unique
+}
+
+func (r *Rule) matchesWeekday(day time.Time) bool {
+	for _, wd := range r.ByDay {
+		if wd.Day == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchesMonthDay(day time.Time) bool {
+	last := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+	for _, d := range r.ByMonthDay {
+		if d == day.Day() || (d < 0 && last+d+1 == day.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsMonth(months []time.Month, month time.Month) bool {
+	for _, m := range months {
+		if m == month {
+			return true
+		}
+	}
+	return false
+}
+
+func positiveInt(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid positive number %q", value)
+	}
+	return n, nil
+}
+
+func parseIntList(value string, min int, max int) ([]int, error) {
+	var list []int
+	for _, item := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(item)
+		if err != nil || n == 0 || n < min || n > max {
+			return nil, fmt.Errorf("invalid value %q", item)
+		}
+		list = append(list, n)
+	}
+	return list, nil
+}
+
+func parseByDay(value string) ([]Weekday, error) {
+	var list []Weekday
+	for _, item := range strings.Split(strings.ToUpper(value), ",") {
+		if len(item) < 2 {
+			return nil, fmt.Errorf("invalid BYDAY %q", item)
+		}
+		day, ok := dayNames[item[len(item)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("invalid BYDAY %q", item)
+		}
+
+		wd := Weekday{Day: day}
+		if ordinal := item[:len(item)-2]; ordinal != "" {
+			n, err := strconv.Atoi(ordinal)
+			if err != nil || n == 0 || n < -53 || n > 53 {
+				return nil, fmt.Errorf("invalid BYDAY %q", item)
+			}
+			wd.N = n
+		}
+		list = append(list, wd)
+	}
+	return list, nil
+}
+
+func parseUntil(value string, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		if t, err := time.Parse("20060102T150405Z", value); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.ParseInLocation("20060102T150405", value, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102", value, loc); err == nil {
+		// A date only UNTIL includes the whole day.
+		return t.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL %q", value)
+}
@@ -0,0 +1,202 @@
+package rrule
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func format(times []time.Time) string {
+	var s []string
+	for _, t := range times {
+		s = append(s, t.Format("2006-01-02T15:04Z07:00"))
+	}
+	return strings.Join(s, " ")
+}
+
+func TestAll(t *testing.T) {
+	saoPaulo := mustLocation(t, "America/Sao_Paulo")
+	newYork := mustLocation(t, "America/New_York")
+
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart time.Time
+		loc     *time.Location
+		limit   int
+		want    string
+	}{
+		{
+			name:    "weekly count",
+			rule:    "FREQ=WEEKLY;BYDAY=TU;COUNT=3",
+			dtstart: time.Date(2026, 3, 3, 10, 0, 0, 0, saoPaulo),
+			want:    "2026-03-03T10:00-03:00 2026-03-10T10:00-03:00 2026-03-17T10:00-03:00",
+		},
+		{
+			name:    "count starts at the first match after dtstart",
+			rule:    "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=3",
+			dtstart: time.Date(2026, 3, 3, 10, 0, 0, 0, saoPaulo),
+			want:    "2026-03-04T10:00-03:00 2026-03-09T10:00-03:00 2026-03-11T10:00-03:00",
+		},
+		{
+			name:    "interval",
+			rule:    "RRULE:FREQ=WEEKLY;INTERVAL=2;COUNT=3",
+			dtstart: time.Date(2026, 3, 3, 10, 0, 0, 0, saoPaulo),
+			want:    "2026-03-03T10:00-03:00 2026-03-17T10:00-03:00 2026-03-31T10:00-03:00",
+		},
+		{
+			name:    "limit below count",
+			rule:    "FREQ=DAILY;COUNT=10",
+			dtstart: time.Date(2026, 3, 3, 10, 0, 0, 0, saoPaulo),
+			limit:   2,
+			want:    "2026-03-03T10:00-03:00 2026-03-04T10:00-03:00",
+		},
+		{
+			name:    "date only until includes the day",
+			rule:    "FREQ=DAILY;UNTIL=20260305",
+			dtstart: time.Date(2026, 3, 3, 10, 0, 0, 0, saoPaulo),
+			loc:     saoPaulo,
+			want:    "2026-03-03T10:00-03:00 2026-03-04T10:00-03:00 2026-03-05T10:00-03:00",
+		},
+		{
+			name:    "utc until",
+			rule:    "FREQ=DAILY;UNTIL=20260305T120000Z",
+			dtstart: time.Date(2026, 3, 3, 10, 0, 0, 0, saoPaulo),
+			loc:     saoPaulo,
+			want:    "2026-03-03T10:00-03:00 2026-03-04T10:00-03:00",
+		},
+		{
+			name:    "local until is read in the series zone",
+			rule:    "FREQ=DAILY;UNTIL=20260305T100000",
+			dtstart: time.Date(2026, 3, 3, 10, 0, 0, 0, saoPaulo),
+			loc:     saoPaulo,
+			want:    "2026-03-03T10:00-03:00 2026-03-04T10:00-03:00 2026-03-05T10:00-03:00",
+		},
+		{
+			name:    "the 31st skips shorter months",
+			rule:    "FREQ=MONTHLY;COUNT=4",
+			dtstart: time.Date(2026, 1, 31, 9, 0, 0, 0, saoPaulo),
+			want:    "2026-01-31T09:00-03:00 2026-03-31T09:00-03:00 2026-05-31T09:00-03:00 2026-07-31T09:00-03:00",
+		},
+		{
+			name:    "last day of the month",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3",
+			dtstart: time.Date(2026, 1, 31, 9, 0, 0, 0, saoPaulo),
+			want:    "2026-01-31T09:00-03:00 2026-02-28T09:00-03:00 2026-03-31T09:00-03:00",
+		},
+		{
+			name:    "last friday of the month",
+			rule:    "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3",
+			dtstart: time.Date(2026, 1, 1, 9, 0, 0, 0, saoPaulo),
+			want:    "2026-01-30T09:00-03:00 2026-02-27T09:00-03:00 2026-03-27T09:00-03:00",
+		},
+		{
+			name:    "february 29th only in leap years",
+			rule:    "FREQ=YEARLY;COUNT=2",
+			dtstart: time.Date(2028, 2, 29, 9, 0, 0, 0, saoPaulo),
+			want:    "2028-02-29T09:00-03:00 2032-02-29T09:00-03:00",
+		},
+		{
+			name:    "wall time kept across spring forward",
+			rule:    "FREQ=WEEKLY;COUNT=3",
+			dtstart: time.Date(2026, 3, 1, 10, 0, 0, 0, newYork),
+			want:    "2026-03-01T10:00-05:00 2026-03-08T10:00-04:00 2026-03-15T10:00-04:00",
+		},
+		{
+			name:    "wall time kept across fall back",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: time.Date(2026, 10, 31, 9, 0, 0, 0, newYork),
+			want:    "2026-10-31T09:00-04:00 2026-11-01T09:00-05:00 2026-11-02T09:00-05:00",
+		},
+		{
+			name:    "skipped hour moves forward",
+			rule:    "FREQ=DAILY;COUNT=2",
+			dtstart: time.Date(2026, 3, 7, 2, 30, 0, 0, newYork),
+			want:    "2026-03-07T02:30-05:00 2026-03-08T03:30-04:00",
+		},
+		{
+			name:    "repeated hour takes the first one",
+			rule:    "FREQ=DAILY;COUNT=2",
+			dtstart: time.Date(2026, 10, 31, 1, 30, 0, 0, newYork),
+			want:    "2026-10-31T01:30-04:00 2026-11-01T01:30-04:00",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, err := Parse(tc.rule, tc.loc)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tc.rule, err)
+			}
+			if got := format(rule.All(tc.dtstart, tc.limit)); got != tc.want {
+				t.Errorf("got  %s\nwant %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBetween(t *testing.T) {
+	loc := mustLocation(t, "America/Sao_Paulo")
+	rule, err := Parse("FREQ=WEEKLY;BYDAY=TU;COUNT=4", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dtstart := time.Date(2026, 3, 3, 10, 0, 0, 0, loc)
+
+	// COUNT is counted from dtstart, so the window only sees the last two.
+	got := rule.Between(dtstart, time.Date(2026, 3, 15, 0, 0, 0, 0, loc), time.Time{}, 0)
+	if want := "2026-03-17T10:00-03:00 2026-03-24T10:00-03:00"; format(got) != want {
+		t.Errorf("got %s, want %s", format(got), want)
+	}
+
+	got = rule.Between(dtstart, dtstart, time.Date(2026, 3, 17, 10, 0, 0, 0, loc), 0)
+	if want := "2026-03-03T10:00-03:00 2026-03-10T10:00-03:00"; format(got) != want {
+		t.Errorf("before is exclusive: got %s, want %s", format(got), want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	rule, err := Parse("freq=monthly;interval=2;byday=1MO,-1FR;bymonth=1,7;wkst=SU", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Freq != Monthly || rule.Interval != 2 || rule.WeekStart != time.Sunday || rule.Bounded() {
+		t.Errorf("parsed %+v", rule)
+	}
+	if len(rule.ByDay) != 2 || rule.ByDay[0] != (Weekday{time.Monday, 1}) || rule.ByDay[1] != (Weekday{time.Friday, -1}) {
+		t.Errorf("BYDAY parsed as %v", rule.ByDay)
+	}
+	if len(rule.ByMonth) != 2 || rule.ByMonth[1] != time.July {
+		t.Errorf("BYMONTH parsed as %v", rule.ByMonth)
+	}
+
+	for _, value := range []string{
+		"",
+		"COUNT=3",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;INTERVAL=-1",
+		"FREQ=DAILY;COUNT=3;UNTIL=20260301",
+		"FREQ=DAILY;UNTIL=2026-03-01",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;BYDAY=0MO",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=YEARLY;BYMONTH=13",
+		"FREQ=DAILY;BYHOUR=9",
+		"FREQ=DAILY;COUNT",
+	} {
+		if _, err := Parse(value, time.UTC); err == nil {
+			t.Errorf("Parse(%q) accepted the rule", value)
+		}
+	}
+}
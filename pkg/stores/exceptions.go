@@ -0,0 +1,162 @@
+package stores
+
+import (
+	"fmt"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// validateException checks the dates and hours of an availability exception
+// and fills in the end date of a single day exception.
+func validateException(exception *StoreAvailabilityException) error {
+	if exception.EndDate == "" {
+		exception.EndDate = exception.StartDate
+	}
+
+	start, err := time.Parse(dateLayout, exception.StartDate)
+	if err != nil {
+		return fmt.Errorf("invalid start_date %q, expected YYYY-MM-DD", exception.StartDate)
+	}
+	end, err := time.Parse(dateLayout, exception.EndDate)
+	if err != nil {
+		return fmt.Errorf("invalid end_date %q, expected YYYY-MM-DD", exception.EndDate)
+	}
+	if end.Before(start) {
+		return fmt.Errorf("end_date can't be before start_date")
+	}
+
+	if exception.Kind != ExceptionKindHours {
+		exception.OpenTime = ""
+		exception.CloseTime = ""
+		return nil
+	}
+	if _, err := parseClock(exception.OpenTime); err != nil {
+		return err
+	}
+	if _, err := parseClock(exception.CloseTime); err != nil {
+		return err
+	}
+	return nil
+}
+
+// exceptionsFor keeps the store wide exceptions and the ones of the resource.
+func exceptionsFor(exceptions []StoreAvailabilityException, resourceId string) []StoreAvailabilityException {
+	var kept []StoreAvailabilityException
+	for _, e := range exceptions {
+		if e.ResourceId == "" || e.ResourceId == resourceId {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// exceptionIntervals expands the exceptions between from and to, on the wall
+// clock of from's location. overridden holds every day an exception touches;
+// hours holds the custom hours worked on them, minus any day that is closed.
+func exceptionIntervals(exceptions []StoreAvailabilityException, from time.Time, to time.Time) (overridden []interval, hours []interval, err error) {
+	loc := from.Location()
+
+	var closed []interval
+	for _, e := range exceptions {
+		start, err := time.ParseInLocation(dateLayout, e.StartDate, loc)
+		if err != nil {
+			return nil, nil, err
+		}
+		end, err := time.ParseInLocation(dateLayout, e.EndDate, loc)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+			whole := interval{atClock(day, 0), atClock(day, 24*time.Hour)}
+			if !whole.start.Before(to) || !whole.end.After(from) {
+				continue
+			}
+			overridden = append(overridden, whole)
+
+			if e.Kind != ExceptionKindHours {
+				closed = append(closed, whole)
+				continue
+			}
+			openAt, err := parseClock(e.OpenTime)
+			if err != nil {
+				return nil, nil, err
+			}
+			closeAt, err := parseClock(e.CloseTime)
+			if err != nil {
+				return nil, nil, err
+			}
+			if closeAt <= openAt {
+				closeAt += 24 * time.Hour
+			}
+			hours = append(hours, interval{atClock(day, openAt), atClock(day, closeAt)})
+		}
+	}
+
+	return mergeIntervals(overridden), subtractIntervals(mergeIntervals(hours), closed), nil
+}
+
+// applyExceptions replaces the open intervals on every exception day with the
+// hours the exceptions set for it, if any.
+func applyExceptions(open []interval, exceptions []StoreAvailabilityException, from time.Time, to time.Time) ([]interval, error) {
+	if len(exceptions) == 0 {
+		return open, nil
+	}
+
+	overridden, hours, err := exceptionIntervals(exceptions, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	result := subtractIntervals(open, overridden)
+	for _, h := range hours {
+		if h.start.Before(from) {
+			h.start = from
+		}
+		if h.end.After(to) {
+			h.end = to
+		}
+		if h.start.Before(h.end) {
+			result = append(result, h)
+		}
+	}
+	return mergeIntervals(result), nil
+}
+
+// exceptionViolation returns an error naming the exception that blocks the
+// [start, end) range, or nil when no exception does.
+func exceptionViolation(exceptions []StoreAvailabilityException, start time.Time, end time.Time) error {
+	for _, e := range exceptions {
+		overridden, hours, err := exceptionIntervals([]StoreAvailabilityException{e}, start, end)
+		if err != nil {
+			return err
+		}
+		if overlaps(subtractIntervals(overridden, hours), start, end) {
+			return exceptionError(e)
+		}
+	}
+	return nil
+}
+
+func exceptionError(e StoreAvailabilityException) error {
+	dates := e.StartDate
+	if e.EndDate != e.StartDate {
+		dates += " to " + e.EndDate
+	}
+	reason := ""
+	if e.Reason != "" {
+		reason = " (" + e.Reason + ")"
+	}
+
+	if e.ResourceId != "" {
+		if e.Kind == ExceptionKindHours {
+			return fmt.Errorf("the resource only works from %s to %s on %s%s", e.OpenTime, e.CloseTime, dates, reason)
+		}
+		return fmt.Errorf("the resource is unavailable on %s%s", dates, reason)
+	}
+	if e.Kind == ExceptionKindHours {
+		return fmt.Errorf("the store only opens from %s to %s on %s%s", e.OpenTime, e.CloseTime, dates, reason)
+	}
+	return fmt.Errorf("the store is closed on %s%s", dates, reason)
+}
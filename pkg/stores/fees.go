@@ -0,0 +1,24 @@
+package stores
+
+import "github.com/genda/genda-api/pkg/money"
+
+// applyPlatformFee sets the platform's cut of the appointment price at the
+// rate the store pays. It is ours to set, whatever the request carried.
+func (s *service) applyPlatformFee(appointment *StoreAppointment) error {
+	fee, err := s.platformFee(appointment.StoreId, appointment.Price, appointment.Currency)
+	if err != nil {
+		return err
+	}
+	appointment.FeePlatform = fee
+	return nil
+}
+
+// platformFee returns the store rate of price, exact and rounded half away
+// from zero to the minor units of the currency, like round() on numeric.
+func (s *service) platformFee(storeId string, price money.Decimal, currency money.Currency) (money.Decimal, error) {
+	percent, err := s.storeRepository.GetStorePlatformFeePct(storeId)
+	if err != nil {
+		return money.Decimal{}, err
+	}
+	return money.Money{Amount: price, Currency: currency}.Percent(percent).Amount, nil
+}
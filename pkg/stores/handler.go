@@ -4,10 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/genda/genda-api/internal/app"
+	"github.com/genda/genda-api/internal/storage/postgres"
+	"github.com/genda/genda-api/pkg/notifications"
 	"github.com/go-playground/validator/v10"
 	"github.com/julienschmidt/httprouter"
 )
@@ -19,7 +24,7 @@ type handler struct {
 
 func NewHandler(postgresDB *sql.DB) *handler {
 	storeRepository := NewStoreRepository(postgresDB)
-	storeService := NewService(storeRepository)
+	storeService := newConfiguredService(storeRepository, notifications.NewScheduler(postgresDB))
 
 	return &handler{
 		service:    storeService,
@@ -306,6 +311,106 @@ func (h *handler) DeleteStoreAvailability(ctx context.Context, w http.ResponseWr
 	return nil
 }
 
+// POST /stores/{id}/availability/exceptions
+func (h *handler) CreateStoreAvailabilityException(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	var exception StoreAvailabilityException
+	if err := json.NewDecoder(r.Body).Decode(&exception); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+	exception.StoreId = p.ByName("id")
+
+	validate := validator.New()
+	if err := validate.Struct(exception); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.CreateStoreAvailabilityException(exception)
+	if err != nil {
+		transformError(w, "Failed to create store availability exception", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /stores/{id}/availability/exceptions?from={date}&to={date}
+func (h *handler) GetStoreAvailabilityExceptions(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	query := r.URL.Query()
+
+	exceptions, err := h.service.GetStoreAvailabilityExceptions(p.ByName("id"), query.Get("from"), query.Get("to"))
+	if err != nil {
+		transformError(w, "Failed to get store availability exceptions", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(exceptions)
+	return nil
+}
+
+// PUT /stores/{id}/availability/exceptions/{exceptionId}
+func (h *handler) UpdateStoreAvailabilityException(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	if !isExceptionsPath(p) {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	var exception StoreAvailabilityException
+	if err := json.NewDecoder(r.Body).Decode(&exception); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(exception); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.UpdateStoreAvailabilityException(p.ByName("id"), p.ByName("exceptionId"), exception)
+	if err != nil {
+		transformError(w, "Failed to update store availability exception", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// DELETE /stores/{id}/availability/exceptions/{exceptionId}
+func (h *handler) DeleteStoreAvailabilityException(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	if !isExceptionsPath(p) {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	if err := h.service.DeleteStoreAvailabilityException(p.ByName("id"), p.ByName("exceptionId")); err != nil {
+		transformError(w, "Failed to delete store availability exception", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+	_ = json.NewEncoder(w).Encode("Store availability exception deleted")
+	return nil
+}
+
+// isExceptionsPath tells whether the availability route matched the
+// exceptions segment. httprouter can't register /availability/exceptions/:id
+// next to /availability/:availabilityId, so the PUT and DELETE routes share
+// that wildcard.
+func isExceptionsPath(p httprouter.Params) bool {
+	return p.ByName("availabilityId") == "exceptions"
+}
+
 // POST /stores/ratings
 func (h *handler) CreateStoreRating(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
 	var rating StoreRating
@@ -322,7 +427,7 @@ func (h *handler) CreateStoreRating(ctx context.Context, w http.ResponseWriter,
 
 	res, err := h.service.CreateStoreRating(rating)
 	if err != nil {
-		transformError(w, "Failed to create store rating", err.Error())
+		respondError(w, "Failed to create store rating", err)
 		return nil
 	}
 
@@ -411,7 +516,7 @@ func (h *handler) CreateStoreAppointment(ctx context.Context, w http.ResponseWri
 
 	res, err := h.service.CreateStoreAppointment(appointment)
 	if err != nil {
-		transformError(w, "Failed to create store appointment", err.Error())
+		respondError(w, "Failed to create store appointment", err)
 		return nil
 	}
 
@@ -421,6 +526,108 @@ func (h *handler) CreateStoreAppointment(ctx context.Context, w http.ResponseWri
 	return nil
 }
 
+// POST /stores/{id}/appointments/{appointmentId}/confirm
+func (h *handler) ConfirmStoreAppointment(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	return h.transitionStoreAppointment(ctx, w, r, p, AppointmentStatusConfirmed, "Failed to confirm store appointment")
+}
+
+// POST /stores/{id}/appointments/{appointmentId}/cancel
+func (h *handler) CancelStoreAppointment(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	return h.transitionStoreAppointment(ctx, w, r, p, AppointmentStatusCanceled, "Failed to cancel store appointment")
+}
+
+// POST /stores/{id}/appointments/{appointmentId}/complete
+func (h *handler) CompleteStoreAppointment(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	return h.transitionStoreAppointment(ctx, w, r, p, AppointmentStatusCompleted, "Failed to complete store appointment")
+}
+
+// POST /stores/{id}/appointments/{appointmentId}/no-show
+func (h *handler) NoShowStoreAppointment(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	return h.transitionStoreAppointment(ctx, w, r, p, AppointmentStatusNoShow, "Failed to mark store appointment as no-show")
+}
+
+// GET /stores/{id}/appointments/{appointmentId}/history
+func (h *handler) GetStoreAppointmentHistory(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	id := p.ByName("appointmentId")
+
+	history, err := h.service.GetStoreAppointmentHistory(id)
+	if err != nil {
+		transformError(w, "Failed to get store appointment history", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(history)
+	return nil
+}
+
+// POST /stores/{id}/appointments/{appointmentId}/reschedule
+func (h *handler) RescheduleStoreAppointment(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	id := p.ByName("appointmentId")
+
+	var reschedule RescheduleStoreAppointmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&reschedule); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(reschedule); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.RescheduleStoreAppointment(id, reschedule, app.UserID(ctx))
+	if err != nil {
+		respondError(w, "Failed to reschedule store appointment", err)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /stores/{id}/appointments/{appointmentId}/reschedules
+func (h *handler) GetStoreAppointmentReschedules(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	id := p.ByName("appointmentId")
+
+	reschedules, err := h.service.GetStoreAppointmentReschedules(id)
+	if err != nil {
+		transformError(w, "Failed to get store appointment reschedules", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(reschedules)
+	return nil
+}
+
+func (h *handler) transitionStoreAppointment(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params, status string, message string) error {
+	id := p.ByName("appointmentId")
+
+	// The body is optional, it only carries the reason for the change.
+	var transition AppointmentTransitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&transition); err != nil && err != io.EOF {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.TransitionStoreAppointment(p.ByName("id"), id, status, app.UserID(ctx), transition.Reason)
+	if err != nil {
+		respondError(w, message, err)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
 // GET /stores/appointments?storeId={storeId}&page={page}&limit={limit}
 func (h *handler) GetStoreAppointments(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
 	query := r.URL.Query()
@@ -458,7 +665,7 @@ func (h *handler) UpdateStoreAppointment(ctx context.Context, w http.ResponseWri
 
 	res, err := h.service.UpdateStoreAppointment(id, appointment)
 	if err != nil {
-		transformError(w, "Failed to update store appointment", err.Error())
+		respondError(w, "Failed to update store appointment", err)
 		return nil
 	}
 
@@ -483,6 +690,992 @@ func (h *handler) DeleteStoreAppointment(ctx context.Context, w http.ResponseWri
 	return nil
 }
 
+// POST /stores/{id}/appointments/series
+func (h *handler) CreateStoreAppointmentSeries(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	id := p.ByName("id")
+
+	var series CreateStoreAppointmentSeriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&series); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(series); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.CreateStoreAppointmentSeries(id, series)
+	if err != nil {
+		respondError(w, "Failed to create store appointment series", err)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /stores/{id}/appointments/series/{seriesId}
+func (h *handler) GetStoreAppointmentSeries(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	id := p.ByName("seriesId")
+
+	series, err := h.service.GetStoreAppointmentSeries(id)
+	if err != nil {
+		transformError(w, "Failed to get store appointment series", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(series)
+	return nil
+}
+
+// PUT /stores/{id}/appointments/series/{seriesId}
+func (h *handler) UpdateStoreAppointmentSeries(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	id := p.ByName("seriesId")
+
+	var update UpdateStoreAppointmentSeriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(update); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.UpdateStoreAppointmentSeries(id, update)
+	if err != nil {
+		respondError(w, "Failed to update store appointment series", err)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// POST /stores/{id}/appointments/series/{seriesId}/cancel
+func (h *handler) CancelStoreAppointmentSeries(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	id := p.ByName("seriesId")
+
+	var cancel CancelStoreAppointmentSeriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&cancel); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(cancel); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.CancelStoreAppointmentSeries(id, cancel, app.UserID(ctx))
+	if err != nil {
+		transformError(w, "Failed to cancel store appointment series", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /stores/{id}/slots?from={from}&to={to}&duration={duration}
+func (h *handler) GetStoreSlots(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	id := p.ByName("id")
+	query := r.URL.Query()
+
+	from := query.Get("from")
+	if from == "" {
+		transformError(w, "Invalid from parameter", "value is required")
+		return nil
+	}
+
+	to := query.Get("to")
+	if to == "" {
+		transformError(w, "Invalid to parameter", "value is required")
+		return nil
+	}
+
+	// With a service_id the duration comes from the service.
+	serviceId := query.Get("service_id")
+	duration := 0
+	if serviceId == "" || query.Get("duration") != "" {
+		var err error
+		duration, err = strconv.Atoi(query.Get("duration"))
+		if err != nil || duration <= 0 {
+			transformError(w, "Invalid duration parameter", "duration must be a positive number of minutes")
+			return nil
+		}
+	}
+
+	slots, err := h.service.GetStoreSlots(id, from, to, time.Duration(duration)*time.Minute, serviceId, query.Get("resource_id"))
+	if err != nil {
+		transformError(w, "Failed to get store slots", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(slots)
+	return nil
+}
+
+// GET /stores/{id}/booking-policy
+func (h *handler) GetStoreBookingPolicy(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	id := p.ByName("id")
+
+	res, err := h.service.GetStoreBookingPolicy(id)
+	if err != nil {
+		transformError(w, "Failed to get store booking policy", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// PUT /stores/{id}/booking-policy
+func (h *handler) UpdateStoreBookingPolicy(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	id := p.ByName("id")
+
+	var policy StoreBookingPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(policy); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.UpdateStoreBookingPolicy(id, policy)
+	if err != nil {
+		transformError(w, "Failed to update store booking policy", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /stores/{id}/cancellation-policy
+func (h *handler) GetStoreCancellationPolicy(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	id := p.ByName("id")
+
+	res, err := h.service.GetStoreCancellationPolicy(id)
+	if err != nil {
+		transformError(w, "Failed to get store cancellation policy", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// PUT /stores/{id}/cancellation-policy
+func (h *handler) UpdateStoreCancellationPolicy(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	id := p.ByName("id")
+
+	var policy StoreCancellationPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(policy); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.UpdateStoreCancellationPolicy(id, policy)
+	if err != nil {
+		transformError(w, "Failed to update store cancellation policy", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /stores/{id}/customers/{userId}/no-shows
+func (h *handler) GetStoreCustomerNoShows(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	id := p.ByName("id")
+	userId := p.ByName("userId")
+
+	res, err := h.service.GetStoreCustomerNoShows(id, userId)
+	if err != nil {
+		transformError(w, "Failed to get store customer no-shows", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// POST /stores/{id}/waitlist
+func (h *handler) CreateStoreWaitlistEntry(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	var entry StoreWaitlistEntry
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+	entry.StoreId = p.ByName("id")
+
+	validate := validator.New()
+	if err := validate.Struct(entry); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.CreateStoreWaitlistEntry(entry)
+	if err != nil {
+		transformError(w, "Failed to join store waitlist", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /stores/{id}/waitlist?status={status}&user_id={userId}
+func (h *handler) GetStoreWaitlistEntries(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	id := p.ByName("id")
+	query := r.URL.Query()
+
+	entries, err := h.service.GetStoreWaitlistEntries(id, query.Get("status"), query.Get("user_id"))
+	if err != nil {
+		transformError(w, "Failed to get store waitlist", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(entries)
+	return nil
+}
+
+// GET /stores/{id}/waitlist/{entryId}
+func (h *handler) GetStoreWaitlistEntry(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.GetStoreWaitlistEntry(p.ByName("id"), p.ByName("entryId"))
+	if err != nil {
+		transformError(w, "Failed to get store waitlist entry", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// DELETE /stores/{id}/waitlist/{entryId}
+func (h *handler) CancelStoreWaitlistEntry(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.CancelStoreWaitlistEntry(p.ByName("id"), p.ByName("entryId"), app.UserID(ctx))
+	if err != nil {
+		transformError(w, "Failed to leave store waitlist", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// POST /stores/{id}/waitlist/{entryId}/accept
+func (h *handler) AcceptStoreWaitlistOffer(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.AcceptStoreWaitlistOffer(p.ByName("id"), p.ByName("entryId"), app.UserID(ctx))
+	if err != nil {
+		transformError(w, "Failed to accept waitlist offer", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// POST /stores/{id}/waitlist/{entryId}/decline
+func (h *handler) DeclineStoreWaitlistOffer(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.DeclineStoreWaitlistOffer(p.ByName("id"), p.ByName("entryId"), app.UserID(ctx))
+	if err != nil {
+		transformError(w, "Failed to decline waitlist offer", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// POST /stores/{id}/sessions
+func (h *handler) CreateStoreSession(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	var session StoreSession
+	if err := json.NewDecoder(r.Body).Decode(&session); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+	session.StoreId = p.ByName("id")
+
+	validate := validator.New()
+	if err := validate.Struct(session); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.CreateStoreSession(session)
+	if err != nil {
+		respondError(w, "Failed to create store session", err)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /stores/{id}/sessions?from={from}&to={to}&status={status}
+func (h *handler) GetStoreSessions(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	id := p.ByName("id")
+	query := r.URL.Query()
+
+	sessions, err := h.service.GetStoreSessions(id, query.Get("from"), query.Get("to"), query.Get("status"))
+	if err != nil {
+		transformError(w, "Failed to get store sessions", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(sessions)
+	return nil
+}
+
+// GET /stores/{id}/sessions/{sessionId}
+func (h *handler) GetStoreSession(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	session, err := h.service.GetStoreSession(p.ByName("id"), p.ByName("sessionId"))
+	if err != nil {
+		transformError(w, "Failed to get store session", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(session)
+	return nil
+}
+
+// PUT /stores/{id}/sessions/{sessionId}
+func (h *handler) UpdateStoreSession(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	var session StoreSession
+	if err := json.NewDecoder(r.Body).Decode(&session); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(session); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.UpdateStoreSession(p.ByName("id"), p.ByName("sessionId"), session)
+	if err != nil {
+		respondError(w, "Failed to update store session", err)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// POST /stores/{id}/sessions/{sessionId}/cancel
+func (h *handler) CancelStoreSession(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.CancelStoreSession(p.ByName("id"), p.ByName("sessionId"))
+	if err != nil {
+		transformError(w, "Failed to cancel store session", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// POST /stores/{id}/sessions/{sessionId}/bookings
+func (h *handler) CreateStoreSessionBooking(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	var booking StoreSessionBooking
+	if err := json.NewDecoder(r.Body).Decode(&booking); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+	booking.SessionId = p.ByName("sessionId")
+
+	validate := validator.New()
+	if err := validate.Struct(booking); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.CreateStoreSessionBooking(p.ByName("id"), booking)
+	if err != nil {
+		respondError(w, "Failed to book store session", err)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /stores/{id}/sessions/{sessionId}/bookings?status={status}
+func (h *handler) GetStoreSessionBookings(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	bookings, err := h.service.GetStoreSessionBookings(p.ByName("id"), p.ByName("sessionId"), r.URL.Query().Get("status"))
+	if err != nil {
+		transformError(w, "Failed to get store session bookings", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(bookings)
+	return nil
+}
+
+// POST /stores/{id}/sessions/{sessionId}/bookings/{bookingId}/cancel
+func (h *handler) CancelStoreSessionBooking(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.CancelStoreSessionBooking(p.ByName("id"), p.ByName("sessionId"), p.ByName("bookingId"))
+	if err != nil {
+		transformError(w, "Failed to cancel store session booking", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// PUT /stores/{id}/sessions/{sessionId}/attendance
+func (h *handler) MarkStoreSessionAttendance(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	var attendance MarkSessionAttendanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&attendance); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(attendance); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.MarkStoreSessionAttendance(p.ByName("id"), p.ByName("sessionId"), attendance)
+	if err != nil {
+		transformError(w, "Failed to mark store session attendance", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// POST /stores/{id}/calendar-feed
+func (h *handler) CreateStoreCalendarFeed(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.CreateStoreCalendarFeed(p.ByName("id"))
+	if err != nil {
+		transformError(w, "Failed to create store calendar feed", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// DELETE /stores/{id}/calendar-feed
+func (h *handler) RevokeStoreCalendarFeed(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	if err := h.service.RevokeStoreCalendarFeed(p.ByName("id")); err != nil {
+		transformError(w, "Failed to revoke store calendar feed", err.Error())
+		return nil
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// GET /stores/{id}/calendar.ics?token={token}
+func (h *handler) GetStoreCalendarFeed(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	feed, err := h.service.GetStoreCalendarFeed(p.ByName("id"), r.URL.Query().Get("token"))
+	if err != nil {
+		respondCalendarError(w, "Failed to get store calendar feed", err)
+		return nil
+	}
+
+	writeCalendar(w, feed)
+	return nil
+}
+
+// POST /users/{id}/calendar-feed
+func (h *handler) CreateUserCalendarFeed(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.CreateUserCalendarFeed(p.ByName("id"))
+	if err != nil {
+		transformError(w, "Failed to create user calendar feed", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// DELETE /users/{id}/calendar-feed
+func (h *handler) RevokeUserCalendarFeed(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	if err := h.service.RevokeUserCalendarFeed(p.ByName("id")); err != nil {
+		transformError(w, "Failed to revoke user calendar feed", err.Error())
+		return nil
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// GET /users/{id}/calendar.ics?token={token}
+func (h *handler) GetUserCalendarFeed(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	feed, err := h.service.GetUserCalendarFeed(p.ByName("id"), r.URL.Query().Get("token"))
+	if err != nil {
+		respondCalendarError(w, "Failed to get user calendar feed", err)
+		return nil
+	}
+
+	writeCalendar(w, feed)
+	return nil
+}
+
+// POST /stores/{id}/calendar-sources
+func (h *handler) CreateStoreCalendarSource(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	var source StoreCalendarSource
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxCalendarSourceSize*2)).Decode(&source); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(source); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.CreateStoreCalendarSource(p.ByName("id"), source)
+	if err != nil {
+		transformError(w, "Failed to create store calendar source", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /stores/{id}/calendar-sources
+func (h *handler) GetStoreCalendarSources(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.GetStoreCalendarSources(p.ByName("id"))
+	if err != nil {
+		transformError(w, "Failed to get store calendar sources", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /stores/{id}/calendar-sources/{sourceId}
+func (h *handler) GetStoreCalendarSource(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.GetStoreCalendarSource(p.ByName("id"), p.ByName("sourceId"))
+	if err != nil {
+		transformError(w, "Failed to get store calendar source", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// PUT /stores/{id}/calendar-sources/{sourceId}/content, the body is the
+// iCalendar file itself
+func (h *handler) UploadStoreCalendarSource(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	content, err := io.ReadAll(io.LimitReader(r.Body, maxCalendarSourceSize+1))
+	if err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.UploadStoreCalendarSource(p.ByName("id"), p.ByName("sourceId"), string(content))
+	if err != nil {
+		transformError(w, "Failed to upload store calendar source", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// POST /stores/{id}/calendar-sources/{sourceId}/refresh
+func (h *handler) RefreshStoreCalendarSource(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	res, err := h.service.RefreshStoreCalendarSource(p.ByName("id"), p.ByName("sourceId"))
+	if err != nil {
+		transformError(w, "Failed to refresh store calendar source", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// DELETE /stores/{id}/calendar-sources/{sourceId}
+func (h *handler) DeleteStoreCalendarSource(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	if err := h.service.DeleteStoreCalendarSource(p.ByName("id"), p.ByName("sourceId")); err != nil {
+		transformError(w, "Failed to delete store calendar source", err.Error())
+		return nil
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// GET /stores/{id}/holidays?year={year}
+func (h *handler) GetStoreHolidays(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	id := p.ByName("id")
+
+	year := time.Now().Year()
+	if value := r.URL.Query().Get("year"); value != "" {
+		var err error
+		year, err = strconv.Atoi(value)
+		if err != nil || year < 1900 || year > 2200 {
+			transformError(w, "Invalid year parameter", "year must be between 1900 and 2200")
+			return nil
+		}
+	}
+
+	res, err := h.service.GetStoreHolidays(id, year)
+	if err != nil {
+		transformError(w, "Failed to get store holidays", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// POST /stores/{id}/services
+func (h *handler) CreateStoreService(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	var storeService StoreService
+	if err := json.NewDecoder(r.Body).Decode(&storeService); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+	storeService.StoreId = p.ByName("id")
+
+	validate := validator.New()
+	if err := validate.Struct(storeService); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.CreateStoreService(storeService)
+	if err != nil {
+		transformError(w, "Failed to create store service", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /stores/{id}/services?active=true
+func (h *handler) GetStoreServices(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	id := p.ByName("id")
+	activeOnly := r.URL.Query().Get("active") == "true"
+
+	services, err := h.service.GetStoreServices(id, activeOnly)
+	if err != nil {
+		transformError(w, "Failed to get store services", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(services)
+	return nil
+}
+
+// GET /stores/{id}/services/{serviceId}
+func (h *handler) GetStoreService(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	storeService, err := h.service.GetStoreService(p.ByName("id"), p.ByName("serviceId"))
+	if err != nil {
+		transformError(w, "Failed to get store service", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(storeService)
+	return nil
+}
+
+// PUT /stores/{id}/services/{serviceId}
+func (h *handler) UpdateStoreService(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	var storeService StoreService
+	if err := json.NewDecoder(r.Body).Decode(&storeService); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(storeService); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.UpdateStoreService(p.ByName("id"), p.ByName("serviceId"), storeService)
+	if err != nil {
+		transformError(w, "Failed to update store service", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// DELETE /stores/{id}/services/{serviceId}
+func (h *handler) DeleteStoreService(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	if err := h.service.DeleteStoreService(p.ByName("id"), p.ByName("serviceId")); err != nil {
+		transformError(w, "Failed to delete store service", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+	_ = json.NewEncoder(w).Encode("Store service deleted")
+	return nil
+}
+
+// POST /stores/{id}/resources
+func (h *handler) CreateStoreResource(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	var resource StoreResource
+	if err := json.NewDecoder(r.Body).Decode(&resource); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+	resource.StoreId = p.ByName("id")
+
+	validate := validator.New()
+	if err := validate.Struct(resource); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.CreateStoreResource(resource)
+	if err != nil {
+		transformError(w, "Failed to create store resource", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// GET /stores/{id}/resources?active=true
+func (h *handler) GetStoreResources(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	id := p.ByName("id")
+	activeOnly := r.URL.Query().Get("active") == "true"
+
+	resources, err := h.service.GetStoreResources(id, activeOnly)
+	if err != nil {
+		transformError(w, "Failed to get store resources", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resources)
+	return nil
+}
+
+// GET /stores/{id}/resources/{resourceId}
+func (h *handler) GetStoreResource(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	resource, err := h.service.GetStoreResource(p.ByName("id"), p.ByName("resourceId"))
+	if err != nil {
+		transformError(w, "Failed to get store resource", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resource)
+	return nil
+}
+
+// PUT /stores/{id}/resources/{resourceId}
+func (h *handler) UpdateStoreResource(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	var resource StoreResource
+	if err := json.NewDecoder(r.Body).Decode(&resource); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(resource); err != nil {
+		transformError(w, "Invalid request body", err.Error())
+		return nil
+	}
+
+	res, err := h.service.UpdateStoreResource(p.ByName("id"), p.ByName("resourceId"), resource)
+	if err != nil {
+		transformError(w, "Failed to update store resource", err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(res)
+	return nil
+}
+
+// DELETE /stores/{id}/resources/{resourceId}
+func (h *handler) DeleteStoreResource(ctx context.Context, w http.ResponseWriter, r *http.Request, p httprouter.Params) error {
+	if err := h.service.DeleteStoreResource(p.ByName("id"), p.ByName("resourceId")); err != nil {
+		respondError(w, "Failed to delete store resource", err)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+	_ = json.NewEncoder(w).Encode("Store resource deleted")
+	return nil
+}
+
+// respond error for response api, constraint conflicts are answered with 409
+func respondError(w http.ResponseWriter, m string, err error) {
+	var policy *BookingPolicyError
+	if errors.As(err, &policy) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(app.ErrorResponse{Error: m, Fields: policy.Fields})
+		return
+	}
+
+	var series *SeriesAvailabilityError
+	if errors.As(err, &series) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(app.ConflictResponse{Message: m, Error: series.Error(), Conflict: series.Occurrences})
+		return
+	}
+
+	// The appointment isn't in a status that allows the change, or left it
+	// while the change was being made.
+	var transition *TransitionError
+	if errors.As(err, &transition) || errors.Is(err, ErrAppointmentStatusChanged) || errors.Is(err, ErrHoldExpired) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(app.ConflictResponse{Message: m, Error: err.Error()})
+		return
+	}
+
+	var conflict *postgres.ConflictError
+	if !errors.As(err, &conflict) {
+		transformError(w, m, err.Error())
+		return
+	}
+
+	var data = app.ConflictResponse{
+		Message:  m,
+		Error:    conflict.Message,
+		Conflict: conflict.Conflict,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(data)
+}
+
+// writeCalendar sends an iCalendar feed. Calendar apps poll feeds, so they
+// are not cached on the way.
+func writeCalendar(w http.ResponseWriter, feed []byte) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(feed)
+}
+
+// respondCalendarError answers an unknown or revoked feed token with a 404,
+// so feeds can't be told apart from stores or customers without one.
+func respondCalendarError(w http.ResponseWriter, m string, err error) {
+	if !errors.Is(err, ErrCalendarFeedNotFound) {
+		transformError(w, m, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(app.ValidateError{Message: m, Error: err.Error()})
+}
+
 // transform error for response api
 func transformError(w http.ResponseWriter, m string, e string) {
 	var data = app.ValidateError{
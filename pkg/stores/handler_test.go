@@ -0,0 +1,35 @@
+package stores
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/genda/genda-api/internal/app"
+	"github.com/genda/genda-api/internal/storage/postgres"
+)
+
+func TestRespondError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"transition not allowed", &TransitionError{From: AppointmentStatusCompleted, To: AppointmentStatusCanceled}, http.StatusConflict},
+		{"status changed meanwhile", ErrAppointmentStatusChanged, http.StatusConflict},
+		{"wrapped status change", fmt.Errorf("cancel: %w", ErrAppointmentStatusChanged), http.StatusConflict},
+		{"hold expired", ErrHoldExpired, http.StatusConflict},
+		{"overlap", &postgres.ConflictError{Constraint: "store_appointments_no_overlap", Message: "taken"}, http.StatusConflict},
+		{"policy", &BookingPolicyError{Fields: []app.FieldError{{Field: "start_at", Error: "too soon"}}}, http.StatusUnprocessableEntity},
+		{"anything else", errors.New("appointment a1 not found"), http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		respondError(w, "Failed to cancel store appointment", tc.err)
+		if w.Code != tc.code {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.code)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package stores
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/genda/genda-api/pkg/holidays"
+)
+
+// validateHolidayCalendar checks the state and city a store takes its
+// holidays from.
+func validateHolidayCalendar(store *Store) error {
+	store.HolidayState = strings.ToUpper(strings.TrimSpace(store.HolidayState))
+	store.HolidayCity = strings.TrimSpace(store.HolidayCity)
+
+	if store.HolidayState != "" && !holidays.ValidState(store.HolidayState) {
+		return fmt.Errorf("unknown holiday_state %q", store.HolidayState)
+	}
+	if store.HolidayCity != "" && store.HolidayState == "" {
+		return fmt.Errorf("holiday_city requires holiday_state")
+	}
+	return nil
+}
+
+// holidayExceptions turns the holidays of the store calendar between from and
+// to into closed exceptions. Days the store already has a store wide
+// exception for are left out, so the store can still open on a holiday.
+func holidayExceptions(calendar *StoreCalendar, from time.Time, to time.Time, existing []StoreAvailabilityException) ([]StoreAvailabilityException, error) {
+	if !calendar.HolidayCalendar {
+		return nil, nil
+	}
+
+	days, err := holidays.Between(from, to, calendar.HolidayState, calendar.HolidayCity)
+	if err != nil {
+		return nil, err
+	}
+
+	var exceptions []StoreAvailabilityException
+	for _, day := range days {
+		if coveredByException(existing, day.Date) {
+			continue
+		}
+		exceptions = append(exceptions, StoreAvailabilityException{
+			Kind:      ExceptionKindClosed,
+			StartDate: day.Date,
+			EndDate:   day.Date,
+			Reason:    day.Name,
+		})
+	}
+	return exceptions, nil
+}
+
+// coveredByException reports whether a store wide exception covers the date.
+func coveredByException(exceptions []StoreAvailabilityException, date string) bool {
+	for _, e := range exceptions {
+		if e.ResourceId == "" && e.StartDate <= date && date <= e.EndDate {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package stores
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// openingHours are the weekly hours an appointment has to fit in.
+type openingHours struct {
+	weekly []Availability
+	// resource is set when the hours are the resource's own rather than
+	// the store's.
+	resource bool
+}
+
+// hoursViolation returns an error naming the rule the [start, end) range
+// breaks: an exception on one of its days, or the weekly hours. It returns nil
+// when the whole range is open.
+func hoursViolation(hours openingHours, exceptions []StoreAvailabilityException, start time.Time, end time.Time) error {
+	if err := exceptionViolation(exceptions, start, end); err != nil {
+		return err
+	}
+
+	open, err := applyExceptions(openIntervals(hours.weekly, start, end), exceptions, start, end)
+	if err != nil {
+		return err
+	}
+	if covers(open, start, end) {
+		return nil
+	}
+	return hoursError(hours, start, end)
+}
+
+// hoursError describes the weekly hours of the day the range starts on.
+func hoursError(hours openingHours, start time.Time, end time.Time) error {
+	subject := "store"
+	if hours.resource {
+		subject = "resource"
+	}
+
+	var ranges []string
+	for _, a := range hours.weekly {
+		weekday, err := parseWeekday(a.DayOfWeek)
+		if err != nil || weekday != start.Weekday() {
+			continue
+		}
+		ranges = append(ranges, a.OpenTime+" to "+a.CloseTime)
+	}
+
+	if len(ranges) == 0 {
+		return fmt.Errorf("the %s is closed on %ss", subject, start.Weekday())
+	}
+	return fmt.Errorf("the %s only opens on %ss from %s, the appointment runs from %s to %s",
+		subject, start.Weekday(), strings.Join(ranges, " and "), start.Format("15:04"), end.Format("15:04"))
+}
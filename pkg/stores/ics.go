@@ -0,0 +1,161 @@
+package stores
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrCalendarFeedNotFound is returned for a feed token that doesn't exist, was
+// revoked, or belongs to another store or customer.
+var ErrCalendarFeedNotFound = errors.New("calendar feed not found")
+
+// calendarFeedSince is how far back the feeds go, so subscribers keep the
+// recent history without the feed growing forever.
+const calendarFeedSince = 90 * 24 * time.Hour
+
+// icsUIDDomain keeps the event UIDs globally unique, as RFC 5545 asks.
+const icsUIDDomain = "genda"
+
+// icsTimeFormat is the UTC form of an iCalendar DATE-TIME.
+const icsTimeFormat = "20060102T150405Z"
+
+// calendarAppointment is an appointment as the calendar feeds read it.
+type calendarAppointment struct {
+	Id           string
+	Status       string
+	StartAt      time.Time
+	EndAt        time.Time
+	UpdatedAt    time.Time
+	ServiceName  string
+	StoreName    string
+	CustomerName string
+	Notes        string
+}
+
+type icsEvent struct {
+	UID         string
+	Status      string
+	Summary     string
+	Description string
+	Start       time.Time
+	End         time.Time
+	Modified    time.Time
+}
+
+// icsStatuses maps the appointment statuses onto the VEVENT STATUS values.
+var icsStatuses = map[string]string{
+	AppointmentStatusPending:   "TENTATIVE",
+	AppointmentStatusConfirmed: "CONFIRMED",
+	AppointmentStatusCompleted: "CONFIRMED",
+	AppointmentStatusNoShow:    "CONFIRMED",
+	AppointmentStatusCanceled:  "CANCELLED",
+}
+
+// newCalendarFeedToken returns a random feed token and the hash it is stored
+// under.
+func newCalendarFeedToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, calendarFeedTokenHash(token), nil
+}
+
+func calendarFeedTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// appointmentEvent renders an appointment as a VEVENT. The UID only depends
+// on the appointment, so calendar apps update the event in place when it is
+// moved or canceled.
+func appointmentEvent(a calendarAppointment, summary string, description string) icsEvent {
+	return icsEvent{
+		UID:         a.Id + "@" + icsUIDDomain,
+		Status:      icsStatuses[a.Status],
+		Summary:     summary,
+		Description: description,
+		Start:       a.StartAt,
+		End:         a.EndAt,
+		Modified:    a.UpdatedAt,
+	}
+}
+
+// renderCalendar writes a VCALENDAR holding the events, with CRLF line
+// endings and long lines folded as RFC 5545 requires.
+func renderCalendar(name string, events []icsEvent) []byte {
+	var b strings.Builder
+	line := func(content string) {
+		b.WriteString(foldICSLine(content))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//Genda//Genda API//PT")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:" + escapeICSText(name))
+	for _, e := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + e.UID)
+		line("DTSTAMP:" + e.Modified.UTC().Format(icsTimeFormat))
+		line("LAST-MODIFIED:" + e.Modified.UTC().Format(icsTimeFormat))
+		line("DTSTART:" + e.Start.UTC().Format(icsTimeFormat))
+		line("DTEND:" + e.End.UTC().Format(icsTimeFormat))
+		line("SUMMARY:" + escapeICSText(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION:" + escapeICSText(e.Description))
+		}
+		if e.Status != "" {
+			line("STATUS:" + e.Status)
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+
+	return []byte(b.String())
+}
+
+// escapeICSText escapes a TEXT property value.
+func escapeICSText(value string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(value)
+}
+
+// foldICSLine splits a content line into lines of at most 75 octets, the
+// continuations starting with a space, without breaking a UTF-8 sequence.
+func foldICSLine(content string) string {
+	const limit = 75
+	if len(content) <= limit {
+		return content
+	}
+
+	var b strings.Builder
+	width := limit
+	for len(content) > width {
+		cut := width
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		b.WriteString(content[:cut])
+		b.WriteString("\r\n ")
+		content = content[cut:]
+		// The leading space counts towards the continuation line.
+		width = limit - 1
+	}
+	b.WriteString(content)
+	return b.String()
+}
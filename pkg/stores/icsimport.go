@@ -0,0 +1,476 @@
+package stores
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/genda/genda-api/pkg/rrule"
+)
+
+// calendarImportWindow is how far ahead the busy time of a calendar source
+// is read. Recurring events are expanded over it, so it moves forward with
+// every refresh.
+const calendarImportWindow = 90 * 24 * time.Hour
+
+// maxCalendarSourceSize bounds the iCalendar files read, fetched or uploaded.
+const maxCalendarSourceSize = 5 << 20
+
+// maxImportedBlocks bounds the busy blocks kept per source, the nearest ones
+// are kept.
+const maxImportedBlocks = 5000
+
+// maxCalendarRedirects bounds the redirects followed fetching a source.
+const maxCalendarRedirects = 5
+
+// calendarSourceClient fetches the calendar source URLs. Source URLs come
+// from users, so it only connects to public addresses, whatever the host
+// resolves to and wherever the server redirects, and skips any proxy.
+var calendarSourceClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: dialPublicOnly,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: checkCalendarRedirect,
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), private in
+// all but name.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// dialPublicOnly refuses connections to loopback, private, link-local (cloud
+// metadata at 169.254.169.254 among them) and other non-public addresses. It
+// runs on the resolved address of every connection, redirects included.
+func dialPublicOnly(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() ||
+		sharedAddressSpace.Contains(ip) || (ip.Is4() && ip.As4()[0] == 0) {
+		return fmt.Errorf("the calendar address %s is not public", ip)
+	}
+	return nil
+}
+
+// checkCalendarRedirect follows redirects to http and https URLs only.
+func checkCalendarRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxCalendarRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxCalendarRedirects)
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("can't follow a redirect to a %s URL", req.URL.Scheme)
+	}
+	return nil
+}
+
+// calendarBusyBlock is time a calendar source marks busy.
+type calendarBusyBlock struct {
+	UID   string
+	Start time.Time
+	End   time.Time
+}
+
+// calendarImport is what was read from a calendar source. Skipped counts the
+// events left out because their recurrence can't be read.
+type calendarImport struct {
+	Blocks  []calendarBusyBlock
+	Skipped int
+}
+
+type icsProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// importedEvent is a VEVENT as read, before recurrences are expanded. An
+// event with a RecurrenceId replaces that one occurrence of its UID.
+type importedEvent struct {
+	UID          string
+	Start        time.Time
+	End          time.Time
+	Duration     time.Duration
+	AllDay       bool
+	RRule        string
+	RDates       []time.Time
+	ExDates      []time.Time
+	RecurrenceId time.Time
+	Free         bool
+}
+
+// calendarSourceURL checks a source URL, reading webcal:// as https://.
+func calendarSourceURL(value string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(value))
+	if err != nil || u.Host == "" {
+		return "", errors.New("url must be an absolute http, https or webcal URL")
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "webcal", "webcals":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return "", errors.New("url must be an absolute http, https or webcal URL")
+	}
+	return u.String(), nil
+}
+
+// fetchCalendarSource downloads the iCalendar file at the source URL.
+func fetchCalendarSource(sourceURL string) (string, error) {
+	target, err := calendarSourceURL(sourceURL)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "text/calendar")
+
+	res, err := calendarSourceClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching calendar: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching calendar: the server returned %d", res.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxCalendarSourceSize+1))
+	if err != nil {
+		return "", fmt.Errorf("fetching calendar: %w", err)
+	}
+	if len(data) > maxCalendarSourceSize {
+		return "", fmt.Errorf("the calendar is larger than %d MB", maxCalendarSourceSize>>20)
+	}
+	return string(data), nil
+}
+
+// parseBusyCalendar reads the busy time of an iCalendar file between from
+// and to. Cancelled and free (TRANSP:TRANSPARENT) events don't count. Times
+// without a zone, and all-day events, are read in loc.
+func parseBusyCalendar(data string, loc *time.Location, from time.Time, to time.Time) (*calendarImport, error) {
+	properties := unfoldICS(data)
+	if len(properties) == 0 || properties[0].Name != "BEGIN" || !strings.EqualFold(properties[0].Value, "VCALENDAR") {
+		return nil, errors.New("not an iCalendar file, it must start with BEGIN:VCALENDAR")
+	}
+
+	var events []importedEvent
+	var current *importedEvent
+	depth := 0
+	for _, p := range properties {
+		switch p.Name {
+		case "BEGIN":
+			if strings.EqualFold(p.Value, "VEVENT") && depth == 0 {
+				current = &importedEvent{}
+			} else if current != nil {
+				depth++
+			}
+			continue
+		case "END":
+			if current != nil && depth > 0 {
+				depth--
+			} else if current != nil && strings.EqualFold(p.Value, "VEVENT") {
+				events = append(events, *current)
+				current = nil
+			}
+			continue
+		}
+		// Alarms and other components nested in the event have their own
+		// DURATION and such, they are not the event's.
+		if current == nil || depth > 0 {
+			continue
+		}
+		if err := current.set(p, loc); err != nil {
+			return nil, err
+		}
+	}
+
+	return expandBusyEvents(events, from, to), nil
+}
+
+func (e *importedEvent) set(p icsProperty, loc *time.Location) error {
+	var err error
+	switch p.Name {
+	case "UID":
+		e.UID = p.Value
+	case "DTSTART":
+		e.Start, e.AllDay, err = parseICSTime(p.Params, p.Value, loc)
+	case "DTEND":
+		e.End, _, err = parseICSTime(p.Params, p.Value, loc)
+	case "DURATION":
+		e.Duration, err = parseICSDuration(p.Value)
+	case "RRULE":
+		e.RRule = p.Value
+	case "RDATE":
+		e.RDates, err = parseICSTimes(p, loc, e.RDates)
+	case "EXDATE":
+		e.ExDates, err = parseICSTimes(p, loc, e.ExDates)
+	case "RECURRENCE-ID":
+		e.RecurrenceId, _, err = parseICSTime(p.Params, p.Value, loc)
+	case "STATUS":
+		if strings.EqualFold(p.Value, "CANCELLED") {
+			e.Free = true
+		}
+	case "TRANSP":
+		if strings.EqualFold(p.Value, "TRANSPARENT") {
+			e.Free = true
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("event %s: invalid %s: %w", e.UID, p.Name, err)
+	}
+	return nil
+}
+
+// length is how long each occurrence of the event lasts. Events without an
+// end last a day when all-day, and take no time otherwise.
+func (e importedEvent) length() time.Duration {
+	switch {
+	case !e.End.IsZero():
+		return e.End.Sub(e.Start)
+	case e.Duration > 0:
+		return e.Duration
+	case e.AllDay:
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+// expandBusyEvents lays the events, recurrences included, over [from, to).
+func expandBusyEvents(events []importedEvent, from time.Time, to time.Time) *calendarImport {
+	overridden := map[string]map[int64]bool{}
+	for _, e := range events {
+		if e.RecurrenceId.IsZero() {
+			continue
+		}
+		if overridden[e.UID] == nil {
+			overridden[e.UID] = map[int64]bool{}
+		}
+		overridden[e.UID][e.RecurrenceId.Unix()] = true
+	}
+
+	res := &calendarImport{Blocks: []calendarBusyBlock{}}
+	for _, e := range events {
+		length := e.length()
+		if e.Free || e.Start.IsZero() || length <= 0 {
+			continue
+		}
+
+		starts := []time.Time{e.Start}
+		if e.RecurrenceId.IsZero() {
+			if e.RRule != "" {
+				rule, err := rrule.Parse(e.RRule, e.Start.Location())
+				if err != nil {
+					res.Skipped++
+					continue
+				}
+				starts = rule.Between(e.Start, from.Add(-length), to, maxImportedBlocks)
+			}
+			starts = append(starts, e.RDates...)
+		}
+
+		for _, start := range starts {
+			if e.RecurrenceId.IsZero() && (overridden[e.UID][start.Unix()] || excluded(e.ExDates, start)) {
+				continue
+			}
+			end := start.Add(length)
+			if !start.Before(to) || !end.After(from) {
+				continue
+			}
+			res.Blocks = append(res.Blocks, calendarBusyBlock{UID: e.UID, Start: start, End: end})
+		}
+	}
+
+	sort.Slice(res.Blocks, func(i, j int) bool {
+		return res.Blocks[i].Start.Before(res.Blocks[j].Start)
+	})
+	if len(res.Blocks) > maxImportedBlocks {
+		res.Blocks = res.Blocks[:maxImportedBlocks]
+	}
+	return res
+}
+
+func excluded(exDates []time.Time, start time.Time) bool {
+	for _, d := range exDates {
+		if d.Equal(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// unfoldICS splits an iCalendar file into its properties, joining the folded
+// lines back.
+func unfoldICS(data string) []icsProperty {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.TrimPrefix(data, "\ufeff")
+
+	var lines []string
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	properties := make([]icsProperty, 0, len(lines))
+	for _, line := range lines {
+		if p, ok := parseICSProperty(line); ok {
+			properties = append(properties, p)
+		}
+	}
+	return properties
+}
+
+// parseICSProperty reads NAME;PARAM=VALUE;...:value, the parameter values
+// may be quoted and hold ':' or ';'.
+func parseICSProperty(line string) (icsProperty, bool) {
+	p := icsProperty{Params: map[string]string{}}
+
+	quoted := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return p, false
+	}
+	p.Value = line[colon+1:]
+
+	parts := splitOutsideQuotes(line[:colon], ';')
+	p.Name = strings.ToUpper(strings.TrimSpace(parts[0]))
+	for _, param := range parts[1:] {
+		key, value, ok := strings.Cut(param, "=")
+		if ok {
+			p.Params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+		}
+	}
+	return p, p.Name != ""
+}
+
+func splitOutsideQuotes(value string, sep rune) []string {
+	var parts []string
+	quoted := false
+	last := 0
+	for i, r := range value {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == sep && !quoted {
+			parts = append(parts, value[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, value[last:])
+}
+
+// parseICSTime reads a DATE or DATE-TIME value: UTC when it ends in Z, in its
+// TZID when it has one that is known, and in loc otherwise.
+func parseICSTime(params map[string]string, value string, loc *time.Location) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	if params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(icsTimeFormat, value)
+		return t, false, err
+	}
+
+	zone := loc
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+			zone = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, zone)
+	return t, false, err
+}
+
+// parseICSTimes reads a comma separated RDATE or EXDATE onto list.
+func parseICSTimes(p icsProperty, loc *time.Location, list []time.Time) ([]time.Time, error) {
+	for _, value := range strings.Split(p.Value, ",") {
+		// RDATE periods (start/end) only take their start.
+		value, _, _ = strings.Cut(value, "/")
+		t, _, err := parseICSTime(p.Params, value, loc)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, nil
+}
+
+// parseICSDuration reads a DURATION such as PT1H30M, P1D or P2W.
+func parseICSDuration(value string) (time.Duration, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	sign := time.Duration(1)
+	if strings.HasPrefix(value, "-") {
+		sign = -1
+	}
+	value = strings.TrimLeft(value, "+-")
+	if !strings.HasPrefix(value, "P") || len(value) < 3 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	units := map[byte]time.Duration{
+		'W': 7 * 24 * time.Hour,
+		'D': 24 * time.Hour,
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+	}
+	var total time.Duration
+	number := ""
+	inTime := false
+	for i := 1; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == 'T':
+			inTime = true
+		case c >= '0' && c <= '9':
+			number += string(c)
+		default:
+			unit, ok := units[c]
+			n, err := strconv.Atoi(number)
+			// M is minutes only after the T, there are no months.
+			if !ok || err != nil || (c == 'M' && !inTime) {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			total += time.Duration(n) * unit
+			number = ""
+		}
+	}
+	if number != "" {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return sign * total, nil
+}
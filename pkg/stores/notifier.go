@@ -0,0 +1,34 @@
+package stores
+
+import "log"
+
+// Notifier keeps the notifications sent to customers in line with their
+// appointments: confirmations, reminders that move when the appointment
+// moves, rating requests once it is completed.
+type Notifier interface {
+	SyncAppointment(string) error
+	CancelAppointment(string) error
+}
+
+// notify syncs the notifications of the appointments after a change. The
+// change already happened, a failed sync is logged and caught up on the next
+// change.
+func (s *service) notify(ids ...string) {
+	if s.notifier == nil {
+		return
+	}
+	for _, id := range ids {
+		if err := s.notifier.SyncAppointment(id); err != nil {
+			log.Println("An error occurred while scheduling appointment notifications", err)
+		}
+	}
+}
+
+// seriesIds lists the appointments of the series.
+func seriesIds(series *StoreAppointmentSeries) []string {
+	ids := make([]string, 0, len(series.Appointments))
+	for _, appointment := range series.Appointments {
+		ids = append(ids, appointment.Id)
+	}
+	return ids
+}
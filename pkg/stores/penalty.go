@@ -0,0 +1,53 @@
+package stores
+
+import (
+	"time"
+
+	"github.com/genda/genda-api/pkg/money"
+)
+
+// cancellationPercent returns the fee percentage for canceling an appointment
+// that starts at start: the one of the tightest window the time left falls
+// in, or zero when it falls in none.
+func cancellationPercent(policy *StoreCancellationPolicy, start time.Time, now time.Time) money.Decimal {
+	left := start.Sub(now)
+
+	var percent money.Decimal
+	tightest := -1
+	for _, window := range policy.Windows {
+		if left >= time.Duration(window.HoursBefore)*time.Hour {
+			continue
+		}
+		if tightest == -1 || window.HoursBefore < tightest {
+			tightest = window.HoursBefore
+			percent = window.FeePercent
+		}
+	}
+	return percent
+}
+
+// appointmentPenalty computes the fee for moving the appointment to status,
+// or nil when the move carries none. Holds that were never confirmed are
+// released for free.
+func appointmentPenalty(policy *StoreCancellationPolicy, appointment StoreAppointment, status string, loc *time.Location, now time.Time) (*AppointmentPenalty, error) {
+	penalty := AppointmentPenalty{}
+	switch {
+	case status == AppointmentStatusNoShow:
+		penalty.Kind = PenaltyKindNoShow
+		penalty.Percent = policy.NoShowFeePercent
+	case status == AppointmentStatusCanceled && appointment.Status == AppointmentStatusConfirmed:
+		start, err := parseTimeParam(appointment.StartAt, loc)
+		if err != nil {
+			return nil, err
+		}
+		penalty.Kind = PenaltyKindCancellation
+		penalty.Percent = cancellationPercent(policy, start, now)
+	case status == AppointmentStatusCanceled:
+		penalty.Kind = PenaltyKindCancellation
+	default:
+		return nil, nil
+	}
+
+	penalty.Amount = money.Money{Amount: appointment.Price, Currency: appointment.Currency}.Percent(penalty.Percent).Amount
+	return &penalty, nil
+}
@@ -0,0 +1,136 @@
+package stores
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/genda/genda-api/internal/app"
+)
+
+// BookingPolicyError is returned when a booking breaks the store booking
+// policy. It lists every rule broken, by request field.
+type BookingPolicyError struct {
+	Fields []app.FieldError
+}
+
+func (e *BookingPolicyError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, field.Field+": "+field.Error)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// bufferMinutes returns the buffer kept after an appointment, the longest of
+// the service buffer and the store one.
+func (p *StoreBookingPolicy) bufferMinutes(serviceBuffer int) int {
+	if p.BufferMinutes > serviceBuffer {
+		return p.BufferMinutes
+	}
+	return serviceBuffer
+}
+
+// tooSoon reports whether start is within the minimum lead time.
+func (p *StoreBookingPolicy) tooSoon(start time.Time, now time.Time) bool {
+	return p.MinLeadMinutes > 0 && start.Before(now.Add(time.Duration(p.MinLeadMinutes)*time.Minute))
+}
+
+// tooFar reports whether start is past the booking horizon, counted in days
+// on the store wall clock.
+func (p *StoreBookingPolicy) tooFar(start time.Time, now time.Time) bool {
+	return p.MaxHorizonDays > 0 && start.After(fromWallClock(wallClock(now.In(start.Location())).AddDate(0, 0, p.MaxHorizonDays), start.Location()))
+}
+
+// checkWindow returns the range of appointments policyViolations needs: the
+// whole local day of start, widened by the buffer on both sides.
+func (p *StoreBookingPolicy) checkWindow(start time.Time, end time.Time) (time.Time, time.Time) {
+	buffer := time.Duration(p.BufferMinutes) * time.Minute
+	from := atClock(start, 0)
+	if early := start.Add(-buffer); early.Before(from) {
+		from = early
+	}
+	to := atClock(start, 24*time.Hour)
+	if late := end.Add(buffer); late.After(to) {
+		to = late
+	}
+	return from, to
+}
+
+// policyViolations checks an appointment against the policy. busy holds the
+// live appointments of the store around it, as returned for checkWindow, and
+// may hold bookings not saved yet, without an id.
+func policyViolations(policy *StoreBookingPolicy, appointment StoreAppointment, start time.Time, end time.Time, now time.Time, busy []StoreAppointment) ([]app.FieldError, error) {
+	var fields []app.FieldError
+
+	if policy.tooSoon(start, now) {
+		fields = append(fields, app.FieldError{
+			Field: "start_at",
+			Error: fmt.Sprintf("must be booked at least %d minutes ahead", policy.MinLeadMinutes),
+		})
+	}
+	if policy.tooFar(start, now) {
+		fields = append(fields, app.FieldError{
+			Field: "start_at",
+			Error: fmt.Sprintf("can't be booked more than %d days ahead", policy.MaxHorizonDays),
+		})
+	}
+
+	buffer := time.Duration(policy.BufferMinutes) * time.Minute
+	day := start.Format(dateLayout)
+	booked := 0
+	for _, other := range busy {
+		if other.Id != "" && other.Id == appointment.Id {
+			continue
+		}
+		otherStart, err := parseTimeParam(other.StartAt, start.Location())
+		if err != nil {
+			return nil, err
+		}
+		otherEnd, err := parseTimeParam(other.EndAt, start.Location())
+		if err != nil {
+			return nil, err
+		}
+
+		if otherStart.Format(dateLayout) == day {
+			booked++
+		}
+
+		// Overlapping bookings are left to the overlap check, which names
+		// the conflicting appointment.
+		if buffer == 0 || other.ResourceId != appointment.ResourceId || (otherStart.Before(end) && otherEnd.After(start)) {
+			continue
+		}
+		if otherStart.Before(end.Add(buffer)) && otherEnd.Add(buffer).After(start) {
+			fields = append(fields, app.FieldError{
+				Field: "buffer_minutes",
+				Error: fmt.Sprintf("the store keeps %d minutes between appointments, appointment %s is too close", policy.BufferMinutes, other.Id),
+			})
+			buffer = 0
+		}
+	}
+
+	if policy.MaxDailyAppointments > 0 && booked >= policy.MaxDailyAppointments {
+		fields = append(fields, app.FieldError{
+			Field: "start_at",
+			Error: fmt.Sprintf("the store takes at most %d appointments on %s", policy.MaxDailyAppointments, day),
+		})
+	}
+
+	return fields, nil
+}
+
+// policySlots drops the slots the lead time and horizon don't allow.
+func policySlots(policy *StoreBookingPolicy, slots []Slot, now time.Time, loc *time.Location) ([]Slot, error) {
+	kept := []Slot{}
+	for _, slot := range slots {
+		start, err := parseTimeParam(slot.StartAt, loc)
+		if err != nil {
+			return nil, err
+		}
+		if !policy.tooSoon(start, now) && !policy.tooFar(start, now) {
+			kept = append(kept, slot)
+		}
+	}
+	return kept, nil
+}
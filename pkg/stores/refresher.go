@@ -0,0 +1,59 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/genda/genda-api/pkg/notifications"
+)
+
+// CalendarSourceRefresher reads the store calendar sources again once they
+// are older than the interval, so changes to the fetched calendars reach the
+// slots and the recurring events keep covering the import window.
+type CalendarSourceRefresher struct {
+	repository *StoreRepo
+	service    Service
+	interval   time.Duration
+	log        *log.Logger
+}
+
+func NewCalendarSourceRefresher(postgresDB *sql.DB, interval time.Duration, log *log.Logger) *CalendarSourceRefresher {
+	repository := NewStoreRepository(postgresDB)
+	return &CalendarSourceRefresher{
+		repository: repository,
+		service:    newConfiguredService(repository, notifications.NewScheduler(postgresDB)),
+		interval:   interval,
+		log:        log,
+	}
+}
+
+// Run refreshes the stale sources once per interval until the context is
+// canceled.
+func (r *CalendarSourceRefresher) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sources, err := r.repository.GetStaleStoreCalendarSources(time.Now().Add(-r.interval))
+			if err != nil {
+				r.log.Printf("calendar source refresher: %v", err)
+				continue
+			}
+
+			for _, source := range sources {
+				if ctx.Err() != nil {
+					return
+				}
+				if _, err := r.service.RefreshStoreCalendarSource(source.StoreId, source.Id); err != nil {
+					r.log.Printf("calendar source refresher: source %s: %v", source.Id, err)
+				}
+			}
+		}
+	}
+}
@@ -3,13 +3,92 @@ package stores
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/genda/genda-api/internal/storage/postgres"
+	"github.com/genda/genda-api/pkg/money"
+	"github.com/genda/genda-api/pkg/payments"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+// appointmentColumns is the select list read by formatAppointment; nullable
+// columns are coalesced so they scan into the plain string/decimal fields, and
+// the store timezone comes last so the instants are rendered in local time.
+const appointmentColumns = `
+			id,
+			store_id,
+			user_id,
+			COALESCE(service_id::text, ''),
+			COALESCE(resource_id::text, ''),
+			start_at,
+			end_at,
+			buffer_minutes,
+			status,
+			hold_expires_at,
+			COALESCE(price, 0),
+			COALESCE(currency, ''),
+			COALESCE(fee_platform, 0),
+			penalty_fee,
+			COALESCE(payment_id::text, ''),
+			COALESCE(series_id::text, ''),
+			COALESCE(notes, ''),
+			created_at,
+			updated_at,
+			(SELECT timezone FROM stores WHERE stores.id = store_appointments.store_id)`
+
+// overlapConstraint is the exclusion constraint that keeps live appointments
+// of the same resource from overlapping.
+const overlapConstraint = "no_overlap_per_resource"
+
+// ErrHoldExpired is returned when confirming an appointment that is no longer
+// a live pending hold.
+var ErrHoldExpired = errors.New("appointment is not pending or its hold has expired")
+
+// insertAppointmentSQL takes its arguments from appointmentArgs.
+const insertAppointmentSQL = `
+		INSERT INTO store_appointments
+			(id, store_id, user_id, service_id, resource_id, start_at, end_at, buffer_minutes, status, hold_expires_at, price, currency, fee_platform, payment_id, series_id, notes)
+		VALUES
+			($1,$2,$3,NULLIF($4,'')::uuid,NULLIF($5,'')::uuid,$6,$7,$8,$9,NULLIF($10,'')::timestamptz,$11,$12,$13,NULLIF($14,'')::uuid,NULLIF($15,'')::uuid,$16)
+	`
+
+func appointmentArgs(appointment StoreAppointment) []any {
+	return []any{
+		appointment.Id,
+		appointment.StoreId,
+		appointment.UserId,
+		appointment.ServiceId,
+		appointment.ResourceId,
+		appointment.StartAt,
+		appointment.EndAt,
+		appointment.BufferMinutes,
+		appointment.Status,
+		appointment.HoldExpiresAt,
+		appointment.Price,
+		appointment.Currency,
+		appointment.FeePlatform,
+		appointment.PaymentId,
+		appointment.SeriesId,
+		appointment.Notes,
+	}
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
 type StoreRepo struct {
 	postgresDB *sql.DB
 }
@@ -25,9 +104,9 @@ func (i *StoreRepo) CreateStore(store Store) (*Store, error) {
 
 	const insertSQL = `
 		INSERT INTO stores
-			(id, name, owner_id, "type", location)
+			(id, name, owner_id, "type", location, timezone, holiday_calendar, holiday_state, holiday_city)
 		VALUES
-			($1,$2,$3,$4,$5::json)
+			($1,$2,$3,$4,$5::json,$6,$7,NULLIF($8,''),NULLIF($9,''))
 	`
 	_, err := i.postgresDB.Exec(insertSQL,
 		store.Id,
@@ -35,6 +114,10 @@ func (i *StoreRepo) CreateStore(store Store) (*Store, error) {
 		store.OwnerId,
 		store.Type,
 		store.Location,
+		store.Timezone,
+		store.HolidayCalendar,
+		store.HolidayState,
+		store.HolidayCity,
 	)
 	if err != nil {
 		log.Println("An error occurred while creating store", err)
@@ -89,7 +172,11 @@ func (i *StoreRepo) GetStores(page int, limit int, name string, storeType string
 			name,
 			owner_id,
 			type,
-			location
+			location,
+			timezone,
+			holiday_calendar,
+			COALESCE(holiday_state, ''),
+			COALESCE(holiday_city, '')
 		FROM stores
 	` + filter + `
 		ORDER BY name ASC
@@ -167,14 +254,19 @@ func (i *StoreRepo) GetStore(id string) (*GetStoreByIdResponse, error) {
 func (i *StoreRepo) UpdateStore(id string, store Store) (*Store, error) {
 	const sqlStmt = `
 		UPDATE stores
-		SET name = $1, "type" = $2, owner_id = $3, location = $4::json
-		WHERE id = $5
+		SET name = $1, "type" = $2, owner_id = $3, location = $4::json, timezone = $5,
+			holiday_calendar = $6, holiday_state = NULLIF($7,''), holiday_city = NULLIF($8,'')
+		WHERE id = $9
 	`
 	_, err := i.postgresDB.Exec(sqlStmt,
 		store.Name,
 		store.Type,
 		store.OwnerId,
 		store.Location, // string JSON
+		store.Timezone,
+		store.HolidayCalendar,
+		store.HolidayState,
+		store.HolidayCity,
 		id,
 	)
 	if err != nil {
@@ -184,6 +276,30 @@ func (i *StoreRepo) UpdateStore(id string, store Store) (*Store, error) {
 	return &store, nil
 }
 
+func (i *StoreRepo) GetStoreCalendar(storeId string) (*StoreCalendar, error) {
+	const sqlStmt = `
+		SELECT name, timezone, holiday_calendar, COALESCE(holiday_state, ''), COALESCE(holiday_city, '')
+		FROM stores
+		WHERE id = $1
+	`
+	var calendar StoreCalendar
+	err := i.postgresDB.QueryRow(sqlStmt, storeId).Scan(
+		&calendar.Name,
+		&calendar.Timezone,
+		&calendar.HolidayCalendar,
+		&calendar.HolidayState,
+		&calendar.HolidayCity,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("store %s not found", storeId)
+		}
+		log.Println("An error occurred while getting store calendar", err)
+		return nil, err
+	}
+	return &calendar, nil
+}
+
 func (i *StoreRepo) DeleteStore(id string) error {
 	const sqlStmt = `DELETE FROM stores WHERE id = $1`
 	if _, err := i.postgresDB.Exec(sqlStmt, id); err != nil {
@@ -213,6 +329,9 @@ func (i *StoreRepo) CreateStoreRating(rating StoreRating) (*StoreRating, error)
 	)
 	if err != nil {
 		log.Println("An error occurred while creating store rating", err)
+		if conflict := i.storeConflict(err, nil); conflict != nil {
+			return nil, conflict
+		}
 		return nil, err
 	}
 	return &rating, nil
@@ -482,238 +601,2858 @@ func (i *StoreRepo) GetStoreAvailability(storeId string) (*StoreAvailability, er
 		&availability.UpdatedAt,
 	)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("store %s has no opening hours set", storeId)
+		}
 		log.Println("An error occurred while getting store availability", err)
 		return nil, err
 	}
 	return &availability, nil
 }
 
-func (i *StoreRepo) CreateStoreAppointment(appointment StoreAppointment) (*StoreAppointment, error) {
-	if appointment.Id == "" {
-		appointment.Id = uuid.New().String()
+const availabilityExceptionColumns = `
+			id,
+			store_id,
+			COALESCE(resource_id::text, ''),
+			kind,
+			to_char(start_date, 'YYYY-MM-DD'),
+			to_char(end_date, 'YYYY-MM-DD'),
+			COALESCE(open_time, ''),
+			COALESCE(close_time, ''),
+			COALESCE(reason, ''),
+			created_at,
+			updated_at`
+
+func (i *StoreRepo) CreateStoreAvailabilityException(exception StoreAvailabilityException) (*StoreAvailabilityException, error) {
+	if exception.Id == "" {
+		exception.Id = uuid.New().String()
 	}
 
 	const insertSQL = `
-		INSERT INTO store_appointments
-			(id, store_id, user_id, start_at, end_at, status, hold_expires_at, price, currency, fee_platform, payment_id, notes)
+		INSERT INTO store_availability_exceptions
+			(id, store_id, resource_id, kind, start_date, end_date, open_time, close_time, reason)
 		VALUES
-			($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+			($1,$2,NULLIF($3,'')::uuid,$4,$5,$6,NULLIF($7,''),NULLIF($8,''),NULLIF($9,''))
 	`
 	_, err := i.postgresDB.Exec(insertSQL,
-		appointment.Id,
-		appointment.StoreId,
-		appointment.UserId,
-		appointment.StartAt,
-		appointment.EndAt,
-		appointment.Status,
-		appointment.HoldExpiresAt,
-		appointment.Price,
-		appointment.Currency,
-		appointment.FeePlatform,
-		appointment.PaymentId,
-		appointment.Notes,
+		exception.Id,
+		exception.StoreId,
+		exception.ResourceId,
+		exception.Kind,
+		exception.StartDate,
+		exception.EndDate,
+		exception.OpenTime,
+		exception.CloseTime,
+		exception.Reason,
 	)
 	if err != nil {
-		log.Println("An error occurred while creating store appointment", err)
+		log.Println("An error occurred while creating store availability exception", err)
 		return nil, err
 	}
-	return &appointment, nil
+	return &exception, nil
 }
 
-func (i *StoreRepo) GetStoreAppointments(storeId string, page int, limit int) (*GetStoreAppointmentsResponse, error) {
-	res := GetStoreAppointmentsResponse{
-		Page:         page,
-		Limit:        limit,
-		Appointments: []StoreAppointment{},
-	}
-
-	// total
-	countSQL := "SELECT count(*) FROM store_appointments WHERE store_id = $1"
-	if err := i.postgresDB.QueryRow(countSQL, storeId).Scan(&res.Total); err != nil {
-		log.Println("An error occurred while counting store appointments", err)
-		return nil, err
-	}
-
-	// página
-	listSQL := `
-		SELECT
-			id,
-			store_id,
-			user_id,
-			start_at,
-			end_at,
-			status,
-			hold_expires_at,
-			price,
-			currency,
-			fee_platform,
-			payment_id,
-			notes,
-			created_at,
-			updated_at
-		FROM store_appointments
+// GetStoreAvailabilityExceptions lists the exceptions of the store touching
+// the from-to date range, both YYYY-MM-DD and optional.
+func (i *StoreRepo) GetStoreAvailabilityExceptions(storeId string, from string, to string) ([]StoreAvailabilityException, error) {
+	sqlStmt := `
+		SELECT` + availabilityExceptionColumns + `
+		FROM store_availability_exceptions
 		WHERE store_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3;
+			AND end_date >= COALESCE(NULLIF($2,'')::date, '-infinity')
+			AND start_date <= COALESCE(NULLIF($3,'')::date, 'infinity')
+		ORDER BY start_date ASC, end_date ASC;
 	`
-	offset := (page * limit) - limit
-
-	rows, err := i.postgresDB.Query(listSQL, storeId, limit, offset)
+	rows, err := i.postgresDB.Query(sqlStmt, storeId, from, to)
 	if err != nil {
-		log.Println("An error occurred while getting store appointments", err)
+		log.Println("An error occurred while getting store availability exceptions", err)
 		return nil, err
 	}
 	defer rows.Close()
 
+	exceptions := []StoreAvailabilityException{}
 	for rows.Next() {
-		var appointment StoreAppointment
-		err := rows.Scan(
-			&appointment.Id,
-			&appointment.StoreId,
-			&appointment.UserId,
-			&appointment.StartAt,
-			&appointment.EndAt,
-			&appointment.Status,
-			&appointment.HoldExpiresAt,
-			&appointment.Price,
-			&appointment.Currency,
-			&appointment.FeePlatform,
-			&appointment.PaymentId,
-			&appointment.Notes,
-			&appointment.CreatedAt,
-			&appointment.UpdatedAt,
-		)
+		exception, err := i.formatAvailabilityException(rows)
 		if err != nil {
-			log.Println("An error occurred while scanning store appointment", err)
+			log.Println("An error occurred while scanning store availability exception", err)
 			return nil, err
 		}
-		res.Appointments = append(res.Appointments, appointment)
+		exceptions = append(exceptions, *exception)
 	}
-	if err := rows.Err(); err != nil {
-		log.Println("Row iteration error while getting store appointments", err)
+	return exceptions, rows.Err()
+}
+
+func (i *StoreRepo) GetStoreAvailabilityException(id string) (*StoreAvailabilityException, error) {
+	sqlStmt := `
+		SELECT` + availabilityExceptionColumns + `
+		FROM store_availability_exceptions
+		WHERE id = $1;
+	`
+	exception, err := i.formatAvailabilityException(i.postgresDB.QueryRow(sqlStmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("availability exception %s not found", id)
+		}
+		log.Println("An error occurred while getting store availability exception", err)
 		return nil, err
 	}
-
-	return &res, nil
+	return exception, nil
 }
 
-func (i *StoreRepo) UpdateStoreAppointment(id string, appointment StoreAppointment) (*StoreAppointment, error) {
+func (i *StoreRepo) UpdateStoreAvailabilityException(id string, exception StoreAvailabilityException) (*StoreAvailabilityException, error) {
+	exception.Id = id
+
 	const sqlStmt = `
-		UPDATE store_appointments
-		SET start_at = $1, end_at = $2, status = $3, hold_expires_at = $4, price = $5, currency = $6, fee_platform = $7, payment_id = $8, notes = $9
-		WHERE id = $10
+		UPDATE store_availability_exceptions
+		SET resource_id = NULLIF($1,'')::uuid, kind = $2, start_date = $3, end_date = $4, open_time = NULLIF($5,''), close_time = NULLIF($6,''), reason = NULLIF($7,''), updated_at = now()
+		WHERE id = $8
 	`
 	_, err := i.postgresDB.Exec(sqlStmt,
-		appointment.StartAt,
-		appointment.EndAt,
-		appointment.Status,
-		appointment.HoldExpiresAt,
-		appointment.Price,
-		appointment.Currency,
-		appointment.FeePlatform,
-		appointment.PaymentId,
-		appointment.Notes,
+		exception.ResourceId,
+		exception.Kind,
+		exception.StartDate,
+		exception.EndDate,
+		exception.OpenTime,
+		exception.CloseTime,
+		exception.Reason,
 		id,
 	)
 	if err != nil {
-		log.Println("An error occurred while updating store appointment", err)
+		log.Println("An error occurred while updating store availability exception", err)
 		return nil, err
 	}
-	return &appointment, nil
+	return &exception, nil
 }
 
-func (i *StoreRepo) DeleteStoreAppointment(id string) error {
-	const sqlStmt = `DELETE FROM store_appointments WHERE id = $1`
+func (i *StoreRepo) DeleteStoreAvailabilityException(id string) error {
+	const sqlStmt = `DELETE FROM store_availability_exceptions WHERE id = $1`
 	if _, err := i.postgresDB.Exec(sqlStmt, id); err != nil {
-		log.Println("An error occurred while deleting store appointment", err)
+		log.Println("An error occurred while deleting store availability exception", err)
 		return err
 	}
 	return nil
 }
 
-func (i *StoreRepo) getStoreStatements(storeId string) (string, error) {
+func (i *StoreRepo) CreateStoreAppointment(appointment StoreAppointment) (*StoreAppointment, error) {
+	if appointment.Id == "" {
+		appointment.Id = uuid.New().String()
+	}
+
+	// A pending appointment with hold_expires_at set is a hold: it already
+	// takes part in no_overlap_per_resource, so the slot is reserved until it is
+	// confirmed or the sweeper cancels it.
+	_, err := i.postgresDB.Exec(insertAppointmentSQL, appointmentArgs(appointment)...)
+	if err != nil {
+		log.Println("An error occurred while creating store appointment", err)
+		if conflict := i.storeConflict(err, &appointment); conflict != nil {
+			return nil, conflict
+		}
+		return nil, err
+	}
+	return &appointment, nil
+}
+
+func (i *StoreRepo) GetStoreAppointment(id string) (*StoreAppointment, error) {
 	const sqlStmt = `
-		SELECT
-			stores.id,
-			stores.name,
-			stores.owner_id,
-			stores.type,
-			stores.location,
-			store_availability.availability,
-			store_ratings.user_id,
-			store_ratings.rating,
-			store_ratings.message,
-			store_ratings.created_at
-			store_plans.id as plan_id,
-			store_plans.name as plan_name,
-			store_plans.price as plan_price,
-			store_plans.currency as plan_currency,
-			store_plans.plan_type,
-			store_plans.frequency
-		FROM stores
-		LEFT JOIN store_availability ON stores.id = store_availability.store_id
-		LEFT JOIN store_ratings ON stores.id = store_ratings.store_id
-		LEFT JOIN store_plans ON stores.id = store_plans.store_id
-		WHERE stores.id = '` + storeId + `';
+		SELECT ` + appointmentColumns + `
+		FROM store_appointments
+		WHERE id = $1;
 	`
-	return sqlStmt, nil
+	appointment, err := i.formatAppointment(i.postgresDB.QueryRow(sqlStmt, id))
+	if err != nil {
+		log.Println("An error occurred while getting store appointment", err)
+		return nil, err
+	}
+	return appointment, nil
 }
 
-func (i *StoreRepo) formatStore(row *sql.Rows) (*Store, error) {
-	s := Store{}
-
-	var location []byte
-	err := row.Scan(
-		&s.Id,
-		&s.Name,
-		&s.OwnerId,
-		&s.Type,
-		&location,
-	)
+// TransitionStoreAppointment moves the appointment of the store from one
+// status to another and records the change. It fails with
+// ErrAppointmentStatusChanged when the appointment is no longer in the from
+// status, and with ErrHoldExpired when confirming a hold that already expired.
+func (i *StoreRepo) TransitionStoreAppointment(storeId string, id string, from string, to string, changedBy string, reason string, now time.Time, penalty *AppointmentPenalty) (*StoreAppointment, error) {
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting store appointment transition", err)
+		return nil, err
+	}
+	defer tx.Rollback()
 
+	const updateSQL = `
+		UPDATE store_appointments
+		SET status = $3,
+			hold_expires_at = NULL,
+			updated_at = now()
+		WHERE id = $1
+			AND store_id = $5
+			AND status = $2
+			AND ($3 <> 'confirmed' OR hold_expires_at IS NULL OR hold_expires_at > $4)
+		RETURNING ` + appointmentColumns + `;
+	`
+	appointment, err := i.formatAppointment(tx.QueryRow(updateSQL, id, from, to, now, storeId))
+	if err == sql.ErrNoRows {
+		if from == AppointmentStatusPending && to == AppointmentStatusConfirmed {
+			return nil, ErrHoldExpired
+		}
+		return nil, ErrAppointmentStatusChanged
+	}
 	if err != nil {
-		log.Println("An error occurred while scanning store", err)
+		log.Println("An error occurred while updating store appointment status", err)
 		return nil, err
 	}
 
-	if location != nil {
-		if err := json.Unmarshal(location, &s.Location); err != nil {
-			log.Println("An error occurred while getting stores", err)
+	const historySQL = `
+		INSERT INTO store_appointment_status_history
+			(appointment_id, from_status, to_status, changed_by, reason)
+		VALUES
+			($1,$2,$3,NULLIF($4,''),NULLIF($5,''))
+	`
+	if _, err := tx.Exec(historySQL, id, from, to, changedBy, reason); err != nil {
+		log.Println("An error occurred while recording store appointment status change", err)
+		return nil, err
+	}
+
+	if err := i.recordPenalty(tx, appointment, penalty, reason); err != nil {
+		return nil, err
+	}
+
+	// Accepting or turning down a waitlist offer settles the entry with it.
+	if entryStatus, ok := offerOutcomes[to]; ok {
+		const offerSQL = `
+			UPDATE store_waitlist_entries
+			SET status = $2, updated_at = now()
+			WHERE appointment_id = $1 AND status = 'offered'
+		`
+		if _, err := tx.Exec(offerSQL, id, entryStatus); err != nil {
+			log.Println("An error occurred while settling store waitlist offer", err)
 			return nil, err
 		}
 	}
 
-	return &s, nil
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing store appointment transition", err)
+		return nil, err
+	}
+	return appointment, nil
 }
 
-func (i *StoreRepo) formatFullStore(row *sql.Rows) (*FullStore, error) {
-	s := FullStore{
-		Ratings: []StoreRating{},
-		Plans:   []StorePlan{},
+// recordPenalty charges the penalty to the customer. A prepaid appointment
+// keeps the fee out of its payment, and a canceled one gets the rest back; a
+// no-show keeps the whole payment. Otherwise the fee is recorded as a payment
+// the customer owes.
+func (i *StoreRepo) recordPenalty(tx *sql.Tx, appointment *StoreAppointment, penalty *AppointmentPenalty, reason string) error {
+	if penalty == nil {
+		return nil
 	}
 
-	var location []byte
-	err := row.Scan(
-		&s.Store.Id,
-		&s.Store.Name,
-		&s.Store.OwnerId,
-		&s.Store.Type,
-		&location,
-		&s.Availability.Availability,
-		// Additional fields for Ratings and Plans would go here
-	)
+	if penalty.Amount.Sign() > 0 {
+		const feeSQL = `UPDATE store_appointments SET penalty_fee = $2 WHERE id = $1`
+		if _, err := tx.Exec(feeSQL, appointment.Id, penalty.Amount); err != nil {
+			log.Println("An error occurred while recording store appointment penalty", err)
+			return err
+		}
+		appointment.PenaltyFee = penalty.Amount
+	}
 
+	if reason == "" {
+		reason = penalty.Kind
+	}
+	return payments.RecordPenalty(tx, payments.Penalty{
+		StoreId:       appointment.StoreId,
+		UserId:        appointment.UserId,
+		AppointmentId: appointment.Id,
+		PaymentId:     appointment.PaymentId,
+		Kind:          penalty.Kind,
+		Percent:       penalty.Percent,
+		Amount:        money.Money{Amount: penalty.Amount, Currency: appointment.Currency},
+		Reason:        reason,
+		Refund:        appointment.Status == AppointmentStatusCanceled,
+	})
+}
+
+// GetStoreCustomerNoShows lists the appointments the customer missed at the
+// store, latest first.
+func (i *StoreRepo) GetStoreCustomerNoShows(storeId string, userId string) ([]StoreNoShow, error) {
+	const sqlStmt = `
+		SELECT
+			a.id,
+			COALESCE(a.service_id::text, ''),
+			a.start_at,
+			COALESCE(a.price, 0),
+			a.penalty_fee,
+			COALESCE(a.currency, ''),
+			COALESCE(h.created_at, a.updated_at),
+			s.timezone
+		FROM store_appointments a
+		JOIN stores s ON s.id = a.store_id
+		LEFT JOIN LATERAL (
+			SELECT created_at
+			FROM store_appointment_status_history
+			WHERE appointment_id = a.id AND to_status = 'no_show'
+			ORDER BY created_at DESC
+			LIMIT 1
+		) h ON true
+		WHERE a.store_id = $1
+			AND a.user_id = $2
+			AND a.status = 'no_show'
+		ORDER BY a.start_at DESC;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, storeId, userId)
 	if err != nil {
-		log.Println("An error occurred while scanning full store", err)
+		log.Println("An error occurred while getting store customer no-shows", err)
 		return nil, err
 	}
+	defer rows.Close()
 
-	if location != nil {
-		if err := json.Unmarshal(location, &s.Store.Location); err != nil {
-			log.Println("An error occurred while unmarshalling store location", err)
+	noShows := []StoreNoShow{}
+	for rows.Next() {
+		var noShow StoreNoShow
+		var timezone string
+		err := rows.Scan(
+			&noShow.AppointmentId,
+			&noShow.ServiceId,
+			&noShow.StartAt,
+			&noShow.Price,
+			&noShow.PenaltyFee,
+			&noShow.Currency,
+			&noShow.MarkedAt,
+			&timezone,
+		)
+		if err != nil {
+			log.Println("An error occurred while scanning store customer no-show", err)
 			return nil, err
 		}
+		if loc, err := loadTimezone(timezone); err == nil {
+			noShow.StartAt = localTime(noShow.StartAt, loc)
+		}
+		noShows = append(noShows, noShow)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting store customer no-shows", err)
+		return nil, err
 	}
 
-	return &s, nil
+	return noShows, nil
+}
+
+func (i *StoreRepo) GetStoreCancellationPolicy(storeId string) (*StoreCancellationPolicy, error) {
+	const sqlStmt = `
+		SELECT
+			store_id,
+			windows,
+			no_show_fee_percent,
+			created_at,
+			updated_at
+		FROM store_cancellation_policies
+		WHERE store_id = $1;
+	`
+	var policy StoreCancellationPolicy
+	var windows []byte
+	err := i.postgresDB.QueryRow(sqlStmt, storeId).Scan(
+		&policy.StoreId,
+		&windows,
+		&policy.NoShowFeePercent,
+		&policy.CreatedAt,
+		&policy.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &StoreCancellationPolicy{StoreId: storeId, Windows: []CancellationWindow{}}, nil
+		}
+		log.Println("An error occurred while getting store cancellation policy", err)
+		return nil, err
+	}
+	if err := json.Unmarshal(windows, &policy.Windows); err != nil {
+		log.Println("An error occurred while unmarshalling store cancellation windows", err)
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (i *StoreRepo) UpdateStoreCancellationPolicy(storeId string, policy StoreCancellationPolicy) (*StoreCancellationPolicy, error) {
+	policy.StoreId = storeId
+	if policy.Windows == nil {
+		policy.Windows = []CancellationWindow{}
+	}
+	windows, err := json.Marshal(policy.Windows)
+	if err != nil {
+		return nil, err
+	}
+
+	const sqlStmt = `
+		INSERT INTO store_cancellation_policies
+			(store_id, windows, no_show_fee_percent)
+		VALUES
+			($1,$2::json,$3)
+		ON CONFLICT (store_id) DO UPDATE
+		SET windows = EXCLUDED.windows,
+			no_show_fee_percent = EXCLUDED.no_show_fee_percent,
+			updated_at = now()
+		RETURNING created_at, updated_at
+	`
+	err = i.postgresDB.QueryRow(sqlStmt,
+		policy.StoreId,
+		string(windows),
+		policy.NoShowFeePercent,
+	).Scan(&policy.CreatedAt, &policy.UpdatedAt)
+	if err != nil {
+		log.Println("An error occurred while updating store cancellation policy", err)
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// RescheduleStoreAppointment moves a live appointment from the time it had
+// when it was read, at previousStartAt, to the time, resource and buffer of
+// moved, and records the previous time. Everything else, payment_id
+// included, stays as it is. It fails with ErrAppointmentMoved when the
+// appointment changed in the meantime.
+func (i *StoreRepo) RescheduleStoreAppointment(id string, previousStartAt string, moved StoreAppointment, changedBy string, reason string) (*StoreAppointment, error) {
+	moved.Id = id
+
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting store appointment reschedule", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	const lockSQL = `
+		SELECT start_at, end_at, COALESCE(resource_id::text, '')
+		FROM store_appointments
+		WHERE id = $1
+			AND status IN ('pending','confirmed')
+			AND start_at = $2
+		FOR UPDATE
+	`
+	var previous StoreAppointment
+	err = tx.QueryRow(lockSQL, id, previousStartAt).Scan(&previous.StartAt, &previous.EndAt, &previous.ResourceId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAppointmentMoved
+	}
+	if err != nil {
+		log.Println("An error occurred while locking store appointment for reschedule", err)
+		return nil, err
+	}
+
+	const updateSQL = `
+		UPDATE store_appointments
+		SET start_at = $2, end_at = $3, resource_id = NULLIF($4,'')::uuid, buffer_minutes = $5, updated_at = now()
+		WHERE id = $1
+		RETURNING ` + appointmentColumns + `;
+	`
+	appointment, err := i.formatAppointment(tx.QueryRow(updateSQL, id, moved.StartAt, moved.EndAt, moved.ResourceId, moved.BufferMinutes))
+	if err != nil {
+		log.Println("An error occurred while rescheduling store appointment", err)
+		if conflict := i.storeConflict(err, &moved); conflict != nil {
+			return nil, conflict
+		}
+		return nil, err
+	}
+
+	const historySQL = `
+		INSERT INTO store_appointment_reschedules
+			(appointment_id, previous_start_at, previous_end_at, previous_resource_id, start_at, end_at, resource_id, changed_by, reason)
+		VALUES
+			($1,$2,$3,NULLIF($4,'')::uuid,$5,$6,NULLIF($7,'')::uuid,NULLIF($8,''),NULLIF($9,''))
+	`
+	_, err = tx.Exec(historySQL,
+		id,
+		previous.StartAt,
+		previous.EndAt,
+		previous.ResourceId,
+		moved.StartAt,
+		moved.EndAt,
+		moved.ResourceId,
+		changedBy,
+		reason,
+	)
+	if err != nil {
+		log.Println("An error occurred while recording store appointment reschedule", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing store appointment reschedule", err)
+		return nil, err
+	}
+	return appointment, nil
+}
+
+func (i *StoreRepo) GetStoreAppointmentReschedules(appointmentId string) ([]StoreAppointmentReschedule, error) {
+	const sqlStmt = `
+		SELECT
+			r.id,
+			r.appointment_id,
+			r.previous_start_at,
+			r.previous_end_at,
+			COALESCE(r.previous_resource_id::text, ''),
+			r.start_at,
+			r.end_at,
+			COALESCE(r.resource_id::text, ''),
+			COALESCE(r.changed_by, ''),
+			COALESCE(r.reason, ''),
+			r.created_at,
+			s.timezone
+		FROM store_appointment_reschedules r
+		JOIN store_appointments a ON a.id = r.appointment_id
+		JOIN stores s ON s.id = a.store_id
+		WHERE r.appointment_id = $1
+		ORDER BY r.created_at ASC;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, appointmentId)
+	if err != nil {
+		log.Println("An error occurred while getting store appointment reschedules", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	reschedules := []StoreAppointmentReschedule{}
+	for rows.Next() {
+		var r StoreAppointmentReschedule
+		var timezone string
+		err := rows.Scan(
+			&r.Id,
+			&r.AppointmentId,
+			&r.PreviousStartAt,
+			&r.PreviousEndAt,
+			&r.PreviousResourceId,
+			&r.StartAt,
+			&r.EndAt,
+			&r.ResourceId,
+			&r.ChangedBy,
+			&r.Reason,
+			&r.CreatedAt,
+			&timezone,
+		)
+		if err != nil {
+			log.Println("An error occurred while scanning store appointment reschedule", err)
+			return nil, err
+		}
+		if loc, err := loadTimezone(timezone); err == nil {
+			r.PreviousStartAt = localTime(r.PreviousStartAt, loc)
+			r.PreviousEndAt = localTime(r.PreviousEndAt, loc)
+			r.StartAt = localTime(r.StartAt, loc)
+			r.EndAt = localTime(r.EndAt, loc)
+		}
+		reschedules = append(reschedules, r)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting store appointment reschedules", err)
+		return nil, err
+	}
+
+	return reschedules, nil
+}
+
+func (i *StoreRepo) GetStoreAppointmentHistory(appointmentId string) ([]StoreAppointmentStatusChange, error) {
+	const sqlStmt = `
+		SELECT
+			id,
+			appointment_id,
+			from_status,
+			to_status,
+			COALESCE(changed_by, ''),
+			COALESCE(reason, ''),
+			created_at
+		FROM store_appointment_status_history
+		WHERE appointment_id = $1
+		ORDER BY created_at ASC;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, appointmentId)
+	if err != nil {
+		log.Println("An error occurred while getting store appointment history", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []StoreAppointmentStatusChange{}
+	for rows.Next() {
+		var change StoreAppointmentStatusChange
+		err := rows.Scan(
+			&change.Id,
+			&change.AppointmentId,
+			&change.FromStatus,
+			&change.ToStatus,
+			&change.ChangedBy,
+			&change.Reason,
+			&change.CreatedAt,
+		)
+		if err != nil {
+			log.Println("An error occurred while scanning store appointment status change", err)
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting store appointment history", err)
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// CancelExpiredHolds cancels the holds that expired by now, along with the
+// waitlist offers they carried, and returns them so their time can be offered
+// again.
+func (i *StoreRepo) CancelExpiredHolds(now time.Time) ([]StoreAppointment, error) {
+	const sqlStmt = `
+		WITH expired AS (
+			UPDATE store_appointments
+			SET status = 'canceled', updated_at = now()
+			WHERE status = 'pending'
+				AND hold_expires_at IS NOT NULL
+				AND hold_expires_at <= $1
+			RETURNING ` + appointmentColumns + `
+		), history AS (
+			INSERT INTO store_appointment_status_history
+				(appointment_id, from_status, to_status, reason)
+			SELECT id, 'pending', 'canceled', 'hold expired'
+			FROM expired
+		), offers AS (
+			UPDATE store_waitlist_entries
+			SET status = 'expired', updated_at = now()
+			WHERE status = 'offered'
+				AND appointment_id IN (SELECT id FROM expired)
+		)
+		SELECT * FROM expired
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, now)
+	if err != nil {
+		log.Println("An error occurred while canceling expired holds", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	expired := []StoreAppointment{}
+	for rows.Next() {
+		appointment, err := i.formatAppointment(rows)
+		if err != nil {
+			return nil, err
+		}
+		expired = append(expired, *appointment)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while canceling expired holds", err)
+		return nil, err
+	}
+
+	return expired, nil
+}
+
+// waitlistColumns is the select list read by formatWaitlistEntry.
+const waitlistColumns = `
+			id,
+			store_id,
+			user_id,
+			COALESCE(service_id::text, ''),
+			window_start,
+			window_end,
+			status,
+			COALESCE(appointment_id::text, ''),
+			offer_expires_at,
+			COALESCE(notes, ''),
+			created_at,
+			updated_at,
+			(SELECT timezone FROM stores WHERE stores.id = store_waitlist_entries.store_id)`
+
+func (i *StoreRepo) CreateStoreWaitlistEntry(entry StoreWaitlistEntry) (*StoreWaitlistEntry, error) {
+	if entry.Id == "" {
+		entry.Id = uuid.New().String()
+	}
+
+	const sqlStmt = `
+		INSERT INTO store_waitlist_entries
+			(id, store_id, user_id, service_id, window_start, window_end, status, notes)
+		VALUES
+			($1,$2,$3,NULLIF($4,'')::uuid,$5,$6,$7,NULLIF($8,''))
+		RETURNING ` + waitlistColumns + `;
+	`
+	created, err := i.formatWaitlistEntry(i.postgresDB.QueryRow(sqlStmt,
+		entry.Id,
+		entry.StoreId,
+		entry.UserId,
+		entry.ServiceId,
+		entry.WindowStart,
+		entry.WindowEnd,
+		entry.Status,
+		entry.Notes,
+	))
+	if err != nil {
+		log.Println("An error occurred while creating store waitlist entry", err)
+		return nil, err
+	}
+	return created, nil
+}
+
+// GetStoreWaitlistEntries lists the store waitlist in the order offers are
+// made, optionally filtered by status and customer.
+func (i *StoreRepo) GetStoreWaitlistEntries(storeId string, status string, userId string) ([]StoreWaitlistEntry, error) {
+	const sqlStmt = `
+		SELECT ` + waitlistColumns + `
+		FROM store_waitlist_entries
+		WHERE store_id = $1
+			AND ($2 = '' OR status = $2)
+			AND ($3 = '' OR user_id::text = $3)
+		ORDER BY created_at ASC, id ASC;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, storeId, status, userId)
+	if err != nil {
+		log.Println("An error occurred while getting store waitlist", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []StoreWaitlistEntry{}
+	for rows.Next() {
+		entry, err := i.formatWaitlistEntry(rows)
+		if err != nil {
+			log.Println("An error occurred while scanning store waitlist entry", err)
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting store waitlist", err)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (i *StoreRepo) GetStoreWaitlistEntry(id string) (*StoreWaitlistEntry, error) {
+	const sqlStmt = `
+		SELECT ` + waitlistColumns + `
+		FROM store_waitlist_entries
+		WHERE id = $1;
+	`
+	entry, err := i.formatWaitlistEntry(i.postgresDB.QueryRow(sqlStmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("waitlist entry %s not found", id)
+		}
+		log.Println("An error occurred while getting store waitlist entry", err)
+		return nil, err
+	}
+	return entry, nil
+}
+
+// CancelStoreWaitlistEntry takes the customer off the waitlist. It fails with
+// ErrWaitlistEntryClosed when the entry is no longer waiting or offered.
+func (i *StoreRepo) CancelStoreWaitlistEntry(id string) (*StoreWaitlistEntry, error) {
+	const sqlStmt = `
+		UPDATE store_waitlist_entries
+		SET status = 'canceled', updated_at = now()
+		WHERE id = $1 AND status IN ('waiting','offered')
+		RETURNING ` + waitlistColumns + `;
+	`
+	entry, err := i.formatWaitlistEntry(i.postgresDB.QueryRow(sqlStmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWaitlistEntryClosed
+		}
+		log.Println("An error occurred while canceling store waitlist entry", err)
+		return nil, err
+	}
+	return entry, nil
+}
+
+// OfferStoreWaitlistSlot holds the slot for the first customer waiting for
+// its time, other than freedBy, and marks their entry as offered. The hold
+// lapses at slot.HoldExpiresAt. It returns nil when nobody is waiting or the
+// slot was taken in the meantime.
+func (i *StoreRepo) OfferStoreWaitlistSlot(slot StoreAppointment, freedBy string) (*StoreWaitlistEntry, error) {
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting store waitlist offer", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	const nextSQL = `
+		SELECT id, user_id
+		FROM store_waitlist_entries
+		WHERE store_id = $1
+			AND status = 'waiting'
+			AND window_start <= $2
+			AND window_end >= $3
+			AND (service_id IS NULL OR service_id = NULLIF($4,'')::uuid)
+			AND user_id::text <> $5
+		ORDER BY created_at ASC, id ASC
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`
+	var entryId string
+	err = tx.QueryRow(nextSQL, slot.StoreId, slot.StartAt, slot.EndAt, slot.ServiceId, freedBy).Scan(&entryId, &slot.UserId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Println("An error occurred while getting next store waitlist entry", err)
+		return nil, err
+	}
+
+	slot.Id = uuid.New().String()
+	if _, err := tx.Exec(insertAppointmentSQL, appointmentArgs(slot)...); err != nil {
+		if constraint, ok := postgres.ViolatedConstraint(err); ok && constraint == overlapConstraint {
+			return nil, nil
+		}
+		log.Println("An error occurred while holding store waitlist slot", err)
+		return nil, err
+	}
+
+	const offerSQL = `
+		UPDATE store_waitlist_entries
+		SET status = 'offered', appointment_id = $2, offer_expires_at = $3, updated_at = now()
+		WHERE id = $1
+		RETURNING ` + waitlistColumns + `;
+	`
+	entry, err := i.formatWaitlistEntry(tx.QueryRow(offerSQL, entryId, slot.Id, slot.HoldExpiresAt))
+	if err != nil {
+		log.Println("An error occurred while offering store waitlist slot", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing store waitlist offer", err)
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (i *StoreRepo) formatWaitlistEntry(row rowScanner) (*StoreWaitlistEntry, error) {
+	e := StoreWaitlistEntry{}
+
+	var offerExpiresAt sql.NullString
+	var timezone string
+	err := row.Scan(
+		&e.Id,
+		&e.StoreId,
+		&e.UserId,
+		&e.ServiceId,
+		&e.WindowStart,
+		&e.WindowEnd,
+		&e.Status,
+		&e.AppointmentId,
+		&offerExpiresAt,
+		&e.Notes,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+		&timezone,
+	)
+	if err != nil {
+		return nil, err
+	}
+	e.OfferExpiresAt = offerExpiresAt.String
+
+	if loc, err := loadTimezone(timezone); err == nil {
+		e.WindowStart = localTime(e.WindowStart, loc)
+		e.WindowEnd = localTime(e.WindowEnd, loc)
+		e.OfferExpiresAt = localTime(e.OfferExpiresAt, loc)
+	}
+	return &e, nil
+}
+
+// sessionColumns is the select list read by formatSession. Booked counts the
+// spots taken, attended and no-show bookings included.
+const sessionColumns = `
+			id,
+			store_id,
+			COALESCE(service_id::text, ''),
+			COALESCE(resource_id::text, ''),
+			title,
+			COALESCE(description, ''),
+			start_at,
+			end_at,
+			capacity,
+			price,
+			currency,
+			status,
+			(SELECT count(*) FROM store_session_bookings b WHERE b.session_id = store_sessions.id AND b.status IN ('booked','attended','no_show')),
+			(SELECT count(*) FROM store_session_bookings b WHERE b.session_id = store_sessions.id AND b.status = 'waitlisted'),
+			created_at,
+			updated_at,
+			(SELECT timezone FROM stores WHERE stores.id = store_sessions.store_id)`
+
+// sessionBookingColumns is the select list read by formatSessionBooking.
+const sessionBookingColumns = `
+			id,
+			session_id,
+			user_id,
+			status,
+			CASE WHEN status = 'waitlisted' THEN (
+				SELECT count(*) FROM store_session_bookings w
+				WHERE w.session_id = store_session_bookings.session_id
+					AND w.status = 'waitlisted'
+					AND (w.created_at, w.id) <= (store_session_bookings.created_at, store_session_bookings.id)
+			) ELSE 0 END,
+			attendance_marked_at,
+			created_at,
+			updated_at,
+			(SELECT s.timezone FROM stores s JOIN store_sessions ss ON ss.store_id = s.id WHERE ss.id = store_session_bookings.session_id)`
+
+func (i *StoreRepo) CreateStoreSession(session StoreSession) (*StoreSession, error) {
+	if session.Id == "" {
+		session.Id = uuid.New().String()
+	}
+
+	const sqlStmt = `
+		INSERT INTO store_sessions
+			(id, store_id, service_id, resource_id, title, description, start_at, end_at, capacity, price, currency, status)
+		VALUES
+			($1,$2,NULLIF($3,'')::uuid,NULLIF($4,'')::uuid,$5,NULLIF($6,''),$7,$8,$9,$10,COALESCE(NULLIF($11,''),'BRL'),$12)
+		RETURNING ` + sessionColumns + `;
+	`
+	created, err := i.formatSession(i.postgresDB.QueryRow(sqlStmt,
+		session.Id,
+		session.StoreId,
+		session.ServiceId,
+		session.ResourceId,
+		session.Title,
+		session.Description,
+		session.StartAt,
+		session.EndAt,
+		session.Capacity,
+		session.Price,
+		session.Currency,
+		session.Status,
+	))
+	if err != nil {
+		log.Println("An error occurred while creating store session", err)
+		if conflict := i.storeConflict(err, nil); conflict != nil {
+			return nil, conflict
+		}
+		return nil, err
+	}
+	return created, nil
+}
+
+// GetStoreSessions lists the classes running between from and to, optionally
+// filtered by status, in the order they start.
+func (i *StoreRepo) GetStoreSessions(storeId string, from time.Time, to time.Time, status string) ([]StoreSession, error) {
+	const sqlStmt = `
+		SELECT ` + sessionColumns + `
+		FROM store_sessions
+		WHERE store_id = $1
+			AND start_at < $3
+			AND end_at > $2
+			AND ($4 = '' OR status = $4)
+		ORDER BY start_at ASC, id ASC;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, storeId, from, to, status)
+	if err != nil {
+		log.Println("An error occurred while getting store sessions", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []StoreSession{}
+	for rows.Next() {
+		session, err := i.formatSession(rows)
+		if err != nil {
+			log.Println("An error occurred while scanning store session", err)
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting store sessions", err)
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (i *StoreRepo) GetStoreSession(id string) (*StoreSession, error) {
+	return i.getStoreSession(i.postgresDB, id)
+}
+
+func (i *StoreRepo) getStoreSession(q queryRower, id string) (*StoreSession, error) {
+	const sqlStmt = `
+		SELECT ` + sessionColumns + `
+		FROM store_sessions
+		WHERE id = $1;
+	`
+	session, err := i.formatSession(q.QueryRow(sqlStmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("session %s not found", id)
+		}
+		log.Println("An error occurred while getting store session", err)
+		return nil, err
+	}
+	return session, nil
+}
+
+// UpdateStoreSession changes a scheduled class. The capacity can't drop below
+// the spots already taken, and the spots it adds go to the waitlist.
+func (i *StoreRepo) UpdateStoreSession(id string, session StoreSession) (*StoreSession, error) {
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting store session update", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	booked, err := i.lockStoreSession(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Capacity < booked {
+		return nil, fmt.Errorf("capacity can't be lower than the %d spots already booked", booked)
+	}
+
+	const sqlStmt = `
+		UPDATE store_sessions
+		SET service_id = NULLIF($2,'')::uuid, resource_id = NULLIF($3,'')::uuid, title = $4, description = NULLIF($5,''), start_at = $6, end_at = $7, capacity = $8, price = $9, currency = COALESCE(NULLIF($10,''),'BRL'), updated_at = now()
+		WHERE id = $1
+	`
+	_, err = tx.Exec(sqlStmt,
+		id,
+		session.ServiceId,
+		session.ResourceId,
+		session.Title,
+		session.Description,
+		session.StartAt,
+		session.EndAt,
+		session.Capacity,
+		session.Price,
+		session.Currency,
+	)
+	if err != nil {
+		log.Println("An error occurred while updating store session", err)
+		if conflict := i.storeConflict(err, nil); conflict != nil {
+			return nil, conflict
+		}
+		return nil, err
+	}
+	if err := i.promoteSessionWaitlist(tx, id); err != nil {
+		return nil, err
+	}
+
+	updated, err := i.getStoreSession(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing store session update", err)
+		return nil, err
+	}
+	return updated, nil
+}
+
+// CancelStoreSession cancels a scheduled class along with every live booking
+// in it, freeing its calendar. It fails with ErrSessionClosed when the class
+// was canceled or already started.
+func (i *StoreRepo) CancelStoreSession(id string) (*StoreSession, error) {
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting store session cancel", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := i.lockStoreSession(tx, id); err != nil {
+		return nil, err
+	}
+
+	const cancelSQL = `
+		UPDATE store_sessions
+		SET status = 'canceled', updated_at = now()
+		WHERE id = $1
+	`
+	if _, err := tx.Exec(cancelSQL, id); err != nil {
+		log.Println("An error occurred while canceling store session", err)
+		return nil, err
+	}
+
+	const bookingsSQL = `
+		UPDATE store_session_bookings
+		SET status = 'canceled', updated_at = now()
+		WHERE session_id = $1 AND status IN ('booked','waitlisted')
+	`
+	if _, err := tx.Exec(bookingsSQL, id); err != nil {
+		log.Println("An error occurred while canceling store session bookings", err)
+		return nil, err
+	}
+
+	canceled, err := i.getStoreSession(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing store session cancel", err)
+		return nil, err
+	}
+	return canceled, nil
+}
+
+// CreateStoreSessionBooking takes a spot in the class for the customer, or a
+// place on its waitlist when the class is full. It fails with
+// ErrSessionClosed when the class was canceled or already started.
+func (i *StoreRepo) CreateStoreSessionBooking(booking StoreSessionBooking) (*StoreSessionBooking, error) {
+	if booking.Id == "" {
+		booking.Id = uuid.New().String()
+	}
+
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting store session booking", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The session row lock serializes bookings, so two customers can't both
+	// take the last spot.
+	booked, err := i.lockStoreSession(tx, booking.SessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	const insertSQL = `
+		INSERT INTO store_session_bookings
+			(id, session_id, user_id, status)
+		SELECT $1, $2, $3, CASE WHEN $4 < capacity THEN 'booked' ELSE 'waitlisted' END
+		FROM store_sessions
+		WHERE id = $2
+	`
+	if _, err := tx.Exec(insertSQL, booking.Id, booking.SessionId, booking.UserId, booked); err != nil {
+		log.Println("An error occurred while creating store session booking", err)
+		if conflict := i.storeConflict(err, nil); conflict != nil {
+			return nil, conflict
+		}
+		return nil, err
+	}
+
+	created, err := i.getStoreSessionBooking(tx, booking.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing store session booking", err)
+		return nil, err
+	}
+	return created, nil
+}
+
+// GetStoreSessionBookings lists the class bookings in the order they were
+// made, optionally filtered by status.
+func (i *StoreRepo) GetStoreSessionBookings(sessionId string, status string) ([]StoreSessionBooking, error) {
+	const sqlStmt = `
+		SELECT ` + sessionBookingColumns + `
+		FROM store_session_bookings
+		WHERE session_id = $1
+			AND ($2 = '' OR status = $2)
+		ORDER BY created_at ASC, id ASC;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, sessionId, status)
+	if err != nil {
+		log.Println("An error occurred while getting store session bookings", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookings := []StoreSessionBooking{}
+	for rows.Next() {
+		booking, err := i.formatSessionBooking(rows)
+		if err != nil {
+			log.Println("An error occurred while scanning store session booking", err)
+			return nil, err
+		}
+		bookings = append(bookings, *booking)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting store session bookings", err)
+		return nil, err
+	}
+
+	return bookings, nil
+}
+
+func (i *StoreRepo) getStoreSessionBooking(q queryRower, id string) (*StoreSessionBooking, error) {
+	const sqlStmt = `
+		SELECT ` + sessionBookingColumns + `
+		FROM store_session_bookings
+		WHERE id = $1;
+	`
+	booking, err := i.formatSessionBooking(q.QueryRow(sqlStmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("session booking %s not found", id)
+		}
+		log.Println("An error occurred while getting store session booking", err)
+		return nil, err
+	}
+	return booking, nil
+}
+
+// CancelStoreSessionBooking gives up the customer's spot, or place on the
+// waitlist, and hands a freed spot to the first customer waiting. It fails
+// with ErrSessionClosed once the class started, and with
+// ErrSessionBookingClosed when the booking was already canceled or marked.
+func (i *StoreRepo) CancelStoreSessionBooking(sessionId string, id string) (*StoreSessionBooking, error) {
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting store session booking cancel", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := i.lockStoreSession(tx, sessionId); err != nil {
+		return nil, err
+	}
+
+	const cancelSQL = `
+		UPDATE store_session_bookings
+		SET status = 'canceled', updated_at = now()
+		WHERE id = $1 AND session_id = $2 AND status IN ('booked','waitlisted')
+	`
+	res, err := tx.Exec(cancelSQL, id, sessionId)
+	if err != nil {
+		log.Println("An error occurred while canceling store session booking", err)
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrSessionBookingClosed
+	}
+	if err := i.promoteSessionWaitlist(tx, sessionId); err != nil {
+		return nil, err
+	}
+
+	canceled, err := i.getStoreSessionBooking(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing store session booking cancel", err)
+		return nil, err
+	}
+	return canceled, nil
+}
+
+// MarkStoreSessionAttendance records who came to the class. Marks can be
+// corrected, but only bookings that held a spot can be marked.
+func (i *StoreRepo) MarkStoreSessionAttendance(sessionId string, attendance []SessionAttendance) ([]StoreSessionBooking, error) {
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting store session attendance", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	const markSQL = `
+		UPDATE store_session_bookings
+		SET status = $3, attendance_marked_at = now(), updated_at = now()
+		WHERE id = $1 AND session_id = $2 AND status IN ('booked','attended','no_show')
+	`
+	marked := make([]StoreSessionBooking, 0, len(attendance))
+	for _, a := range attendance {
+		res, err := tx.Exec(markSQL, a.BookingId, sessionId, a.Status)
+		if err != nil {
+			log.Println("An error occurred while marking store session attendance", err)
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, err
+		} else if n == 0 {
+			return nil, fmt.Errorf("booking %s doesn't hold a spot in this class", a.BookingId)
+		}
+
+		booking, err := i.getStoreSessionBooking(tx, a.BookingId)
+		if err != nil {
+			return nil, err
+		}
+		marked = append(marked, *booking)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing store session attendance", err)
+		return nil, err
+	}
+	return marked, nil
+}
+
+// lockStoreSession locks a class that is still open for changes and returns
+// how many spots are taken. It fails with ErrSessionClosed when the class was
+// canceled or already started.
+func (i *StoreRepo) lockStoreSession(tx *sql.Tx, id string) (int, error) {
+	const sqlStmt = `
+		SELECT
+			(SELECT count(*) FROM store_session_bookings b WHERE b.session_id = store_sessions.id AND b.status IN ('booked','attended','no_show'))
+		FROM store_sessions
+		WHERE id = $1
+			AND status = 'scheduled'
+			AND start_at > now()
+		FOR UPDATE
+	`
+	var booked int
+	err := tx.QueryRow(sqlStmt, id).Scan(&booked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrSessionClosed
+	}
+	if err != nil {
+		log.Println("An error occurred while locking store session", err)
+		return 0, err
+	}
+	return booked, nil
+}
+
+// promoteSessionWaitlist books the customers waiting the longest into the
+// spots left in the class. The class must be locked by the caller.
+func (i *StoreRepo) promoteSessionWaitlist(tx *sql.Tx, sessionId string) error {
+	const sqlStmt = `
+		UPDATE store_session_bookings
+		SET status = 'booked', updated_at = now()
+		WHERE id IN (
+			SELECT id
+			FROM store_session_bookings
+			WHERE session_id = $1 AND status = 'waitlisted'
+			ORDER BY created_at ASC, id ASC
+			LIMIT GREATEST(
+				(SELECT capacity FROM store_sessions WHERE id = $1) -
+				(SELECT count(*) FROM store_session_bookings WHERE session_id = $1 AND status IN ('booked','attended','no_show')),
+				0
+			)
+		)
+	`
+	if _, err := tx.Exec(sqlStmt, sessionId); err != nil {
+		log.Println("An error occurred while promoting store session waitlist", err)
+		return err
+	}
+	return nil
+}
+
+func (i *StoreRepo) formatSession(row rowScanner) (*StoreSession, error) {
+	s := StoreSession{}
+
+	var timezone string
+	err := row.Scan(
+		&s.Id,
+		&s.StoreId,
+		&s.ServiceId,
+		&s.ResourceId,
+		&s.Title,
+		&s.Description,
+		&s.StartAt,
+		&s.EndAt,
+		&s.Capacity,
+		&s.Price,
+		&s.Currency,
+		&s.Status,
+		&s.Booked,
+		&s.Waitlisted,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+		&timezone,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if loc, err := loadTimezone(timezone); err == nil {
+		s.StartAt = localTime(s.StartAt, loc)
+		s.EndAt = localTime(s.EndAt, loc)
+	}
+	return &s, nil
+}
+
+func (i *StoreRepo) formatSessionBooking(row rowScanner) (*StoreSessionBooking, error) {
+	b := StoreSessionBooking{}
+
+	var attendanceMarkedAt sql.NullString
+	var timezone string
+	err := row.Scan(
+		&b.Id,
+		&b.SessionId,
+		&b.UserId,
+		&b.Status,
+		&b.WaitlistPosition,
+		&attendanceMarkedAt,
+		&b.CreatedAt,
+		&b.UpdatedAt,
+		&timezone,
+	)
+	if err != nil {
+		return nil, err
+	}
+	b.AttendanceMarkedAt = attendanceMarkedAt.String
+
+	if loc, err := loadTimezone(timezone); err == nil {
+		b.AttendanceMarkedAt = localTime(b.AttendanceMarkedAt, loc)
+	}
+	return &b, nil
+}
+
+func (i *StoreRepo) GetStoreAppointments(storeId string, page int, limit int) (*GetStoreAppointmentsResponse, error) {
+	res := GetStoreAppointmentsResponse{
+		Page:         page,
+		Limit:        limit,
+		Appointments: []StoreAppointment{},
+	}
+
+	// total
+	countSQL := "SELECT count(*) FROM store_appointments WHERE store_id = $1"
+	if err := i.postgresDB.QueryRow(countSQL, storeId).Scan(&res.Total); err != nil {
+		log.Println("An error occurred while counting store appointments", err)
+		return nil, err
+	}
+
+	// página
+	listSQL := `
+		SELECT ` + appointmentColumns + `
+		FROM store_appointments
+		WHERE store_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3;
+	`
+	offset := (page * limit) - limit
+
+	rows, err := i.postgresDB.Query(listSQL, storeId, limit, offset)
+	if err != nil {
+		log.Println("An error occurred while getting store appointments", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		appointment, err := i.formatAppointment(rows)
+		if err != nil {
+			log.Println("An error occurred while scanning store appointment", err)
+			return nil, err
+		}
+		res.Appointments = append(res.Appointments, *appointment)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting store appointments", err)
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+func (i *StoreRepo) GetStoreBusyAppointments(storeId string, from time.Time, to time.Time) ([]StoreAppointment, error) {
+	const sqlStmt = `
+		SELECT ` + appointmentColumns + `
+		FROM store_appointments
+		WHERE store_id = $1
+			AND status IN ('pending','confirmed')
+			AND start_at < $3
+			AND end_at + make_interval(mins => buffer_minutes) > $2
+		ORDER BY start_at ASC;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, storeId, from, to)
+	if err != nil {
+		log.Println("An error occurred while getting busy store appointments", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	appointments := []StoreAppointment{}
+	for rows.Next() {
+		appointment, err := i.formatAppointment(rows)
+		if err != nil {
+			log.Println("An error occurred while scanning store appointment", err)
+			return nil, err
+		}
+		appointments = append(appointments, *appointment)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting busy store appointments", err)
+		return nil, err
+	}
+
+	return appointments, nil
+}
+
+// GetStoreCalendarBusy lists the busy time imported into the store between
+// from and to, as appointments: the store owner's connected calendars, which
+// block the whole store, and the store calendar sources, which block their
+// resource or, without one, the whole store.
+func (i *StoreRepo) GetStoreCalendarBusy(storeId string, from time.Time, to time.Time) ([]StoreAppointment, error) {
+	const sqlStmt = `
+		SELECT b.id, '', b.start_at, b.end_at
+		FROM calendar_busy_blocks b
+		JOIN calendar_connections c ON c.id = b.connection_id
+		JOIN stores s ON s.owner_id = b.user_id
+		WHERE s.id = $1
+			AND c.active
+			AND b.start_at < $3
+			AND b.end_at > $2
+		UNION ALL
+		SELECT b.id, COALESCE(b.resource_id::text, ''), b.start_at, b.end_at
+		FROM store_calendar_source_blocks b
+		WHERE b.store_id = $1
+			AND b.start_at < $3
+			AND b.end_at > $2
+		ORDER BY 3 ASC;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, storeId, from, to)
+	if err != nil {
+		log.Println("An error occurred while getting store calendar busy time", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocks := []StoreAppointment{}
+	for rows.Next() {
+		var id, resourceId string
+		var start, end time.Time
+		if err := rows.Scan(&id, &resourceId, &start, &end); err != nil {
+			log.Println("An error occurred while scanning store calendar busy time", err)
+			return nil, err
+		}
+		blocks = append(blocks, StoreAppointment{
+			Id:         id,
+			StoreId:    storeId,
+			ResourceId: resourceId,
+			StartAt:    start.UTC().Format(time.RFC3339),
+			EndAt:      end.UTC().Format(time.RFC3339),
+			Status:     AppointmentStatusConfirmed,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting store calendar busy time", err)
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+// calendarSourceColumns is the select list read by formatCalendarSource, the
+// content is left out.
+const calendarSourceColumns = `
+			id,
+			store_id,
+			COALESCE(resource_id::text, ''),
+			name,
+			COALESCE(url, ''),
+			(SELECT count(*) FROM store_calendar_source_blocks b WHERE b.source_id = store_calendar_sources.id),
+			last_fetched_at,
+			COALESCE(last_error, ''),
+			created_at,
+			updated_at,
+			(SELECT timezone FROM stores WHERE stores.id = store_calendar_sources.store_id)`
+
+func (i *StoreRepo) CreateStoreCalendarSource(source StoreCalendarSource) (*StoreCalendarSource, error) {
+	const sqlStmt = `
+		INSERT INTO store_calendar_sources
+			(store_id, resource_id, name, url, content)
+		VALUES
+			($1, NULLIF($2,'')::uuid, $3, NULLIF($4,''), NULLIF($5,''))
+		RETURNING ` + calendarSourceColumns + `;
+	`
+	res, err := i.formatCalendarSource(i.postgresDB.QueryRow(sqlStmt,
+		source.StoreId,
+		source.ResourceId,
+		source.Name,
+		source.Url,
+		source.Content,
+	))
+	if err != nil {
+		log.Println("An error occurred while creating store calendar source", err)
+		return nil, err
+	}
+	return res, nil
+}
+
+func (i *StoreRepo) GetStoreCalendarSources(storeId string) ([]StoreCalendarSource, error) {
+	const sqlStmt = `
+		SELECT ` + calendarSourceColumns + `
+		FROM store_calendar_sources
+		WHERE store_id = $1
+		ORDER BY created_at ASC;
+	`
+	return i.queryCalendarSources(sqlStmt, storeId)
+}
+
+// GetStaleStoreCalendarSources lists the calendar sources of every store
+// last refreshed before olderThan, or never.
+func (i *StoreRepo) GetStaleStoreCalendarSources(olderThan time.Time) ([]StoreCalendarSource, error) {
+	const sqlStmt = `
+		SELECT ` + calendarSourceColumns + `
+		FROM store_calendar_sources
+		WHERE last_fetched_at IS NULL OR last_fetched_at < $1
+		ORDER BY last_fetched_at ASC NULLS FIRST;
+	`
+	return i.queryCalendarSources(sqlStmt, olderThan)
+}
+
+func (i *StoreRepo) queryCalendarSources(sqlStmt string, args ...any) ([]StoreCalendarSource, error) {
+	rows, err := i.postgresDB.Query(sqlStmt, args...)
+	if err != nil {
+		log.Println("An error occurred while getting store calendar sources", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	sources := []StoreCalendarSource{}
+	for rows.Next() {
+		source, err := i.formatCalendarSource(rows)
+		if err != nil {
+			log.Println("An error occurred while scanning store calendar source", err)
+			return nil, err
+		}
+		sources = append(sources, *source)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting store calendar sources", err)
+		return nil, err
+	}
+
+	return sources, nil
+}
+
+func (i *StoreRepo) GetStoreCalendarSource(id string) (*StoreCalendarSource, error) {
+	const sqlStmt = `
+		SELECT ` + calendarSourceColumns + `
+		FROM store_calendar_sources
+		WHERE id = $1;
+	`
+	source, err := i.formatCalendarSource(i.postgresDB.QueryRow(sqlStmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("calendar source %s not found", id)
+		}
+		log.Println("An error occurred while getting store calendar source", err)
+		return nil, err
+	}
+	return source, nil
+}
+
+// GetStoreCalendarSourceContent reads the file uploaded to a calendar
+// source, empty for the ones fetched from a URL.
+func (i *StoreRepo) GetStoreCalendarSourceContent(id string) (string, error) {
+	const sqlStmt = `SELECT COALESCE(content, '') FROM store_calendar_sources WHERE id = $1`
+
+	var content string
+	if err := i.postgresDB.QueryRow(sqlStmt, id).Scan(&content); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("calendar source %s not found", id)
+		}
+		log.Println("An error occurred while getting store calendar source content", err)
+		return "", err
+	}
+	return content, nil
+}
+
+func (i *StoreRepo) UpdateStoreCalendarSourceContent(id string, content string) error {
+	const sqlStmt = `
+		UPDATE store_calendar_sources
+		SET content = $2, updated_at = now()
+		WHERE id = $1 AND url IS NULL
+	`
+	res, err := i.postgresDB.Exec(sqlStmt, id, content)
+	if err != nil {
+		log.Println("An error occurred while updating store calendar source content", err)
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("calendar source %s not found", id)
+	}
+	return nil
+}
+
+// ReplaceStoreCalendarSourceBlocks swaps the busy time of a calendar source
+// for what its last refresh read, noting what the refresh had to say.
+func (i *StoreRepo) ReplaceStoreCalendarSourceBlocks(id string, blocks []calendarBusyBlock, note string) (*StoreCalendarSource, error) {
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting calendar source refresh", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	const deleteSQL = `DELETE FROM store_calendar_source_blocks WHERE source_id = $1`
+	if _, err := tx.Exec(deleteSQL, id); err != nil {
+		log.Println("An error occurred while clearing calendar source blocks", err)
+		return nil, err
+	}
+
+	const insertSQL = `
+		INSERT INTO store_calendar_source_blocks
+			(source_id, store_id, resource_id, uid, start_at, end_at)
+		SELECT id, store_id, resource_id, $2, $3, $4
+		FROM store_calendar_sources
+		WHERE id = $1
+	`
+	stmt, err := tx.Prepare(insertSQL)
+	if err != nil {
+		log.Println("An error occurred while preparing calendar source blocks", err)
+		return nil, err
+	}
+	defer stmt.Close()
+	for _, block := range blocks {
+		if _, err := stmt.Exec(id, block.UID, block.Start, block.End); err != nil {
+			log.Println("An error occurred while saving calendar source block", err)
+			return nil, err
+		}
+	}
+
+	const sourceSQL = `
+		UPDATE store_calendar_sources
+		SET last_fetched_at = now(), last_error = NULLIF($2,''), updated_at = now()
+		WHERE id = $1
+		RETURNING ` + calendarSourceColumns + `;
+	`
+	source, err := i.formatCalendarSource(tx.QueryRow(sourceSQL, id, note))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("calendar source %s not found", id)
+		}
+		log.Println("An error occurred while updating store calendar source", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing calendar source refresh", err)
+		return nil, err
+	}
+	return source, nil
+}
+
+// MarkStoreCalendarSourceFailed records a refresh that couldn't read the
+// source. The busy time of the previous refresh is kept.
+func (i *StoreRepo) MarkStoreCalendarSourceFailed(id string, reason string) error {
+	const sqlStmt = `
+		UPDATE store_calendar_sources
+		SET last_fetched_at = now(), last_error = $2, updated_at = now()
+		WHERE id = $1
+	`
+	if _, err := i.postgresDB.Exec(sqlStmt, id, reason); err != nil {
+		log.Println("An error occurred while marking store calendar source failed", err)
+		return err
+	}
+	return nil
+}
+
+func (i *StoreRepo) DeleteStoreCalendarSource(id string) error {
+	const sqlStmt = `DELETE FROM store_calendar_sources WHERE id = $1`
+
+	res, err := i.postgresDB.Exec(sqlStmt, id)
+	if err != nil {
+		log.Println("An error occurred while deleting store calendar source", err)
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("calendar source %s not found", id)
+	}
+	return nil
+}
+
+func (i *StoreRepo) formatCalendarSource(row rowScanner) (*StoreCalendarSource, error) {
+	c := StoreCalendarSource{}
+
+	var lastFetchedAt sql.NullString
+	var timezone string
+	err := row.Scan(
+		&c.Id,
+		&c.StoreId,
+		&c.ResourceId,
+		&c.Name,
+		&c.Url,
+		&c.Blocks,
+		&lastFetchedAt,
+		&c.LastError,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&timezone,
+	)
+	if err != nil {
+		return nil, err
+	}
+	c.LastFetchedAt = lastFetchedAt.String
+
+	if loc, err := loadTimezone(timezone); err == nil {
+		c.LastFetchedAt = localTime(c.LastFetchedAt, loc)
+	}
+	return &c, nil
+}
+
+func (i *StoreRepo) UpdateStoreAppointment(id string, appointment StoreAppointment) (*StoreAppointment, error) {
+	appointment.Id = id
+
+	const sqlStmt = `
+		UPDATE store_appointments
+		SET service_id = NULLIF($1,'')::uuid, resource_id = NULLIF($2,'')::uuid, start_at = $3, end_at = $4, buffer_minutes = $5, price = $6, currency = $7, fee_platform = $8, payment_id = NULLIF($9,'')::uuid, notes = $10, updated_at = now()
+		WHERE id = $11
+	`
+	_, err := i.postgresDB.Exec(sqlStmt,
+		appointment.ServiceId,
+		appointment.ResourceId,
+		appointment.StartAt,
+		appointment.EndAt,
+		appointment.BufferMinutes,
+		appointment.Price,
+		appointment.Currency,
+		appointment.FeePlatform,
+		appointment.PaymentId,
+		appointment.Notes,
+		id,
+	)
+	if err != nil {
+		log.Println("An error occurred while updating store appointment", err)
+		if conflict := i.storeConflict(err, &appointment); conflict != nil {
+			return nil, conflict
+		}
+		return nil, err
+	}
+	return &appointment, nil
+}
+
+func (i *StoreRepo) DeleteStoreAppointment(id string) error {
+	const sqlStmt = `DELETE FROM store_appointments WHERE id = $1`
+	if _, err := i.postgresDB.Exec(sqlStmt, id); err != nil {
+		log.Println("An error occurred while deleting store appointment", err)
+		return err
+	}
+	return nil
+}
+
+const storeServiceColumns = `
+			id,
+			store_id,
+			name,
+			COALESCE(description, ''),
+			duration_minutes,
+			buffer_minutes,
+			price,
+			currency,
+			active,
+			created_at,
+			updated_at`
+
+func (i *StoreRepo) CreateStoreService(service StoreService) (*StoreService, error) {
+	if service.Id == "" {
+		service.Id = uuid.New().String()
+	}
+	if service.Active == nil {
+		active := true
+		service.Active = &active
+	}
+
+	const insertSQL = `
+		INSERT INTO store_services
+			(id, store_id, name, description, duration_minutes, buffer_minutes, price, currency, active)
+		VALUES
+			($1,$2,$3,$4,$5,$6,$7,$8,$9)
+	`
+	_, err := i.postgresDB.Exec(insertSQL,
+		service.Id,
+		service.StoreId,
+		service.Name,
+		service.Description,
+		service.DurationMinutes,
+		service.BufferMinutes,
+		service.Price,
+		service.Currency,
+		*service.Active,
+	)
+	if err != nil {
+		log.Println("An error occurred while creating store service", err)
+		return nil, err
+	}
+	return &service, nil
+}
+
+func (i *StoreRepo) GetStoreServices(storeId string, activeOnly bool) ([]StoreService, error) {
+	sqlStmt := `
+		SELECT` + storeServiceColumns + `
+		FROM store_services
+		WHERE store_id = $1
+			AND (active OR NOT $2)
+		ORDER BY name ASC;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, storeId, activeOnly)
+	if err != nil {
+		log.Println("An error occurred while getting store services", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	services := []StoreService{}
+	for rows.Next() {
+		service, err := i.formatService(rows)
+		if err != nil {
+			log.Println("An error occurred while scanning store service", err)
+			return nil, err
+		}
+		services = append(services, *service)
+	}
+	return services, rows.Err()
+}
+
+// GetStorePlatformFeePct returns the platform fee rate of the store, the
+// store override or the default when it has none.
+func (i *StoreRepo) GetStorePlatformFeePct(storeId string) (money.Decimal, error) {
+	const sqlStmt = `SELECT platform_fee_pct($1, NULL);`
+	var percent money.Decimal
+	if err := i.postgresDB.QueryRow(sqlStmt, storeId).Scan(&percent); err != nil {
+		log.Println("An error occurred while getting store platform fee", err)
+		return money.Decimal{}, err
+	}
+	return percent, nil
+}
+
+// GetStoreBookingPolicy returns the store booking policy, or an empty one
+// when the store never set it.
+func (i *StoreRepo) GetStoreBookingPolicy(storeId string) (*StoreBookingPolicy, error) {
+	const sqlStmt = `
+		SELECT
+			store_id,
+			min_lead_minutes,
+			max_horizon_days,
+			buffer_minutes,
+			max_daily_appointments,
+			created_at,
+			updated_at
+		FROM store_booking_policies
+		WHERE store_id = $1;
+	`
+	var policy StoreBookingPolicy
+	err := i.postgresDB.QueryRow(sqlStmt, storeId).Scan(
+		&policy.StoreId,
+		&policy.MinLeadMinutes,
+		&policy.MaxHorizonDays,
+		&policy.BufferMinutes,
+		&policy.MaxDailyAppointments,
+		&policy.CreatedAt,
+		&policy.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &StoreBookingPolicy{StoreId: storeId}, nil
+		}
+		log.Println("An error occurred while getting store booking policy", err)
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (i *StoreRepo) UpdateStoreBookingPolicy(storeId string, policy StoreBookingPolicy) (*StoreBookingPolicy, error) {
+	policy.StoreId = storeId
+
+	const sqlStmt = `
+		INSERT INTO store_booking_policies
+			(store_id, min_lead_minutes, max_horizon_days, buffer_minutes, max_daily_appointments)
+		VALUES
+			($1,$2,$3,$4,$5)
+		ON CONFLICT (store_id) DO UPDATE
+		SET min_lead_minutes = EXCLUDED.min_lead_minutes,
+			max_horizon_days = EXCLUDED.max_horizon_days,
+			buffer_minutes = EXCLUDED.buffer_minutes,
+			max_daily_appointments = EXCLUDED.max_daily_appointments,
+			updated_at = now()
+		RETURNING created_at, updated_at
+	`
+	err := i.postgresDB.QueryRow(sqlStmt,
+		policy.StoreId,
+		policy.MinLeadMinutes,
+		policy.MaxHorizonDays,
+		policy.BufferMinutes,
+		policy.MaxDailyAppointments,
+	).Scan(&policy.CreatedAt, &policy.UpdatedAt)
+	if err != nil {
+		log.Println("An error occurred while updating store booking policy", err)
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (i *StoreRepo) GetStoreService(id string) (*StoreService, error) {
+	sqlStmt := `
+		SELECT` + storeServiceColumns + `
+		FROM store_services
+		WHERE id = $1;
+	`
+	service, err := i.formatService(i.postgresDB.QueryRow(sqlStmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("service %s not found", id)
+		}
+		log.Println("An error occurred while getting store service", err)
+		return nil, err
+	}
+	return service, nil
+}
+
+func (i *StoreRepo) UpdateStoreService(id string, service StoreService) (*StoreService, error) {
+	service.Id = id
+	if service.Active == nil {
+		active := true
+		service.Active = &active
+	}
+
+	const sqlStmt = `
+		UPDATE store_services
+		SET name = $1, description = $2, duration_minutes = $3, buffer_minutes = $4, price = $5, currency = $6, active = $7, updated_at = now()
+		WHERE id = $8
+	`
+	_, err := i.postgresDB.Exec(sqlStmt,
+		service.Name,
+		service.Description,
+		service.DurationMinutes,
+		service.BufferMinutes,
+		service.Price,
+		service.Currency,
+		*service.Active,
+		id,
+	)
+	if err != nil {
+		log.Println("An error occurred while updating store service", err)
+		return nil, err
+	}
+	return &service, nil
+}
+
+func (i *StoreRepo) DeleteStoreService(id string) error {
+	const sqlStmt = `DELETE FROM store_services WHERE id = $1`
+	if _, err := i.postgresDB.Exec(sqlStmt, id); err != nil {
+		log.Println("An error occurred while deleting store service", err)
+		return err
+	}
+	return nil
+}
+
+const storeResourceColumns = `
+			id,
+			store_id,
+			name,
+			kind,
+			COALESCE(availability::text, ''),
+			active,
+			created_at,
+			updated_at`
+
+func (i *StoreRepo) CreateStoreResource(resource StoreResource) (*StoreResource, error) {
+	if resource.Id == "" {
+		resource.Id = uuid.New().String()
+	}
+	if resource.Kind == "" {
+		resource.Kind = "staff"
+	}
+	if resource.Active == nil {
+		active := true
+		resource.Active = &active
+	}
+
+	const insertSQL = `
+		INSERT INTO store_resources
+			(id, store_id, name, kind, availability, active)
+		VALUES
+			($1,$2,$3,$4,NULLIF($5,'')::json,$6)
+	`
+	_, err := i.postgresDB.Exec(insertSQL,
+		resource.Id,
+		resource.StoreId,
+		resource.Name,
+		resource.Kind,
+		resource.Availability,
+		*resource.Active,
+	)
+	if err != nil {
+		log.Println("An error occurred while creating store resource", err)
+		return nil, err
+	}
+	return &resource, nil
+}
+
+func (i *StoreRepo) GetStoreResources(storeId string, activeOnly bool) ([]StoreResource, error) {
+	sqlStmt := `
+		SELECT` + storeResourceColumns + `
+		FROM store_resources
+		WHERE store_id = $1
+			AND (active OR NOT $2)
+		ORDER BY name ASC, id ASC;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, storeId, activeOnly)
+	if err != nil {
+		log.Println("An error occurred while getting store resources", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	resources := []StoreResource{}
+	for rows.Next() {
+		resource, err := i.formatResource(rows)
+		if err != nil {
+			log.Println("An error occurred while scanning store resource", err)
+			return nil, err
+		}
+		resources = append(resources, *resource)
+	}
+	return resources, rows.Err()
+}
+
+func (i *StoreRepo) GetStoreResource(id string) (*StoreResource, error) {
+	sqlStmt := `
+		SELECT` + storeResourceColumns + `
+		FROM store_resources
+		WHERE id = $1;
+	`
+	resource, err := i.formatResource(i.postgresDB.QueryRow(sqlStmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("resource %s not found", id)
+		}
+		log.Println("An error occurred while getting store resource", err)
+		return nil, err
+	}
+	return resource, nil
+}
+
+func (i *StoreRepo) UpdateStoreResource(id string, resource StoreResource) (*StoreResource, error) {
+	resource.Id = id
+	if resource.Kind == "" {
+		resource.Kind = "staff"
+	}
+	if resource.Active == nil {
+		active := true
+		resource.Active = &active
+	}
+
+	const sqlStmt = `
+		UPDATE store_resources
+		SET name = $1, kind = $2, availability = NULLIF($3,'')::json, active = $4, updated_at = now()
+		WHERE id = $5
+	`
+	_, err := i.postgresDB.Exec(sqlStmt,
+		resource.Name,
+		resource.Kind,
+		resource.Availability,
+		*resource.Active,
+		id,
+	)
+	if err != nil {
+		log.Println("An error occurred while updating store resource", err)
+		return nil, err
+	}
+	return &resource, nil
+}
+
+func (i *StoreRepo) DeleteStoreResource(id string) error {
+	const sqlStmt = `DELETE FROM store_resources WHERE id = $1`
+	if _, err := i.postgresDB.Exec(sqlStmt, id); err != nil {
+		log.Println("An error occurred while deleting store resource", err)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return &postgres.ConflictError{Constraint: pqErr.Constraint, Message: "the resource still has appointments, deactivate it instead"}
+		}
+		return err
+	}
+	return nil
+}
+
+// CreateStoreAppointmentSeries inserts the series and all of its occurrences
+// in one transaction. When occurrences overlap existing appointments nothing
+// is written and a *postgres.ConflictError listing every one of them is returned.
+func (i *StoreRepo) CreateStoreAppointmentSeries(series StoreAppointmentSeries, occurrences []StoreAppointment) (*StoreAppointmentSeries, error) {
+	if series.Id == "" {
+		series.Id = uuid.New().String()
+	}
+
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting store appointment series", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	const insertSQL = `
+		INSERT INTO store_appointment_series
+			(id, store_id, user_id, rrule, start_at, end_at, notes)
+		VALUES
+			($1,$2,$3,$4,$5,$6,$7)
+	`
+	_, err = tx.Exec(insertSQL,
+		series.Id,
+		series.StoreId,
+		series.UserId,
+		series.RRule,
+		series.StartAt,
+		series.EndAt,
+		series.Notes,
+	)
+	if err != nil {
+		log.Println("An error occurred while creating store appointment series", err)
+		return nil, err
+	}
+
+	series.Appointments = []StoreAppointment{}
+	var conflicts []SeriesOccurrenceConflict
+	for _, occurrence := range occurrences {
+		occurrence.Id = uuid.New().String()
+		occurrence.SeriesId = series.Id
+
+		conflict, err := i.execOccurrence(tx, insertAppointmentSQL, appointmentArgs(occurrence), occurrence)
+		if err != nil {
+			log.Println("An error occurred while creating store appointment series occurrence", err)
+			return nil, err
+		}
+		if conflict != nil {
+			conflicts = append(conflicts, *conflict)
+			continue
+		}
+		series.Appointments = append(series.Appointments, occurrence)
+	}
+
+	if len(conflicts) > 0 {
+		return nil, seriesConflict(conflicts)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing store appointment series", err)
+		return nil, err
+	}
+	return &series, nil
+}
+
+func (i *StoreRepo) GetStoreAppointmentSeries(id string) (*StoreAppointmentSeries, error) {
+	const seriesSQL = `
+		SELECT
+			id,
+			store_id,
+			user_id,
+			rrule,
+			start_at,
+			end_at,
+			COALESCE(notes, ''),
+			created_at,
+			updated_at,
+			(SELECT timezone FROM stores WHERE stores.id = store_appointment_series.store_id)
+		FROM store_appointment_series
+		WHERE id = $1;
+	`
+	var series StoreAppointmentSeries
+	var timezone string
+	err := i.postgresDB.QueryRow(seriesSQL, id).Scan(
+		&series.Id,
+		&series.StoreId,
+		&series.UserId,
+		&series.RRule,
+		&series.StartAt,
+		&series.EndAt,
+		&series.Notes,
+		&series.CreatedAt,
+		&series.UpdatedAt,
+		&timezone,
+	)
+	if err != nil {
+		log.Println("An error occurred while getting store appointment series", err)
+		return nil, err
+	}
+	if loc, err := loadTimezone(timezone); err == nil {
+		series.StartAt = localTime(series.StartAt, loc)
+		series.EndAt = localTime(series.EndAt, loc)
+	}
+
+	const appointmentsSQL = `
+		SELECT ` + appointmentColumns + `
+		FROM store_appointments
+		WHERE series_id = $1
+		ORDER BY start_at ASC;
+	`
+	rows, err := i.postgresDB.Query(appointmentsSQL, id)
+	if err != nil {
+		log.Println("An error occurred while getting store appointment series occurrences", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	series.Appointments = []StoreAppointment{}
+	for rows.Next() {
+		appointment, err := i.formatAppointment(rows)
+		if err != nil {
+			return nil, err
+		}
+		series.Appointments = append(series.Appointments, *appointment)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting store appointment series occurrences", err)
+		return nil, err
+	}
+
+	return &series, nil
+}
+
+// UpdateStoreAppointmentSeriesOccurrences writes the new times and notes of
+// the given occurrences in one transaction, with the same all-or-nothing
+// conflict reporting as CreateStoreAppointmentSeries. Occurrences must be
+// ordered so that no occurrence moves onto one that wasn't moved yet.
+func (i *StoreRepo) UpdateStoreAppointmentSeriesOccurrences(seriesId string, occurrences []StoreAppointment) error {
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting store appointment series update", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	const updateSQL = `
+		UPDATE store_appointments
+		SET start_at = $1, end_at = $2, notes = $3, buffer_minutes = $6, updated_at = now()
+		WHERE id = $4 AND series_id = $5
+	`
+	var conflicts []SeriesOccurrenceConflict
+	for _, occurrence := range occurrences {
+		args := []any{occurrence.StartAt, occurrence.EndAt, occurrence.Notes, occurrence.Id, seriesId, occurrence.BufferMinutes}
+		conflict, err := i.execOccurrence(tx, updateSQL, args, occurrence)
+		if err != nil {
+			log.Println("An error occurred while updating store appointment series occurrence", err)
+			return err
+		}
+		if conflict != nil {
+			conflicts = append(conflicts, *conflict)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return seriesConflict(conflicts)
+	}
+
+	const touchSQL = `UPDATE store_appointment_series SET updated_at = now() WHERE id = $1`
+	if _, err := tx.Exec(touchSQL, seriesId); err != nil {
+		log.Println("An error occurred while updating store appointment series", err)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing store appointment series update", err)
+		return err
+	}
+	return nil
+}
+
+// CancelStoreAppointments cancels every given appointment that is still
+// pending or confirmed and records the change in the status history.
+func (i *StoreRepo) CancelStoreAppointments(ids []string, changedBy string, reason string) (int64, error) {
+	const sqlStmt = `
+		WITH target AS (
+			SELECT id, status
+			FROM store_appointments
+			WHERE id = ANY($1::uuid[])
+				AND status IN ('pending','confirmed')
+			FOR UPDATE
+		), canceled AS (
+			UPDATE store_appointments a
+			SET status = 'canceled', hold_expires_at = NULL, updated_at = now()
+			FROM target
+			WHERE a.id = target.id
+			RETURNING a.id, target.status AS from_status
+		)
+		INSERT INTO store_appointment_status_history
+			(appointment_id, from_status, to_status, changed_by, reason)
+		SELECT id, from_status, 'canceled', NULLIF($2,''), NULLIF($3,'')
+		FROM canceled
+	`
+	res, err := i.postgresDB.Exec(sqlStmt, pq.Array(ids), changedBy, reason)
+	if err != nil {
+		log.Println("An error occurred while canceling store appointments", err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// execOccurrence runs one series occurrence write inside a savepoint, so an
+// overlap is reported for that occurrence without aborting the transaction.
+func (i *StoreRepo) execOccurrence(tx *sql.Tx, query string, args []any, occurrence StoreAppointment) (*SeriesOccurrenceConflict, error) {
+	if _, err := tx.Exec("SAVEPOINT occurrence"); err != nil {
+		return nil, err
+	}
+
+	_, err := tx.Exec(query, args...)
+	if err == nil {
+		_, err = tx.Exec("RELEASE SAVEPOINT occurrence")
+		return nil, err
+	}
+
+	if _, rollbackErr := tx.Exec("ROLLBACK TO SAVEPOINT occurrence"); rollbackErr != nil {
+		return nil, rollbackErr
+	}
+	if constraint, ok := postgres.ViolatedConstraint(err); !ok || constraint != overlapConstraint {
+		return nil, err
+	}
+
+	return &SeriesOccurrenceConflict{
+		StartAt:  occurrence.StartAt,
+		EndAt:    occurrence.EndAt,
+		Conflict: i.findOverlappingAppointment(tx, occurrence),
+	}, nil
+}
+
+func seriesConflict(conflicts []SeriesOccurrenceConflict) error {
+	return &postgres.ConflictError{
+		Constraint: overlapConstraint,
+		Message:    fmt.Sprintf("%d occurrences overlap existing appointments", len(conflicts)),
+		Conflict:   conflicts,
+	}
+}
+
+// storeConflict turns constraint violations on the store tables into a
+// *postgres.ConflictError, it returns nil for any other error. The appointment
+// being written, when given, is used to look up the booking it overlaps.
+func (i *StoreRepo) storeConflict(err error, appointment *StoreAppointment) error {
+	constraint, ok := postgres.ViolatedConstraint(err)
+	if !ok {
+		return nil
+	}
+
+	switch constraint {
+	case overlapConstraint:
+		conflict := &postgres.ConflictError{
+			Constraint: constraint,
+			Message:    "the requested time overlaps an existing appointment",
+		}
+		if appointment != nil {
+			if overlapping := i.findOverlappingAppointment(i.postgresDB, *appointment); overlapping != nil {
+				conflict.Conflict = overlapping
+			}
+		}
+		return conflict
+	case appointmentSessionConstraint:
+		return &postgres.ConflictError{
+			Constraint: constraint,
+			Message:    "the requested time overlaps a class",
+		}
+	case sessionOverlapConstraint:
+		return &postgres.ConflictError{
+			Constraint: constraint,
+			Message:    "the class overlaps another class",
+		}
+	case sessionAppointmentConstraint:
+		return &postgres.ConflictError{
+			Constraint: constraint,
+			Message:    "the class overlaps an existing appointment",
+		}
+	case "uniq_session_booking":
+		return &postgres.ConflictError{
+			Constraint: constraint,
+			Message:    "the customer already booked this class",
+		}
+	case "uniq_daily_review":
+		return &postgres.ConflictError{
+			Constraint: constraint,
+			Message:    "the user already rated this store today",
+		}
+	}
+
+	return &postgres.ConflictError{Constraint: constraint, Message: err.Error()}
+}
+
+func (i *StoreRepo) findOverlappingAppointment(q queryRower, appointment StoreAppointment) *AppointmentConflict {
+	const sqlStmt = `
+		SELECT id, start_at, end_at, (SELECT timezone FROM stores WHERE stores.id = $1)
+		FROM store_appointments
+		WHERE store_id = $1
+			AND id <> $2
+			AND resource_id IS NOT DISTINCT FROM NULLIF($6,'')::uuid
+			AND status IN ('pending','confirmed')
+			AND start_at < $4::timestamptz + make_interval(mins => $5)
+			AND end_at + make_interval(mins => buffer_minutes) > $3
+		ORDER BY start_at ASC
+		LIMIT 1;
+	`
+	var conflict AppointmentConflict
+	var timezone string
+	err := q.QueryRow(sqlStmt,
+		appointment.StoreId,
+		appointment.Id,
+		appointment.StartAt,
+		appointment.EndAt,
+		appointment.BufferMinutes,
+		appointment.ResourceId,
+	).Scan(&conflict.AppointmentId, &conflict.StartAt, &conflict.EndAt, &timezone)
+	if err != nil {
+		log.Println("An error occurred while looking up the overlapping appointment", err)
+		return nil
+	}
+	if loc, err := loadTimezone(timezone); err == nil {
+		conflict.StartAt = localTime(conflict.StartAt, loc)
+		conflict.EndAt = localTime(conflict.EndAt, loc)
+	}
+	return &conflict
+}
+
+func (i *StoreRepo) getStoreStatements(storeId string) (string, error) {
+	const sqlStmt = `
+		SELECT
+			stores.id,
+			stores.name,
+			stores.owner_id,
+			stores.type,
+			stores.location,
+			stores.timezone,
+			stores.holiday_calendar,
+			COALESCE(stores.holiday_state, ''),
+			COALESCE(stores.holiday_city, ''),
+			store_availability.availability,
+			store_ratings.user_id,
+			store_ratings.rating,
+			store_ratings.message,
+			store_ratings.created_at
+			store_plans.id as plan_id,
+			store_plans.name as plan_name,
+			store_plans.price as plan_price,
+			store_plans.currency as plan_currency,
+			store_plans.plan_type,
+			store_plans.frequency
+		FROM stores
+		LEFT JOIN store_availability ON stores.id = store_availability.store_id
+		LEFT JOIN store_ratings ON stores.id = store_ratings.store_id
+		LEFT JOIN store_plans ON stores.id = store_plans.store_id
+		WHERE stores.id = '` + storeId + `';
+	`
+	return sqlStmt, nil
+}
+
+func (i *StoreRepo) formatAppointment(row rowScanner) (*StoreAppointment, error) {
+	a := StoreAppointment{}
+
+	var holdExpiresAt sql.NullString
+	var timezone string
+	err := row.Scan(
+		&a.Id,
+		&a.StoreId,
+		&a.UserId,
+		&a.ServiceId,
+		&a.ResourceId,
+		&a.StartAt,
+		&a.EndAt,
+		&a.BufferMinutes,
+		&a.Status,
+		&holdExpiresAt,
+		&a.Price,
+		&a.Currency,
+		&a.FeePlatform,
+		&a.PenaltyFee,
+		&a.PaymentId,
+		&a.SeriesId,
+		&a.Notes,
+		&a.CreatedAt,
+		&a.UpdatedAt,
+		&timezone,
+	)
+	if err != nil {
+		log.Println("An error occurred while scanning store appointment", err)
+		return nil, err
+	}
+	a.HoldExpiresAt = holdExpiresAt.String
+	localizeAppointment(&a, timezone)
+
+	return &a, nil
+}
+
+func (i *StoreRepo) formatService(row rowScanner) (*StoreService, error) {
+	s := StoreService{}
+
+	var active bool
+	err := row.Scan(
+		&s.Id,
+		&s.StoreId,
+		&s.Name,
+		&s.Description,
+		&s.DurationMinutes,
+		&s.BufferMinutes,
+		&s.Price,
+		&s.Currency,
+		&active,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	s.Active = &active
+
+	return &s, nil
+}
+
+func (i *StoreRepo) formatResource(row rowScanner) (*StoreResource, error) {
+	r := StoreResource{}
+
+	var active bool
+	err := row.Scan(
+		&r.Id,
+		&r.StoreId,
+		&r.Name,
+		&r.Kind,
+		&r.Availability,
+		&active,
+		&r.CreatedAt,
+		&r.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	r.Active = &active
+
+	return &r, nil
+}
+
+func (i *StoreRepo) formatAvailabilityException(row rowScanner) (*StoreAvailabilityException, error) {
+	e := StoreAvailabilityException{}
+
+	err := row.Scan(
+		&e.Id,
+		&e.StoreId,
+		&e.ResourceId,
+		&e.Kind,
+		&e.StartDate,
+		&e.EndDate,
+		&e.OpenTime,
+		&e.CloseTime,
+		&e.Reason,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (i *StoreRepo) formatStore(row *sql.Rows) (*Store, error) {
+	s := Store{}
+
+	var location []byte
+	err := row.Scan(
+		&s.Id,
+		&s.Name,
+		&s.OwnerId,
+		&s.Type,
+		&location,
+		&s.Timezone,
+		&s.HolidayCalendar,
+		&s.HolidayState,
+		&s.HolidayCity,
+	)
+
+	if err != nil {
+		log.Println("An error occurred while scanning store", err)
+		return nil, err
+	}
+
+	if location != nil {
+		if err := json.Unmarshal(location, &s.Location); err != nil {
+			log.Println("An error occurred while getting stores", err)
+			return nil, err
+		}
+	}
+
+	return &s, nil
+}
+
+func (i *StoreRepo) formatFullStore(row *sql.Rows) (*FullStore, error) {
+	s := FullStore{
+		Ratings: []StoreRating{},
+		Plans:   []StorePlan{},
+	}
+
+	var location []byte
+	err := row.Scan(
+		&s.Store.Id,
+		&s.Store.Name,
+		&s.Store.OwnerId,
+		&s.Store.Type,
+		&location,
+		&s.Store.Timezone,
+		&s.Store.HolidayCalendar,
+		&s.Store.HolidayState,
+		&s.Store.HolidayCity,
+		&s.Availability.Availability,
+		// Additional fields for Ratings and Plans would go here
+	)
+
+	if err != nil {
+		log.Println("An error occurred while scanning full store", err)
+		return nil, err
+	}
+
+	if location != nil {
+		if err := json.Unmarshal(location, &s.Store.Location); err != nil {
+			log.Println("An error occurred while unmarshalling store location", err)
+			return nil, err
+		}
+	}
+
+	return &s, nil
+}
+
+// CreateCalendarFeed stores the hash of a new feed token for the store, or
+// the customer, revoking the feed they had before.
+func (i *StoreRepo) CreateCalendarFeed(storeId string, userId string, tokenHash string) error {
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting calendar feed creation", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := revokeCalendarFeed(tx, storeId, userId); err != nil {
+		return err
+	}
+
+	const sqlStmt = `
+		INSERT INTO calendar_feeds
+			(store_id, user_id, token_hash)
+		VALUES
+			(NULLIF($1,'')::uuid,NULLIF($2,'')::uuid,$3)
+	`
+	if _, err := tx.Exec(sqlStmt, storeId, userId, tokenHash); err != nil {
+		log.Println("An error occurred while creating calendar feed", err)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing calendar feed creation", err)
+		return err
+	}
+	return nil
+}
+
+func (i *StoreRepo) RevokeCalendarFeed(storeId string, userId string) error {
+	tx, err := i.postgresDB.Begin()
+	if err != nil {
+		log.Println("An error occurred while starting calendar feed revocation", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := revokeCalendarFeed(tx, storeId, userId); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("An error occurred while committing calendar feed revocation", err)
+		return err
+	}
+	return nil
+}
+
+func revokeCalendarFeed(tx *sql.Tx, storeId string, userId string) error {
+	const sqlStmt = `
+		UPDATE calendar_feeds
+		SET revoked_at = now()
+		WHERE revoked_at IS NULL
+			AND store_id IS NOT DISTINCT FROM NULLIF($1,'')::uuid
+			AND user_id IS NOT DISTINCT FROM NULLIF($2,'')::uuid
+	`
+	if _, err := tx.Exec(sqlStmt, storeId, userId); err != nil {
+		log.Println("An error occurred while revoking calendar feed", err)
+		return err
+	}
+	return nil
+}
+
+// CalendarFeedExists reports whether the token hash belongs to a live feed of
+// the store, or of the customer.
+func (i *StoreRepo) CalendarFeedExists(storeId string, userId string, tokenHash string) (bool, error) {
+	const sqlStmt = `
+		SELECT EXISTS (
+			SELECT 1
+			FROM calendar_feeds
+			WHERE token_hash = $3
+				AND revoked_at IS NULL
+				AND store_id IS NOT DISTINCT FROM NULLIF($1,'')::uuid
+				AND user_id IS NOT DISTINCT FROM NULLIF($2,'')::uuid
+		);
+	`
+	var exists bool
+	if err := i.postgresDB.QueryRow(sqlStmt, storeId, userId, tokenHash).Scan(&exists); err != nil {
+		log.Println("An error occurred while checking calendar feed", err)
+		return false, err
+	}
+	return exists, nil
+}
+
+// calendarAppointmentsSQL is the select list read by scanCalendarAppointments.
+const calendarAppointmentsSQL = `
+		SELECT
+			a.id,
+			a.status,
+			a.start_at,
+			a.end_at,
+			a.updated_at,
+			COALESCE(sv.name, ''),
+			s.name,
+			u.name,
+			COALESCE(a.notes, '')
+		FROM store_appointments a
+		JOIN stores s ON s.id = a.store_id
+		JOIN users u ON u.id = a.user_id
+		LEFT JOIN store_services sv ON sv.id = a.service_id
+	`
+
+// GetStoreCalendarAppointments lists the store appointments starting after
+// since that the store feed shows: the confirmed ones, including those that
+// were confirmed and canceled afterwards. Holds that never got confirmed
+// are left out.
+func (i *StoreRepo) GetStoreCalendarAppointments(storeId string, since time.Time) ([]calendarAppointment, error) {
+	const sqlStmt = calendarAppointmentsSQL + `
+		WHERE a.store_id = $1
+			AND a.start_at >= $2
+			AND (
+				a.status IN ('confirmed','completed','no_show')
+				OR (a.status = 'canceled' AND EXISTS (
+					SELECT 1 FROM store_appointment_status_history h
+					WHERE h.appointment_id = a.id
+						AND h.from_status = 'confirmed'
+						AND h.to_status = 'canceled'
+				))
+			)
+		ORDER BY a.start_at ASC, a.id ASC;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, storeId, since)
+	if err != nil {
+		log.Println("An error occurred while getting store calendar appointments", err)
+		return nil, err
+	}
+	return i.scanCalendarAppointments(rows)
+}
+
+// GetUserCalendarAppointments lists every booking of the customer starting
+// after since, at any store.
+func (i *StoreRepo) GetUserCalendarAppointments(userId string, since time.Time) ([]calendarAppointment, error) {
+	const sqlStmt = calendarAppointmentsSQL + `
+		WHERE a.user_id = $1
+			AND a.start_at >= $2
+		ORDER BY a.start_at ASC, a.id ASC;
+	`
+	rows, err := i.postgresDB.Query(sqlStmt, userId, since)
+	if err != nil {
+		log.Println("An error occurred while getting user calendar appointments", err)
+		return nil, err
+	}
+	return i.scanCalendarAppointments(rows)
+}
+
+func (i *StoreRepo) scanCalendarAppointments(rows *sql.Rows) ([]calendarAppointment, error) {
+	defer rows.Close()
+
+	appointments := []calendarAppointment{}
+	for rows.Next() {
+		var a calendarAppointment
+		err := rows.Scan(
+			&a.Id,
+			&a.Status,
+			&a.StartAt,
+			&a.EndAt,
+			&a.UpdatedAt,
+			&a.ServiceName,
+			&a.StoreName,
+			&a.CustomerName,
+			&a.Notes,
+		)
+		if err != nil {
+			log.Println("An error occurred while scanning calendar appointment", err)
+			return nil, err
+		}
+		appointments = append(appointments, a)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Row iteration error while getting calendar appointments", err)
+		return nil, err
+	}
+
+	return appointments, nil
 }
@@ -0,0 +1,153 @@
+package stores
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSeriesPolicyViolations(t *testing.T) {
+	loc := mustLocation(t, "America/Sao_Paulo")
+	now := time.Now().In(loc)
+	// day is 10:00 n days from now, far from midnight so the lead time
+	// doesn't depend on when the test runs.
+	day := func(n int) time.Time {
+		return time.Date(now.Year(), now.Month(), now.Day()+n, 10, 0, 0, 0, loc)
+	}
+	booking := func(id string, resource string, start time.Time, minutes int) StoreAppointment {
+		return StoreAppointment{
+			Id:         id,
+			StoreId:    testStore,
+			ResourceId: resource,
+			StartAt:    start.Format(time.RFC3339),
+			EndAt:      start.Add(time.Duration(minutes) * time.Minute).Format(time.RFC3339),
+		}
+	}
+	weeklyAt := func(first int, offset time.Duration, weeks int) []StoreAppointment {
+		var occurrences []StoreAppointment
+		for w := 0; w < weeks; w++ {
+			occurrences = append(occurrences, booking("", "chair-1", day(first+7*w).Add(offset), 60))
+		}
+		return occurrences
+	}
+
+	tests := []struct {
+		name        string
+		policy      *StoreBookingPolicy
+		saved       []StoreAppointment
+		occurrences []StoreAppointment
+		// want lists, per occurrence, the fields in violation.
+		want []string
+	}{
+		{
+			name:        "no policy",
+			occurrences: weeklyAt(1, 0, 3),
+			want:        []string{"", "", ""},
+		},
+		{
+			name:        "lead time stops only the first",
+			policy:      &StoreBookingPolicy{MinLeadMinutes: 3 * 24 * 60},
+			occurrences: weeklyAt(1, 0, 3),
+			want:        []string{"start_at", "", ""},
+		},
+		{
+			name:        "horizon stops the last ones",
+			policy:      &StoreBookingPolicy{MaxHorizonDays: 20},
+			occurrences: weeklyAt(2, 0, 4),
+			want:        []string{"", "", "", "start_at"},
+		},
+		{
+			name:        "buffer against a saved appointment",
+			policy:      &StoreBookingPolicy{BufferMinutes: 15},
+			saved:       []StoreAppointment{booking("a1", "chair-1", day(9).Add(-time.Hour), 55)},
+			occurrences: weeklyAt(2, 0, 3),
+			want:        []string{"", "buffer_minutes", ""},
+		},
+		{
+			name:        "buffer on another resource",
+			policy:      &StoreBookingPolicy{BufferMinutes: 15},
+			saved:       []StoreAppointment{booking("a1", "chair-2", day(9).Add(-time.Hour), 55)},
+			occurrences: weeklyAt(2, 0, 3),
+			want:        []string{"", "", ""},
+		},
+		{
+			name:        "buffer past midnight",
+			policy:      &StoreBookingPolicy{BufferMinutes: 30},
+			saved:       []StoreAppointment{booking("a1", "chair-1", day(10).Add(13*time.Hour), 55)},
+			occurrences: weeklyAt(3, 14*time.Hour+5*time.Minute, 2),
+			want:        []string{"", "buffer_minutes"},
+		},
+		{
+			name:   "buffer between occurrences",
+			policy: &StoreBookingPolicy{BufferMinutes: 15},
+			occurrences: []StoreAppointment{
+				booking("", "chair-1", day(2), 60),
+				booking("", "chair-1", day(2).Add(65*time.Minute), 60),
+				booking("", "chair-1", day(9), 60),
+			},
+			want: []string{"buffer_minutes", "buffer_minutes", ""},
+		},
+		{
+			name:        "daily limit counts saved appointments",
+			policy:      &StoreBookingPolicy{MaxDailyAppointments: 1},
+			saved:       []StoreAppointment{booking("a1", "chair-2", day(2).Add(4*time.Hour), 30)},
+			occurrences: weeklyAt(2, 0, 2),
+			want:        []string{"start_at", ""},
+		},
+		{
+			name:   "daily limit counts the series itself",
+			policy: &StoreBookingPolicy{MaxDailyAppointments: 2},
+			saved:  []StoreAppointment{booking("a1", "chair-2", day(2).Add(4*time.Hour), 30)},
+			occurrences: []StoreAppointment{
+				booking("", "chair-1", day(2), 60),
+				booking("", "chair-1", day(2).Add(2*time.Hour), 60),
+			},
+			want: []string{"start_at", "start_at"},
+		},
+		{
+			name:   "moved occurrences don't count against themselves",
+			policy: &StoreBookingPolicy{MaxDailyAppointments: 1, BufferMinutes: 15},
+			saved: []StoreAppointment{
+				booking("o1", "chair-1", day(2), 60),
+				booking("o2", "chair-1", day(9), 60),
+			},
+			occurrences: []StoreAppointment{
+				booking("o1", "chair-1", day(2).Add(70*time.Minute), 60),
+				booking("o2", "chair-1", day(9).Add(70*time.Minute), 60),
+			},
+			want: []string{"", ""},
+		},
+		{
+			name:        "several fields on one occurrence",
+			policy:      &StoreBookingPolicy{MinLeadMinutes: 3 * 24 * 60, MaxDailyAppointments: 1},
+			saved:       []StoreAppointment{booking("a1", "chair-2", day(1).Add(4*time.Hour), 30)},
+			occurrences: weeklyAt(1, 0, 2),
+			want:        []string{"start_at,start_at", ""},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newStubRepository(loc.String(), weekly("08:00", "18:00"))
+			r.appointments = tc.saved
+			s := newTestService(r)
+
+			violations, err := s.seriesPolicyViolations(testStore, tc.policy, tc.occurrences, loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(violations) != len(tc.occurrences) {
+				t.Fatalf("got %d results for %d occurrences", len(violations), len(tc.occurrences))
+			}
+			for idx, fields := range violations {
+				var names []string
+				for _, f := range fields {
+					names = append(names, f.Field)
+				}
+				if got := strings.Join(names, ","); got != tc.want[idx] {
+					t.Errorf("occurrence %d: got %q, want %q (%v)", idx, got, tc.want[idx], fields)
+				}
+			}
+		})
+	}
+}
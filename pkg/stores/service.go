@@ -1,5 +1,22 @@
 package stores
 
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/genda/genda-api/internal/app"
+	"github.com/genda/genda-api/internal/storage/postgres"
+	"github.com/genda/genda-api/pkg/config"
+	"github.com/genda/genda-api/pkg/holidays"
+	"github.com/genda/genda-api/pkg/money"
+	"github.com/genda/genda-api/pkg/rrule"
+)
+
+// maxSeriesOccurrences caps how many appointments a single series may create.
+const maxSeriesOccurrences = 100
+
 type Service interface {
 	CreateStore(Store) (*Store, error)
 	GetStores(int, int, string, string, string) (*GetStoreResponse, error)
@@ -22,6 +39,63 @@ type Service interface {
 	CreateStoreAppointment(StoreAppointment) (*StoreAppointment, error)
 	UpdateStoreAppointment(string, StoreAppointment) (*StoreAppointment, error)
 	DeleteStoreAppointment(string) error
+	GetStoreSlots(string, string, string, time.Duration, string, string) (*GetStoreSlotsResponse, error)
+	TransitionStoreAppointment(string, string, string, string, string) (*StoreAppointment, error)
+	GetStoreAppointmentHistory(string) ([]StoreAppointmentStatusChange, error)
+	RescheduleStoreAppointment(string, RescheduleStoreAppointmentRequest, string) (*StoreAppointment, error)
+	GetStoreAppointmentReschedules(string) ([]StoreAppointmentReschedule, error)
+	CreateStoreAppointmentSeries(string, CreateStoreAppointmentSeriesRequest) (*StoreAppointmentSeries, error)
+	GetStoreAppointmentSeries(string) (*StoreAppointmentSeries, error)
+	UpdateStoreAppointmentSeries(string, UpdateStoreAppointmentSeriesRequest) (*StoreAppointmentSeries, error)
+	CancelStoreAppointmentSeries(string, CancelStoreAppointmentSeriesRequest, string) (*StoreAppointmentSeries, error)
+	CreateStoreService(StoreService) (*StoreService, error)
+	GetStoreServices(string, bool) ([]StoreService, error)
+	GetStoreService(string, string) (*StoreService, error)
+	UpdateStoreService(string, string, StoreService) (*StoreService, error)
+	DeleteStoreService(string, string) error
+	CreateStoreResource(StoreResource) (*StoreResource, error)
+	GetStoreResources(string, bool) ([]StoreResource, error)
+	GetStoreResource(string, string) (*StoreResource, error)
+	UpdateStoreResource(string, string, StoreResource) (*StoreResource, error)
+	DeleteStoreResource(string, string) error
+	CreateStoreAvailabilityException(StoreAvailabilityException) (*StoreAvailabilityException, error)
+	GetStoreAvailabilityExceptions(string, string, string) ([]StoreAvailabilityException, error)
+	UpdateStoreAvailabilityException(string, string, StoreAvailabilityException) (*StoreAvailabilityException, error)
+	DeleteStoreAvailabilityException(string, string) error
+	GetStoreHolidays(string, int) (*GetStoreHolidaysResponse, error)
+	GetStoreBookingPolicy(string) (*StoreBookingPolicy, error)
+	UpdateStoreBookingPolicy(string, StoreBookingPolicy) (*StoreBookingPolicy, error)
+	GetStoreCancellationPolicy(string) (*StoreCancellationPolicy, error)
+	UpdateStoreCancellationPolicy(string, StoreCancellationPolicy) (*StoreCancellationPolicy, error)
+	GetStoreCustomerNoShows(string, string) (*GetStoreCustomerNoShowsResponse, error)
+	CreateStoreWaitlistEntry(StoreWaitlistEntry) (*StoreWaitlistEntry, error)
+	GetStoreWaitlistEntries(string, string, string) ([]StoreWaitlistEntry, error)
+	GetStoreWaitlistEntry(string, string) (*StoreWaitlistEntry, error)
+	CancelStoreWaitlistEntry(string, string, string) (*StoreWaitlistEntry, error)
+	AcceptStoreWaitlistOffer(string, string, string) (*StoreAppointment, error)
+	DeclineStoreWaitlistOffer(string, string, string) (*StoreWaitlistEntry, error)
+	OfferFreedSlot(StoreAppointment) (*StoreWaitlistEntry, error)
+	CreateStoreSession(StoreSession) (*StoreSession, error)
+	GetStoreSessions(string, string, string, string) ([]StoreSession, error)
+	GetStoreSession(string, string) (*StoreSession, error)
+	UpdateStoreSession(string, string, StoreSession) (*StoreSession, error)
+	CancelStoreSession(string, string) (*StoreSession, error)
+	CreateStoreSessionBooking(string, StoreSessionBooking) (*StoreSessionBooking, error)
+	GetStoreSessionBookings(string, string, string) ([]StoreSessionBooking, error)
+	CancelStoreSessionBooking(string, string, string) (*StoreSessionBooking, error)
+	MarkStoreSessionAttendance(string, string, MarkSessionAttendanceRequest) ([]StoreSessionBooking, error)
+	CreateStoreCalendarFeed(string) (*CalendarFeed, error)
+	CreateUserCalendarFeed(string) (*CalendarFeed, error)
+	RevokeStoreCalendarFeed(string) error
+	RevokeUserCalendarFeed(string) error
+	GetStoreCalendarFeed(string, string) ([]byte, error)
+	GetUserCalendarFeed(string, string) ([]byte, error)
+	CreateStoreCalendarSource(string, StoreCalendarSource) (*StoreCalendarSource, error)
+	GetStoreCalendarSources(string) ([]StoreCalendarSource, error)
+	GetStoreCalendarSource(string, string) (*StoreCalendarSource, error)
+	UploadStoreCalendarSource(string, string, string) (*StoreCalendarSource, error)
+	RefreshStoreCalendarSource(string, string) (*StoreCalendarSource, error)
+	DeleteStoreCalendarSource(string, string) error
 }
 
 type Repository interface {
@@ -30,6 +104,10 @@ type Repository interface {
 	GetStore(string) (*GetStoreByIdResponse, error)
 	UpdateStore(string, Store) (*Store, error)
 	DeleteStore(string) error
+	GetStoreCalendar(string) (*StoreCalendar, error)
+	GetStoreBookingPolicy(string) (*StoreBookingPolicy, error)
+	UpdateStoreBookingPolicy(string, StoreBookingPolicy) (*StoreBookingPolicy, error)
+	GetStorePlatformFeePct(string) (money.Decimal, error)
 	CreateStorePlan(StorePlan) (*StorePlan, error)
 	CreateStoreAvailability(StoreAvailability) (*StoreAvailability, error)
 	CreateStoreRating(StoreRating) (*StoreRating, error)
@@ -46,17 +124,98 @@ type Repository interface {
 	CreateStoreAppointment(StoreAppointment) (*StoreAppointment, error)
 	UpdateStoreAppointment(string, StoreAppointment) (*StoreAppointment, error)
 	DeleteStoreAppointment(string) error
+	GetStoreBusyAppointments(string, time.Time, time.Time) ([]StoreAppointment, error)
+	GetStoreCalendarBusy(string, time.Time, time.Time) ([]StoreAppointment, error)
+	GetStoreAppointment(string) (*StoreAppointment, error)
+	TransitionStoreAppointment(string, string, string, string, string, string, time.Time, *AppointmentPenalty) (*StoreAppointment, error)
+	GetStoreCustomerNoShows(string, string) ([]StoreNoShow, error)
+	GetStoreCancellationPolicy(string) (*StoreCancellationPolicy, error)
+	UpdateStoreCancellationPolicy(string, StoreCancellationPolicy) (*StoreCancellationPolicy, error)
+	GetStoreAppointmentHistory(string) ([]StoreAppointmentStatusChange, error)
+	RescheduleStoreAppointment(string, string, StoreAppointment, string, string) (*StoreAppointment, error)
+	GetStoreAppointmentReschedules(string) ([]StoreAppointmentReschedule, error)
+	CancelExpiredHolds(time.Time) ([]StoreAppointment, error)
+	CreateStoreAppointmentSeries(StoreAppointmentSeries, []StoreAppointment) (*StoreAppointmentSeries, error)
+	GetStoreAppointmentSeries(string) (*StoreAppointmentSeries, error)
+	UpdateStoreAppointmentSeriesOccurrences(string, []StoreAppointment) error
+	CancelStoreAppointments([]string, string, string) (int64, error)
+	CreateStoreService(StoreService) (*StoreService, error)
+	GetStoreServices(string, bool) ([]StoreService, error)
+	GetStoreService(string) (*StoreService, error)
+	UpdateStoreService(string, StoreService) (*StoreService, error)
+	DeleteStoreService(string) error
+	CreateStoreResource(StoreResource) (*StoreResource, error)
+	GetStoreResources(string, bool) ([]StoreResource, error)
+	GetStoreResource(string) (*StoreResource, error)
+	UpdateStoreResource(string, StoreResource) (*StoreResource, error)
+	DeleteStoreResource(string) error
+	CreateStoreAvailabilityException(StoreAvailabilityException) (*StoreAvailabilityException, error)
+	GetStoreAvailabilityExceptions(string, string, string) ([]StoreAvailabilityException, error)
+	GetStoreAvailabilityException(string) (*StoreAvailabilityException, error)
+	UpdateStoreAvailabilityException(string, StoreAvailabilityException) (*StoreAvailabilityException, error)
+	DeleteStoreAvailabilityException(string) error
+	CreateStoreWaitlistEntry(StoreWaitlistEntry) (*StoreWaitlistEntry, error)
+	GetStoreWaitlistEntries(string, string, string) ([]StoreWaitlistEntry, error)
+	GetStoreWaitlistEntry(string) (*StoreWaitlistEntry, error)
+	CancelStoreWaitlistEntry(string) (*StoreWaitlistEntry, error)
+	OfferStoreWaitlistSlot(StoreAppointment, string) (*StoreWaitlistEntry, error)
+	CreateStoreSession(StoreSession) (*StoreSession, error)
+	GetStoreSessions(string, time.Time, time.Time, string) ([]StoreSession, error)
+	GetStoreSession(string) (*StoreSession, error)
+	UpdateStoreSession(string, StoreSession) (*StoreSession, error)
+	CancelStoreSession(string) (*StoreSession, error)
+	CreateStoreSessionBooking(StoreSessionBooking) (*StoreSessionBooking, error)
+	GetStoreSessionBookings(string, string) ([]StoreSessionBooking, error)
+	CancelStoreSessionBooking(string, string) (*StoreSessionBooking, error)
+	MarkStoreSessionAttendance(string, []SessionAttendance) ([]StoreSessionBooking, error)
+	CreateCalendarFeed(string, string, string) error
+	RevokeCalendarFeed(string, string) error
+	CalendarFeedExists(string, string, string) (bool, error)
+	GetStoreCalendarAppointments(string, time.Time) ([]calendarAppointment, error)
+	GetUserCalendarAppointments(string, time.Time) ([]calendarAppointment, error)
+	CreateStoreCalendarSource(StoreCalendarSource) (*StoreCalendarSource, error)
+	GetStoreCalendarSources(string) ([]StoreCalendarSource, error)
+	GetStoreCalendarSource(string) (*StoreCalendarSource, error)
+	GetStoreCalendarSourceContent(string) (string, error)
+	UpdateStoreCalendarSourceContent(string, string) error
+	ReplaceStoreCalendarSourceBlocks(string, []calendarBusyBlock, string) (*StoreCalendarSource, error)
+	MarkStoreCalendarSourceFailed(string, string) error
+	DeleteStoreCalendarSource(string) error
 }
 
 type service struct {
 	storeRepository Repository
+	holdTTL         time.Duration
+	offerTTL        time.Duration
+	notifier        Notifier
+}
+
+func NewService(r Repository, holdTTL time.Duration, offerTTL time.Duration, notifier Notifier) Service {
+	return &service{r, holdTTL, offerTTL, notifier}
 }
 
-func NewService(r Repository) Service {
-	return &service{r}
+// newConfiguredService builds the service with the hold and offer TTLs from
+// the environment, falling back to the defaults when they are unset or invalid.
+func newConfiguredService(r Repository, notifier Notifier) Service {
+	conf := config.New()
+	holdTTL, err := time.ParseDuration(conf.AppointmentHoldTTL)
+	if err != nil || holdTTL <= 0 {
+		holdTTL, _ = time.ParseDuration(config.DefaultHoldTTL)
+	}
+	offerTTL, err := time.ParseDuration(conf.WaitlistOfferTTL)
+	if err != nil || offerTTL <= 0 {
+		offerTTL, _ = time.ParseDuration(config.DefaultOfferTTL)
+	}
+	return NewService(r, holdTTL, offerTTL, notifier)
 }
 
 func (s *service) CreateStore(store Store) (*Store, error) {
+	if store.Timezone == "" {
+		store.Timezone = DefaultTimezone
+	}
+	if err := validateHolidayCalendar(&store); err != nil {
+		return nil, err
+	}
 	return s.storeRepository.CreateStore(store)
 }
 
@@ -70,6 +229,16 @@ func (s *service) GetStore(id string) (*GetStoreByIdResponse, error) {
 }
 
 func (s *service) UpdateStore(id string, store Store) (*Store, error) {
+	if store.Timezone == "" {
+		calendar, err := s.storeRepository.GetStoreCalendar(id)
+		if err != nil {
+			return nil, err
+		}
+		store.Timezone = calendar.Timezone
+	}
+	if err := validateHolidayCalendar(&store); err != nil {
+		return nil, err
+	}
 	return s.storeRepository.UpdateStore(id, store)
 }
 
@@ -78,6 +247,9 @@ func (s *service) DeleteStore(id string) error {
 }
 
 func (s *service) CreateStorePlan(plan StorePlan) (*StorePlan, error) {
+	if err := checkPlanPrice(plan); err != nil {
+		return nil, err
+	}
 	return s.storeRepository.CreateStorePlan(plan)
 }
 
@@ -106,6 +278,9 @@ func (s *service) DeleteStoreRating(id string) error {
 }
 
 func (s *service) UpdateStorePlan(id string, plan StorePlan) (*StorePlan, error) {
+	if err := checkPlanPrice(plan); err != nil {
+		return nil, err
+	}
 	return s.storeRepository.UpdateStorePlan(id, plan)
 }
 
@@ -121,6 +296,62 @@ func (s *service) DeleteStoreAvailability(id string) error {
 	return s.storeRepository.DeleteStoreAvailability(id)
 }
 
+func (s *service) CreateStoreAvailabilityException(exception StoreAvailabilityException) (*StoreAvailabilityException, error) {
+	if err := s.checkException(&exception); err != nil {
+		return nil, err
+	}
+	return s.storeRepository.CreateStoreAvailabilityException(exception)
+}
+
+func (s *service) GetStoreAvailabilityExceptions(storeId string, from string, to string) ([]StoreAvailabilityException, error) {
+	for _, date := range []string{from, to} {
+		if _, err := time.Parse(dateLayout, date); date != "" && err != nil {
+			return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+		}
+	}
+	return s.storeRepository.GetStoreAvailabilityExceptions(storeId, from, to)
+}
+
+func (s *service) UpdateStoreAvailabilityException(storeId string, id string, exception StoreAvailabilityException) (*StoreAvailabilityException, error) {
+	current, err := s.storeRepository.GetStoreAvailabilityException(id)
+	if err != nil {
+		return nil, err
+	}
+	if current.StoreId != storeId {
+		return nil, fmt.Errorf("availability exception %s not found", id)
+	}
+
+	exception.StoreId = storeId
+	if err := s.checkException(&exception); err != nil {
+		return nil, err
+	}
+	return s.storeRepository.UpdateStoreAvailabilityException(id, exception)
+}
+
+func (s *service) DeleteStoreAvailabilityException(storeId string, id string) error {
+	current, err := s.storeRepository.GetStoreAvailabilityException(id)
+	if err != nil {
+		return err
+	}
+	if current.StoreId != storeId {
+		return fmt.Errorf("availability exception %s not found", id)
+	}
+	return s.storeRepository.DeleteStoreAvailabilityException(id)
+}
+
+// checkException validates an exception and the resource it belongs to.
+func (s *service) checkException(exception *StoreAvailabilityException) error {
+	if err := validateException(exception); err != nil {
+		return err
+	}
+	if exception.ResourceId != "" {
+		if _, err := s.GetStoreResource(exception.StoreId, exception.ResourceId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *service) GetStorePlans(storeId string) (*[]StorePlan, error) {
 	return s.storeRepository.GetStorePlans(storeId)
 }
@@ -130,13 +361,1898 @@ func (s *service) GetStoreAvailability(storeId string) (*StoreAvailability, erro
 }
 
 func (s *service) CreateStoreAppointment(appointment StoreAppointment) (*StoreAppointment, error) {
-	return s.storeRepository.CreateStoreAppointment(appointment)
+	// Later statuses are only reached through the transition endpoints.
+	if appointment.Status != AppointmentStatusPending && appointment.Status != AppointmentStatusConfirmed {
+		return nil, fmt.Errorf("an appointment can't be created as %s, only as pending or confirmed", appointment.Status)
+	}
+	storeService, err := s.bookableService(appointment.StoreId, appointment.ServiceId)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := s.storeLocation(appointment.StoreId)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyService(&appointment, storeService, loc); err != nil {
+		return nil, err
+	}
+	policy, err := s.storeRepository.GetStoreBookingPolicy(appointment.StoreId)
+	if err != nil {
+		return nil, err
+	}
+	appointment.BufferMinutes = policy.bufferMinutes(appointment.BufferMinutes)
+	exceptions, err := s.appointmentExceptions(appointment, loc)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.assignResource(&appointment, loc, exceptions); err != nil {
+		return nil, err
+	}
+	hours, err := s.openingHours(appointment.StoreId, appointment.ResourceId)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAvailability(appointment, loc, *hours, exceptions); err != nil {
+		return nil, err
+	}
+	if err := s.checkCalendarBusy(appointment, loc); err != nil {
+		return nil, err
+	}
+	if err := s.checkBookingPolicy(policy, appointment, loc); err != nil {
+		return nil, err
+	}
+	if err := s.applyPlatformFee(&appointment); err != nil {
+		return nil, err
+	}
+
+	// Pending appointments are holds, the expiry is always ours to decide.
+	appointment.HoldExpiresAt = ""
+	if appointment.Status == AppointmentStatusPending {
+		appointment.HoldExpiresAt = time.Now().In(loc).Add(s.holdTTL).Format(time.RFC3339)
+	}
+	res, err := s.storeRepository.CreateStoreAppointment(appointment)
+	if err != nil {
+		return nil, err
+	}
+	s.notify(res.Id)
+	return res, nil
+}
+
+func (s *service) TransitionStoreAppointment(storeId string, id string, status string, changedBy string, reason string) (*StoreAppointment, error) {
+	current, err := s.storeRepository.GetStoreAppointment(id)
+	if err != nil {
+		return nil, err
+	}
+	if current.StoreId != storeId {
+		return nil, fmt.Errorf("appointment %s not found", id)
+	}
+
+	if !canTransition(current.Status, status) {
+		return nil, &TransitionError{From: current.Status, To: status}
+	}
+
+	now := time.Now().UTC()
+	penalty, err := s.transitionPenalty(*current, status, now)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.storeRepository.TransitionStoreAppointment(storeId, id, current.Status, status, changedBy, reason, now, penalty)
+	if err != nil {
+		return nil, err
+	}
+	s.notify(id)
+
+	// The cancel already happened, a failed offer only leaves the time free.
+	if status == AppointmentStatusCanceled {
+		if _, err := s.OfferFreedSlot(*res); err != nil {
+			log.Println("An error occurred while offering freed slot to the waitlist", err)
+		}
+	}
+	return res, nil
+}
+
+// transitionPenalty computes the fee the store policy charges for moving the
+// appointment to status, if any.
+func (s *service) transitionPenalty(appointment StoreAppointment, status string, now time.Time) (*AppointmentPenalty, error) {
+	if status != AppointmentStatusCanceled && status != AppointmentStatusNoShow {
+		return nil, nil
+	}
+
+	policy, err := s.storeRepository.GetStoreCancellationPolicy(appointment.StoreId)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := s.storeLocation(appointment.StoreId)
+	if err != nil {
+		return nil, err
+	}
+	return appointmentPenalty(policy, appointment, status, loc, now)
+}
+
+func (s *service) GetStoreCancellationPolicy(storeId string) (*StoreCancellationPolicy, error) {
+	return s.storeRepository.GetStoreCancellationPolicy(storeId)
+}
+
+func (s *service) UpdateStoreCancellationPolicy(storeId string, policy StoreCancellationPolicy) (*StoreCancellationPolicy, error) {
+	if err := money.CheckPercent("no_show_fee_percent", policy.NoShowFeePercent); err != nil {
+		return nil, err
+	}
+	seen := map[int]bool{}
+	for _, window := range policy.Windows {
+		if err := money.CheckPercent("fee_percent", window.FeePercent); err != nil {
+			return nil, err
+		}
+		if seen[window.HoursBefore] {
+			return nil, fmt.Errorf("more than one window for %d hours before", window.HoursBefore)
+		}
+		seen[window.HoursBefore] = true
+	}
+	return s.storeRepository.UpdateStoreCancellationPolicy(storeId, policy)
+}
+
+func (s *service) GetStoreCustomerNoShows(storeId string, userId string) (*GetStoreCustomerNoShowsResponse, error) {
+	noShows, err := s.storeRepository.GetStoreCustomerNoShows(storeId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &GetStoreCustomerNoShowsResponse{
+		StoreId:   storeId,
+		UserId:    userId,
+		Total:     len(noShows),
+		TotalFees: money.NewDecimal(0, 2),
+		NoShows:   noShows,
+	}
+	for _, noShow := range noShows {
+		res.TotalFees = res.TotalFees.Add(noShow.PenaltyFee)
+	}
+	return res, nil
+}
+
+func (s *service) GetStoreAppointmentHistory(id string) ([]StoreAppointmentStatusChange, error) {
+	return s.storeRepository.GetStoreAppointmentHistory(id)
 }
 
 func (s *service) UpdateStoreAppointment(id string, appointment StoreAppointment) (*StoreAppointment, error) {
-	return s.storeRepository.UpdateStoreAppointment(id, appointment)
+	current, err := s.storeRepository.GetStoreAppointment(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Status only moves through the transition endpoints.
+	if appointment.Status != "" && appointment.Status != current.Status {
+		return nil, errors.New("status can't be changed here, use the appointment transition endpoints")
+	}
+	if current.Status != AppointmentStatusPending && current.Status != AppointmentStatusConfirmed {
+		return nil, fmt.Errorf("a %s appointment can't be changed", current.Status)
+	}
+	appointment.Status = current.Status
+	appointment.HoldExpiresAt = current.HoldExpiresAt
+	// The payment is linked through checkout only.
+	appointment.PaymentId = current.PaymentId
+
+	loc, err := s.storeLocation(current.StoreId)
+	if err != nil {
+		return nil, err
+	}
+	// Moves go through the reschedule endpoint, which keeps their history
+	// and offers the old time to the waitlist.
+	start, err := parseTimeParam(appointment.StartAt, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start_at: %w", err)
+	}
+	currentStart, err := parseTimeParam(current.StartAt, loc)
+	if err != nil {
+		return nil, err
+	}
+	if !start.Equal(currentStart) {
+		return nil, errors.New("start_at can't be changed here, use the appointment reschedule endpoint")
+	}
+
+	// Switching services reprices the appointment, otherwise the price it
+	// was booked at is kept.
+	storeService, err := s.bookableService(current.StoreId, appointment.ServiceId)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyService(&appointment, storeService, loc); err != nil {
+		return nil, err
+	}
+	if appointment.ServiceId == current.ServiceId {
+		appointment.Price = current.Price
+		appointment.Currency = current.Currency
+	}
+	appointment.StoreId = current.StoreId
+	if err := s.applyPlatformFee(&appointment); err != nil {
+		return nil, err
+	}
+	policy, err := s.storeRepository.GetStoreBookingPolicy(current.StoreId)
+	if err != nil {
+		return nil, err
+	}
+	appointment.BufferMinutes = policy.bufferMinutes(appointment.BufferMinutes)
+
+	// Leaving resource_id out keeps the appointment with who it was booked with.
+	if appointment.ResourceId == "" {
+		appointment.ResourceId = current.ResourceId
+	}
+	if appointment.ResourceId != current.ResourceId {
+		if _, err := s.bookableResource(current.StoreId, appointment.ResourceId); err != nil {
+			return nil, err
+		}
+	}
+
+	exceptions, err := s.appointmentExceptions(appointment, loc)
+	if err != nil {
+		return nil, err
+	}
+	hours, err := s.openingHours(appointment.StoreId, appointment.ResourceId)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAvailability(appointment, loc, *hours, exceptions); err != nil {
+		return nil, err
+	}
+
+	// An appointment that keeps its time and resource isn't held to rules
+	// the store set after it was booked.
+	if rebooked(*current, appointment) {
+		if err := s.checkCalendarBusy(appointment, loc); err != nil {
+			return nil, err
+		}
+		if err := s.checkBookingPolicy(policy, appointment, loc); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := s.storeRepository.UpdateStoreAppointment(id, appointment)
+	if err != nil {
+		return nil, err
+	}
+	s.notify(id)
+	return res, nil
+}
+
+// RescheduleStoreAppointment moves a pending or confirmed appointment to a
+// new start, keeping its duration, service, price and payment. The new time
+// is checked like a new booking, and the time it leaves is offered to the
+// waitlist.
+func (s *service) RescheduleStoreAppointment(id string, req RescheduleStoreAppointmentRequest, changedBy string) (*StoreAppointment, error) {
+	current, err := s.storeRepository.GetStoreAppointment(id)
+	if err != nil {
+		return nil, err
+	}
+	if current.Status != AppointmentStatusPending && current.Status != AppointmentStatusConfirmed {
+		return nil, fmt.Errorf("a %s appointment can't be rescheduled", current.Status)
+	}
+
+	loc, err := s.storeLocation(current.StoreId)
+	if err != nil {
+		return nil, err
+	}
+	start, err := parseTimeParam(req.StartAt, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start_at: %w", err)
+	}
+	currentStart, err := parseTimeParam(current.StartAt, loc)
+	if err != nil {
+		return nil, err
+	}
+	currentEnd, err := parseTimeParam(current.EndAt, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	moved := *current
+	moved.StartAt = start.Format(time.RFC3339)
+	moved.EndAt = start.Add(currentEnd.Sub(currentStart)).Format(time.RFC3339)
+
+	policy, err := s.storeRepository.GetStoreBookingPolicy(current.StoreId)
+	if err != nil {
+		return nil, err
+	}
+	moved.BufferMinutes = policy.bufferMinutes(current.BufferMinutes)
+
+	exceptions, err := s.appointmentExceptions(moved, loc)
+	if err != nil {
+		return nil, err
+	}
+	// Leaving resource_id out keeps the appointment with who it was booked with.
+	if req.ResourceId != "" {
+		moved.ResourceId = req.ResourceId
+	}
+	if moved.ResourceId == AnyResource {
+		if err := s.assignResource(&moved, loc, exceptions); err != nil {
+			return nil, err
+		}
+	} else if moved.ResourceId != current.ResourceId {
+		if _, err := s.bookableResource(current.StoreId, moved.ResourceId); err != nil {
+			return nil, err
+		}
+	}
+
+	hours, err := s.openingHours(moved.StoreId, moved.ResourceId)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAvailability(moved, loc, *hours, exceptions); err != nil {
+		return nil, err
+	}
+	if err := s.checkCalendarBusy(moved, loc); err != nil {
+		return nil, err
+	}
+	if err := s.checkBookingPolicy(policy, moved, loc); err != nil {
+		return nil, err
+	}
+
+	res, err := s.storeRepository.RescheduleStoreAppointment(id, current.StartAt, moved, changedBy, req.Reason)
+	if err != nil {
+		return nil, err
+	}
+	s.notify(id)
+
+	// The move already happened, a failed offer only leaves the old time free.
+	if _, err := s.OfferFreedSlot(*current); err != nil {
+		log.Println("An error occurred while offering freed slot to the waitlist", err)
+	}
+	return res, nil
 }
 
+func (s *service) GetStoreAppointmentReschedules(id string) ([]StoreAppointmentReschedule, error) {
+	return s.storeRepository.GetStoreAppointmentReschedules(id)
+}
+
+// DeleteStoreAppointment deletes the appointment after canceling the
+// notifications it still had coming, and offers the time it held to the
+// waitlist.
 func (s *service) DeleteStoreAppointment(id string) error {
-	return s.storeRepository.DeleteStoreAppointment(id)
+	deleted, err := s.storeRepository.GetStoreAppointment(id)
+	if err != nil {
+		return err
+	}
+	if s.notifier != nil {
+		if err := s.notifier.CancelAppointment(id); err != nil {
+			return err
+		}
+	}
+	if err := s.storeRepository.DeleteStoreAppointment(id); err != nil {
+		return err
+	}
+
+	// The delete already happened, a failed offer only leaves the time free.
+	if deleted.Status == AppointmentStatusPending || deleted.Status == AppointmentStatusConfirmed {
+		if _, err := s.OfferFreedSlot(*deleted); err != nil {
+			log.Println("An error occurred while offering freed slot to the waitlist", err)
+		}
+	}
+	return nil
+}
+
+// GetStoreSlots lists the bookable slots between from and to, read in the
+// store timezone when they carry no offset. A resourceId limits the search to
+// that resource; without one, or with "any", every active resource is searched
+// and each slot lists the resources free for it.
+func (s *service) GetStoreSlots(storeId string, fromParam string, toParam string, duration time.Duration, serviceId string, resourceId string) (*GetStoreSlotsResponse, error) {
+	loc, err := s.storeLocation(storeId)
+	if err != nil {
+		return nil, err
+	}
+	from, err := parseTimeParam(fromParam, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from: %w", err)
+	}
+	to, err := parseTimeParam(toParam, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to: %w", err)
+	}
+
+	if !to.After(from) {
+		return nil, errors.New("to must be after from")
+	}
+	if to.Sub(from) > maxSlotRange {
+		return nil, errors.New("the requested range can't be longer than 31 days")
+	}
+
+	// A service decides the duration, and its buffer keeps the time after
+	// each slot free as well.
+	var buffer time.Duration
+	if serviceId != "" {
+		storeService, err := s.bookableService(storeId, serviceId)
+		if err != nil {
+			return nil, err
+		}
+		duration = time.Duration(storeService.DurationMinutes) * time.Minute
+		buffer = time.Duration(storeService.BufferMinutes) * time.Minute
+	}
+
+	policy, err := s.storeRepository.GetStoreBookingPolicy(storeId)
+	if err != nil {
+		return nil, err
+	}
+	buffer = time.Duration(policy.bufferMinutes(int(buffer/time.Minute))) * time.Minute
+	if duration <= 0 {
+		return nil, errors.New("duration must be positive")
+	}
+
+	availability, err := s.storeRepository.GetStoreAvailability(storeId)
+	if err != nil {
+		return nil, err
+	}
+	weekly, err := parseAvailability(availability.Availability)
+	if err != nil {
+		return nil, err
+	}
+
+	appointments, err := s.busyAppointments(storeId, from.Add(-time.Duration(policy.BufferMinutes)*time.Minute), to)
+	if err != nil {
+		return nil, err
+	}
+	for i := range appointments {
+		appointments[i].BufferMinutes = policy.bufferMinutes(appointments[i].BufferMinutes)
+	}
+
+	var resources []StoreResource
+	if resourceId != "" && resourceId != AnyResource {
+		resource, err := s.bookableResource(storeId, resourceId)
+		if err != nil {
+			return nil, err
+		}
+		resources = []StoreResource{*resource}
+	} else {
+		resources, err = s.storeRepository.GetStoreResources(storeId, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	exceptions, err := s.availabilityExceptions(storeId, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &GetStoreSlotsResponse{
+		StoreId:  storeId,
+		From:     from.Format(time.RFC3339),
+		To:       to.Format(time.RFC3339),
+		Duration: int(duration / time.Minute),
+	}
+
+	// Stores without resources keep a single calendar.
+	if len(resources) == 0 {
+		free, err := freeIntervals(weekly, exceptionsFor(exceptions, ""), resourceAppointments(appointments, ""), from, to)
+		if err != nil {
+			return nil, err
+		}
+		res.Slots, err = policySlots(policy, buildSlots(free, duration, buffer), time.Now(), loc)
+		return res, err
+	}
+
+	slotsByResource := make(map[string][]Slot, len(resources))
+	for _, resource := range resources {
+		hours, err := resourceHours(resource, weekly)
+		if err != nil {
+			return nil, err
+		}
+		free, err := freeIntervals(hours, exceptionsFor(exceptions, resource.Id), resourceAppointments(appointments, resource.Id), from, to)
+		if err != nil {
+			return nil, err
+		}
+		slotsByResource[resource.Id] = buildSlots(free, duration, buffer)
+	}
+	res.Slots, err = policySlots(policy, mergeResourceSlots(resources, slotsByResource), time.Now(), loc)
+	return res, err
+}
+
+func (s *service) CreateStoreAppointmentSeries(storeId string, req CreateStoreAppointmentSeriesRequest) (*StoreAppointmentSeries, error) {
+	storeService, err := s.bookableService(storeId, req.ServiceId)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.ResourceId != "" {
+		if _, err := s.bookableResource(storeId, req.ResourceId); err != nil {
+			return nil, err
+		}
+	}
+
+	loc, err := s.storeLocation(storeId)
+	if err != nil {
+		return nil, err
+	}
+	start, err := parseTimeParam(req.StartAt, loc)
+	if err != nil {
+		return nil, err
+	}
+	duration := time.Duration(storeService.DurationMinutes) * time.Minute
+
+	// Occurrences repeat on the store wall clock, across daylight saving.
+	rule, err := rrule.Parse(req.RRule, loc)
+	if err != nil {
+		return nil, err
+	}
+	if !rule.Bounded() {
+		return nil, errors.New("rrule must end through COUNT or UNTIL")
+	}
+
+	starts := rule.All(start, maxSeriesOccurrences+1)
+	if len(starts) == 0 {
+		return nil, errors.New("rrule has no occurrences after start_at")
+	}
+	if len(starts) > maxSeriesOccurrences {
+		return nil, fmt.Errorf("a series can't have more than %d occurrences", maxSeriesOccurrences)
+	}
+
+	holdExpiresAt := ""
+	if req.Status == AppointmentStatusPending {
+		holdExpiresAt = time.Now().In(loc).Add(s.holdTTL).Format(time.RFC3339)
+	}
+	feePlatform, err := s.platformFee(storeId, storeService.Price, storeService.Currency)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := s.storeRepository.GetStoreBookingPolicy(storeId)
+	if err != nil {
+		return nil, err
+	}
+
+	occurrences := make([]StoreAppointment, 0, len(starts))
+	for _, occurrenceStart := range starts {
+		occurrences = append(occurrences, StoreAppointment{
+			StoreId:       storeId,
+			UserId:        req.UserId,
+			ServiceId:     storeService.Id,
+			ResourceId:    req.ResourceId,
+			StartAt:       occurrenceStart.Format(time.RFC3339),
+			EndAt:         occurrenceStart.Add(duration).Format(time.RFC3339),
+			BufferMinutes: policy.bufferMinutes(storeService.BufferMinutes),
+			Status:        req.Status,
+			HoldExpiresAt: holdExpiresAt,
+			Price:         storeService.Price,
+			Currency:      storeService.Currency,
+			FeePlatform:   feePlatform,
+			Notes:         req.Notes,
+		})
+	}
+
+	series := StoreAppointmentSeries{
+		StoreId: storeId,
+		UserId:  req.UserId,
+		RRule:   req.RRule,
+		StartAt: start.Format(time.RFC3339),
+		EndAt:   start.Add(duration).Format(time.RFC3339),
+		Notes:   req.Notes,
+	}
+	if err := s.checkSeriesAvailability(storeId, occurrences, policy, loc); err != nil {
+		return nil, err
+	}
+	res, err := s.storeRepository.CreateStoreAppointmentSeries(series, occurrences)
+	if err != nil {
+		return nil, err
+	}
+	s.notify(seriesIds(res)...)
+	return res, nil
+}
+
+func (s *service) GetStoreAppointmentSeries(id string) (*StoreAppointmentSeries, error) {
+	return s.storeRepository.GetStoreAppointmentSeries(id)
+}
+
+func (s *service) UpdateStoreAppointmentSeries(id string, req UpdateStoreAppointmentSeriesRequest) (*StoreAppointmentSeries, error) {
+	series, err := s.storeRepository.GetStoreAppointmentSeries(id)
+	if err != nil {
+		return nil, err
+	}
+
+	targets, anchor, err := seriesScope(series.Appointments, req.Scope, req.AppointmentId)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := s.storeLocation(series.StoreId)
+	if err != nil {
+		return nil, err
+	}
+	newStart, err := parseTimeParam(req.StartAt, loc)
+	if err != nil {
+		return nil, err
+	}
+	anchorStart, err := parseTimeParam(anchor.StartAt, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := s.storeRepository.GetStoreBookingPolicy(series.StoreId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every occurrence in scope moves on the store wall clock by the same
+	// amount as the anchor and keeps the duration it was booked for.
+	shift := wallClock(newStart).Sub(wallClock(anchorStart))
+	rebookedAny := false
+	for idx := range targets {
+		current := targets[idx]
+		start, err := parseTimeParam(targets[idx].StartAt, loc)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseTimeParam(targets[idx].EndAt, loc)
+		if err != nil {
+			return nil, err
+		}
+		moved := addWallClock(start, shift)
+		targets[idx].StartAt = moved.Format(time.RFC3339)
+		targets[idx].EndAt = moved.Add(end.Sub(start)).Format(time.RFC3339)
+		if req.Notes != "" {
+			targets[idx].Notes = req.Notes
+		}
+		targets[idx].BufferMinutes = policy.bufferMinutes(targets[idx].BufferMinutes)
+		rebookedAny = rebookedAny || rebooked(current, targets[idx])
+	}
+
+	// As with a single appointment, occurrences that keep their time aren't
+	// held to rules the store set after they were booked.
+	if !rebookedAny {
+		policy = nil
+	}
+
+	// Moving later, the last occurrence goes first so the series never
+	// overlaps itself half way through the update.
+	if shift > 0 {
+		for a, b := 0, len(targets)-1; a < b; a, b = a+1, b-1 {
+			targets[a], targets[b] = targets[b], targets[a]
+		}
+	}
+
+	if err := s.checkSeriesAvailability(series.StoreId, targets, policy, loc); err != nil {
+		return nil, err
+	}
+	if err := s.storeRepository.UpdateStoreAppointmentSeriesOccurrences(id, targets); err != nil {
+		return nil, err
+	}
+	for _, target := range targets {
+		s.notify(target.Id)
+	}
+	return s.storeRepository.GetStoreAppointmentSeries(id)
+}
+
+func (s *service) CancelStoreAppointmentSeries(id string, req CancelStoreAppointmentSeriesRequest, changedBy string) (*StoreAppointmentSeries, error) {
+	series, err := s.storeRepository.GetStoreAppointmentSeries(id)
+	if err != nil {
+		return nil, err
+	}
+
+	targets, _, err := seriesScope(series.Appointments, req.Scope, req.AppointmentId)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(targets))
+	for _, target := range targets {
+		ids = append(ids, target.Id)
+	}
+	if _, err := s.storeRepository.CancelStoreAppointments(ids, changedBy, req.Reason); err != nil {
+		return nil, err
+	}
+	s.notify(ids...)
+
+	for _, target := range targets {
+		if target.Status != AppointmentStatusPending && target.Status != AppointmentStatusConfirmed {
+			continue
+		}
+		if _, err := s.OfferFreedSlot(target); err != nil {
+			log.Println("An error occurred while offering freed slot to the waitlist", err)
+		}
+	}
+	return s.storeRepository.GetStoreAppointmentSeries(id)
+}
+
+func (s *service) CreateStoreService(storeService StoreService) (*StoreService, error) {
+	if err := checkPrice(storeService.Price, storeService.Currency); err != nil {
+		return nil, err
+	}
+	return s.storeRepository.CreateStoreService(storeService)
+}
+
+func (s *service) GetStoreServices(storeId string, activeOnly bool) ([]StoreService, error) {
+	return s.storeRepository.GetStoreServices(storeId, activeOnly)
+}
+
+func (s *service) GetStoreService(storeId string, id string) (*StoreService, error) {
+	storeService, err := s.storeRepository.GetStoreService(id)
+	if err != nil {
+		return nil, err
+	}
+	if storeService.StoreId != storeId {
+		return nil, fmt.Errorf("service %s not found", id)
+	}
+	return storeService, nil
+}
+
+func (s *service) UpdateStoreService(storeId string, id string, storeService StoreService) (*StoreService, error) {
+	if _, err := s.GetStoreService(storeId, id); err != nil {
+		return nil, err
+	}
+	if err := checkPrice(storeService.Price, storeService.Currency); err != nil {
+		return nil, err
+	}
+	storeService.StoreId = storeId
+	return s.storeRepository.UpdateStoreService(id, storeService)
+}
+
+func (s *service) DeleteStoreService(storeId string, id string) error {
+	if _, err := s.GetStoreService(storeId, id); err != nil {
+		return err
+	}
+	return s.storeRepository.DeleteStoreService(id)
+}
+
+func (s *service) CreateStoreResource(resource StoreResource) (*StoreResource, error) {
+	if resource.Availability != "" {
+		if _, err := parseAvailability(resource.Availability); err != nil {
+			return nil, err
+		}
+	}
+	return s.storeRepository.CreateStoreResource(resource)
+}
+
+func (s *service) GetStoreResources(storeId string, activeOnly bool) ([]StoreResource, error) {
+	return s.storeRepository.GetStoreResources(storeId, activeOnly)
+}
+
+func (s *service) GetStoreResource(storeId string, id string) (*StoreResource, error) {
+	resource, err := s.storeRepository.GetStoreResource(id)
+	if err != nil {
+		return nil, err
+	}
+	if resource.StoreId != storeId {
+		return nil, fmt.Errorf("resource %s not found", id)
+	}
+	return resource, nil
+}
+
+func (s *service) UpdateStoreResource(storeId string, id string, resource StoreResource) (*StoreResource, error) {
+	if _, err := s.GetStoreResource(storeId, id); err != nil {
+		return nil, err
+	}
+	if resource.Availability != "" {
+		if _, err := parseAvailability(resource.Availability); err != nil {
+			return nil, err
+		}
+	}
+	resource.StoreId = storeId
+	return s.storeRepository.UpdateStoreResource(id, resource)
+}
+
+func (s *service) DeleteStoreResource(storeId string, id string) error {
+	if _, err := s.GetStoreResource(storeId, id); err != nil {
+		return err
+	}
+	return s.storeRepository.DeleteStoreResource(id)
+}
+
+// bookableResource loads an active resource of the store.
+func (s *service) bookableResource(storeId string, resourceId string) (*StoreResource, error) {
+	resource, err := s.GetStoreResource(storeId, resourceId)
+	if err != nil {
+		return nil, err
+	}
+	if resource.Active != nil && !*resource.Active {
+		return nil, fmt.Errorf("resource %s is not active", resourceId)
+	}
+	return resource, nil
+}
+
+// assignResource checks the requested resource, or when none (or "any") was
+// requested picks the first active resource that works and is free for the
+// whole appointment. Stores without resources leave it unassigned.
+func (s *service) assignResource(appointment *StoreAppointment, loc *time.Location, exceptions []StoreAvailabilityException) error {
+	if appointment.ResourceId != "" && appointment.ResourceId != AnyResource {
+		_, err := s.bookableResource(appointment.StoreId, appointment.ResourceId)
+		return err
+	}
+	appointment.ResourceId = ""
+
+	resources, err := s.storeRepository.GetStoreResources(appointment.StoreId, true)
+	if err != nil || len(resources) == 0 {
+		return err
+	}
+
+	start, err := parseTimeParam(appointment.StartAt, loc)
+	if err != nil {
+		return err
+	}
+	end, err := parseTimeParam(appointment.EndAt, loc)
+	if err != nil {
+		return err
+	}
+	blockedUntil := end.Add(time.Duration(appointment.BufferMinutes) * time.Minute)
+
+	appointments, err := s.busyAppointments(appointment.StoreId, start, blockedUntil)
+	if err != nil {
+		return err
+	}
+
+	for _, resource := range resources {
+		if len(resourceAppointments(appointments, resource.Id)) > 0 {
+			continue
+		}
+
+		var own []StoreAvailabilityException
+		for _, e := range exceptions {
+			if e.ResourceId == resource.Id {
+				own = append(own, e)
+			}
+		}
+		if resource.Availability == "" {
+			if exceptionViolation(own, start, end) != nil {
+				continue
+			}
+		} else {
+			hours, err := parseAvailability(resource.Availability)
+			if err != nil {
+				return err
+			}
+			open, err := applyExceptions(openIntervals(hours, start, end), own, start, end)
+			if err != nil {
+				return err
+			}
+			if !covers(open, start, end) {
+				continue
+			}
+		}
+
+		appointment.ResourceId = resource.Id
+		return nil
+	}
+
+	return errors.New("no professional is available for the requested time")
+}
+
+// appointmentExceptions loads the availability exceptions on the days the
+// appointment takes place.
+func (s *service) appointmentExceptions(appointment StoreAppointment, loc *time.Location) ([]StoreAvailabilityException, error) {
+	start, err := parseTimeParam(appointment.StartAt, loc)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTimeParam(appointment.EndAt, loc)
+	if err != nil {
+		return nil, err
+	}
+	return s.availabilityExceptions(appointment.StoreId, start, end)
+}
+
+// availabilityExceptions loads the availability exceptions from one day to
+// another plus, when the store follows a holiday calendar, a closed exception
+// for each holiday in between.
+func (s *service) availabilityExceptions(storeId string, from time.Time, to time.Time) ([]StoreAvailabilityException, error) {
+	exceptions, err := s.storeRepository.GetStoreAvailabilityExceptions(storeId, from.Format(dateLayout), to.Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+
+	calendar, err := s.storeRepository.GetStoreCalendar(storeId)
+	if err != nil {
+		return nil, err
+	}
+	closed, err := holidayExceptions(calendar, from, to, exceptions)
+	if err != nil {
+		return nil, err
+	}
+	return append(exceptions, closed...), nil
+}
+
+// openingHours loads the weekly hours an appointment with the resource has to
+// fit in: the resource's own, or the store's when it has none.
+func (s *service) openingHours(storeId string, resourceId string) (*openingHours, error) {
+	availability, err := s.storeRepository.GetStoreAvailability(storeId)
+	if err != nil {
+		return nil, err
+	}
+	weekly, err := parseAvailability(availability.Availability)
+	if err != nil {
+		return nil, err
+	}
+	if resourceId == "" {
+		return &openingHours{weekly: weekly}, nil
+	}
+
+	resource, err := s.GetStoreResource(storeId, resourceId)
+	if err != nil {
+		return nil, err
+	}
+	if resource.Availability == "" {
+		return &openingHours{weekly: weekly}, nil
+	}
+	own, err := parseAvailability(resource.Availability)
+	if err != nil {
+		return nil, err
+	}
+	return &openingHours{weekly: own, resource: true}, nil
+}
+
+// checkAvailability rejects an appointment at a time the store, or the
+// resource it is assigned to, doesn't work, naming the rule it breaks.
+func checkAvailability(appointment StoreAppointment, loc *time.Location, hours openingHours, exceptions []StoreAvailabilityException) error {
+	start, err := parseTimeParam(appointment.StartAt, loc)
+	if err != nil {
+		return err
+	}
+	end, err := parseTimeParam(appointment.EndAt, loc)
+	if err != nil {
+		return err
+	}
+	return hoursViolation(hours, exceptionsFor(exceptions, appointment.ResourceId), start, end)
+}
+
+// SeriesAvailabilityError lists every occurrence of a series that can't be
+// booked, each with why.
+type SeriesAvailabilityError struct {
+	Occurrences []SeriesOccurrenceConflict
+}
+
+func (e *SeriesAvailabilityError) Error() string {
+	return fmt.Sprintf("%d occurrences can't be booked", len(e.Occurrences))
+}
+
+// checkSeriesAvailability runs checkAvailability, checkCalendarBusy and, when
+// policy is given, the booking policy on every occurrence. It returns a
+// SeriesAvailabilityError naming all the ones that can't be booked.
+func (s *service) checkSeriesAvailability(storeId string, occurrences []StoreAppointment, policy *StoreBookingPolicy, loc *time.Location) error {
+	if len(occurrences) == 0 {
+		return nil
+	}
+
+	first, err := parseTimeParam(occurrences[0].StartAt, loc)
+	if err != nil {
+		return err
+	}
+	last, err := parseTimeParam(occurrences[len(occurrences)-1].EndAt, loc)
+	if err != nil {
+		return err
+	}
+	if last.Before(first) {
+		first, last = last, first
+	}
+	exceptions, err := s.availabilityExceptions(storeId, first.AddDate(0, 0, -1), last.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+
+	violations, err := s.seriesPolicyViolations(storeId, policy, occurrences, loc)
+	if err != nil {
+		return err
+	}
+
+	var failed []SeriesOccurrenceConflict
+	hoursByResource := map[string]*openingHours{}
+	for idx, occurrence := range occurrences {
+		hours, ok := hoursByResource[occurrence.ResourceId]
+		if !ok {
+			hours, err = s.openingHours(storeId, occurrence.ResourceId)
+			if err != nil {
+				return err
+			}
+			hoursByResource[occurrence.ResourceId] = hours
+		}
+		reason := checkAvailability(occurrence, loc, *hours, exceptions)
+		if reason == nil {
+			var busy *postgres.ConflictError
+			if err := s.checkCalendarBusy(occurrence, loc); errors.As(err, &busy) {
+				reason = busy
+			} else if err != nil {
+				return err
+			}
+		}
+		if reason != nil || len(violations[idx]) > 0 {
+			conflict := SeriesOccurrenceConflict{
+				StartAt: occurrence.StartAt,
+				EndAt:   occurrence.EndAt,
+				Fields:  violations[idx],
+			}
+			if reason != nil {
+				conflict.Error = reason.Error()
+			}
+			failed = append(failed, conflict)
+		}
+	}
+	if len(failed) > 0 {
+		return &SeriesAvailabilityError{Occurrences: failed}
+	}
+	return nil
+}
+
+// seriesPolicyViolations checks every occurrence against the booking policy,
+// returning the rules each one breaks by index. The other occurrences count
+// as booked, in place of where they are saved now when the series moves.
+func (s *service) seriesPolicyViolations(storeId string, policy *StoreBookingPolicy, occurrences []StoreAppointment, loc *time.Location) ([][]app.FieldError, error) {
+	violations := make([][]app.FieldError, len(occurrences))
+	if policy == nil {
+		return violations, nil
+	}
+
+	starts := make([]time.Time, len(occurrences))
+	ends := make([]time.Time, len(occurrences))
+	var from, to time.Time
+	for idx, occurrence := range occurrences {
+		start, err := parseTimeParam(occurrence.StartAt, loc)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseTimeParam(occurrence.EndAt, loc)
+		if err != nil {
+			return nil, err
+		}
+		starts[idx], ends[idx] = start, end
+
+		windowFrom, windowTo := policy.checkWindow(start, end)
+		if idx == 0 || windowFrom.Before(from) {
+			from = windowFrom
+		}
+		if idx == 0 || windowTo.After(to) {
+			to = windowTo
+		}
+	}
+
+	var saved []StoreAppointment
+	if policy.BufferMinutes > 0 || policy.MaxDailyAppointments > 0 {
+		busy, err := s.storeRepository.GetStoreBusyAppointments(storeId, from, to)
+		if err != nil {
+			return nil, err
+		}
+		moving := map[string]bool{}
+		for _, occurrence := range occurrences {
+			moving[occurrence.Id] = occurrence.Id != ""
+		}
+		for _, appointment := range busy {
+			if !moving[appointment.Id] {
+				saved = append(saved, appointment)
+			}
+		}
+	}
+
+	now := time.Now()
+	for idx, occurrence := range occurrences {
+		busy := saved
+		if policy.BufferMinutes > 0 || policy.MaxDailyAppointments > 0 {
+			busy = append(append([]StoreAppointment{}, saved...), occurrences[:idx]...)
+			busy = append(busy, occurrences[idx+1:]...)
+		}
+		fields, err := policyViolations(policy, occurrence, starts[idx], ends[idx], now, busy)
+		if err != nil {
+			return nil, err
+		}
+		violations[idx] = fields
+	}
+	return violations, nil
+}
+
+// checkBookingPolicy rejects an appointment that breaks the store booking
+// policy with a BookingPolicyError.
+func (s *service) checkBookingPolicy(policy *StoreBookingPolicy, appointment StoreAppointment, loc *time.Location) error {
+	start, err := parseTimeParam(appointment.StartAt, loc)
+	if err != nil {
+		return err
+	}
+	end, err := parseTimeParam(appointment.EndAt, loc)
+	if err != nil {
+		return err
+	}
+
+	var busy []StoreAppointment
+	if policy.BufferMinutes > 0 || policy.MaxDailyAppointments > 0 {
+		from, to := policy.checkWindow(start, end)
+		busy, err = s.storeRepository.GetStoreBusyAppointments(appointment.StoreId, from, to)
+		if err != nil {
+			return err
+		}
+	}
+
+	fields, err := policyViolations(policy, appointment, start, end, time.Now(), busy)
+	if err != nil {
+		return err
+	}
+	if len(fields) > 0 {
+		return &BookingPolicyError{Fields: fields}
+	}
+	return nil
+}
+
+// rebooked reports whether an update moves the appointment in time, to
+// another resource, or grows its buffer.
+func rebooked(current StoreAppointment, updated StoreAppointment) bool {
+	return !sameInstant(current.StartAt, updated.StartAt) ||
+		!sameInstant(current.EndAt, updated.EndAt) ||
+		current.ResourceId != updated.ResourceId ||
+		updated.BufferMinutes > current.BufferMinutes
+}
+
+func sameInstant(a string, b string) bool {
+	ta, errA := time.Parse(time.RFC3339Nano, a)
+	tb, errB := time.Parse(time.RFC3339Nano, b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return ta.Equal(tb)
+}
+
+func (s *service) GetStoreBookingPolicy(storeId string) (*StoreBookingPolicy, error) {
+	return s.storeRepository.GetStoreBookingPolicy(storeId)
+}
+
+func (s *service) UpdateStoreBookingPolicy(storeId string, policy StoreBookingPolicy) (*StoreBookingPolicy, error) {
+	return s.storeRepository.UpdateStoreBookingPolicy(storeId, policy)
+}
+
+// storeLocation loads the timezone the store works in.
+func (s *service) storeLocation(storeId string) (*time.Location, error) {
+	calendar, err := s.storeRepository.GetStoreCalendar(storeId)
+	if err != nil {
+		return nil, err
+	}
+	return loadTimezone(calendar.Timezone)
+}
+
+// GetStoreHolidays lists the holidays of the store calendar in the year.
+// They only close the store when it has opted in to the calendar.
+func (s *service) GetStoreHolidays(storeId string, year int) (*GetStoreHolidaysResponse, error) {
+	calendar, err := s.storeRepository.GetStoreCalendar(storeId)
+	if err != nil {
+		return nil, err
+	}
+
+	days, err := holidays.Calendar(year, calendar.HolidayState, calendar.HolidayCity)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GetStoreHolidaysResponse{
+		StoreId:  storeId,
+		Year:     year,
+		Enabled:  calendar.HolidayCalendar,
+		Holidays: days,
+	}, nil
+}
+
+// bookableService loads a service that belongs to the store and is still
+// offered.
+func (s *service) bookableService(storeId string, serviceId string) (*StoreService, error) {
+	storeService, err := s.GetStoreService(storeId, serviceId)
+	if err != nil {
+		return nil, err
+	}
+	if storeService.Active != nil && !*storeService.Active {
+		return nil, fmt.Errorf("service %s is not active", serviceId)
+	}
+	return storeService, nil
+}
+
+// applyService fills the fields the server owns on an appointment from the
+// service it books: end_at, buffer, price and currency. A start_at without an
+// offset is read in the store timezone.
+func applyService(appointment *StoreAppointment, storeService *StoreService, loc *time.Location) error {
+	start, err := parseTimeParam(appointment.StartAt, loc)
+	if err != nil {
+		return err
+	}
+
+	appointment.ServiceId = storeService.Id
+	appointment.StartAt = start.Format(time.RFC3339)
+	appointment.EndAt = start.Add(time.Duration(storeService.DurationMinutes) * time.Minute).Format(time.RFC3339)
+	appointment.BufferMinutes = storeService.BufferMinutes
+	appointment.Price = storeService.Price
+	appointment.Currency = storeService.Currency
+	return nil
+}
+
+// checkPrice refuses negative prices and ones with more decimal places than
+// the currency has, which would be rounded away when stored.
+func checkPrice(price money.Decimal, currency money.Currency) error {
+	if price.Sign() < 0 {
+		return errors.New("price can't be negative")
+	}
+	if price.Round(currency.Digits()).Cmp(price) != 0 {
+		return fmt.Errorf("price can't have more than %d decimal places", currency.Digits())
+	}
+	return nil
+}
+
+func checkPlanPrice(plan StorePlan) error {
+	if plan.Price.IsZero() {
+		return errors.New("price is required")
+	}
+	return checkPrice(plan.Price, plan.Currency)
+}
+
+// seriesScope picks the active occurrences a series edit applies to, ordered
+// by start, along with the occurrence the edit is anchored on.
+func seriesScope(appointments []StoreAppointment, scope string, appointmentId string) ([]StoreAppointment, StoreAppointment, error) {
+	var active []StoreAppointment
+	for _, appointment := range appointments {
+		if canTransition(appointment.Status, AppointmentStatusCanceled) {
+			active = append(active, appointment)
+		}
+	}
+	if len(active) == 0 {
+		return nil, StoreAppointment{}, errors.New("the series has no active occurrences")
+	}
+
+	anchorIdx := -1
+	for idx, appointment := range active {
+		if appointment.Id == appointmentId {
+			anchorIdx = idx
+		}
+	}
+	if anchorIdx == -1 {
+		if appointmentId != "" || scope != SeriesScopeAll {
+			return nil, StoreAppointment{}, errors.New("appointment_id is not an active occurrence of the series")
+		}
+		anchorIdx = 0
+	}
+
+	switch scope {
+	case SeriesScopeThis:
+		return active[anchorIdx : anchorIdx+1], active[anchorIdx], nil
+	case SeriesScopeFollowing:
+		return active[anchorIdx:], active[anchorIdx], nil
+	case SeriesScopeAll:
+		return active, active[anchorIdx], nil
+	}
+	return nil, StoreAppointment{}, fmt.Errorf("invalid scope %q", scope)
+}
+
+// CreateStoreWaitlistEntry puts the customer on the store waitlist for any
+// time between window_start and window_end, read in the store timezone when
+// they carry no offset.
+func (s *service) CreateStoreWaitlistEntry(entry StoreWaitlistEntry) (*StoreWaitlistEntry, error) {
+	loc, err := s.storeLocation(entry.StoreId)
+	if err != nil {
+		return nil, err
+	}
+	start, err := parseTimeParam(entry.WindowStart, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid window_start: %w", err)
+	}
+	end, err := parseTimeParam(entry.WindowEnd, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid window_end: %w", err)
+	}
+	if !end.After(start) {
+		return nil, errors.New("window_end must be after window_start")
+	}
+	if !end.After(time.Now()) {
+		return nil, errors.New("window_end must be in the future")
+	}
+
+	if entry.ServiceId != "" {
+		if _, err := s.bookableService(entry.StoreId, entry.ServiceId); err != nil {
+			return nil, err
+		}
+	}
+
+	entry.WindowStart = start.Format(time.RFC3339)
+	entry.WindowEnd = end.Format(time.RFC3339)
+	entry.Status = WaitlistStatusWaiting
+	return s.storeRepository.CreateStoreWaitlistEntry(entry)
+}
+
+func (s *service) GetStoreWaitlistEntries(storeId string, status string, userId string) ([]StoreWaitlistEntry, error) {
+	return s.storeRepository.GetStoreWaitlistEntries(storeId, status, userId)
+}
+
+func (s *service) GetStoreWaitlistEntry(storeId string, id string) (*StoreWaitlistEntry, error) {
+	entry, err := s.storeRepository.GetStoreWaitlistEntry(id)
+	if err != nil {
+		return nil, err
+	}
+	if entry.StoreId != storeId {
+		return nil, fmt.Errorf("waitlist entry %s not found", id)
+	}
+	return entry, nil
+}
+
+// CancelStoreWaitlistEntry takes the customer off the waitlist, releasing the
+// hold of an open offer.
+func (s *service) CancelStoreWaitlistEntry(storeId string, id string, changedBy string) (*StoreWaitlistEntry, error) {
+	if _, err := s.GetStoreWaitlistEntry(storeId, id); err != nil {
+		return nil, err
+	}
+
+	entry, err := s.storeRepository.CancelStoreWaitlistEntry(id)
+	if err != nil {
+		return nil, err
+	}
+	if entry.AppointmentId != "" {
+		if _, err := s.TransitionStoreAppointment(storeId, entry.AppointmentId, AppointmentStatusCanceled, changedBy, "left the waitlist"); err != nil &&
+			!errors.As(err, new(*TransitionError)) {
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+// AcceptStoreWaitlistOffer confirms the hold the offer placed.
+func (s *service) AcceptStoreWaitlistOffer(storeId string, id string, changedBy string) (*StoreAppointment, error) {
+	entry, err := s.GetStoreWaitlistEntry(storeId, id)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Status != WaitlistStatusOffered {
+		return nil, fmt.Errorf("waitlist entry %s has no open offer", id)
+	}
+	return s.TransitionStoreAppointment(storeId, entry.AppointmentId, AppointmentStatusConfirmed, changedBy, "waitlist offer accepted")
+}
+
+// DeclineStoreWaitlistOffer releases the hold the offer placed, which passes
+// the time on to the next customer waiting.
+func (s *service) DeclineStoreWaitlistOffer(storeId string, id string, changedBy string) (*StoreWaitlistEntry, error) {
+	entry, err := s.GetStoreWaitlistEntry(storeId, id)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Status != WaitlistStatusOffered {
+		return nil, fmt.Errorf("waitlist entry %s has no open offer", id)
+	}
+	if _, err := s.TransitionStoreAppointment(storeId, entry.AppointmentId, AppointmentStatusCanceled, changedBy, "waitlist offer declined"); err != nil {
+		return nil, err
+	}
+	return s.storeRepository.GetStoreWaitlistEntry(id)
+}
+
+// OfferFreedSlot offers the time a canceled appointment held to the first
+// customer waiting for it, as a hold that lapses after the offer TTL. It
+// returns nil when nobody gets an offer.
+func (s *service) OfferFreedSlot(freed StoreAppointment) (*StoreWaitlistEntry, error) {
+	loc, err := s.storeLocation(freed.StoreId)
+	if err != nil {
+		return nil, err
+	}
+	start, err := parseTimeParam(freed.StartAt, loc)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().In(loc)
+	if !start.After(now) {
+		return nil, nil
+	}
+
+	// The hold is priced at what the service costs today, and a service the
+	// store no longer offers isn't offered again.
+	storeService, err := s.bookableService(freed.StoreId, freed.ServiceId)
+	if err != nil {
+		return nil, nil
+	}
+	feePlatform, err := s.platformFee(freed.StoreId, storeService.Price, storeService.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := now.Add(s.offerTTL)
+	if expiresAt.After(start) {
+		expiresAt = start
+	}
+
+	slot := StoreAppointment{
+		StoreId:       freed.StoreId,
+		ServiceId:     freed.ServiceId,
+		ResourceId:    freed.ResourceId,
+		StartAt:       freed.StartAt,
+		EndAt:         freed.EndAt,
+		BufferMinutes: freed.BufferMinutes,
+		Status:        AppointmentStatusPending,
+		HoldExpiresAt: expiresAt.Format(time.RFC3339),
+		Price:         storeService.Price,
+		Currency:      storeService.Currency,
+		FeePlatform:   feePlatform,
+		Notes:         "waitlist offer",
+	}
+	return s.storeRepository.OfferStoreWaitlistSlot(slot, freed.UserId)
+}
+
+// CreateStoreSession schedules a class. A service sets its length, price and
+// currency; without one the class runs until end_at. The class must fit the
+// opening hours of the store, or of its resource.
+func (s *service) CreateStoreSession(session StoreSession) (*StoreSession, error) {
+	loc, err := s.storeLocation(session.StoreId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applySessionSchedule(&session, loc); err != nil {
+		return nil, err
+	}
+
+	session.Status = SessionStatusScheduled
+	return s.storeRepository.CreateStoreSession(session)
+}
+
+// GetStoreSessions lists the classes between from and to, a week from now
+// when left out.
+func (s *service) GetStoreSessions(storeId string, fromParam string, toParam string, status string) ([]StoreSession, error) {
+	loc, err := s.storeLocation(storeId)
+	if err != nil {
+		return nil, err
+	}
+
+	from := time.Now().In(loc)
+	if fromParam != "" {
+		if from, err = parseTimeParam(fromParam, loc); err != nil {
+			return nil, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	to := from.AddDate(0, 0, 7)
+	if toParam != "" {
+		if to, err = parseTimeParam(toParam, loc); err != nil {
+			return nil, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	if !to.After(from) {
+		return nil, errors.New("to must be after from")
+	}
+	if to.Sub(from) > maxSlotRange {
+		return nil, errors.New("the requested range can't be longer than 31 days")
+	}
+
+	return s.storeRepository.GetStoreSessions(storeId, from, to, status)
+}
+
+func (s *service) GetStoreSession(storeId string, id string) (*StoreSession, error) {
+	session, err := s.storeRepository.GetStoreSession(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.StoreId != storeId {
+		return nil, fmt.Errorf("session %s not found", id)
+	}
+	return session, nil
+}
+
+// UpdateStoreSession changes a class that hasn't started. A new time or
+// resource is checked against the opening hours again.
+func (s *service) UpdateStoreSession(storeId string, id string, session StoreSession) (*StoreSession, error) {
+	current, err := s.GetStoreSession(storeId, id)
+	if err != nil {
+		return nil, err
+	}
+	if current.Status != SessionStatusScheduled {
+		return nil, ErrSessionClosed
+	}
+
+	loc, err := s.storeLocation(storeId)
+	if err != nil {
+		return nil, err
+	}
+	session.Id = id
+	session.StoreId = storeId
+	if err := s.applySessionSchedule(&session, loc); err != nil {
+		return nil, err
+	}
+
+	return s.storeRepository.UpdateStoreSession(id, session)
+}
+
+func (s *service) CancelStoreSession(storeId string, id string) (*StoreSession, error) {
+	if _, err := s.GetStoreSession(storeId, id); err != nil {
+		return nil, err
+	}
+	return s.storeRepository.CancelStoreSession(id)
+}
+
+// CreateStoreSessionBooking books the customer into the class, or onto its
+// waitlist when it is full.
+func (s *service) CreateStoreSessionBooking(storeId string, booking StoreSessionBooking) (*StoreSessionBooking, error) {
+	if _, err := s.GetStoreSession(storeId, booking.SessionId); err != nil {
+		return nil, err
+	}
+	return s.storeRepository.CreateStoreSessionBooking(booking)
+}
+
+func (s *service) GetStoreSessionBookings(storeId string, sessionId string, status string) ([]StoreSessionBooking, error) {
+	if _, err := s.GetStoreSession(storeId, sessionId); err != nil {
+		return nil, err
+	}
+	return s.storeRepository.GetStoreSessionBookings(sessionId, status)
+}
+
+func (s *service) CancelStoreSessionBooking(storeId string, sessionId string, id string) (*StoreSessionBooking, error) {
+	if _, err := s.GetStoreSession(storeId, sessionId); err != nil {
+		return nil, err
+	}
+	return s.storeRepository.CancelStoreSessionBooking(sessionId, id)
+}
+
+// MarkStoreSessionAttendance records who came to a class once it started.
+func (s *service) MarkStoreSessionAttendance(storeId string, sessionId string, req MarkSessionAttendanceRequest) ([]StoreSessionBooking, error) {
+	session, err := s.GetStoreSession(storeId, sessionId)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != SessionStatusScheduled {
+		return nil, errors.New("attendance can't be marked for a canceled class")
+	}
+	start, err := time.Parse(time.RFC3339, session.StartAt)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().Before(start) {
+		return nil, errors.New("attendance can only be marked once the class started")
+	}
+
+	return s.storeRepository.MarkStoreSessionAttendance(sessionId, req.Attendance)
+}
+
+// applySessionSchedule fills in the end, price and currency of a class from
+// its service, when it has one, and checks its time and resource.
+func (s *service) applySessionSchedule(session *StoreSession, loc *time.Location) error {
+	start, err := parseTimeParam(session.StartAt, loc)
+	if err != nil {
+		return fmt.Errorf("invalid start_at: %w", err)
+	}
+	if !start.After(time.Now()) {
+		return errors.New("start_at must be in the future")
+	}
+
+	var end time.Time
+	if session.ServiceId != "" {
+		storeService, err := s.bookableService(session.StoreId, session.ServiceId)
+		if err != nil {
+			return err
+		}
+		end = start.Add(time.Duration(storeService.DurationMinutes) * time.Minute)
+		session.Price = storeService.Price
+		session.Currency = storeService.Currency
+	} else {
+		if end, err = parseTimeParam(session.EndAt, loc); err != nil {
+			return fmt.Errorf("invalid end_at: %w", err)
+		}
+		if !end.After(start) {
+			return errors.New("end_at must be after start_at")
+		}
+		if err := checkPrice(session.Price, session.Currency); err != nil {
+			return err
+		}
+	}
+	session.StartAt = start.Format(time.RFC3339)
+	session.EndAt = end.Format(time.RFC3339)
+
+	if session.ResourceId != "" {
+		if _, err := s.bookableResource(session.StoreId, session.ResourceId); err != nil {
+			return err
+		}
+	}
+
+	block := sessionBlock(*session)
+	exceptions, err := s.appointmentExceptions(block, loc)
+	if err != nil {
+		return err
+	}
+	hours, err := s.openingHours(session.StoreId, session.ResourceId)
+	if err != nil {
+		return err
+	}
+	if err := checkAvailability(block, loc, *hours, exceptions); err != nil {
+		return err
+	}
+	return s.checkCalendarBusy(block, loc)
+}
+
+// busyAppointments lists what keeps the store calendars busy between from
+// and to: the live appointments and, as appointments, the scheduled classes.
+func (s *service) busyAppointments(storeId string, from time.Time, to time.Time) ([]StoreAppointment, error) {
+	appointments, err := s.storeRepository.GetStoreBusyAppointments(storeId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := s.storeRepository.GetStoreSessions(storeId, from, to, SessionStatusScheduled)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		appointments = append(appointments, sessionBlock(session))
+	}
+
+	// Imported busy time without a resource blocks every calendar of the
+	// store.
+	blocks, err := s.storeRepository.GetStoreCalendarBusy(storeId, from, to)
+	if err != nil || len(blocks) == 0 {
+		return appointments, err
+	}
+	resources, err := s.storeRepository.GetStoreResources(storeId, true)
+	if err != nil {
+		return nil, err
+	}
+	appointments = append(appointments, blocks...)
+	for _, block := range blocks {
+		if block.ResourceId != "" {
+			continue
+		}
+		for _, resource := range resources {
+			block.ResourceId = resource.Id
+			appointments = append(appointments, block)
+		}
+	}
+	return appointments, nil
+}
+
+// calendarBusyConstraint names the conflict with imported busy time, it is
+// checked here rather than by a constraint since that time comes from
+// outside.
+const calendarBusyConstraint = "calendar_busy"
+
+// checkCalendarBusy rejects an appointment or class at a time the store
+// owner is busy on their connected calendar, or a calendar source of the
+// store or of its resource marks busy.
+func (s *service) checkCalendarBusy(appointment StoreAppointment, loc *time.Location) error {
+	start, err := parseTimeParam(appointment.StartAt, loc)
+	if err != nil {
+		return err
+	}
+	end, err := parseTimeParam(appointment.EndAt, loc)
+	if err != nil {
+		return err
+	}
+	blocks, err := s.storeRepository.GetStoreCalendarBusy(appointment.StoreId, start, end)
+	if err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		if block.ResourceId != "" && block.ResourceId != appointment.ResourceId {
+			continue
+		}
+		return &postgres.ConflictError{
+			Constraint: calendarBusyConstraint,
+			Message:    "the calendar is busy at this time",
+			Conflict:   block,
+		}
+	}
+	return nil
+}
+
+// CreateStoreCalendarFeed issues the token of the store calendar feed,
+// revoking the previous one.
+func (s *service) CreateStoreCalendarFeed(storeId string) (*CalendarFeed, error) {
+	if _, err := s.storeRepository.GetStoreCalendar(storeId); err != nil {
+		return nil, err
+	}
+	token, hash, err := newCalendarFeedToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storeRepository.CreateCalendarFeed(storeId, "", hash); err != nil {
+		return nil, err
+	}
+	return &CalendarFeed{
+		Token: token,
+		Path:  fmt.Sprintf("/api/v1/stores/%s/calendar.ics?token=%s", storeId, token),
+	}, nil
+}
+
+// CreateUserCalendarFeed issues the token of the customer calendar feed,
+// revoking the previous one.
+func (s *service) CreateUserCalendarFeed(userId string) (*CalendarFeed, error) {
+	token, hash, err := newCalendarFeedToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storeRepository.CreateCalendarFeed("", userId, hash); err != nil {
+		return nil, err
+	}
+	return &CalendarFeed{
+		Token: token,
+		Path:  fmt.Sprintf("/api/v1/users/%s/calendar.ics?token=%s", userId, token),
+	}, nil
+}
+
+func (s *service) RevokeStoreCalendarFeed(storeId string) error {
+	return s.storeRepository.RevokeCalendarFeed(storeId, "")
+}
+
+func (s *service) RevokeUserCalendarFeed(userId string) error {
+	return s.storeRepository.RevokeCalendarFeed("", userId)
+}
+
+// GetStoreCalendarFeed renders the store appointments as an iCalendar feed.
+// It fails with ErrCalendarFeedNotFound unless the token is the store's.
+func (s *service) GetStoreCalendarFeed(storeId string, token string) ([]byte, error) {
+	if err := s.checkCalendarFeed(storeId, "", token); err != nil {
+		return nil, err
+	}
+	calendar, err := s.storeRepository.GetStoreCalendar(storeId)
+	if err != nil {
+		return nil, err
+	}
+	appointments, err := s.storeRepository.GetStoreCalendarAppointments(storeId, time.Now().Add(-calendarFeedSince))
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]icsEvent, 0, len(appointments))
+	for _, a := range appointments {
+		events = append(events, appointmentEvent(a, joinSummary(a.ServiceName, a.CustomerName), a.Notes))
+	}
+	return renderCalendar(calendar.Name, events), nil
+}
+
+// GetUserCalendarFeed renders the customer bookings, at every store, as an
+// iCalendar feed. It fails with ErrCalendarFeedNotFound unless the token is
+// the customer's.
+func (s *service) GetUserCalendarFeed(userId string, token string) ([]byte, error) {
+	if err := s.checkCalendarFeed("", userId, token); err != nil {
+		return nil, err
+	}
+	appointments, err := s.storeRepository.GetUserCalendarAppointments(userId, time.Now().Add(-calendarFeedSince))
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]icsEvent, 0, len(appointments))
+	for _, a := range appointments {
+		events = append(events, appointmentEvent(a, joinSummary(a.ServiceName, a.StoreName), ""))
+	}
+	return renderCalendar("Genda", events), nil
+}
+
+func (s *service) checkCalendarFeed(storeId string, userId string, token string) error {
+	if token == "" {
+		return ErrCalendarFeedNotFound
+	}
+	exists, err := s.storeRepository.CalendarFeedExists(storeId, userId, calendarFeedTokenHash(token))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrCalendarFeedNotFound
+	}
+	return nil
+}
+
+// joinSummary names an event after the service and who, or where, it is
+// with, leaving out whichever is unknown.
+func joinSummary(service string, with string) string {
+	switch {
+	case service == "":
+		return with
+	case with == "":
+		return service
+	}
+	return service + " - " + with
+}
+
+// CreateStoreCalendarSource adds an iCalendar file the store takes busy time
+// from. The file is read right away, one that can't be fetched or parsed is
+// rejected.
+func (s *service) CreateStoreCalendarSource(storeId string, source StoreCalendarSource) (*StoreCalendarSource, error) {
+	loc, err := s.storeLocation(storeId)
+	if err != nil {
+		return nil, err
+	}
+	if source.ResourceId != "" {
+		if _, err := s.bookableResource(storeId, source.ResourceId); err != nil {
+			return nil, err
+		}
+	}
+	if source.Url != "" {
+		if source.Url, err = calendarSourceURL(source.Url); err != nil {
+			return nil, err
+		}
+		if source.Content, err = fetchCalendarSource(source.Url); err != nil {
+			return nil, err
+		}
+	}
+	if len(source.Content) > maxCalendarSourceSize {
+		return nil, fmt.Errorf("the calendar is larger than %d MB", maxCalendarSourceSize>>20)
+	}
+	imported, err := readCalendarSource(source.Content, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetched sources are read again on every refresh, only uploads are kept.
+	if source.Url != "" {
+		source.Content = ""
+	}
+	source.StoreId = storeId
+	created, err := s.storeRepository.CreateStoreCalendarSource(source)
+	if err != nil {
+		return nil, err
+	}
+	return s.storeRepository.ReplaceStoreCalendarSourceBlocks(created.Id, imported.Blocks, importNote(imported))
+}
+
+func (s *service) GetStoreCalendarSources(storeId string) ([]StoreCalendarSource, error) {
+	return s.storeRepository.GetStoreCalendarSources(storeId)
+}
+
+func (s *service) GetStoreCalendarSource(storeId string, id string) (*StoreCalendarSource, error) {
+	source, err := s.storeRepository.GetStoreCalendarSource(id)
+	if err != nil {
+		return nil, err
+	}
+	if source.StoreId != storeId {
+		return nil, fmt.Errorf("calendar source %s not found", id)
+	}
+	return source, nil
+}
+
+// UploadStoreCalendarSource replaces the file of an uploaded calendar source
+// and reads its busy time again.
+func (s *service) UploadStoreCalendarSource(storeId string, id string, content string) (*StoreCalendarSource, error) {
+	source, err := s.GetStoreCalendarSource(storeId, id)
+	if err != nil {
+		return nil, err
+	}
+	if source.Url != "" {
+		return nil, errors.New("the calendar source is fetched from its url, it can't be uploaded")
+	}
+	if len(content) > maxCalendarSourceSize {
+		return nil, fmt.Errorf("the calendar is larger than %d MB", maxCalendarSourceSize>>20)
+	}
+	loc, err := s.storeLocation(storeId)
+	if err != nil {
+		return nil, err
+	}
+	imported, err := readCalendarSource(content, loc)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storeRepository.UpdateStoreCalendarSourceContent(id, content); err != nil {
+		return nil, err
+	}
+	return s.storeRepository.ReplaceStoreCalendarSourceBlocks(id, imported.Blocks, importNote(imported))
+}
+
+// RefreshStoreCalendarSource reads the busy time of a calendar source again,
+// fetching it when it has a URL. Uploads are read again too, so their
+// recurring events keep covering the import window. A source that can't be
+// read keeps its previous busy time and records why.
+func (s *service) RefreshStoreCalendarSource(storeId string, id string) (*StoreCalendarSource, error) {
+	source, err := s.GetStoreCalendarSource(storeId, id)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := s.storeLocation(storeId)
+	if err != nil {
+		return nil, err
+	}
+
+	var content string
+	if source.Url != "" {
+		content, err = fetchCalendarSource(source.Url)
+	} else {
+		content, err = s.storeRepository.GetStoreCalendarSourceContent(id)
+	}
+	var imported *calendarImport
+	if err == nil {
+		imported, err = readCalendarSource(content, loc)
+	}
+	if err != nil {
+		if markErr := s.storeRepository.MarkStoreCalendarSourceFailed(id, err.Error()); markErr != nil {
+			return nil, markErr
+		}
+		return nil, err
+	}
+	return s.storeRepository.ReplaceStoreCalendarSourceBlocks(id, imported.Blocks, importNote(imported))
+}
+
+func (s *service) DeleteStoreCalendarSource(storeId string, id string) error {
+	if _, err := s.GetStoreCalendarSource(storeId, id); err != nil {
+		return err
+	}
+	return s.storeRepository.DeleteStoreCalendarSource(id)
+}
+
+// readCalendarSource reads the busy time of a calendar source from now
+// through the import window.
+func readCalendarSource(content string, loc *time.Location) (*calendarImport, error) {
+	from := time.Now().In(loc).Truncate(time.Minute)
+	return parseBusyCalendar(content, loc, from, from.Add(calendarImportWindow))
+}
+
+// importNote tells the store about the events a refresh left out.
+func importNote(imported *calendarImport) string {
+	if imported.Skipped == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d recurring events use rules that can't be read and were left out", imported.Skipped)
 }
@@ -0,0 +1,217 @@
+package stores
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/genda/genda-api/pkg/money"
+)
+
+const testStore = "store-1"
+
+// stubRepository answers the reads the booking paths make from its fields.
+// The embedded Repository is nil, a call the test didn't plan for panics.
+type stubRepository struct {
+	Repository
+	calendar     StoreCalendar
+	availability string
+	policy       StoreBookingPolicy
+	services     map[string]StoreService
+	resources    []StoreResource
+	appointments []StoreAppointment
+	calendarBusy []StoreAppointment
+	exceptions   []StoreAvailabilityException
+}
+
+func newStubRepository(timezone string, availability string) *stubRepository {
+	return &stubRepository{
+		calendar:     StoreCalendar{Name: "Store", Timezone: timezone},
+		availability: availability,
+		services:     map[string]StoreService{},
+	}
+}
+
+func newTestService(r Repository) *service {
+	return &service{storeRepository: r, holdTTL: 10 * time.Minute, offerTTL: time.Hour}
+}
+
+func (r *stubRepository) GetStoreCalendar(string) (*StoreCalendar, error) {
+	calendar := r.calendar
+	return &calendar, nil
+}
+
+func (r *stubRepository) GetStoreAvailability(storeId string) (*StoreAvailability, error) {
+	return &StoreAvailability{StoreId: storeId, Availability: r.availability}, nil
+}
+
+func (r *stubRepository) GetStoreBookingPolicy(storeId string) (*StoreBookingPolicy, error) {
+	policy := r.policy
+	policy.StoreId = storeId
+	return &policy, nil
+}
+
+func (r *stubRepository) GetStoreService(id string) (*StoreService, error) {
+	storeService, ok := r.services[id]
+	if !ok {
+		return nil, fmt.Errorf("service %s not found", id)
+	}
+	return &storeService, nil
+}
+
+func (r *stubRepository) GetStoreResources(string, bool) ([]StoreResource, error) {
+	return r.resources, nil
+}
+
+func (r *stubRepository) GetStoreResource(id string) (*StoreResource, error) {
+	for _, resource := range r.resources {
+		if resource.Id == id {
+			return &resource, nil
+		}
+	}
+	return nil, fmt.Errorf("resource %s not found", id)
+}
+
+func (r *stubRepository) GetStoreBusyAppointments(storeId string, from time.Time, to time.Time) ([]StoreAppointment, error) {
+	return overlapping(r.appointments, from, to), nil
+}
+
+func (r *stubRepository) GetStoreCalendarBusy(storeId string, from time.Time, to time.Time) ([]StoreAppointment, error) {
+	return overlapping(r.calendarBusy, from, to), nil
+}
+
+func (r *stubRepository) GetStoreSessions(string, time.Time, time.Time, string) ([]StoreSession, error) {
+	return nil, nil
+}
+
+func (r *stubRepository) GetStoreAvailabilityExceptions(string, string, string) ([]StoreAvailabilityException, error) {
+	return r.exceptions, nil
+}
+
+// overlapping keeps the appointments sharing time with [from, to), copied so
+// the service can change them.
+func overlapping(appointments []StoreAppointment, from time.Time, to time.Time) []StoreAppointment {
+	kept := []StoreAppointment{}
+	for _, a := range appointments {
+		start, _ := time.Parse(time.RFC3339, a.StartAt)
+		end, _ := time.Parse(time.RFC3339, a.EndAt)
+		if start.Before(to) && end.After(from) {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+// weekly is the availability JSON for the same hours on each of days.
+func weekly(openTime string, closeTime string, days ...string) string {
+	json := "["
+	for i, day := range days {
+		if i > 0 {
+			json += ","
+		}
+		json += fmt.Sprintf(`{"day_of_week":%q,"open_time":%q,"close_time":%q}`, day, openTime, closeTime)
+	}
+	return json + "]"
+}
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func (r *stubRepository) GetStoreAppointment(id string) (*StoreAppointment, error) {
+	for _, a := range r.appointments {
+		if a.Id == id {
+			return &a, nil
+		}
+	}
+	return nil, fmt.Errorf("appointment %s not found", id)
+}
+
+func TestTransitionStoreAppointmentOtherStore(t *testing.T) {
+	r := newStubRepository("America/Sao_Paulo", weekly("09:00", "18:00"))
+	r.appointments = []StoreAppointment{{Id: "a1", StoreId: "store-2", Status: AppointmentStatusConfirmed}}
+	s := newTestService(r)
+
+	// The stub has no TransitionStoreAppointment, reaching it would panic.
+	if _, err := s.TransitionStoreAppointment(testStore, "a1", AppointmentStatusCanceled, "user-1", ""); err == nil {
+		t.Error("canceled the appointment of another store")
+	}
+}
+
+func TestUpdateStoreAppointmentRejects(t *testing.T) {
+	r := newStubRepository("America/Sao_Paulo", weekly("09:00", "18:00"))
+	r.appointments = []StoreAppointment{
+		{Id: "a1", StoreId: testStore, Status: AppointmentStatusConfirmed, StartAt: "2026-03-02T10:00:00-03:00", EndAt: "2026-03-02T11:00:00-03:00"},
+		{Id: "a2", StoreId: testStore, Status: AppointmentStatusCanceled, StartAt: "2026-03-02T13:00:00-03:00", EndAt: "2026-03-02T14:00:00-03:00"},
+	}
+	s := newTestService(r)
+
+	// The stub has no UpdateStoreAppointment, reaching it would panic.
+	for _, tc := range []struct {
+		name        string
+		appointment StoreAppointment
+		id          string
+	}{
+		{"moved start", StoreAppointment{StartAt: "2026-03-02T12:00:00-03:00"}, "a1"},
+		{"moved start in store time", StoreAppointment{StartAt: "2026-03-02T10:30:00"}, "a1"},
+		{"canceled appointment", StoreAppointment{StartAt: "2026-03-02T13:00:00-03:00"}, "a2"},
+	} {
+		if _, err := s.UpdateStoreAppointment(tc.id, tc.appointment); err == nil {
+			t.Errorf("%s: updated the appointment", tc.name)
+		}
+	}
+}
+
+// deleteRepository records the appointments deleted and the slots offered to
+// the waitlist.
+type deleteRepository struct {
+	*stubRepository
+	deleted []string
+	offered []StoreAppointment
+}
+
+func (r *deleteRepository) DeleteStoreAppointment(id string) error {
+	r.deleted = append(r.deleted, id)
+	return nil
+}
+
+func (r *deleteRepository) GetStorePlatformFeePct(string) (money.Decimal, error) {
+	return money.MustParseDecimal("8.00"), nil
+}
+
+func (r *deleteRepository) OfferStoreWaitlistSlot(slot StoreAppointment, freedBy string) (*StoreWaitlistEntry, error) {
+	r.offered = append(r.offered, slot)
+	return nil, nil
+}
+
+func TestDeleteStoreAppointmentOffersFreedSlot(t *testing.T) {
+	start := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Hour)
+	at := func(d time.Duration) string { return start.Add(d).Format(time.RFC3339) }
+
+	stub := newStubRepository("America/Sao_Paulo", weekly("00:00", "23:59"))
+	stub.services["haircut"] = StoreService{Id: "haircut", StoreId: testStore, DurationMinutes: 60, Price: money.MustParseDecimal("50.00"), Currency: "BRL"}
+	stub.appointments = []StoreAppointment{
+		{Id: "a1", StoreId: testStore, ServiceId: "haircut", Status: AppointmentStatusConfirmed, StartAt: at(0), EndAt: at(time.Hour)},
+		{Id: "a2", StoreId: testStore, ServiceId: "haircut", Status: AppointmentStatusCanceled, StartAt: at(2 * time.Hour), EndAt: at(3 * time.Hour)},
+	}
+	r := &deleteRepository{stubRepository: stub}
+	s := newTestService(r)
+
+	for _, id := range []string{"a1", "a2"} {
+		if err := s.DeleteStoreAppointment(id); err != nil {
+			t.Fatalf("DeleteStoreAppointment(%s): %v", id, err)
+		}
+	}
+	if len(r.deleted) != 2 {
+		t.Errorf("deleted %v, want a1 and a2", r.deleted)
+	}
+	// The canceled appointment had already given its time back.
+	if len(r.offered) != 1 || r.offered[0].StartAt != at(0) {
+		t.Errorf("offered %+v, want only the time of a1", r.offered)
+	}
+}
@@ -0,0 +1,33 @@
+package stores
+
+import "errors"
+
+// ErrSessionClosed is returned when booking or canceling a spot in a class
+// that was canceled or already started.
+var ErrSessionClosed = errors.New("the class was canceled or already started")
+
+// ErrSessionBookingClosed is returned when canceling a class booking that is
+// no longer booked or waitlisted.
+var ErrSessionBookingClosed = errors.New("the class booking is no longer booked or waitlisted")
+
+// The constraints that keep classes and one-to-one appointments from taking
+// the same calendar at once, see migration 000021.
+const (
+	sessionOverlapConstraint     = "no_session_overlap_per_resource"
+	sessionAppointmentConstraint = "no_overlap_with_appointments"
+	appointmentSessionConstraint = "no_overlap_with_sessions"
+)
+
+// sessionBlock is the time a class takes on its calendar, as an appointment,
+// so the hours checks and the slot search treat both the same way.
+func sessionBlock(session StoreSession) StoreAppointment {
+	return StoreAppointment{
+		Id:         session.Id,
+		StoreId:    session.StoreId,
+		ServiceId:  session.ServiceId,
+		ResourceId: session.ResourceId,
+		StartAt:    session.StartAt,
+		EndAt:      session.EndAt,
+		Status:     AppointmentStatusConfirmed,
+	}
+}
@@ -0,0 +1,337 @@
+package stores
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSlotRange caps how far a single slot search may look, so a bad query
+// can't make us expand months of availability in one request.
+const maxSlotRange = 31 * 24 * time.Hour
+
+// weekdays maps the day_of_week spellings accepted in the availability JSON.
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"sun":       time.Sunday,
+	"0":         time.Sunday,
+	"monday":    time.Monday,
+	"mon":       time.Monday,
+	"1":         time.Monday,
+	"tuesday":   time.Tuesday,
+	"tue":       time.Tuesday,
+	"2":         time.Tuesday,
+	"wednesday": time.Wednesday,
+	"wed":       time.Wednesday,
+	"3":         time.Wednesday,
+	"thursday":  time.Thursday,
+	"thu":       time.Thursday,
+	"4":         time.Thursday,
+	"friday":    time.Friday,
+	"fri":       time.Friday,
+	"5":         time.Friday,
+	"saturday":  time.Saturday,
+	"sat":       time.Saturday,
+	"6":         time.Saturday,
+}
+
+// interval is a half-open [start, end) range of time.
+type interval struct {
+	start time.Time
+	end   time.Time
+}
+
+// parseAvailability decodes the weekly availability stored as JSON in
+// store_availability into its typed form.
+func parseAvailability(raw string) ([]Availability, error) {
+	var availability []Availability
+	if err := json.Unmarshal([]byte(raw), &availability); err != nil {
+		return nil, fmt.Errorf("invalid availability json: %w", err)
+	}
+
+	for _, a := range availability {
+		if _, err := parseWeekday(a.DayOfWeek); err != nil {
+			return nil, err
+		}
+		if _, err := parseClock(a.OpenTime); err != nil {
+			return nil, err
+		}
+		if _, err := parseClock(a.CloseTime); err != nil {
+			return nil, err
+		}
+	}
+
+	return availability, nil
+}
+
+func parseWeekday(day string) (time.Weekday, error) {
+	weekday, ok := weekdays[strings.ToLower(strings.TrimSpace(day))]
+	if !ok {
+		return 0, fmt.Errorf("invalid day_of_week %q", day)
+	}
+	return weekday, nil
+}
+
+// parseClock parses a wall clock time such as "09:00" or "18:30:00" into the
+// offset from midnight. "24:00" is accepted as the end of the day.
+func parseClock(clock string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(clock), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+
+	var values [3]int
+	for idx, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+		}
+		values[idx] = v
+	}
+
+	hours, minutes, seconds := values[0], values[1], values[2]
+	if minutes > 59 || seconds > 59 || hours > 24 || (hours == 24 && (minutes > 0 || seconds > 0)) {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second, nil
+}
+
+// parseTimeParam accepts RFC 3339 timestamps as well as plain dates and
+// local date-times, which are read in loc. The result is always in loc.
+func parseTimeParam(value string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("value is required")
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t.In(loc), nil
+	}
+	layouts := []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339 or YYYY-MM-DD", value)
+}
+
+// openIntervals expands the weekly availability into concrete open intervals
+// between from and to, on the wall clock of from's location. A close time at
+// or before the open time is read as closing on the following day.
+func openIntervals(availability []Availability, from time.Time, to time.Time) []interval {
+	var open []interval
+
+	// Start one day early so overnight openings from the previous day are included.
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location()).AddDate(0, 0, -1)
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		for _, a := range availability {
+			weekday, err := parseWeekday(a.DayOfWeek)
+			if err != nil || weekday != day.Weekday() {
+				continue
+			}
+
+			openAt, err := parseClock(a.OpenTime)
+			if err != nil {
+				continue
+			}
+			closeAt, err := parseClock(a.CloseTime)
+			if err != nil {
+				continue
+			}
+			if closeAt <= openAt {
+				closeAt += 24 * time.Hour
+			}
+
+			start := atClock(day, openAt)
+			end := atClock(day, closeAt)
+			if start.Before(from) {
+				start = from
+			}
+			if end.After(to) {
+				end = to
+			}
+			if start.Before(end) {
+				open = append(open, interval{start, end})
+			}
+		}
+	}
+
+	return mergeIntervals(open)
+}
+
+// atClock is the instant the wall clock shows offset past midnight of day,
+// which is not day.Add(offset) on days with a daylight saving change.
+func atClock(day time.Time, offset time.Duration) time.Time {
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	return fromWallClock(midnight.Add(offset), day.Location())
+}
+
+// mergeIntervals sorts the intervals and joins the ones that touch or overlap.
+func mergeIntervals(intervals []interval) []interval {
+	if len(intervals) == 0 {
+		return intervals
+	}
+
+	sort.Slice(intervals, func(a, b int) bool {
+		return intervals[a].start.Before(intervals[b].start)
+	})
+
+	merged := []interval{intervals[0]}
+	for _, current := range intervals[1:] {
+		last := &merged[len(merged)-1]
+		if !current.start.After(last.end) {
+			if current.end.After(last.end) {
+				last.end = current.end
+			}
+			continue
+		}
+		merged = append(merged, current)
+	}
+
+	return merged
+}
+
+// subtractIntervals removes every busy interval from the open ones.
+func subtractIntervals(open []interval, busy []interval) []interval {
+	busy = mergeIntervals(busy)
+
+	var free []interval
+	for _, o := range open {
+		start := o.start
+		for _, b := range busy {
+			if !b.end.After(start) || !b.start.Before(o.end) {
+				continue
+			}
+			if b.start.After(start) {
+				free = append(free, interval{start, b.start})
+			}
+			if b.end.After(start) {
+				start = b.end
+			}
+		}
+		if start.Before(o.end) {
+			free = append(free, interval{start, o.end})
+		}
+	}
+
+	return free
+}
+
+// appointmentIntervals converts the stored appointments into busy intervals,
+// including the buffer kept free after each of them.
+func appointmentIntervals(appointments []StoreAppointment, loc *time.Location) ([]interval, error) {
+	busy := make([]interval, 0, len(appointments))
+	for _, a := range appointments {
+		start, err := parseTimeParam(a.StartAt, loc)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseTimeParam(a.EndAt, loc)
+		if err != nil {
+			return nil, err
+		}
+		busy = append(busy, interval{start, end.Add(time.Duration(a.BufferMinutes) * time.Minute)})
+	}
+	return busy, nil
+}
+
+// resourceHours returns the weekly hours a resource works, falling back to
+// the store hours when it has none of its own.
+func resourceHours(resource StoreResource, storeHours []Availability) ([]Availability, error) {
+	if resource.Availability == "" {
+		return storeHours, nil
+	}
+	return parseAvailability(resource.Availability)
+}
+
+// resourceAppointments keeps the appointments assigned to the resource; an
+// empty resourceId keeps the unassigned ones.
+func resourceAppointments(appointments []StoreAppointment, resourceId string) []StoreAppointment {
+	var kept []StoreAppointment
+	for _, a := range appointments {
+		if a.ResourceId == resourceId {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+// covers reports whether a single interval holds the whole [start, end) range.
+func covers(intervals []interval, start time.Time, end time.Time) bool {
+	for _, i := range intervals {
+		if !i.start.After(start) && !i.end.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlaps reports whether any interval shares time with the [start, end) range.
+func overlaps(intervals []interval, start time.Time, end time.Time) bool {
+	for _, i := range intervals {
+		if i.start.Before(end) && i.end.After(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeResourceSlots joins the slots of several resources into one list
+// ordered by start, where each slot names every resource free for it.
+func mergeResourceSlots(resources []StoreResource, slotsByResource map[string][]Slot) []Slot {
+	index := map[string]int{}
+	merged := []Slot{}
+	for _, resource := range resources {
+		for _, slot := range slotsByResource[resource.Id] {
+			key := slot.StartAt + "/" + slot.EndAt
+			idx, ok := index[key]
+			if !ok {
+				idx = len(merged)
+				index[key] = idx
+				merged = append(merged, Slot{StartAt: slot.StartAt, EndAt: slot.EndAt})
+			}
+			merged[idx].ResourceIds = append(merged[idx].ResourceIds, resource.Id)
+		}
+	}
+
+	sort.SliceStable(merged, func(a, b int) bool {
+		startA, _ := time.Parse(time.RFC3339, merged[a].StartAt)
+		startB, _ := time.Parse(time.RFC3339, merged[b].StartAt)
+		return startA.Before(startB)
+	})
+	return merged
+}
+
+// freeIntervals is the time between from and to inside the weekly hours, as
+// changed by the exceptions, that no appointment is using.
+func freeIntervals(hours []Availability, exceptions []StoreAvailabilityException, appointments []StoreAppointment, from time.Time, to time.Time) ([]interval, error) {
+	open, err := applyExceptions(openIntervals(hours, from, to), exceptions, from, to)
+	if err != nil {
+		return nil, err
+	}
+	busy, err := appointmentIntervals(appointments, from.Location())
+	if err != nil {
+		return nil, err
+	}
+	return subtractIntervals(open, busy), nil
+}
+
+// buildSlots cuts the free intervals into slots of the given duration, each
+// followed by its buffer, dropping any remainder that is too short to book.
+func buildSlots(free []interval, duration time.Duration, buffer time.Duration) []Slot {
+	slots := []Slot{}
+	for _, f := range free {
+		for start := f.start; !start.Add(duration + buffer).After(f.end); start = start.Add(duration + buffer) {
+			slots = append(slots, Slot{
+				StartAt: start.Format(time.RFC3339),
+				EndAt:   start.Add(duration).Format(time.RFC3339),
+			})
+		}
+	}
+	return slots
+}
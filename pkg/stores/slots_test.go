@@ -0,0 +1,310 @@
+package stores
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetStoreSlots(t *testing.T) {
+	active := true
+	twoChairs := []StoreResource{
+		{Id: "chair-1", StoreId: testStore, Name: "Chair 1", Active: &active},
+		{Id: "chair-2", StoreId: testStore, Name: "Chair 2", Active: &active},
+	}
+	haircut := StoreService{Id: "haircut", StoreId: testStore, Name: "Haircut", DurationMinutes: 60, BufferMinutes: 15, Active: &active}
+
+	tests := []struct {
+		name         string
+		timezone     string
+		availability string
+		from         string
+		to           string
+		duration     time.Duration
+		serviceId    string
+		resourceId   string
+		policy       StoreBookingPolicy
+		resources    []StoreResource
+		appointments []StoreAppointment
+		calendarBusy []StoreAppointment
+		exceptions   []StoreAvailabilityException
+		want         []string
+	}{
+		{
+			name:         "hours cut into slots",
+			availability: weekly("09:00", "12:00", "monday"),
+			from:         "2026-03-02",
+			to:           "2026-03-03",
+			duration:     time.Hour,
+			want:         []string{"2026-03-02T09:00:00-03:00", "2026-03-02T10:00:00-03:00", "2026-03-02T11:00:00-03:00"},
+		},
+		{
+			name:         "last slot ends by closing time",
+			availability: weekly("09:00", "11:30", "monday"),
+			from:         "2026-03-02",
+			to:           "2026-03-03",
+			duration:     time.Hour,
+			want:         []string{"2026-03-02T09:00:00-03:00", "2026-03-02T10:00:00-03:00"},
+		},
+		{
+			name:         "closed days have no slots",
+			availability: weekly("09:00", "12:00", "tuesday"),
+			from:         "2026-03-02",
+			to:           "2026-03-03",
+			duration:     time.Hour,
+			want:         []string{},
+		},
+		{
+			name:         "search range clips the hours",
+			availability: weekly("09:00", "12:00", "monday"),
+			from:         "2026-03-02T10:00",
+			to:           "2026-03-02T11:30",
+			duration:     30 * time.Minute,
+			want:         []string{"2026-03-02T10:00:00-03:00", "2026-03-02T10:30:00-03:00", "2026-03-02T11:00:00-03:00"},
+		},
+		{
+			name:         "service buffer follows each slot",
+			availability: weekly("09:00", "12:00", "monday"),
+			from:         "2026-03-02",
+			to:           "2026-03-03",
+			serviceId:    "haircut",
+			want:         []string{"2026-03-02T09:00:00-03:00", "2026-03-02T10:15:00-03:00"},
+		},
+		{
+			name:         "store buffer longer than the service one wins",
+			availability: weekly("09:00", "13:00", "monday"),
+			from:         "2026-03-02",
+			to:           "2026-03-03",
+			serviceId:    "haircut",
+			policy:       StoreBookingPolicy{BufferMinutes: 30},
+			want:         []string{"2026-03-02T09:00:00-03:00", "2026-03-02T10:30:00-03:00"},
+		},
+		{
+			name:         "booked time and its buffer are busy",
+			availability: weekly("09:00", "13:00", "monday"),
+			from:         "2026-03-02",
+			to:           "2026-03-03",
+			duration:     time.Hour,
+			appointments: []StoreAppointment{
+				{Id: "a1", StoreId: testStore, StartAt: "2026-03-02T10:00:00-03:00", EndAt: "2026-03-02T11:00:00-03:00", BufferMinutes: 15},
+			},
+			want: []string{"2026-03-02T09:00:00-03:00", "2026-03-02T11:15:00-03:00"},
+		},
+		{
+			name:         "store buffer applies to booked appointments",
+			availability: weekly("09:00", "13:00", "monday"),
+			from:         "2026-03-02",
+			to:           "2026-03-03",
+			duration:     time.Hour,
+			policy:       StoreBookingPolicy{BufferMinutes: 30},
+			appointments: []StoreAppointment{
+				{Id: "a1", StoreId: testStore, StartAt: "2026-03-02T10:00:00-03:00", EndAt: "2026-03-02T11:00:00-03:00"},
+			},
+			want: []string{"2026-03-02T11:30:00-03:00"},
+		},
+		{
+			name:         "buffer of an appointment before the range",
+			availability: weekly("09:00", "12:00", "monday"),
+			from:         "2026-03-02T10:00",
+			to:           "2026-03-02T12:00",
+			duration:     time.Hour,
+			policy:       StoreBookingPolicy{BufferMinutes: 15},
+			appointments: []StoreAppointment{
+				{Id: "a1", StoreId: testStore, StartAt: "2026-03-02T09:00:00-03:00", EndAt: "2026-03-02T09:50:00-03:00"},
+			},
+			want: []string{"2026-03-02T10:05:00-03:00"},
+		},
+		{
+			name:         "calendar busy time blocks the store",
+			availability: weekly("09:00", "12:00", "monday"),
+			from:         "2026-03-02",
+			to:           "2026-03-03",
+			duration:     time.Hour,
+			calendarBusy: []StoreAppointment{
+				{StoreId: testStore, StartAt: "2026-03-02T09:30:00-03:00", EndAt: "2026-03-02T10:30:00-03:00"},
+			},
+			want: []string{"2026-03-02T10:30:00-03:00"},
+		},
+		{
+			name:         "closed exception",
+			availability: weekly("09:00", "12:00", "monday", "tuesday"),
+			from:         "2026-03-02",
+			to:           "2026-03-04",
+			duration:     time.Hour,
+			exceptions: []StoreAvailabilityException{
+				{StoreId: testStore, Kind: ExceptionKindClosed, StartDate: "2026-03-02", EndDate: "2026-03-02"},
+			},
+			want: []string{"2026-03-03T09:00:00-03:00", "2026-03-03T10:00:00-03:00", "2026-03-03T11:00:00-03:00"},
+		},
+		{
+			name:         "hours exception replaces the day",
+			availability: weekly("09:00", "12:00", "monday"),
+			from:         "2026-03-02",
+			to:           "2026-03-03",
+			duration:     time.Hour,
+			exceptions: []StoreAvailabilityException{
+				{StoreId: testStore, Kind: ExceptionKindHours, StartDate: "2026-03-02", EndDate: "2026-03-02", OpenTime: "14:00", CloseTime: "16:00"},
+			},
+			want: []string{"2026-03-02T14:00:00-03:00", "2026-03-02T15:00:00-03:00"},
+		},
+		{
+			name:         "overnight hours from the day before",
+			availability: weekly("22:00", "02:00", "friday"),
+			from:         "2026-03-07",
+			to:           "2026-03-08",
+			duration:     time.Hour,
+			want:         []string{"2026-03-07T00:00:00-03:00", "2026-03-07T01:00:00-03:00"},
+		},
+		{
+			name:         "spring forward day is an hour shorter",
+			timezone:     "America/New_York",
+			availability: weekly("00:00", "05:00", "sunday"),
+			from:         "2026-03-08",
+			to:           "2026-03-09",
+			duration:     time.Hour,
+			want: []string{
+				"2026-03-08T00:00:00-05:00",
+				"2026-03-08T01:00:00-05:00",
+				"2026-03-08T03:00:00-04:00",
+				"2026-03-08T04:00:00-04:00",
+			},
+		},
+		{
+			name:         "fall back day is an hour longer",
+			timezone:     "America/New_York",
+			availability: weekly("00:00", "03:00", "sunday"),
+			from:         "2026-11-01",
+			to:           "2026-11-02",
+			duration:     time.Hour,
+			want: []string{
+				"2026-11-01T00:00:00-04:00",
+				"2026-11-01T01:00:00-04:00",
+				"2026-11-01T01:00:00-05:00",
+				"2026-11-01T02:00:00-05:00",
+			},
+		},
+		{
+			name:         "opening hours stay on the wall clock across DST",
+			timezone:     "America/New_York",
+			availability: weekly("09:00", "10:00", "saturday", "monday"),
+			from:         "2026-03-07",
+			to:           "2026-03-10",
+			duration:     time.Hour,
+			want:         []string{"2026-03-07T09:00:00-05:00", "2026-03-09T09:00:00-04:00"},
+		},
+		{
+			name:         "each resource keeps its own calendar",
+			availability: weekly("09:00", "11:00", "monday"),
+			from:         "2026-03-02",
+			to:           "2026-03-03",
+			duration:     time.Hour,
+			resources:    twoChairs,
+			appointments: []StoreAppointment{
+				{Id: "a1", StoreId: testStore, ResourceId: "chair-1", StartAt: "2026-03-02T09:00:00-03:00", EndAt: "2026-03-02T10:00:00-03:00"},
+			},
+			want: []string{"2026-03-02T09:00:00-03:00 chair-2", "2026-03-02T10:00:00-03:00 chair-1,chair-2"},
+		},
+		{
+			name:         "calendar busy time without a resource blocks every resource",
+			availability: weekly("09:00", "11:00", "monday"),
+			from:         "2026-03-02",
+			to:           "2026-03-03",
+			duration:     time.Hour,
+			resources:    twoChairs,
+			calendarBusy: []StoreAppointment{
+				{StoreId: testStore, StartAt: "2026-03-02T09:00:00-03:00", EndAt: "2026-03-02T10:00:00-03:00"},
+			},
+			want: []string{"2026-03-02T10:00:00-03:00 chair-1,chair-2"},
+		},
+		{
+			name:         "one resource asked for",
+			availability: weekly("09:00", "11:00", "monday"),
+			from:         "2026-03-02",
+			to:           "2026-03-03",
+			duration:     time.Hour,
+			resourceId:   "chair-1",
+			resources:    twoChairs,
+			appointments: []StoreAppointment{
+				{Id: "a1", StoreId: testStore, ResourceId: "chair-1", StartAt: "2026-03-02T09:00:00-03:00", EndAt: "2026-03-02T10:00:00-03:00"},
+			},
+			want: []string{"2026-03-02T10:00:00-03:00 chair-1"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			timezone := tc.timezone
+			if timezone == "" {
+				timezone = "America/Sao_Paulo"
+			}
+			r := newStubRepository(timezone, tc.availability)
+			r.services[haircut.Id] = haircut
+			r.policy = tc.policy
+			r.resources = tc.resources
+			r.appointments = tc.appointments
+			r.calendarBusy = tc.calendarBusy
+			r.exceptions = tc.exceptions
+
+			res, err := newTestService(r).GetStoreSlots(testStore, tc.from, tc.to, tc.duration, tc.serviceId, tc.resourceId)
+			if err != nil {
+				t.Fatalf("GetStoreSlots: %v", err)
+			}
+			got := []string{}
+			for _, slot := range res.Slots {
+				s := slot.StartAt
+				if len(slot.ResourceIds) > 0 {
+					s += " " + strings.Join(slot.ResourceIds, ",")
+				}
+				got = append(got, s)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("slots are\n%v\nwant\n%v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetStoreSlotsPolicyWindow(t *testing.T) {
+	loc := mustLocation(t, "America/Sao_Paulo")
+	tomorrow := time.Now().In(loc).AddDate(0, 0, 1)
+	day := time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 0, 0, 0, 0, loc)
+
+	r := newStubRepository("America/Sao_Paulo", weekly("00:00", "24:00", "sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"))
+	r.policy = StoreBookingPolicy{MinLeadMinutes: 120, MaxHorizonDays: 1}
+	from := day.AddDate(0, 0, -1)
+	to := day.AddDate(0, 0, 2)
+
+	res, err := newTestService(r).GetStoreSlots(testStore, from.Format(time.RFC3339), to.Format(time.RFC3339), time.Hour, "", "")
+	if err != nil {
+		t.Fatalf("GetStoreSlots: %v", err)
+	}
+	now := time.Now()
+	for _, slot := range res.Slots {
+		start, _ := time.Parse(time.RFC3339, slot.StartAt)
+		if start.Before(now.Add(2 * time.Hour)) {
+			t.Errorf("slot %s is within the two hour lead time", slot.StartAt)
+		}
+		if start.After(now.AddDate(0, 0, 1)) {
+			t.Errorf("slot %s is past the one day horizon", slot.StartAt)
+		}
+	}
+	if len(res.Slots) == 0 {
+		t.Error("no slots inside the horizon")
+	}
+}
+
+func TestGetStoreSlotsInvalidRange(t *testing.T) {
+	r := newStubRepository("America/Sao_Paulo", weekly("09:00", "12:00", "monday"))
+	s := newTestService(r)
+	for _, tc := range []struct{ from, to string }{
+		{"2026-03-03", "2026-03-02"},
+		{"2026-03-02", "2026-03-02"},
+		{"2026-03-01", "2026-04-02"},
+		{"yesterday", "2026-03-02"},
+	} {
+		if _, err := s.GetStoreSlots(testStore, tc.from, tc.to, time.Hour, "", ""); err == nil {
+			t.Errorf("from %s to %s: got no error", tc.from, tc.to)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package stores
+
+import (
+	"errors"
+	"fmt"
+)
+
+// appointmentTransitions lists the statuses an appointment may move to from
+// each status. Completed, canceled and no-show are final.
+var appointmentTransitions = map[string][]string{
+	AppointmentStatusPending:   {AppointmentStatusConfirmed, AppointmentStatusCanceled},
+	AppointmentStatusConfirmed: {AppointmentStatusCompleted, AppointmentStatusCanceled, AppointmentStatusNoShow},
+	AppointmentStatusCompleted: {},
+	AppointmentStatusCanceled:  {},
+	AppointmentStatusNoShow:    {},
+}
+
+// ErrAppointmentStatusChanged is returned when the appointment status changed
+// between reading it and applying a transition.
+var ErrAppointmentStatusChanged = errors.New("appointment status was changed by another request, try again")
+
+// ErrAppointmentMoved is returned when rescheduling an appointment that was
+// moved or closed between reading it and applying the change.
+var ErrAppointmentMoved = errors.New("appointment was changed by another request, try again")
+
+// TransitionError is returned when an appointment can't move between two statuses.
+type TransitionError struct {
+	From string
+	To   string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("appointment can't move from %s to %s", e.From, e.To)
+}
+
+func canTransition(from string, to string) bool {
+	for _, status := range appointmentTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
@@ -1,13 +1,84 @@
 package stores
 
+import (
+	"github.com/genda/genda-api/internal/app"
+	"github.com/genda/genda-api/pkg/holidays"
+	"github.com/genda/genda-api/pkg/money"
+)
+
+const (
+	SeriesScopeThis      = "this"
+	SeriesScopeFollowing = "following"
+	SeriesScopeAll       = "all"
+)
+
+// AnyResource asks slot search and booking to use whichever resource is free.
+const AnyResource = "any"
+
+const (
+	ExceptionKindClosed = "closed"
+	ExceptionKindHours  = "hours"
+)
+
+const (
+	AppointmentStatusPending   = "pending"
+	AppointmentStatusConfirmed = "confirmed"
+	AppointmentStatusCompleted = "completed"
+	AppointmentStatusCanceled  = "canceled"
+	AppointmentStatusNoShow    = "no_show"
+)
+
+const (
+	WaitlistStatusWaiting  = "waiting"
+	WaitlistStatusOffered  = "offered"
+	WaitlistStatusBooked   = "booked"
+	WaitlistStatusDeclined = "declined"
+	WaitlistStatusExpired  = "expired"
+	WaitlistStatusCanceled = "canceled"
+)
+
+const (
+	SessionStatusScheduled = "scheduled"
+	SessionStatusCanceled  = "canceled"
+)
+
+const (
+	SessionBookingStatusBooked     = "booked"
+	SessionBookingStatusWaitlisted = "waitlisted"
+	SessionBookingStatusCanceled   = "canceled"
+	SessionBookingStatusAttended   = "attended"
+	SessionBookingStatusNoShow     = "no_show"
+)
+
+const (
+	PenaltyKindCancellation = "cancellation_fee"
+	PenaltyKindNoShow       = "no_show_fee"
+)
+
 type Store struct {
-	Id        string   `json:"id"`
-	Name      string   `json:"name" validate:"required"`
-	OwnerId   string   `json:"owner_id" validate:"required"`
-	Type      string   `json:"type" validate:"required"`
-	Location  Location `json:"location"`
-	CreatedAt string   `json:"created_at"`
-	UpdatedAt string   `json:"updated_at"`
+	Id       string   `json:"id"`
+	Name     string   `json:"name" validate:"required"`
+	OwnerId  string   `json:"owner_id" validate:"required"`
+	Type     string   `json:"type" validate:"required"`
+	Location Location `json:"location"`
+	Timezone string   `json:"timezone" validate:"omitempty,timezone"`
+	// HolidayCalendar closes the store on the national holidays, plus the
+	// ones of HolidayState and HolidayCity when set.
+	HolidayCalendar bool   `json:"holiday_calendar"`
+	HolidayState    string `json:"holiday_state" validate:"omitempty,len=2"`
+	HolidayCity     string `json:"holiday_city" validate:"omitempty,required_with=HolidayState"`
+	CreatedAt       string `json:"created_at"`
+	UpdatedAt       string `json:"updated_at"`
+}
+
+// StoreCalendar is what the booking checks and the calendar feeds need to
+// know about a store's time.
+type StoreCalendar struct {
+	Name            string
+	Timezone        string
+	HolidayCalendar bool
+	HolidayState    string
+	HolidayCity     string
 }
 
 type StoreAvailability struct {
@@ -18,6 +89,23 @@ type StoreAvailability struct {
 	UpdatedAt    string `json:"updated_at"`
 }
 
+// StoreAvailabilityException overrides the weekly availability between two
+// dates, inclusive: the store (or a single resource) is either closed or
+// works the given hours on each of those days.
+type StoreAvailabilityException struct {
+	Id         string `json:"id"`
+	StoreId    string `json:"store_id"`
+	ResourceId string `json:"resource_id"`
+	Kind       string `json:"kind" validate:"required,oneof=closed hours"`
+	StartDate  string `json:"start_date" validate:"required,datetime=2006-01-02"`
+	EndDate    string `json:"end_date" validate:"omitempty,datetime=2006-01-02"`
+	OpenTime   string `json:"open_time" validate:"required_if=Kind hours"`
+	CloseTime  string `json:"close_time" validate:"required_if=Kind hours"`
+	Reason     string `json:"reason"`
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
 type StoreRating struct {
 	Id        string  `json:"id"`
 	StoreId   string  `json:"store_id" validate:"required"`
@@ -28,32 +116,296 @@ type StoreRating struct {
 }
 
 type StorePlan struct {
-	Id        string  `json:"id"`
-	StoreId   string  `json:"store_id" validate:"required"`
-	Name      string  `json:"name" validate:"required"`
-	Price     float32 `json:"price" validate:"required"`
-	Currency  string  `json:"currency" validate:"required"`
-	PlanType  string  `json:"plan_type" validate:"required"`
-	Frequency string  `json:"frequency" validate:"required"`
-	CreatedAt string  `json:"created_at"`
-	UpdatedAt string  `json:"updated_at"`
+	Id        string         `json:"id"`
+	StoreId   string         `json:"store_id" validate:"required"`
+	Name      string         `json:"name" validate:"required"`
+	Price     money.Decimal  `json:"price"`
+	Currency  money.Currency `json:"currency" validate:"required"`
+	PlanType  string         `json:"plan_type" validate:"required"`
+	Frequency string         `json:"frequency" validate:"required"`
+	CreatedAt string         `json:"created_at"`
+	UpdatedAt string         `json:"updated_at"`
 }
 
 type StoreAppointment struct {
-	Id            string  `json:"id"`
-	StoreId       string  `json:"store_id" validate:"required"`
-	UserId        string  `json:"user_id" validate:"required"`
-	StartAt       string  `json:"start_at" validate:"required"`
-	EndAt         string  `json:"end_at" validate:"required"`
-	Status        string  `json:"status" validate:"required"`
-	HoldExpiresAt string  `json:"hold_expires_at"`
-	Price         float32 `json:"price" validate:"required"`
-	Currency      string  `json:"currency" validate:"required"`
-	FeePlatform   float32 `json:"fee_platform" validate:"required"`
-	PaymentId     string  `json:"payment_id"`
-	Notes         string  `json:"notes"`
-	CreatedAt     string  `json:"created_at"`
-	UpdatedAt     string  `json:"updated_at"`
+	Id            string         `json:"id"`
+	StoreId       string         `json:"store_id" validate:"required"`
+	UserId        string         `json:"user_id" validate:"required"`
+	ServiceId     string         `json:"service_id" validate:"required"`
+	ResourceId    string         `json:"resource_id"`
+	StartAt       string         `json:"start_at" validate:"required"`
+	EndAt         string         `json:"end_at"`
+	BufferMinutes int            `json:"buffer_minutes"`
+	Status        string         `json:"status" validate:"required"`
+	HoldExpiresAt string         `json:"hold_expires_at"`
+	Price         money.Decimal  `json:"price"`
+	Currency      money.Currency `json:"currency"`
+	FeePlatform   money.Decimal  `json:"fee_platform"`
+	PenaltyFee    money.Decimal  `json:"penalty_fee"`
+	PaymentId     string         `json:"payment_id"`
+	SeriesId      string         `json:"series_id"`
+	Notes         string         `json:"notes"`
+	CreatedAt     string         `json:"created_at"`
+	UpdatedAt     string         `json:"updated_at"`
+}
+
+// StoreBookingPolicy holds the rules every booking at the store must follow.
+// A zero value turns the rule off.
+type StoreBookingPolicy struct {
+	StoreId              string `json:"store_id"`
+	MinLeadMinutes       int    `json:"min_lead_minutes" validate:"min=0"`
+	MaxHorizonDays       int    `json:"max_horizon_days" validate:"min=0"`
+	BufferMinutes        int    `json:"buffer_minutes" validate:"min=0"`
+	MaxDailyAppointments int    `json:"max_daily_appointments" validate:"min=0"`
+	CreatedAt            string `json:"created_at"`
+	UpdatedAt            string `json:"updated_at"`
+}
+
+// StoreWaitlistEntry is a customer waiting for a time between WindowStart and
+// WindowEnd to free up. An offer is a hold on the freed time, AppointmentId,
+// that lapses at OfferExpiresAt unless the customer accepts it.
+type StoreWaitlistEntry struct {
+	Id             string `json:"id"`
+	StoreId        string `json:"store_id"`
+	UserId         string `json:"user_id" validate:"required"`
+	ServiceId      string `json:"service_id"`
+	WindowStart    string `json:"window_start" validate:"required"`
+	WindowEnd      string `json:"window_end" validate:"required"`
+	Status         string `json:"status"`
+	AppointmentId  string `json:"appointment_id"`
+	OfferExpiresAt string `json:"offer_expires_at"`
+	Notes          string `json:"notes"`
+	CreatedAt      string `json:"created_at"`
+	UpdatedAt      string `json:"updated_at"`
+}
+
+// CancellationWindow charges FeePercent of the price for canceling less than
+// HoursBefore hours before the appointment starts.
+type CancellationWindow struct {
+	HoursBefore int           `json:"hours_before" validate:"min=0"`
+	FeePercent  money.Decimal `json:"fee_percent"`
+}
+
+// StoreCancellationPolicy holds the fees charged for late cancellations and
+// no-shows, as a percentage of the appointment price.
+type StoreCancellationPolicy struct {
+	StoreId          string               `json:"store_id"`
+	Windows          []CancellationWindow `json:"windows" validate:"dive"`
+	NoShowFeePercent money.Decimal        `json:"no_show_fee_percent"`
+	CreatedAt        string               `json:"created_at"`
+	UpdatedAt        string               `json:"updated_at"`
+}
+
+// AppointmentPenalty is the fee charged when an appointment is canceled or
+// marked as a no-show.
+type AppointmentPenalty struct {
+	Kind    string
+	Percent money.Decimal
+	Amount  money.Decimal
+}
+
+type StoreNoShow struct {
+	AppointmentId string         `json:"appointment_id"`
+	ServiceId     string         `json:"service_id"`
+	StartAt       string         `json:"start_at"`
+	Price         money.Decimal  `json:"price"`
+	PenaltyFee    money.Decimal  `json:"penalty_fee"`
+	Currency      money.Currency `json:"currency"`
+	MarkedAt      string         `json:"marked_at"`
+}
+
+type GetStoreCustomerNoShowsResponse struct {
+	StoreId   string        `json:"store_id"`
+	UserId    string        `json:"user_id"`
+	Total     int           `json:"total"`
+	TotalFees money.Decimal `json:"total_fees"`
+	NoShows   []StoreNoShow `json:"no_shows"`
+}
+
+type StoreService struct {
+	Id              string         `json:"id"`
+	StoreId         string         `json:"store_id"`
+	Name            string         `json:"name" validate:"required"`
+	Description     string         `json:"description"`
+	DurationMinutes int            `json:"duration_minutes" validate:"required,min=1"`
+	BufferMinutes   int            `json:"buffer_minutes" validate:"min=0"`
+	Price           money.Decimal  `json:"price"`
+	Currency        money.Currency `json:"currency" validate:"required"`
+	Active          *bool          `json:"active"`
+	CreatedAt       string         `json:"created_at"`
+	UpdatedAt       string         `json:"updated_at"`
+}
+
+type StoreResource struct {
+	Id           string `json:"id"`
+	StoreId      string `json:"store_id"`
+	Name         string `json:"name" validate:"required"`
+	Kind         string `json:"kind" validate:"omitempty,oneof=staff room equipment"`
+	Availability string `json:"availability"`
+	Active       *bool  `json:"active"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+type StoreAppointmentStatusChange struct {
+	Id            string `json:"id"`
+	AppointmentId string `json:"appointment_id"`
+	FromStatus    string `json:"from_status"`
+	ToStatus      string `json:"to_status"`
+	ChangedBy     string `json:"changed_by"`
+	Reason        string `json:"reason"`
+	CreatedAt     string `json:"created_at"`
+}
+
+type AppointmentConflict struct {
+	AppointmentId string `json:"appointment_id"`
+	StartAt       string `json:"start_at"`
+	EndAt         string `json:"end_at"`
+}
+
+type StoreAppointmentSeries struct {
+	Id           string             `json:"id"`
+	StoreId      string             `json:"store_id"`
+	UserId       string             `json:"user_id"`
+	RRule        string             `json:"rrule"`
+	StartAt      string             `json:"start_at"`
+	EndAt        string             `json:"end_at"`
+	Notes        string             `json:"notes"`
+	Appointments []StoreAppointment `json:"appointments"`
+	CreatedAt    string             `json:"created_at"`
+	UpdatedAt    string             `json:"updated_at"`
+}
+
+type CreateStoreAppointmentSeriesRequest struct {
+	UserId     string `json:"user_id" validate:"required"`
+	ServiceId  string `json:"service_id" validate:"required"`
+	ResourceId string `json:"resource_id"`
+	RRule      string `json:"rrule" validate:"required"`
+	StartAt    string `json:"start_at" validate:"required"`
+	Status     string `json:"status" validate:"required,oneof=pending confirmed"`
+	Notes      string `json:"notes"`
+}
+
+type UpdateStoreAppointmentSeriesRequest struct {
+	Scope         string `json:"scope" validate:"required,oneof=this following all"`
+	AppointmentId string `json:"appointment_id" validate:"required_unless=Scope all"`
+	StartAt       string `json:"start_at" validate:"required"`
+	Notes         string `json:"notes"`
+}
+
+type CancelStoreAppointmentSeriesRequest struct {
+	Scope         string `json:"scope" validate:"required,oneof=this following all"`
+	AppointmentId string `json:"appointment_id" validate:"required_unless=Scope all"`
+	Reason        string `json:"reason"`
+}
+
+// SeriesOccurrenceConflict is an occurrence of a series that can't be
+// booked: Conflict is the appointment it overlaps, Error why the store can't
+// take it then and Fields the booking policy rules it breaks.
+type SeriesOccurrenceConflict struct {
+	StartAt  string               `json:"start_at"`
+	EndAt    string               `json:"end_at"`
+	Error    string               `json:"error,omitempty"`
+	Fields   []app.FieldError     `json:"fields,omitempty"`
+	Conflict *AppointmentConflict `json:"conflict,omitempty"`
+}
+
+type AppointmentTransitionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// RescheduleStoreAppointmentRequest moves an appointment to StartAt, keeping
+// its duration. ResourceId switches resource, "any" picks a free one, and
+// leaving it out keeps the current one.
+type RescheduleStoreAppointmentRequest struct {
+	StartAt    string `json:"start_at" validate:"required"`
+	ResourceId string `json:"resource_id"`
+	Reason     string `json:"reason"`
+}
+
+type StoreAppointmentReschedule struct {
+	Id                 string `json:"id"`
+	AppointmentId      string `json:"appointment_id"`
+	PreviousStartAt    string `json:"previous_start_at"`
+	PreviousEndAt      string `json:"previous_end_at"`
+	PreviousResourceId string `json:"previous_resource_id"`
+	StartAt            string `json:"start_at"`
+	EndAt              string `json:"end_at"`
+	ResourceId         string `json:"resource_id"`
+	ChangedBy          string `json:"changed_by"`
+	Reason             string `json:"reason"`
+	CreatedAt          string `json:"created_at"`
+}
+
+// StoreSession is a class up to Capacity customers book together. While it is
+// scheduled it takes its resource, or the store wide calendar when it has
+// none, the same way a one-to-one appointment does. Booked and Waitlisted
+// are counts of the live bookings.
+type StoreSession struct {
+	Id          string         `json:"id"`
+	StoreId     string         `json:"store_id"`
+	ServiceId   string         `json:"service_id"`
+	ResourceId  string         `json:"resource_id"`
+	Title       string         `json:"title" validate:"required"`
+	Description string         `json:"description"`
+	StartAt     string         `json:"start_at" validate:"required"`
+	EndAt       string         `json:"end_at" validate:"required_without=ServiceId"`
+	Capacity    int            `json:"capacity" validate:"required,min=1"`
+	Price       money.Decimal  `json:"price"`
+	Currency    money.Currency `json:"currency"`
+	Status      string         `json:"status"`
+	Booked      int            `json:"booked"`
+	Waitlisted  int            `json:"waitlisted"`
+	CreatedAt   string         `json:"created_at"`
+	UpdatedAt   string         `json:"updated_at"`
+}
+
+// StoreSessionBooking is a customer's spot in a class. Customers who book a
+// full class are waitlisted, WaitlistPosition counting from 1, and take the
+// first spot that frees up.
+type StoreSessionBooking struct {
+	Id                 string `json:"id"`
+	SessionId          string `json:"session_id"`
+	UserId             string `json:"user_id" validate:"required"`
+	Status             string `json:"status"`
+	WaitlistPosition   int    `json:"waitlist_position,omitempty"`
+	AttendanceMarkedAt string `json:"attendance_marked_at"`
+	CreatedAt          string `json:"created_at"`
+	UpdatedAt          string `json:"updated_at"`
+}
+
+type SessionAttendance struct {
+	BookingId string `json:"booking_id" validate:"required"`
+	Status    string `json:"status" validate:"required,oneof=attended no_show"`
+}
+
+type MarkSessionAttendanceRequest struct {
+	Attendance []SessionAttendance `json:"attendance" validate:"required,min=1,dive"`
+}
+
+// CalendarFeed is a read-only iCalendar subscription. The token is only shown
+// when the feed is created, creating another one revokes it.
+type CalendarFeed struct {
+	Token string `json:"token"`
+	Path  string `json:"path"`
+}
+
+// StoreCalendarSource is an iCalendar file the store takes busy time from,
+// fetched from Url by the refresh job or uploaded as Content. With a
+// ResourceId it only blocks that resource's calendar. Blocks counts the busy
+// spans read on the last refresh.
+type StoreCalendarSource struct {
+	Id            string `json:"id"`
+	StoreId       string `json:"store_id"`
+	ResourceId    string `json:"resource_id"`
+	Name          string `json:"name" validate:"required"`
+	Url           string `json:"url" validate:"required_without=Content,excluded_with=Content"`
+	Content       string `json:"content,omitempty"`
+	Blocks        int    `json:"blocks"`
+	LastFetchedAt string `json:"last_fetched_at"`
+	LastError     string `json:"last_error"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
 }
 
 type Subscription struct {
@@ -117,3 +469,24 @@ type GetStoreAppointmentsResponse struct {
 	Page         int                `json:"page"`
 	Appointments []StoreAppointment `json:"appointments"`
 }
+
+type Slot struct {
+	StartAt     string   `json:"start_at"`
+	EndAt       string   `json:"end_at"`
+	ResourceIds []string `json:"resource_ids,omitempty"`
+}
+
+type GetStoreHolidaysResponse struct {
+	StoreId  string             `json:"store_id"`
+	Year     int                `json:"year"`
+	Enabled  bool               `json:"enabled"`
+	Holidays []holidays.Holiday `json:"holidays"`
+}
+
+type GetStoreSlotsResponse struct {
+	StoreId  string `json:"store_id"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Duration int    `json:"duration"`
+	Slots    []Slot `json:"slots"`
+}
@@ -0,0 +1,63 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/genda/genda-api/pkg/notifications"
+)
+
+// HoldSweeper cancels pending appointments whose hold expired, so abandoned
+// checkouts and lapsed waitlist offers stop blocking the store calendar. The
+// time they free is offered to the waitlist.
+type HoldSweeper struct {
+	repository *StoreRepo
+	service    Service
+	interval   time.Duration
+	log        *log.Logger
+}
+
+func NewHoldSweeper(postgresDB *sql.DB, interval time.Duration, log *log.Logger) *HoldSweeper {
+	repository := NewStoreRepository(postgresDB)
+	return &HoldSweeper{
+		repository: repository,
+		service:    newConfiguredService(repository, notifications.NewScheduler(postgresDB)),
+		interval:   interval,
+		log:        log,
+	}
+}
+
+// Run sweeps once per interval until the context is canceled.
+func (s *HoldSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := s.repository.CancelExpiredHolds(time.Now().UTC())
+			if err != nil {
+				s.log.Printf("hold sweeper: %v", err)
+				continue
+			}
+			if len(expired) > 0 {
+				s.log.Printf("hold sweeper: canceled %d expired holds", len(expired))
+			}
+
+			for _, appointment := range expired {
+				entry, err := s.service.OfferFreedSlot(appointment)
+				if err != nil {
+					s.log.Printf("hold sweeper: offering appointment %s time: %v", appointment.Id, err)
+					continue
+				}
+				if entry != nil {
+					s.log.Printf("hold sweeper: offered appointment %s time to waitlist entry %s", appointment.Id, entry.Id)
+				}
+			}
+		}
+	}
+}
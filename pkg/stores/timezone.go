@@ -0,0 +1,64 @@
+package stores
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultTimezone is used for stores created without a timezone.
+const DefaultTimezone = "America/Sao_Paulo"
+
+// loadTimezone resolves an IANA timezone name, an empty name is the default.
+func loadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		name = DefaultTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", name)
+	}
+	return loc, nil
+}
+
+// localTime renders a stored instant as RFC 3339 in the given timezone.
+// Values that don't parse are returned unchanged.
+func localTime(value string, loc *time.Location) string {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil || loc == nil {
+		return value
+	}
+	return t.In(loc).Format(time.RFC3339)
+}
+
+// localizeAppointment renders the appointment instants in the store timezone.
+func localizeAppointment(a *StoreAppointment, timezone string) {
+	loc, err := loadTimezone(timezone)
+	if err != nil {
+		return
+	}
+	a.StartAt = localTime(a.StartAt, loc)
+	a.EndAt = localTime(a.EndAt, loc)
+	if a.HoldExpiresAt != "" {
+		a.HoldExpiresAt = localTime(a.HoldExpiresAt, loc)
+	}
+}
+
+// wallClock reads the local date and clock of t as if it were UTC, so two
+// wall clocks can be subtracted without daylight saving getting in the way.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// fromWallClock is the instant in loc whose wall clock is w. Wall clocks
+// skipped by a daylight saving change land after the gap, so 02:30 on a day
+// that jumps from 02:00 to 03:00 is 03:30.
+func fromWallClock(w time.Time, loc *time.Location) time.Time {
+	t := time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), w.Nanosecond(), loc)
+	return t.Add(w.Sub(wallClock(t)))
+}
+
+// addWallClock moves t by a wall clock amount in its own location, so 09:00
+// moved by an hour is 10:00 on either side of a daylight saving change.
+func addWallClock(t time.Time, delta time.Duration) time.Time {
+	return fromWallClock(wallClock(t).Add(delta), t.Location())
+}
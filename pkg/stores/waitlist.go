@@ -0,0 +1,14 @@
+package stores
+
+import "errors"
+
+// ErrWaitlistEntryClosed is returned when acting on a waitlist entry that is
+// already booked, declined, expired or canceled.
+var ErrWaitlistEntryClosed = errors.New("waitlist entry is no longer waiting or offered")
+
+// offerOutcomes maps the status an offered hold moves to onto the status its
+// waitlist entry ends in.
+var offerOutcomes = map[string]string{
+	AppointmentStatusConfirmed: WaitlistStatusBooked,
+	AppointmentStatusCanceled:  WaitlistStatusDeclined,
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -13,6 +14,7 @@ import (
 	"strings"
 
 	"github.com/genda/genda-api/internal/app"
+	"github.com/genda/genda-api/internal/storage/postgres"
 	"github.com/golang-jwt/jwt/v4"
 
 	"github.com/fesa/genda-api/pkg/config"
@@ -54,7 +56,7 @@ func (h *handler) CreateUser(ctx context.Context, w http.ResponseWriter, r *http
 
 	res, err := h.service.CreateUser(user)
 	if err != nil {
-		transformError(w, "Failed to create user", err.Error())
+		respondError(w, "Failed to create user", err)
 		return nil
 	}
 
@@ -122,7 +124,7 @@ func (h *handler) UpdateUser(ctx context.Context, w http.ResponseWriter, r *http
 
 	res, err := h.service.UpdateUser(id, user)
 	if err != nil {
-		transformError(w, "Failed to update user", err.Error())
+		respondError(w, "Failed to update user", err)
 		return nil
 	}
 
@@ -323,6 +325,25 @@ func (i *handler) decodeJwt(tokenString string) (*jwt.Token, error) {
 	return token, nil
 }
 
+// respond error for response api, constraint conflicts are answered with 409
+func respondError(w http.ResponseWriter, m string, err error) {
+	var conflict *postgres.ConflictError
+	if !errors.As(err, &conflict) {
+		transformError(w, m, err.Error())
+		return
+	}
+
+	var data = app.ConflictResponse{
+		Message:  m,
+		Error:    conflict.Message,
+		Conflict: conflict.Conflict,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(data)
+}
+
 // transform error for response api
 func transformError(w http.ResponseWriter, m string, e string) {
 	var data = app.ValidateError{
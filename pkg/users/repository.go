@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/genda/genda-api/internal/storage/postgres"
 	"github.com/google/uuid"
 )
 
@@ -45,6 +46,9 @@ func (i *UserRepo) CreateUser(user User) (*User, error) {
 	)
 	if err != nil {
 		log.Println("An error occurred while creating user", err)
+		if conflict := userConflict(err); conflict != nil {
+			return nil, conflict
+		}
 		return nil, err
 	}
 	return &user, nil
@@ -148,6 +152,9 @@ func (i *UserRepo) UpdateUser(id string, user User) (*User, error) {
 	)
 	if err != nil {
 		log.Println("An error occurred while updating user", err)
+		if conflict := userConflict(err); conflict != nil {
+			return nil, conflict
+		}
 		return nil, err
 	}
 	return &user, nil
@@ -162,6 +169,24 @@ func (i *UserRepo) DeleteUser(id string) error {
 	return nil
 }
 
+// userConflict turns constraint violations on users into a
+// *postgres.ConflictError, it returns nil for any other error.
+func userConflict(err error) error {
+	constraint, ok := postgres.ViolatedConstraint(err)
+	if !ok {
+		return nil
+	}
+
+	if constraint == "users_email_key" {
+		return &postgres.ConflictError{
+			Constraint: constraint,
+			Message:    "the email is already in use",
+		}
+	}
+
+	return &postgres.ConflictError{Constraint: constraint, Message: err.Error()}
+}
+
 func (i *UserRepo) formatUser(row *sql.Rows) (*User, error) {
 	u := User{}
 	if err := row.Scan(